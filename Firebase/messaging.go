@@ -1,22 +1,26 @@
 package wfb
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
 
 	"firebase.google.com/go/messaging"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/wasabee-project/Wasabee-Server/config"
 	"github.com/wasabee-project/Wasabee-Server/log"
 	wm "github.com/wasabee-project/Wasabee-Server/messaging"
 	"github.com/wasabee-project/Wasabee-Server/model"
+	"github.com/wasabee-project/Wasabee-Server/tracing"
 )
 
 // AgentLocation alerts all appropriate teams about an agent's moving
 // Do not send to topic since this hits the fanout-quota quickly
 // We do the fanout manually, sending directly to tokens has a much higher quota
-func AgentLocation(gid model.GoogleID) {
+func AgentLocation(ctx context.Context, gid model.GoogleID) {
 	if !config.IsFirebaseRunning() {
 		return
 	}
@@ -25,7 +29,7 @@ func AgentLocation(gid model.GoogleID) {
 		return
 	}
 
-	tokens, err := gid.FirebaseLocationTokens()
+	tokens, err := gid.FirebaseLocationTokens(ctx)
 	if err != nil {
 		log.Infow("firebase token load", "gid", gid, "err", err)
 		return
@@ -74,20 +78,23 @@ func AgentLocation(gid model.GoogleID) {
 		return
 	}
 
+	_, span := tracing.Span(ctx, "firebase.sendall", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attribute.Int("firebase.messages", len(toSend))))
 	br, err := msg.SendAll(fbctx, toSend)
+	tracing.End(span, err)
 	if err != nil {
 		log.Error(err)
+		fbSent.WithLabelValues("error").Add(float64(len(toSend)))
 		return
 	}
-	processBatchResponse(br, brTokens) // do the work on an async go routine?
+	processBatchResponse(ctx, br, brTokens) // do the work on an async go routine?
 }
 
 // AssignLink lets an agent know they have a new assignment on a given operation
-func AssignLink(gid model.GoogleID, linkID model.TaskID, opID model.OperationID, updateID string) error {
+func AssignLink(ctx context.Context, gid model.GoogleID, linkID model.TaskID, opID model.OperationID, updateID string) error {
 	if !config.IsFirebaseRunning() {
 		return nil
 	}
-	tokens, err := gid.GetFirebaseTokens()
+	tokens, err := gid.GetFirebaseTokens(ctx)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -102,16 +109,16 @@ func AssignLink(gid model.GoogleID, linkID model.TaskID, opID model.OperationID,
 		"cmd":      "Link Assignment Change",
 		"updateID": updateID,
 	}
-	genericMulticast(data, tokens)
+	genericMulticast(ctx, data, tokens)
 	return nil
 }
 
 // AssignMarker lets an gent know they have a new assignment on a given operation
-func AssignMarker(gid model.GoogleID, markerID model.TaskID, opID model.OperationID, updateID string) error {
+func AssignMarker(ctx context.Context, gid model.GoogleID, markerID model.TaskID, opID model.OperationID, updateID string) error {
 	if !config.IsFirebaseRunning() {
 		return nil
 	}
-	tokens, err := gid.GetFirebaseTokens()
+	tokens, err := gid.GetFirebaseTokens(ctx)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -126,16 +133,16 @@ func AssignMarker(gid model.GoogleID, markerID model.TaskID, opID model.Operatio
 		"cmd":      "Marker Assignment Change",
 		"updateID": updateID,
 	}
-	genericMulticast(data, tokens)
+	genericMulticast(ctx, data, tokens)
 	return nil
 }
 
 // AssignTask lets an gent know they have a new assignment on a given operation
-func AssignTask(gid model.GoogleID, taskID model.TaskID, opID model.OperationID, updateID string) error {
+func AssignTask(ctx context.Context, gid model.GoogleID, taskID model.TaskID, opID model.OperationID, updateID string) error {
 	if !config.IsFirebaseRunning() {
 		return nil
 	}
-	tokens, err := gid.GetFirebaseTokens()
+	tokens, err := gid.GetFirebaseTokens(ctx)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -150,12 +157,12 @@ func AssignTask(gid model.GoogleID, taskID model.TaskID, opID model.OperationID,
 		"cmd":      "Task Assignment Change",
 		"updateID": updateID,
 	}
-	genericMulticast(data, tokens)
+	genericMulticast(ctx, data, tokens)
 	return nil
 }
 
 // MarkerStatus reports a marker update to a team/topic
-func MarkerStatus(markerID model.TaskID, opID model.OperationID, teams []model.TeamID, status string, updateID string) error {
+func MarkerStatus(ctx context.Context, markerID model.TaskID, opID model.OperationID, teams []model.TeamID, status string, updateID string) error {
 	if !config.IsFirebaseRunning() {
 		return nil
 	}
@@ -172,7 +179,7 @@ func MarkerStatus(markerID model.TaskID, opID model.OperationID, teams []model.T
 		"updateID": updateID,
 	}
 
-	conditions := teamsToCondition(teams)
+	conditions := teamsToCondition(ctx, teams)
 	multicastFantoutMutex.Lock()
 	defer multicastFantoutMutex.Unlock()
 	for _, condition := range conditions {
@@ -180,7 +187,7 @@ func MarkerStatus(markerID model.TaskID, opID model.OperationID, teams []model.T
 			Condition: condition,
 			Data:      data,
 		}
-		if _, err := msg.Send(fbctx, &m); err != nil {
+		if err := send(ctx, &m); err != nil {
 			log.Error(err)
 			if messaging.IsTooManyTopics(err) || messaging.IsMessageRateExceeded(err) {
 				slowdown()
@@ -192,7 +199,7 @@ func MarkerStatus(markerID model.TaskID, opID model.OperationID, teams []model.T
 }
 
 // LinkStatus reports a link update to a team/topic
-func LinkStatus(linkID model.TaskID, opID model.OperationID, teams []model.TeamID, status string, updateID string) error {
+func LinkStatus(ctx context.Context, linkID model.TaskID, opID model.OperationID, teams []model.TeamID, status string, updateID string) error {
 	if !config.IsFirebaseRunning() {
 		return nil
 	}
@@ -209,7 +216,7 @@ func LinkStatus(linkID model.TaskID, opID model.OperationID, teams []model.TeamI
 		"updateID": updateID,
 	}
 
-	conditions := teamsToCondition(teams)
+	conditions := teamsToCondition(ctx, teams)
 	multicastFantoutMutex.Lock()
 	defer multicastFantoutMutex.Unlock()
 	for _, condition := range conditions {
@@ -218,7 +225,7 @@ func LinkStatus(linkID model.TaskID, opID model.OperationID, teams []model.TeamI
 			Data:      data,
 		}
 
-		if _, err := msg.Send(fbctx, &m); err != nil {
+		if err := send(ctx, &m); err != nil {
 			log.Error(err)
 			if messaging.IsTooManyTopics(err) || messaging.IsMessageRateExceeded(err) {
 				slowdown()
@@ -230,7 +237,7 @@ func LinkStatus(linkID model.TaskID, opID model.OperationID, teams []model.TeamI
 }
 
 // TaskStatus reports a task update to a team/topic
-func TaskStatus(taskID model.TaskID, opID model.OperationID, teams []model.TeamID, status string, updateID string) error {
+func TaskStatus(ctx context.Context, taskID model.TaskID, opID model.OperationID, teams []model.TeamID, status string, updateID string) error {
 	if !config.IsFirebaseRunning() {
 		return nil
 	}
@@ -247,7 +254,7 @@ func TaskStatus(taskID model.TaskID, opID model.OperationID, teams []model.TeamI
 		"updateID": updateID,
 	}
 
-	conditions := teamsToCondition(teams)
+	conditions := teamsToCondition(ctx, teams)
 	multicastFantoutMutex.Lock()
 	defer multicastFantoutMutex.Unlock()
 	for _, condition := range conditions {
@@ -256,7 +263,7 @@ func TaskStatus(taskID model.TaskID, opID model.OperationID, teams []model.TeamI
 			Data:      data,
 		}
 
-		if _, err := msg.Send(fbctx, &m); err != nil {
+		if err := send(ctx, &m); err != nil {
 			log.Error(err)
 			if messaging.IsTooManyTopics(err) || messaging.IsMessageRateExceeded(err) {
 				slowdown()
@@ -268,13 +275,13 @@ func TaskStatus(taskID model.TaskID, opID model.OperationID, teams []model.TeamI
 }
 
 // addToRemote subscribes all tokens for a given agent to a team/topic
-func addToRemote(g wm.GoogleID, teamID wm.TeamID) error {
+func addToRemote(ctx context.Context, g wm.GoogleID, teamID wm.TeamID) error {
 	if !config.IsFirebaseRunning() {
 		return nil
 	}
 
 	gid := model.GoogleID(g)
-	tokens, err := gid.GetFirebaseTokens()
+	tokens, err := gid.GetFirebaseTokens(ctx)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -290,20 +297,20 @@ func addToRemote(g wm.GoogleID, teamID wm.TeamID) error {
 	}
 	if tmr != nil && tmr.FailureCount > 0 {
 		for _, f := range tmr.Errors {
-			_ = model.RemoveFirebaseToken(tokens[f.Index])
+			_ = model.RemoveFirebaseToken(ctx, tokens[f.Index])
 		}
 	}
 	return nil
 }
 
 // removeFromRemote removes an agent's subscriptions to a given topic/team
-func removeFromRemote(g wm.GoogleID, teamID wm.TeamID) error {
+func removeFromRemote(ctx context.Context, g wm.GoogleID, teamID wm.TeamID) error {
 	if !config.IsFirebaseRunning() {
 		return nil
 	}
 
 	gid := model.GoogleID(g)
-	tokens, err := gid.GetFirebaseTokens()
+	tokens, err := gid.GetFirebaseTokens(ctx)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -319,20 +326,20 @@ func removeFromRemote(g wm.GoogleID, teamID wm.TeamID) error {
 	}
 	if tmr != nil && tmr.FailureCount > 0 {
 		for _, f := range tmr.Errors {
-			_ = model.RemoveFirebaseToken(tokens[f.Index])
+			_ = model.RemoveFirebaseToken(ctx, tokens[f.Index])
 		}
 	}
 	return nil
 }
 
 // sendMessage is registered with Wasabee for sending messages
-func sendMessage(g wm.GoogleID, message string) (bool, error) {
+func sendMessage(ctx context.Context, g wm.GoogleID, message string) (bool, error) {
 	if !config.IsFirebaseRunning() {
 		return false, nil
 	}
 
 	gid := model.GoogleID(g)
-	tokens, err := gid.GetFirebaseTokens()
+	tokens, err := gid.GetFirebaseTokens(ctx)
 	if err != nil {
 		log.Error(err)
 		return false, err
@@ -345,18 +352,18 @@ func sendMessage(g wm.GoogleID, message string) (bool, error) {
 		"msg": message,
 		"cmd": "Generic Message",
 	}
-	genericMulticast(data, tokens)
+	genericMulticast(ctx, data, tokens)
 	return true, nil
 }
 
 // sendTarget sends a portal name/guid to an agent
-func sendTarget(g wm.GoogleID, t wm.Target) error {
+func sendTarget(ctx context.Context, g wm.GoogleID, t wm.Target) error {
 	if !config.IsFirebaseRunning() {
 		return nil
 	}
 
 	gid := model.GoogleID(g)
-	tokens, err := gid.GetFirebaseTokens()
+	tokens, err := gid.GetFirebaseTokens(ctx)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -376,12 +383,12 @@ func sendTarget(g wm.GoogleID, t wm.Target) error {
 		"cmd": "Target",
 	}
 
-	genericMulticast(data, tokens)
+	genericMulticast(ctx, data, tokens)
 	return nil
 }
 
 // MapChange alerts teams of the need to need to refresh map data
-func MapChange(teams []model.TeamID, opID model.OperationID, updateID string) error {
+func MapChange(ctx context.Context, teams []model.TeamID, opID model.OperationID, updateID string) error {
 	if !config.IsFirebaseRunning() {
 		return nil
 	}
@@ -396,7 +403,7 @@ func MapChange(teams []model.TeamID, opID model.OperationID, updateID string) er
 		"srv":      config.Get().HTTP.Webroot,
 	}
 
-	conditions := teamsToCondition(teams)
+	conditions := teamsToCondition(ctx, teams)
 	multicastFantoutMutex.Lock()
 	defer multicastFantoutMutex.Unlock()
 	for _, condition := range conditions {
@@ -405,7 +412,7 @@ func MapChange(teams []model.TeamID, opID model.OperationID, updateID string) er
 			Data:      data,
 		}
 
-		if _, err := msg.Send(fbctx, &m); err != nil {
+		if err := send(ctx, &m); err != nil {
 			log.Error(err)
 			if messaging.IsTooManyTopics(err) || messaging.IsMessageRateExceeded(err) {
 				slowdown()
@@ -417,7 +424,7 @@ func MapChange(teams []model.TeamID, opID model.OperationID, updateID string) er
 }
 
 // AgentLogin alerts a team of an agent on that team logging in
-func AgentLogin(teams []model.TeamID, gid model.GoogleID) error {
+func AgentLogin(ctx context.Context, teams []model.TeamID, gid model.GoogleID) error {
 	if !config.IsFirebaseRunning() {
 		return nil
 	}
@@ -428,7 +435,7 @@ func AgentLogin(teams []model.TeamID, gid model.GoogleID) error {
 		"srv": config.Get().HTTP.Webroot,
 	}
 
-	conditions := teamsToCondition(teams)
+	conditions := teamsToCondition(ctx, teams)
 	multicastFantoutMutex.Lock()
 	defer multicastFantoutMutex.Unlock()
 	for _, condition := range conditions {
@@ -437,7 +444,7 @@ func AgentLogin(teams []model.TeamID, gid model.GoogleID) error {
 			Data:      data,
 		}
 
-		if _, err := msg.Send(fbctx, &m); err != nil {
+		if err := send(ctx, &m); err != nil {
 			log.Error(err)
 			if messaging.IsTooManyTopics(err) || messaging.IsMessageRateExceeded(err) {
 				slowdown()
@@ -449,7 +456,7 @@ func AgentLogin(teams []model.TeamID, gid model.GoogleID) error {
 }
 
 // sendAnnounce sends a generic message to a team
-func sendAnnounce(teamID wm.TeamID, a wm.Announce) error {
+func sendAnnounce(ctx context.Context, teamID wm.TeamID, a wm.Announce) error {
 	if !config.IsFirebaseRunning() {
 		return nil
 	}
@@ -465,7 +472,7 @@ func sendAnnounce(teamID wm.TeamID, a wm.Announce) error {
 		Data:  data,
 	}
 
-	if _, err := msg.Send(fbctx, &m); err != nil {
+	if err := send(ctx, &m); err != nil {
 		log.Error(err)
 		if messaging.IsTooManyTopics(err) || messaging.IsMessageRateExceeded(err) {
 			slowdown()
@@ -476,11 +483,11 @@ func sendAnnounce(teamID wm.TeamID, a wm.Announce) error {
 }
 
 // deleteOperation tells everyone (on this server) to remove a specific op
-func deleteOperation(opID wm.OperationID) error {
+func deleteOperation(ctx context.Context, opID wm.OperationID) error {
 	if !config.IsFirebaseRunning() {
 		return nil
 	}
-	tokens, err := model.FirebaseBroadcastList()
+	tokens, err := model.FirebaseBroadcastList(ctx)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -495,18 +502,18 @@ func deleteOperation(opID wm.OperationID) error {
 	}
 
 	// do this in its own worker since it might take a while
-	go genericMulticast(data, tokens)
+	go genericMulticast(ctx, data, tokens)
 	return nil
 }
 
 // agentDeleteOperation notifies a single agent of the need to delete an operation (e.g. when removed from a team)
-func agentDeleteOperation(g wm.GoogleID, opID wm.OperationID) error {
+func agentDeleteOperation(ctx context.Context, g wm.GoogleID, opID wm.OperationID) error {
 	if !config.IsFirebaseRunning() {
 		return nil
 	}
 
 	gid := model.GoogleID(g)
-	tokens, err := gid.GetFirebaseTokens()
+	tokens, err := gid.GetFirebaseTokens(ctx)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -520,12 +527,12 @@ func agentDeleteOperation(g wm.GoogleID, opID wm.OperationID) error {
 		"opID": string(opID),
 	}
 
-	genericMulticast(data, tokens)
+	genericMulticast(ctx, data, tokens)
 	return nil
 }
 
 // genericMulticast sends multicast messages directly to agents, taking care of breaking into proper segments and cleaning up invalid tokens
-func genericMulticast(data map[string]string, tokens []string) {
+func genericMulticast(ctx context.Context, data map[string]string, tokens []string) {
 	if len(tokens) == 0 {
 		return
 	}
@@ -544,18 +551,43 @@ func genericMulticast(data map[string]string, tokens []string) {
 			Data:   data,
 			Tokens: subset,
 		}
+		_, span := tracing.Span(ctx, "firebase.multicast", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attribute.Int("firebase.tokens", len(subset)), attribute.String("firebase.cmd", data["cmd"])))
 		br, err := msg.SendMulticast(fbctx, &m)
+		tracing.End(span, err)
 		if err != nil {
 			log.Error(err)
+			fbSent.WithLabelValues("error").Add(float64(len(subset)))
 			return // carry on ?
 		}
 		log.Debugw("multicast block", "success", br.SuccessCount, "failure", br.FailureCount)
-		processBatchResponse(br, subset) // spawn a go routine? would async help here?
+		processBatchResponse(ctx, br, subset) // spawn a go routine? would async help here?
 	}
 }
 
+// send sends a single message, counting the result
+func send(ctx context.Context, m *messaging.Message) error {
+	target := m.Topic
+	if target == "" {
+		target = m.Condition
+	}
+	_, span := tracing.Span(ctx, "firebase.send", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attribute.String("firebase.target", target), attribute.String("firebase.cmd", m.Data["cmd"])))
+
+	// the request may be gone by now, send on firebase's own context
+	_, err := msg.Send(fbctx, m)
+	tracing.End(span, err)
+	if err != nil {
+		fbSent.WithLabelValues("error").Inc()
+		return err
+	}
+	fbSent.WithLabelValues("ok").Inc()
+	return nil
+}
+
 // processBatchResponse looks for invalid tokens responses and removes the offending tokens
-func processBatchResponse(br *messaging.BatchResponse, tokens []string) {
+func processBatchResponse(ctx context.Context, br *messaging.BatchResponse, tokens []string) {
+	fbSent.WithLabelValues("ok").Add(float64(br.SuccessCount))
+	fbSent.WithLabelValues("error").Add(float64(br.FailureCount))
+
 	var slowed bool
 	for pos, resp := range br.Responses {
 		if !resp.Success {
@@ -563,7 +595,7 @@ func processBatchResponse(br *messaging.BatchResponse, tokens []string) {
 				continue
 			}
 			if messaging.IsRegistrationTokenNotRegistered(resp.Error) {
-				_ = model.RemoveFirebaseToken(tokens[pos])
+				_ = model.RemoveFirebaseToken(ctx, tokens[pos])
 				continue
 			}
 			if messaging.IsMessageRateExceeded(resp.Error) && !slowed {
@@ -578,14 +610,14 @@ func processBatchResponse(br *messaging.BatchResponse, tokens []string) {
 
 // Resubscribe refreshes all the topic subscriptions for every team
 func Resubscribe() {
-	teams, err := model.GetAllTeams()
+	teams, err := model.GetAllTeams(context.Background())
 	if err != nil {
 		log.Error(err)
 		return
 	}
 
 	for _, teamID := range teams {
-		tokens, err := teamID.FetchFBTokens()
+		tokens, err := teamID.FetchFBTokens(context.Background())
 		if err != nil || len(tokens) == 0 {
 			continue
 		}
@@ -607,7 +639,7 @@ func Resubscribe() {
 			for _, f := range tmr.Errors {
 				if !strings.Contains(f.Reason, "code: internal-error") {
 					log.Debugw("removing dead firebase token", "token", tokens[f.Index][:24], "reason", f.Reason)
-					_ = model.RemoveFirebaseToken(tokens[f.Index])
+					_ = model.RemoveFirebaseToken(context.Background(), tokens[f.Index])
 				} else {
 					log.Debugw("not removing firebase token", "reason", f.Reason)
 				}
@@ -616,12 +648,14 @@ func Resubscribe() {
 	}
 }
 
-func teamsToCondition(teams []model.TeamID) []string {
+// teamsToCondition builds the topic conditions for the teams, including any teams nested under them
+func teamsToCondition(ctx context.Context, teams []model.TeamID) []string {
 	var conditionSet []string
 
 	if len(teams) == 0 {
 		return conditionSet
 	}
+	teams = model.ExpandTeamGroups(ctx, teams)
 
 	for len(teams) > 0 {
 		r := len(teams)
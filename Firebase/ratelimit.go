@@ -3,6 +3,9 @@ package wfb
 import (
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
 	"github.com/wasabee-project/Wasabee-Server/log"
 	"github.com/wasabee-project/Wasabee-Server/model"
 	"github.com/wasabee-project/Wasabee-Server/util"
@@ -14,6 +17,12 @@ var rlAgent *util.Safemap
 var rlOp *util.Safemap
 var rlTeam *util.Safemap
 
+var (
+	fbSent      = promauto.NewCounterVec(prometheus.CounterOpts{Name: "wasabee_firebase_messages_total", Help: "Firebase messages sent, by result."}, []string{"result"})
+	fbSlowdowns = promauto.NewCounter(prometheus.CounterOpts{Name: "wasabee_firebase_slowdowns_total", Help: "Times Firebase quotas forced the send rate down."})
+	fbRate      = promauto.NewGauge(prometheus.GaugeOpts{Name: "wasabee_firebase_change_rate_seconds", Help: "Minimum seconds between map change messages for an operation."})
+)
+
 // standard messaging rates apply
 const baseChangeRate = time.Second * 10
 
@@ -26,6 +35,7 @@ func ratelimitinit() {
 	rlAgent = util.NewSafemap()
 	rlOp = util.NewSafemap()
 	rlTeam = util.NewSafemap()
+	fbRate.Set(mapChangeRate.Seconds())
 }
 
 func ratelimitTeam(teamID model.TeamID) bool {
@@ -92,9 +102,17 @@ func slowdown() {
 	agentLocationChangeRate = agentLocationChangeRate + agentLocationChangeRate
 	mapChangeRate = mapChangeRate + mapChangeRate
 	teamRate = teamRate + teamRate
+	fbSlowdowns.Inc()
+	fbRate.Set(mapChangeRate.Seconds())
 	log.Infow("firebase rate limit slowing down", "mapChangeRate", mapChangeRate)
 }
 
+// Slowed reports if quota errors have slowed the send rate, and to how many seconds between map changes
+func Slowed() (bool, time.Duration) {
+	return mapChangeRate != baseChangeRate, mapChangeRate
+}
+
+// ResetDefaultRateLimits returns the send rate to the default, run hourly
 func ResetDefaultRateLimits() {
 	if mapChangeRate == baseChangeRate {
 		return
@@ -104,4 +122,5 @@ func ResetDefaultRateLimits() {
 	agentLocationChangeRate = baseChangeRate
 	mapChangeRate = baseChangeRate
 	teamRate = baseChangeRate
+	fbRate.Set(mapChangeRate.Seconds())
 }
@@ -94,34 +94,34 @@ func Start(ctx context.Context) {
 		switch e.Type {
 		case "https://schemas.openid.net/secevent/risc/event-type/account-disabled":
 			log.Errorw("locking account", "subsystem", "RISC", "GID", gid, "subject", e.Subject, "issuer", e.Issuer, "reason", e.Reason)
-			_ = gid.Lock(e.Reason)
-			_ = gid.RemoveAllFirebaseTokens()
+			_ = gid.Lock(ctx, e.Reason)
+			_ = gid.RemoveAllFirebaseTokens(ctx)
 			auth.Logout(gid, e.Reason)
 		case "https://schemas.openid.net/secevent/risc/event-type/account-enabled":
 			log.Infow("unlocking account", "subsystem", "RISC", "GID", gid, "subject", e.Subject, "issuer", e.Issuer, "reason", e.Reason)
-			_ = gid.Unlock(e.Reason)
+			_ = gid.Unlock(ctx, e.Reason)
 		case "https://schemas.openid.net/secevent/risc/event-type/account-purged":
 			log.Errorw("deleting account", "subsystem", "RISC", "GID", gid, "subject", e.Subject, "issuer", e.Issuer, "reason", e.Reason)
 			auth.Logout(gid, e.Reason)
-			_ = gid.Delete()
+			_ = gid.Delete(ctx, "", model.AuditSourceRISC)
 		case "https://schemas.openid.net/secevent/risc/event-type/account-credential-change-required":
 			log.Debugw("credential change", "subsystem", "RISC", "GID", gid, "issuer", e.Issuer, "subject", e.Subject, "reason", e.Reason)
-			_ = gid.RemoveAllFirebaseTokens()
+			_ = gid.RemoveAllFirebaseTokens(ctx)
 			auth.Logout(gid, e.Reason)
 		case "https://schemas.openid.net/secevent/risc/event-type/sessions-revoked":
 			log.Debugw("sessions revoked", "subsystem", "RISC", "GID", gid, "issuer", e.Issuer, "subject", e.Subject, "reason", e.Reason)
-			_ = gid.RemoveAllFirebaseTokens()
+			_ = gid.RemoveAllFirebaseTokens(ctx)
 			auth.Logout(gid, e.Reason)
 		case "https://schemas.openid.net/secevent/risc/event-type/tokens-revoked":
 			log.Debugw("tokens revoked", "subsystem", "RISC", "GID", gid, "issuer", e.Issuer, "subject", e.Subject, "reason", e.Reason)
-			_ = gid.RemoveAllFirebaseTokens()
+			_ = gid.RemoveAllFirebaseTokens(ctx)
 			auth.Logout(gid, e.Reason)
 		case "https://schemas.openid.net/secevent/risc/event-type/verification":
 			// log.Debugw("verify", "subsystem", "RISC", "GID", gid,  "issuer", e.Issuer, "subject", e.Subject, "reason", e.Reason)
 			// no need to do anything
 		case "https://accounts.google.com/risc/event/sessions-revoked":
 			log.Debugw("google sessions revoked", "subsystem", "RISC", "GID", gid, "issuer", e.Issuer, "subject", e.Subject, "reason", e.Reason)
-			_ = gid.RemoveAllFirebaseTokens()
+			_ = gid.RemoveAllFirebaseTokens(ctx)
 			auth.Logout(gid, e.Reason)
 		default:
 			log.Warnw("unknown event", "subsystem", "RISC", "type", e.Type, "reason", e.Reason)
@@ -129,6 +129,11 @@ func Start(ctx context.Context) {
 	}
 }
 
+// Running reports if the webhook is registered with Google
+func Running() bool {
+	return running
+}
+
 // This is called from the webhook
 func validateToken(rawjwt []byte) error {
 	// log.Debugw("RISC token", "raw", rawjwt)
@@ -1,6 +1,7 @@
 package wtg
 
 import (
+	"context"
 	"github.com/go-telegram-bot-api/telegram-bot-api/v5"
 
 	"github.com/wasabee-project/Wasabee-Server/log"
@@ -9,9 +10,9 @@ import (
 	"github.com/wasabee-project/Wasabee-Server/templates"
 )
 
-func sendAnnounce(t messaging.TeamID, a messaging.Announce) error {
+func sendAnnounce(ctx context.Context, t messaging.TeamID, a messaging.Announce) error {
 	teamID := model.TeamID(t)
-	tgchat, err := teamID.TelegramChat()
+	tgchat, err := teamID.TelegramChat(ctx)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -34,6 +35,6 @@ func sendAnnounce(t messaging.TeamID, a messaging.Announce) error {
 	msg := tgbotapi.NewMessage(tgchat, text)
 	msg.ParseMode = "HTML"
 
-	sendQueue <- msg
+	enqueue(ctx, msg)
 	return nil
 }
@@ -3,6 +3,7 @@ package wtg
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/go-telegram-bot-api/telegram-bot-api/v5"
 
@@ -21,6 +22,9 @@ var hook string
 
 var bot *tgbotapi.BotAPI
 
+// how long the database work for one update may take
+const updateTimeout = 30 * time.Second
+
 // Start is called from main() to start the bot.
 func Start(ctx context.Context) {
 	c := config.Get().Telegram
@@ -89,9 +93,11 @@ func Start(ctx context.Context) {
 			return
 		case update := <-upChan:
 			// log.Debugw("running update", "update", update)
-			if err := runUpdate(update); err != nil {
+			uctx, cancel := context.WithTimeout(ctx, updateTimeout)
+			if err := runUpdate(uctx, update); err != nil {
 				log.Error(err)
 			}
+			cancel()
 			if (i % 100) == 0 { // every 100 requests, change the endpoint
 				i = 1
 				hook = util.GenerateName()
@@ -115,10 +121,10 @@ func shutdown() {
 	close(sendQueue)
 }
 
-func runUpdate(update tgbotapi.Update) error {
+func runUpdate(ctx context.Context, update tgbotapi.Update) error {
 	if update.CallbackQuery != nil {
 		log.Debugw("callback", "subsystem", "Telegram", "data", update)
-		msg, err := callback(&update)
+		msg, err := callback(ctx, &update)
 		if err != nil {
 			log.Error(err)
 			return err
@@ -133,18 +139,18 @@ func runUpdate(update tgbotapi.Update) error {
 
 	if update.Message != nil {
 		if update.Message.Chat.Type == "private" {
-			if err := processDirectMessage(&update); err != nil {
+			if err := processDirectMessage(ctx, &update); err != nil {
 				log.Error(err)
 			}
 		} else {
-			if err := processChatMessage(&update); err != nil {
+			if err := processChatMessage(ctx, &update); err != nil {
 				log.Error(err)
 			}
 		}
 	}
 
 	if update.EditedMessage != nil && update.EditedMessage.Location != nil {
-		if err := liveLocationUpdate(&update); err != nil {
+		if err := liveLocationUpdate(ctx, &update); err != nil {
 			log.Error(err)
 		}
 	}
@@ -162,9 +168,9 @@ func keyboards() tgbotapi.ReplyKeyboardMarkup {
 }
 
 // sendMessage is registered with Wasabee-Server as a message bus to allow other modules to send messages via Telegram
-func sendMessage(g messaging.GoogleID, message string) (bool, error) {
+func sendMessage(ctx context.Context, g messaging.GoogleID, message string) (bool, error) {
 	gid := model.GoogleID(g)
-	tgid, err := gid.TelegramID()
+	tgid, err := gid.TelegramID(ctx)
 	if err != nil {
 		log.Error(err)
 		return false, err
@@ -178,15 +184,15 @@ func sendMessage(g messaging.GoogleID, message string) (bool, error) {
 	msg.Text = message
 	msg.ParseMode = "HTML"
 
-	sendQueue <- msg
+	enqueue(ctx, msg)
 	// log.Debugw("sent message", "subsystem", "Telegram", "GID", gid)
 	return true, nil
 }
 
 // sendTarget is used to send a formatted target to an agent
-func sendTarget(g messaging.GoogleID, target messaging.Target) error {
+func sendTarget(ctx context.Context, g messaging.GoogleID, target messaging.Target) error {
 	gid := model.GoogleID(g)
-	tgid, err := gid.TelegramID()
+	tgid, err := gid.TelegramID(ctx)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -223,6 +229,6 @@ func sendTarget(g messaging.GoogleID, target messaging.Target) error {
 	}
 
 	// log.Debugw("sent target", "subsystem", "Telegram", "GID", gid, "target", target)
-	sendQueue <- msg
+	enqueue(ctx, msg)
 	return nil
 }
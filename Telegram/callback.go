@@ -1,6 +1,7 @@
 package wtg
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"strings"
@@ -12,11 +13,11 @@ import (
 )
 
 // callback is where to determine which callback is called, and what to do with it
-func callback(update *tgbotapi.Update) (tgbotapi.MessageConfig, error) {
+func callback(ctx context.Context, update *tgbotapi.Update) (tgbotapi.MessageConfig, error) {
 	log.Debug("callback", "query", update.CallbackQuery)
 
 	msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, "")
-	gid, err := model.TelegramID(update.CallbackQuery.From.ID).Gid()
+	gid, err := model.TelegramID(update.CallbackQuery.From.ID).Gid(ctx)
 	if err != nil {
 		log.Error(err)
 		return msg, err
@@ -26,7 +27,7 @@ func callback(update *tgbotapi.Update) (tgbotapi.MessageConfig, error) {
 		log.Debug("location in callback?")
 		lat := strconv.FormatFloat(update.CallbackQuery.Message.Location.Latitude, 'f', -1, 64)
 		lon := strconv.FormatFloat(update.CallbackQuery.Message.Location.Longitude, 'f', -1, 64)
-		if err = gid.SetLocation(lat, lon); err != nil {
+		if err = gid.SetLocation(ctx, lat, lon); err != nil {
 			log.Error(err)
 			return msg, err
 		}
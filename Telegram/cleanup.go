@@ -12,7 +12,7 @@ import (
 const agentHasNotStartedBot = "Bad Request: chat not found"
 
 func cleanup(ctx context.Context) error {
-	tgs, err := model.GetAllTelegramIDs()
+	tgs, err := model.GetAllTelegramIDs(ctx)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -32,12 +32,12 @@ func cleanup(ctx context.Context) error {
 				// other errors are hard fails
 				log.Errorw(err.Error(), "chatID", v)
 
-				gid, err := v.Gid()
+				gid, err := v.Gid(ctx)
 				if err != nil {
 					log.Error(err)
 					continue
 				}
-				_ = gid.RemoveTelegramID()
+				_ = gid.RemoveTelegramID(ctx)
 				continue
 			}
 
@@ -54,7 +54,7 @@ func cleanup(ctx context.Context) error {
 			}
 
 			// log.Debugw("updating username", "name", chat.UserName, "chatID", v)
-			_ = v.SetName(chat.UserName)
+			_ = v.SetName(ctx, chat.UserName)
 		}
 	}
 	return nil
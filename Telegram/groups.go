@@ -1,6 +1,7 @@
 package wtg
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strconv"
@@ -14,10 +15,10 @@ import (
 	"github.com/wasabee-project/Wasabee-Server/templates"
 )
 
-func processChatMessage(inMsg *tgbotapi.Update) error {
-	if !model.IsChatMember(model.TelegramID(inMsg.Message.From.ID), model.TelegramID(inMsg.Message.Chat.ID)) {
+func processChatMessage(ctx context.Context, inMsg *tgbotapi.Update) error {
+	if !model.IsChatMember(ctx, model.TelegramID(inMsg.Message.From.ID), model.TelegramID(inMsg.Message.Chat.ID)) {
 		log.Debugw("adding agent to chat list", "agent", inMsg.Message.From.ID, "chat", inMsg.Message.Chat.ID)
-		if err := model.AddToChatMemberList(model.TelegramID(inMsg.Message.From.ID), model.TelegramID(inMsg.Message.Chat.ID)); err != nil {
+		if err := model.AddToChatMemberList(ctx, model.TelegramID(inMsg.Message.From.ID), model.TelegramID(inMsg.Message.Chat.ID)); err != nil {
 			log.Debug(err)
 			text, _ := templates.ExecuteLang("agentUnknown", inMsg.Message.From.LanguageCode, inMsg.Message.From.UserName)
 			msg := tgbotapi.NewMessage(inMsg.Message.Chat.ID, text)
@@ -26,35 +27,35 @@ func processChatMessage(inMsg *tgbotapi.Update) error {
 	}
 
 	if inMsg.Message.IsCommand() {
-		return processChatCommand(inMsg)
+		return processChatCommand(ctx, inMsg)
 	}
-	return chatResponses(inMsg)
+	return chatResponses(ctx, inMsg)
 }
 
-func processChatCommand(inMsg *tgbotapi.Update) error {
+func processChatCommand(ctx context.Context, inMsg *tgbotapi.Update) error {
 	switch inMsg.Message.Command() {
 	case "unlink":
-		gcUnlink(inMsg)
+		gcUnlink(ctx, inMsg)
 	case "link":
-		gcLink(inMsg)
+		gcLink(ctx, inMsg)
 	case "status":
-		gcStatus(inMsg)
+		gcStatus(ctx, inMsg)
 	case "assignments", "assigned":
-		gcAssigned(inMsg)
+		gcAssigned(ctx, inMsg)
 	case "unassigned":
-		gcUnassigned(inMsg)
+		gcUnassigned(ctx, inMsg)
 	case "claim":
-		gcClaim(inMsg)
+		gcClaim(ctx, inMsg)
 	case "Reject":
-		gcReject(inMsg)
+		gcReject(ctx, inMsg)
 	case "acknowledge":
-		gcAcknowledge(inMsg)
+		gcAcknowledge(ctx, inMsg)
 	default:
 		msg := tgbotapi.NewMessage(inMsg.Message.Chat.ID, "")
 		msg.ParseMode = "HTML"
 		msg.DisableWebPagePreview = true
 
-		gid, err := model.TelegramID(inMsg.Message.From.ID).Gid()
+		gid, err := model.TelegramID(inMsg.Message.From.ID).Gid(ctx)
 		if err != nil {
 			log.Error(err)
 			msg.Text = err.Error()
@@ -72,8 +73,8 @@ func processChatCommand(inMsg *tgbotapi.Update) error {
 	return nil
 }
 
-func chatResponses(inMsg *tgbotapi.Update) error {
-	teamID, opID, err := model.ChatToTeam(inMsg.Message.Chat.ID)
+func chatResponses(ctx context.Context, inMsg *tgbotapi.Update) error {
+	teamID, opID, err := model.ChatToTeam(ctx, inMsg.Message.Chat.ID)
 	if err != nil {
 		// no need to log these, just non-linked chats
 		// log.Debugw("unknown chat", "err", err.Error(), "chatID", inMsg.Message.Chat.ID)
@@ -86,25 +87,30 @@ func chatResponses(inMsg *tgbotapi.Update) error {
 
 	// if the bot is removed from the chat, unlink the team from the chat
 	if inMsg.Message.LeftChatMember != nil && inMsg.Message.LeftChatMember.ID == bot.Self.ID {
-		if err := teamID.UnlinkFromTelegramChat(); err != nil {
+		if err := teamID.UnlinkFromTelegramChat(ctx); err != nil {
 			log.Error(err)
 			return err
 		}
 	}
 
+	// the agent who added/removed chat members, if known
+	actor, _ := model.TelegramID(inMsg.Message.From.ID).Gid(ctx)
+
 	// when new people are added to the chat, attempt to add them to the team
 	if inMsg.Message.NewChatMembers != nil {
 		for _, new := range inMsg.Message.NewChatMembers {
 			log.Debugw("new chat member", "tgid", new.ID, "tg", new.UserName)
 			tgid := model.TelegramID(new.ID)
-			gid, err := tgid.Gid()
+			gid, err := tgid.Gid(ctx)
 			if err != nil {
 				continue
 			}
-			_ = tgid.SetName(new.UserName)
-			if err = teamID.AddAgent(gid); err != nil {
+			_ = tgid.SetName(ctx, new.UserName)
+			if err = teamID.AddAgent(ctx, gid); err != nil {
 				log.Errorw(err.Error(), "tgid", new.ID, "tg", new.UserName, "resource", teamID, "GID", gid, "opID", opID)
+				continue
 			}
+			teamID.AuditMembership(ctx, actor, model.AuditSourceTelegram, gid, model.AuditActionAdd)
 		}
 	}
 
@@ -112,21 +118,23 @@ func chatResponses(inMsg *tgbotapi.Update) error {
 		left := inMsg.Message.LeftChatMember
 		log.Debugw("chat member left", "tgid", left.ID, "tg", left.UserName)
 		tgid := model.TelegramID(left.ID)
-		gid, err := tgid.Gid()
+		gid, err := tgid.Gid(ctx)
 		if err != nil {
 			log.Debugw(err.Error(), "tgid", left.ID, "tg", left.UserName, "resource", teamID, "opID", opID)
 		} else {
-			if err := teamID.RemoveAgent(gid); err != nil {
+			if err := teamID.RemoveAgent(ctx, gid); err != nil {
 				log.Errorw(err.Error(), "tgid", left.ID, "tg", left.UserName, "resource", teamID, "GID", gid, "opID", opID)
+			} else {
+				teamID.AuditMembership(ctx, actor, model.AuditSourceTelegram, gid, model.AuditActionRemove)
 			}
 		}
 	}
 	return nil
 }
 
-func liveLocationUpdate(inMsg *tgbotapi.Update) error {
+func liveLocationUpdate(ctx context.Context, inMsg *tgbotapi.Update) error {
 	tgid := model.TelegramID(inMsg.EditedMessage.From.ID)
-	gid, verified, err := tgid.GidV()
+	gid, verified, err := tgid.GidV(ctx)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -137,7 +145,7 @@ func liveLocationUpdate(inMsg *tgbotapi.Update) error {
 
 	lat := strconv.FormatFloat(inMsg.EditedMessage.Location.Latitude, 'f', -1, 64)
 	lon := strconv.FormatFloat(inMsg.EditedMessage.Location.Longitude, 'f', -1, 64)
-	_ = gid.SetLocation(lat, lon)
+	_ = gid.SetLocation(ctx, lat, lon)
 	return nil
 }
 
@@ -164,12 +172,12 @@ func liveLocationUpdate(inMsg *tgbotapi.Update) error {
 	return nil
 } */
 
-func addToChat(g messaging.GoogleID, t messaging.TeamID) error {
+func addToChat(ctx context.Context, g messaging.GoogleID, t messaging.TeamID) error {
 	lang := "en"
 	gid := model.GoogleID(g)
 	teamID := model.TeamID(t)
 
-	chatID, err := teamID.TelegramChat()
+	chatID, err := teamID.TelegramChat(ctx)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -185,12 +193,12 @@ func addToChat(g messaging.GoogleID, t messaging.TeamID) error {
 	if err != nil {
 		log.Errorw(err.Error(), "chatID", chatID, "GID", gid)
 		if err.Error() == "Bad Request: chat not found" {
-			_ = teamID.UnlinkFromTelegramChat()
+			_ = teamID.UnlinkFromTelegramChat(ctx)
 		}
 		return err
 	}
 
-	tgid, err := gid.TelegramID()
+	tgid, err := gid.TelegramID(ctx)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -198,27 +206,27 @@ func addToChat(g messaging.GoogleID, t messaging.TeamID) error {
 	if tgid == 0 {
 		text, _ := templates.ExecuteLang("agentUnknown", lang, gid)
 		msg := tgbotapi.NewMessage(chat.ID, text)
-		sendQueue <- msg
+		enqueue(ctx, msg)
 		return nil
 	}
 
-	if model.IsChatMember(tgid, model.TelegramID(chatID)) {
+	if model.IsChatMember(ctx, tgid, model.TelegramID(chatID)) {
 		log.Debug("not adding agent to chat since already a member")
 		return nil
 	}
 
-	name, _ := gid.IngressName()
-	if tmp, _ := gid.TelegramName(); tmp != "" {
+	name, _ := gid.IngressName(ctx)
+	if tmp, _ := gid.TelegramName(ctx); tmp != "" {
 		name = fmt.Sprint("@", tmp)
 	}
 
-	teamname, err := teamID.Name()
+	teamname, err := teamID.Name(ctx)
 	if err != nil {
 		log.Error(err)
 		teamname = string(teamID)
 	}
 
-	if err := model.AddToChatMemberList(tgid, model.TelegramID(chatID)); err != nil {
+	if err := model.AddToChatMemberList(ctx, tgid, model.TelegramID(chatID)); err != nil {
 		log.Error(err)
 	}
 
@@ -242,7 +250,7 @@ func addToChat(g messaging.GoogleID, t messaging.TeamID) error {
 	text, _ := templates.ExecuteLang("joinedTeam", lang, d)
 	msg := tgbotapi.NewMessage(chat.ID, text)
 	msg.ParseMode = "HTML"
-	sendQueue <- msg
+	enqueue(ctx, msg)
 
 	return nil
 }
@@ -284,11 +292,11 @@ func sendInviteLink(tgid model.TelegramID, chatID int64, team string) error {
 	return nil
 }
 
-func removeFromChat(g messaging.GoogleID, t messaging.TeamID) error {
+func removeFromChat(ctx context.Context, g messaging.GoogleID, t messaging.TeamID) error {
 	gid := model.GoogleID(g)
 	teamID := model.TeamID(t)
 
-	chatID, err := teamID.TelegramChat()
+	chatID, err := teamID.TelegramChat(ctx)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -297,7 +305,7 @@ func removeFromChat(g messaging.GoogleID, t messaging.TeamID) error {
 		return nil
 	}
 
-	tgid, err := gid.TelegramID()
+	tgid, err := gid.TelegramID(ctx)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -314,8 +322,8 @@ func removeFromChat(g messaging.GoogleID, t messaging.TeamID) error {
 		log.Errorw(err.Error(), "chatID", chatID, "GID", gid)
 		return err
 	}
-	name, _ := gid.IngressName()
-	if tmp, _ := gid.TelegramName(); tmp != "" {
+	name, _ := gid.IngressName(ctx)
+	if tmp, _ := gid.TelegramName(ctx); tmp != "" {
 		name = fmt.Sprint("@", tmp)
 	}
 
@@ -338,9 +346,9 @@ func removeFromChat(g messaging.GoogleID, t messaging.TeamID) error {
 	message, _ := templates.ExecuteLang("leftTeam", "en", data{Agent: name, TeamID: teamID, Admin: cm.IsAdministrator()})
 	msg := tgbotapi.NewMessage(chat.ID, message)
 	msg.ParseMode = "HTML"
-	sendQueue <- msg
+	enqueue(ctx, msg)
 
-	_ = model.RemoveFromChatMemberList(tgid, model.TelegramID(chatID))
+	_ = model.RemoveFromChatMemberList(ctx, tgid, model.TelegramID(chatID))
 
 	if !cm.IsAdministrator() {
 		log.Debug("I am not admin... trying anyways")
@@ -361,17 +369,17 @@ func removeFromChat(g messaging.GoogleID, t messaging.TeamID) error {
 		switch errstr {
 		case "Bad Request: USER_ID_INVALID":
 			log.Infow("invalid telegram ID, clearing from agent", "gid", gid, "tgid", tgid)
-			if err := gid.RemoveTelegramID(); err != nil {
+			if err := gid.RemoveTelegramID(ctx); err != nil {
 				log.Error(err)
 				msg := tgbotapi.NewMessage(chat.ID, err.Error())
-				sendQueue <- msg
+				enqueue(ctx, msg)
 			}
 		case "Bad Request: USER_NOT_PARTICIPANT":
 			// nothing
 		default:
 			log.Error(err)
 			msg := tgbotapi.NewMessage(chat.ID, err.Error())
-			sendQueue <- msg
+			enqueue(ctx, msg)
 		}
 	}
 
@@ -0,0 +1,62 @@
+package wtg
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wasabee-project/Wasabee-Server/config"
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+// how old a Telegram login widget result may be
+const loginMaxAge = 15 * time.Minute
+
+// VerifyLogin checks the fields returned by the Telegram login widget were signed with our bot token
+// https://core.telegram.org/widgets/login#checking-authorization
+func VerifyLogin(fields map[string]string) (model.TelegramID, string, error) {
+	key := config.Get().Telegram.APIKey
+	if key == "" {
+		return 0, "", fmt.Errorf("telegram is not configured")
+	}
+
+	hash := fields["hash"]
+	check := make([]string, 0, len(fields))
+	for k, v := range fields {
+		if k == "hash" {
+			continue
+		}
+		check = append(check, k+"="+v)
+	}
+	sort.Strings(check)
+
+	secret := sha256.Sum256([]byte(key))
+	mac := hmac.New(sha256.New, secret[:])
+	mac.Write([]byte(strings.Join(check, "\n")))
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(hash)) {
+		err := fmt.Errorf("invalid telegram login")
+		log.Warnw(err.Error(), "telegram ID", fields["id"])
+		return 0, "", err
+	}
+
+	authDate, err := strconv.ParseInt(fields["auth_date"], 10, 64)
+	if err != nil || time.Since(time.Unix(authDate, 0)) > loginMaxAge {
+		err := fmt.Errorf("telegram login expired, try again")
+		log.Infow(err.Error(), "telegram ID", fields["id"])
+		return 0, "", err
+	}
+
+	id, err := strconv.ParseInt(fields["id"], 10, 64)
+	if err != nil {
+		log.Error(err)
+		return 0, "", err
+	}
+	return model.TelegramID(id), fields["username"], nil
+}
@@ -16,9 +16,9 @@ import (
 	"github.com/wasabee-project/Wasabee-Server/v"
 )
 
-func processDirectMessage(inMsg *tgbotapi.Update) error {
+func processDirectMessage(ctx context.Context, inMsg *tgbotapi.Update) error {
 	tgid := model.TelegramID(inMsg.Message.From.ID)
-	gid, verified, err := tgid.GidV()
+	gid, verified, err := tgid.GidV(ctx)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -29,7 +29,7 @@ func processDirectMessage(inMsg *tgbotapi.Update) error {
 		log.Infow("unknown user; initializing", "subsystem", "Telegram", "tgusername", inMsg.Message.From.UserName, "tgid", tgid)
 
 		// never logged into this server, check Rocks & V
-		fgid, err := firstlogin(tgid, inMsg.Message.From.UserName)
+		fgid, err := firstlogin(ctx, tgid, inMsg.Message.From.UserName)
 		if fgid != "" && err == nil {
 			// firstlogin found something at Rocks (or V lol), use that
 			msg := tgbotapi.NewMessage(inMsg.Message.Chat.ID, "")
@@ -41,7 +41,7 @@ func processDirectMessage(inMsg *tgbotapi.Update) error {
 		}
 
 		// start manual association process
-		msg, err := newUserInit(inMsg)
+		msg, err := newUserInit(ctx, inMsg)
 		if err != nil {
 			log.Error(err)
 		}
@@ -53,7 +53,7 @@ func processDirectMessage(inMsg *tgbotapi.Update) error {
 	if !verified {
 		log.Infow("verifying Telegram user", "subsystem", "Telegram", "tgusername", inMsg.Message.From.UserName, "tgid", tgid)
 
-		msg, err := newUserVerify(inMsg)
+		msg, err := newUserVerify(ctx, inMsg)
 		if err != nil {
 			log.Error(err)
 		}
@@ -62,7 +62,7 @@ func processDirectMessage(inMsg *tgbotapi.Update) error {
 	}
 
 	// user is verified, process message
-	if err := processMessage(inMsg, gid); err != nil {
+	if err := processMessage(ctx, inMsg, gid); err != nil {
 		log.Error(err)
 		return err
 	}
@@ -70,14 +70,14 @@ func processDirectMessage(inMsg *tgbotapi.Update) error {
 }
 
 // This is where command processing takes place
-func processMessage(inMsg *tgbotapi.Update, gid model.GoogleID) error {
+func processMessage(ctx context.Context, inMsg *tgbotapi.Update, gid model.GoogleID) error {
 	msg := tgbotapi.NewMessage(inMsg.Message.Chat.ID, "")
 	msg.ParseMode = "HTML"
 
 	// update name
 	if inMsg.Message.From.UserName != "" {
 		tgid := model.TelegramID(inMsg.Message.From.ID)
-		if err := tgid.SetName(inMsg.Message.From.UserName); err != nil {
+		if err := tgid.SetName(ctx, inMsg.Message.From.UserName); err != nil {
 			log.Error(err)
 		}
 	}
@@ -111,7 +111,7 @@ func processMessage(inMsg *tgbotapi.Update, gid model.GoogleID) error {
 		log.Debugw("processing location", "subsystem", "Telegram", "GID", gid)
 		lat := strconv.FormatFloat(inMsg.Message.Location.Latitude, 'f', -1, 64)
 		lon := strconv.FormatFloat(inMsg.Message.Location.Longitude, 'f', -1, 64)
-		if err := gid.SetLocation(lat, lon); err != nil {
+		if err := gid.SetLocation(ctx, lat, lon); err != nil {
 			log.Error(err)
 		}
 	}
@@ -121,7 +121,7 @@ func processMessage(inMsg *tgbotapi.Update, gid model.GoogleID) error {
 }
 
 // checks rocks/v based on tgid, Inits agent if found
-func firstlogin(tgid model.TelegramID, name string) (model.GoogleID, error) {
+func firstlogin(ctx context.Context, tgid model.TelegramID, name string) (model.GoogleID, error) {
 	agent, err := rocks.Search(fmt.Sprint(tgid))
 	if err != nil {
 		log.Error(err)
@@ -130,18 +130,18 @@ func firstlogin(tgid model.TelegramID, name string) (model.GoogleID, error) {
 
 	if agent.Gid != "" {
 		gid := model.GoogleID(agent.Gid)
-		if !gid.Valid() {
-			if err := gid.FirstLogin(); err != nil {
+		if !gid.Valid(ctx) {
+			if err := gid.FirstLogin(ctx); err != nil {
 				log.Error(err)
 				return "", err
 			}
 		}
-		if err := gid.SetTelegramID(tgid, name); err != nil {
+		if err := gid.SetTelegramID(ctx, tgid, name); err != nil {
 			log.Error(err)
 			return gid, err
 		}
 
-		federation.SetTelegramID(context.Background(), tgid, name)
+		federation.SetTelegramID(ctx, tgid, name)
 
 		// rocks success
 		return gid, nil
@@ -154,22 +154,22 @@ func firstlogin(tgid model.TelegramID, name string) (model.GoogleID, error) {
 	}
 	if result.Gid != "" {
 		log.Debugw("v is so useless")
-		result.Gid, _ = model.GetGIDFromEnlID(result.EnlID)
+		result.Gid, _ = model.GetGIDFromEnlID(ctx, result.EnlID)
 	}
 
 	if result.Gid != "" {
 		gid := model.GoogleID(result.Gid)
-		if !gid.Valid() {
-			if err := gid.FirstLogin(); err != nil {
+		if !gid.Valid(ctx) {
+			if err := gid.FirstLogin(ctx); err != nil {
 				log.Error(err)
 				return "", err
 			}
 		}
-		if err := gid.SetTelegramID(tgid, name); err != nil {
+		if err := gid.SetTelegramID(ctx, tgid, name); err != nil {
 			log.Error(err)
 			return gid, err
 		}
-		federation.SetTelegramID(context.Background(), tgid, name)
+		federation.SetTelegramID(ctx, tgid, name)
 		// v success?!
 		return gid, nil
 	}
@@ -178,7 +178,7 @@ func firstlogin(tgid model.TelegramID, name string) (model.GoogleID, error) {
 	return "", nil
 }
 
-func newUserInit(inMsg *tgbotapi.Update) (*tgbotapi.MessageConfig, error) {
+func newUserInit(ctx context.Context, inMsg *tgbotapi.Update) (*tgbotapi.MessageConfig, error) {
 	msg := tgbotapi.NewMessage(inMsg.Message.Chat.ID, "")
 	msg.ParseMode = "HTML"
 
@@ -195,7 +195,7 @@ func newUserInit(inMsg *tgbotapi.Update) (*tgbotapi.MessageConfig, error) {
 	log.Debugw("newUserInit", "text", inMsg.Message.Text)
 
 	tid := model.TelegramID(inMsg.Message.From.ID)
-	err := tid.InitAgent(inMsg.Message.From.UserName, ott)
+	err := tid.InitAgent(ctx, inMsg.Message.From.UserName, ott)
 	if err != nil {
 		log.Error(err)
 		tmp, _ := templates.ExecuteLang("InitOneFail", inMsg.Message.From.LanguageCode, nil)
@@ -207,7 +207,7 @@ func newUserInit(inMsg *tgbotapi.Update) (*tgbotapi.MessageConfig, error) {
 	return &msg, err
 }
 
-func newUserVerify(inMsg *tgbotapi.Update) (*tgbotapi.MessageConfig, error) {
+func newUserVerify(ctx context.Context, inMsg *tgbotapi.Update) (*tgbotapi.MessageConfig, error) {
 	msg := tgbotapi.NewMessage(inMsg.Message.Chat.ID, "")
 	msg.ParseMode = "HTML"
 
@@ -222,7 +222,7 @@ func newUserVerify(inMsg *tgbotapi.Update) (*tgbotapi.MessageConfig, error) {
 	}
 	authtoken = strings.TrimSpace(authtoken)
 	tid := model.TelegramID(inMsg.Message.From.ID)
-	err := tid.VerifyAgent(authtoken)
+	err := tid.VerifyAgent(ctx, authtoken)
 	if err != nil {
 		log.Error(err)
 		tmp, _ := templates.ExecuteLang("InitTwoFail", inMsg.Message.From.LanguageCode, nil)
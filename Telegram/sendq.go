@@ -5,13 +5,19 @@ import (
 	"context"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-telegram-bot-api/telegram-bot-api/v5"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/time/rate"
 
 	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/tracing"
 )
 
 // 15/10 with chanSize 30  yeilds 16 second pauses at high load
@@ -23,6 +29,63 @@ const sendQBurst = 8
 // just a "gut feel" value, need to test to determine optimum
 const sendQchanSize = sendQBurst * 2
 
+var (
+	holdQLength = promauto.NewGauge(prometheus.GaugeOpts{Name: "wasabee_telegram_holdq_length", Help: "Telegram messages held back while the sender is paused."})
+	tgSent      = promauto.NewCounterVec(prometheus.CounterOpts{Name: "wasabee_telegram_messages_total", Help: "Telegram messages sent, by result."}, []string{"result"})
+	tgPauses    = promauto.NewCounter(prometheus.CounterOpts{Name: "wasabee_telegram_ratelimit_pauses_total", Help: "Times Telegram told the sender to back off."})
+	tgPaused    = promauto.NewCounter(prometheus.CounterOpts{Name: "wasabee_telegram_ratelimit_paused_seconds_total", Help: "Seconds the sender has been told to back off."})
+)
+
+// the sender's state, for health checks
+var sender struct {
+	sync.Mutex
+	blocked bool
+	held    int
+}
+
+// SenderStatus reports if the message sender is paused by Telegram's rate limits, and how many messages are queued and held
+func SenderStatus() (blocked bool, queued int, held int) {
+	sender.Lock()
+	defer sender.Unlock()
+	return sender.blocked, len(sendQueue), sender.held
+}
+
+func init() {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{Name: "wasabee_telegram_sendqueue_length", Help: "Telegram messages waiting in the send queue."}, func() float64 {
+		return float64(len(sendQueue))
+	})
+}
+
+// traced carries the span of whoever queued the message, so the send shows up in their trace
+type traced struct {
+	tgbotapi.Chattable
+	sc     trace.SpanContext
+	queued time.Time
+}
+
+// enqueue puts msg on the send queue, remembering the span in ctx
+func enqueue(ctx context.Context, msg tgbotapi.Chattable) {
+	sendQueue <- traced{Chattable: msg, sc: trace.SpanContextFromContext(ctx), queued: time.Now()}
+}
+
+// send sends one message, in a span under the queuing request's span when there was one
+func send(msg tgbotapi.Chattable) error {
+	t, ok := msg.(traced)
+	if !ok {
+		_, err := bot.Send(msg)
+		return err
+	}
+
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), t.sc)
+	_, span := tracing.Span(ctx, "telegram.send", trace.WithSpanKind(trace.SpanKindProducer), trace.WithAttributes(
+		attribute.String("messaging.system", "telegram"),
+		attribute.Int64("wasabee.queue_wait_ms", time.Since(t.queued).Milliseconds()),
+	))
+	_, err := bot.Send(t.Chattable)
+	tracing.End(span, err)
+	return err
+}
+
 // Reverse the logic, channel puts it in the queue, and the queue runner is time-limited...
 // The goal is to not have the callers block, but all the blocking to happen on this goprocess
 // if this is really the goal, then stuff them in the holdQ as fast as possible and run that queue at the target rate
@@ -33,6 +96,12 @@ func sendqueueRunner(ctx context.Context) {
 	limiter := rate.NewLimiter(rate.Every(time.Minute/sendQMessagesPerMinutes), sendQBurst)
 
 	for {
+		holdQLength.Set(float64(holdQ.Len()))
+		sender.Lock()
+		sender.blocked = blocked
+		sender.held = holdQ.Len()
+		sender.Unlock()
+
 		select {
 		case <-ctx.Done():
 			log.Debugw("shutting down message sender", "holdQ len", holdQ.Len())
@@ -81,7 +150,8 @@ func sendqueueRunner(ctx context.Context) {
 				continue
 			}
 
-			if _, err := bot.Send(msg); err != nil {
+			if err := send(msg); err != nil {
+				tgSent.WithLabelValues("error").Inc()
 				handleMsgError(msg)
 				errstr := string(err.Error())
 				if errstr == "Bad Request: chat not found" { // user has not started the bot or related condition
@@ -98,12 +168,16 @@ func sendqueueRunner(ctx context.Context) {
 						continue
 					}
 					log.Infow("pausing message sender", "for", sleepfor)
+					tgPauses.Inc()
+					tgPaused.Add(float64(sleepfor))
 					blocked = true
 					holdQ.PushBack(msg)
 					unblocker = time.After(time.Duration(sleepfor) * time.Second)
 					continue
 				}
+				continue
 			}
+			tgSent.WithLabelValues("ok").Inc()
 		}
 	}
 }
@@ -111,6 +185,9 @@ func sendqueueRunner(ctx context.Context) {
 // move the error handling above into here
 // look at way of alerting orig message sender of the fact that the agent does not have the bot started
 func handleMsgError(msg tgbotapi.Chattable) {
+	if t, ok := msg.(traced); ok {
+		msg = t.Chattable
+	}
 	switch msg.(type) {
 	case tgbotapi.MessageConfig:
 		mc := msg.(tgbotapi.MessageConfig)
@@ -3,12 +3,16 @@ package auth
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/wasabee-project/Wasabee-Server/log"
 	"github.com/wasabee-project/Wasabee-Server/model"
 	"github.com/wasabee-project/Wasabee-Server/util"
 )
 
+// how often the revoked JWT list is checked for revocations made elsewhere
+const revokedPollInterval = time.Minute
+
 var logoutlist *util.Safemap
 var revokedjwt *util.Safemap
 
@@ -19,10 +23,29 @@ func Start(ctx context.Context) {
 	logoutlist = util.NewSafemap()
 	revokedjwt = model.LoadRevokedJWT()
 
-	<-ctx.Done()
-
-	log.Infow("shutdown", "message", "shutting down authorization")
-	model.StoreRevokedJWT(revokedjwt)
+	// pick up revocations made from the command line (or another server sharing the database)
+	ticker := time.NewTicker(revokedPollInterval)
+	defer ticker.Stop()
+	last := time.Now()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Infow("shutdown", "message", "shutting down authorization")
+			model.StoreRevokedJWT(revokedjwt)
+			return
+		case t := <-ticker.C:
+			// overlap a little, the database clock and ours may not agree
+			ids, err := model.RevokedJWTSince(ctx, last.Add(-revokedPollInterval))
+			if err != nil {
+				continue
+			}
+			for _, id := range ids {
+				revokedjwt.SetBool(id, true)
+			}
+			last = t
+		}
+	}
 }
 
 // Authorize is called to verify that an agent is permitted to use Wasabee.
@@ -30,22 +53,22 @@ func Start(ctx context.Context) {
 // Accounts that have indicated they are RES in Intel are blocked.
 // V and Rocks are checked (if configured).
 // Returns true if the agent is authorized to continue, false if the agent is blacklisted or otherwise locked.
-func Authorize(gid model.GoogleID) (bool, error) {
+func Authorize(ctx context.Context, gid model.GoogleID) (bool, error) {
 	// if the agent isn't known to this server, pre-populate everything
-	if !gid.Valid() {
-		if err := gid.FirstLogin(); err != nil {
+	if !gid.Valid(ctx) {
+		if err := gid.FirstLogin(ctx); err != nil {
 			log.Error(err)
 			return false, err
 		}
 	}
 
-	if gid.RISC() {
+	if gid.RISC(ctx) {
 		err := fmt.Errorf("account locked by Google RISC")
 		log.Warnw(err.Error(), "GID", gid)
 		return false, err
 	}
 
-	if gid.IntelSmurf() {
+	if gid.IntelSmurf(ctx) {
 		err := fmt.Errorf("intel account self-identified as RES")
 		log.Warnw(err.Error(), "GID", gid)
 		return false, err
@@ -53,7 +76,7 @@ func Authorize(gid model.GoogleID) (bool, error) {
 
 	// sequentially loop through authorization providers
 	for _, p := range providers {
-		if !p.Authorize(gid) {
+		if !p.Authorize(ctx, gid) {
 			return false, fmt.Errorf("access denied")
 		}
 	}
@@ -77,10 +100,11 @@ func IsLoggedOut(gid model.GoogleID) bool {
 	return false
 }
 
-// RevokeJWT adds a JWT ID to the revoked list
-func RevokeJWT(tokenID string) {
+// RevokeJWT adds a JWT ID to the revoked list, the revocation is saved so it survives a restart
+func RevokeJWT(ctx context.Context, tokenID string) {
 	log.Infow("revoking JWT", "id", tokenID)
 	revokedjwt.SetBool(tokenID, true)
+	_ = model.RecordRevokedJWT(ctx, tokenID)
 }
 
 // IsRevokedJWT checks if a JWT ID is on the revoked list.
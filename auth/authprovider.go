@@ -1,6 +1,8 @@
 package auth
 
 import (
+	"context"
+
 	"github.com/wasabee-project/Wasabee-Server/model"
 )
 
@@ -8,7 +10,7 @@ var providers []Provider
 
 // Provider is the interface type for authorizaiton services
 type Provider interface {
-	Authorize(gid model.GoogleID) bool
+	Authorize(ctx context.Context, gid model.GoogleID) bool
 }
 
 // RegisterAuthProvider lets the authorization system know about a service that provides authorization (v/rocks)
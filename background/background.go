@@ -4,16 +4,30 @@ import (
 	"context"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
 	"github.com/wasabee-project/Wasabee-Server/Firebase"
 	"github.com/wasabee-project/Wasabee-Server/config"
 	"github.com/wasabee-project/Wasabee-Server/log"
 	"github.com/wasabee-project/Wasabee-Server/model"
 )
 
+var taskDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{Name: "wasabee_background_task_duration_seconds", Help: "Background task run time, by task.", Buckets: []float64{.1, .5, 1, 5, 10, 30, 60, 300, 900}}, []string{"task"})
+
+// timed runs a task, recording how long it took
+func timed(task string, f func()) {
+	start := time.Now()
+	f()
+	taskDuration.WithLabelValues(task).Observe(time.Since(start).Seconds())
+}
+
 // Start runs the database cleaning tasks such as expiring stale user locations
 func Start(ctx context.Context) {
 	log.Infow("startup", "message", "running initial background tasks")
-	model.LocationClean()
+	timed("locationclean", model.LocationClean)
+	// don't wait an interval after a restart to catch up with the rosters
+	go timed("teamsync", func() { syncLinkedTeams(ctx) })
 
 	hourly := time.NewTicker(time.Hour)
 	defer hourly.Stop()
@@ -21,8 +35,11 @@ func Start(ctx context.Context) {
 	weekly := time.NewTicker(time.Hour * 24 * 7)
 	defer weekly.Stop()
 
+	teamsync := time.NewTicker(teamSyncInterval)
+	defer teamsync.Stop()
+
 	if config.IsFirebaseRunning() {
-		wfb.Resubscribe() // prevent a crash if background starts before firebase
+		timed("resubscribe", wfb.Resubscribe) // prevent a crash if background starts before firebase
 	}
 
 	for {
@@ -31,10 +48,15 @@ func Start(ctx context.Context) {
 			log.Infow("shutdown", "message", "background tasks shutting down")
 			return
 		case <-hourly.C:
-			model.LocationClean()
+			timed("locationclean", model.LocationClean)
+			timed("sessionclean", model.SessionClean)
+			timed("idempotencyclean", model.IdempotencyClean)
+			timed("blocklistclean", model.BlocklistClean)
 			wfb.ResetDefaultRateLimits()
 		case <-weekly.C:
-			wfb.Resubscribe()
+			timed("resubscribe", wfb.Resubscribe)
+		case <-teamsync.C:
+			go timed("teamsync", func() { syncLinkedTeams(ctx) })
 		}
 	}
 }
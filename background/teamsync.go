@@ -0,0 +1,126 @@
+package background
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/model"
+	"github.com/wasabee-project/Wasabee-Server/roster"
+)
+
+// how often linked teams are synced with their roster providers (V, .rocks, roster URLs)
+const teamSyncInterval = 6 * time.Hour
+
+// each team's sync is delayed a random amount, up to this, to keep from hitting the providers all at once
+const teamSyncJitter = 30 * time.Minute
+
+// the number of teams synced at the same time
+const teamSyncConcurrency = 4
+
+// after repeated failures a team is skipped for up to this many intervals
+const teamSyncMaxBackoff = 8
+
+// teamSyncRunning prevents a slow run from overlapping the next one
+var teamSyncRunning int32
+
+// backoff tracks teams whose syncs have been failing
+var backoff = struct {
+	sync.Mutex
+	failures map[model.TeamID]int
+	skip     map[model.TeamID]int
+}{
+	failures: make(map[model.TeamID]int),
+	skip:     make(map[model.TeamID]int),
+}
+
+// syncLinkedTeams syncs every team linked to a roster provider
+func syncLinkedTeams(ctx context.Context) {
+	if !atomic.CompareAndSwapInt32(&teamSyncRunning, 0, 1) {
+		log.Infow("previous team sync still running, skipping")
+		return
+	}
+	defer atomic.StoreInt32(&teamSyncRunning, 0)
+
+	teams, err := model.LinkedTeams(ctx)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	log.Infow("syncing linked teams", "count", len(teams))
+
+	sem := make(chan struct{}, teamSyncConcurrency)
+	var wg sync.WaitGroup
+
+	for _, teamID := range teams {
+		if skipTeamSync(teamID) {
+			continue
+		}
+
+		wg.Add(1)
+		go func(teamID model.TeamID) {
+			defer wg.Done()
+
+			// #nosec -- jitter does not need to be cryptographically random
+			jitter := time.Duration(rand.Int63n(int64(teamSyncJitter)))
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(jitter):
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case sem <- struct{}{}:
+			}
+			defer func() { <-sem }()
+
+			err := syncTeam(ctx, teamID)
+			recordTeamSync(teamID, err)
+		}(teamID)
+	}
+	wg.Wait()
+}
+
+// syncTeam syncs a single team with every roster provider to which it is linked
+func syncTeam(ctx context.Context, teamID model.TeamID) error {
+	return roster.SyncAll(ctx, teamID)
+}
+
+// skipTeamSync reports if a team is still backing off after failed syncs
+func skipTeamSync(teamID model.TeamID) bool {
+	backoff.Lock()
+	defer backoff.Unlock()
+
+	if backoff.skip[teamID] > 0 {
+		backoff.skip[teamID]--
+		return true
+	}
+	return false
+}
+
+// recordTeamSync stores the result of a sync and adjusts the team's backoff
+func recordTeamSync(teamID model.TeamID, err error) {
+	backoff.Lock()
+	defer backoff.Unlock()
+
+	if err == nil {
+		delete(backoff.failures, teamID)
+		delete(backoff.skip, teamID)
+		_ = teamID.SetSyncStatus(context.Background(), "ok")
+		return
+	}
+
+	backoff.failures[teamID]++
+	skip := 1 << (backoff.failures[teamID] - 1)
+	if skip > teamSyncMaxBackoff {
+		skip = teamSyncMaxBackoff
+	}
+	backoff.skip[teamID] = skip
+	log.Infow("team sync failed, backing off", "resource", teamID, "error", err.Error(), "failures", backoff.failures[teamID], "skip", skip)
+	_ = teamID.SetSyncStatus(context.Background(), err.Error())
+}
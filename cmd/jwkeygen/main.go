@@ -4,32 +4,34 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io/fs"
+	"os"
+	"time"
 
 	"github.com/lestrrat-go/jwx/v2/jwk"
 
+	"github.com/wasabee-project/Wasabee-Server/config"
 	"github.com/wasabee-project/Wasabee-Server/util"
 )
 
 func main() {
-	raw, err := rsa.GenerateKey(rand.Reader, 2048)
-	if err != nil {
-		fmt.Printf("failed to generate new RSA private key: %s\n", err)
+	if len(os.Args) > 1 && os.Args[1] == "rotate" {
+		if err := rotate(os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
 		return
 	}
 
-	key, err := jwk.FromRaw(raw)
+	key, err := newKey()
 	if err != nil {
-		fmt.Printf("failed to create symmetric key: %s\n", err)
-		return
-	}
-	if _, ok := key.(jwk.RSAPrivateKey); !ok {
-		fmt.Printf("expected jwk.SymmetricKey, got %T\n", key)
+		fmt.Println(err)
 		return
 	}
 
-	_ = key.Set(jwk.KeyIDKey, util.GenerateID(16))
-
 	buf, err := json.MarshalIndent(key, "", "  ")
 	if err != nil {
 		fmt.Printf("failed to marshal key into JSON: %s\n", err)
@@ -45,3 +47,86 @@ func main() {
 	}
 	fmt.Printf("%s\n", buf)
 }
+
+func newKey() (jwk.Key, error) {
+	raw, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate new RSA private key: %s", err)
+	}
+
+	key, err := jwk.FromRaw(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create symmetric key: %s", err)
+	}
+	if _, ok := key.(jwk.RSAPrivateKey); !ok {
+		return nil, fmt.Errorf("expected jwk.SymmetricKey, got %T", key)
+	}
+
+	_ = key.Set(jwk.KeyIDKey, util.GenerateID(16))
+	return key, nil
+}
+
+// rotate adds a next key to the key files, which starts signing after the lead time, and drops retired keys
+// publish the new public key file (at the JKU and to federation peers) before the lead time is up
+func rotate(args []string) error {
+	fl := flag.NewFlagSet("rotate", flag.ExitOnError)
+	priv := fl.String("priv", "certs/jwkpriv.json", "private key set (JWKpriv)")
+	pub := fl.String("pub", "certs/jwkpub.json", "public key set (JWKpub)")
+	lead := fl.Duration("in", 24*time.Hour, "how long until the new key starts signing")
+	_ = fl.Parse(args)
+
+	now := time.Now()
+	set, err := jwk.ReadFile(*priv)
+	if errors.Is(err, fs.ErrNotExist) {
+		set = jwk.NewSet()
+		*lead = 0 // nothing is signing yet
+	} else if err != nil {
+		return err
+	}
+
+	if next, ok := config.ActiveJWK(set, now.Add(100*365*24*time.Hour)); ok {
+		if active, _ := config.ActiveJWK(set, now); active != next {
+			return fmt.Errorf("key %s is already waiting to start signing", next.KeyID())
+		}
+	}
+
+	key, err := newKey()
+	if err != nil {
+		return err
+	}
+	activates := now.Add(*lead)
+	_ = key.Set(config.JWKActivatesKey, activates.Unix())
+
+	// drop the keys retired by now, keep the rest so current JWTs still verify
+	live := config.LiveJWK(set, now)
+	for i := 0; i < set.Len(); i++ {
+		k, _ := set.Key(i)
+		if _, ok := live.LookupKeyID(k.KeyID()); !ok {
+			fmt.Printf("retired key %s\n", k.KeyID())
+		}
+	}
+	_ = live.AddKey(key)
+
+	pubset, err := jwk.PublicSetOf(live)
+	if err != nil {
+		return err
+	}
+	if err := writeSet(*priv, live, 0600); err != nil {
+		return err
+	}
+	if err := writeSet(*pub, pubset, 0644); err != nil {
+		return err
+	}
+
+	fmt.Printf("new key %s starts signing at %s\n", key.KeyID(), activates.Format(time.RFC1123))
+	fmt.Printf("publish %s at the JKU URL (and to federation peers) before then\n", *pub)
+	return nil
+}
+
+func writeSet(file string, set jwk.Set, perm os.FileMode) error {
+	buf, err := json.MarshalIndent(set, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(buf, '\n'), perm)
+}
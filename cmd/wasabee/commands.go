@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli"
+	"go.uber.org/zap"
+
+	"github.com/wasabee-project/Wasabee-Server/config"
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+// cliAdmin is recorded as the administrator in the admin audit log for changes made from the command line
+const cliAdmin = model.GoogleID("cli")
+
+// commands operate directly on the configured database, without starting any services
+var commands = []cli.Command{
+	{
+		Name:  "agent",
+		Usage: "Inspect and manage agents",
+		Subcommands: []cli.Command{
+			{Name: "show", Usage: "Show everything about an agent", ArgsUsage: "<gid|name>", Action: agentShow},
+			{Name: "lock", Usage: "Lock an account and end all its sessions", ArgsUsage: "<gid|name> [reason]", Action: agentLock},
+			{Name: "unlock", Usage: "Unlock an account", ArgsUsage: "<gid|name> [reason]", Action: agentUnlock},
+			{Name: "delete", Usage: "Delete an agent and everything they own", ArgsUsage: "<gid|name>", Action: agentDelete},
+		},
+	},
+	{
+		Name:  "team",
+		Usage: "Inspect and manage teams",
+		Subcommands: []cli.Command{
+			{Name: "list", Usage: "List all teams", Action: teamList},
+			{Name: "show", Usage: "Show a team's members", ArgsUsage: "<teamID>", Action: teamShow},
+			{Name: "chown", Usage: "Give a team to another agent", ArgsUsage: "<teamID> <gid|name>", Action: teamChown},
+		},
+	},
+	{
+		Name:  "op",
+		Usage: "Export, import and manage operations",
+		Subcommands: []cli.Command{
+			{Name: "export", Usage: "Write an operation as JSON to stdout", ArgsUsage: "<opID>", Action: opExport},
+			{Name: "import", Usage: "Load an operation from a JSON file (as written by export)", ArgsUsage: "<file> <owner gid|name>", Action: opImport},
+			{Name: "delete", Usage: "Delete an operation", ArgsUsage: "<opID>", Action: opDelete},
+			{Name: "chown", Usage: "Give an operation to another agent", ArgsUsage: "<opID> <gid|name>", Action: opChown},
+		},
+	},
+	{
+		Name:      "revoke-jwt",
+		Usage:     "Revoke JWTs by ID, a running server picks up the revocation within a minute",
+		ArgsUsage: "<token ID>...",
+		Action:    revokeJWT,
+	},
+	{
+		Name:  "config",
+		Usage: "Work with the config file",
+		Subcommands: []cli.Command{
+			{Name: "check", Usage: "Validate the config file without starting any services", Action: configCheck},
+		},
+	},
+}
+
+// connect loads the config and opens the database for a command
+func connect(cargs *cli.Context) error {
+	log.Start(context.Background(), &log.Configuration{
+		Console:      true,
+		ConsoleLevel: zap.WarnLevel,
+		FilePath:     cargs.GlobalString("log"),
+		FileLevel:    zap.InfoLevel,
+	})
+
+	conf, err := config.LoadFile(cargs.GlobalString("config"))
+	if err != nil {
+		return err
+	}
+	return model.Open(conf.DB)
+}
+
+// args checks a command got the number of arguments it needs
+func args(cargs *cli.Context, min int) error {
+	if cargs.NArg() < min {
+		return cli.NewExitError(fmt.Sprintf("usage: %s %s", cargs.Command.HelpName, cargs.Command.ArgsUsage), 2)
+	}
+	return nil
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// revokeSessions revokes all an agent's JWTs, a running server picks up the revocations within a minute
+func revokeSessions(gid model.GoogleID) error {
+	ids, err := gid.SessionIDs(context.Background())
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := model.RecordRevokedJWT(context.Background(), id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func agentArg(cargs *cli.Context) (model.GoogleID, error) {
+	if err := args(cargs, 1); err != nil {
+		return "", err
+	}
+	if err := connect(cargs); err != nil {
+		return "", err
+	}
+	gid, err := model.ToGid(context.Background(), cargs.Args().First())
+	if err != nil {
+		return "", cli.NewExitError(err.Error(), 1)
+	}
+	return gid, nil
+}
+
+func agentShow(cargs *cli.Context) error {
+	gid, err := agentArg(cargs)
+	if err != nil {
+		return err
+	}
+	view, err := gid.AdminView(context.Background())
+	if err != nil {
+		return err
+	}
+	model.RecordAdminAction(context.Background(), cliAdmin, model.AdminActionView, gid.String(), "")
+	return printJSON(view)
+}
+
+func agentLock(cargs *cli.Context) error {
+	gid, err := agentArg(cargs)
+	if err != nil {
+		return err
+	}
+	reason := strings.Join(cargs.Args().Tail(), " ")
+	if err := gid.Lock(context.Background(), reason); err != nil {
+		return err
+	}
+	if err := revokeSessions(gid); err != nil {
+		return err
+	}
+	model.RecordAdminAction(context.Background(), cliAdmin, model.AdminActionLock, gid.String(), reason)
+	return nil
+}
+
+func agentUnlock(cargs *cli.Context) error {
+	gid, err := agentArg(cargs)
+	if err != nil {
+		return err
+	}
+	reason := strings.Join(cargs.Args().Tail(), " ")
+	if err := gid.Unlock(context.Background(), reason); err != nil {
+		return err
+	}
+	model.RecordAdminAction(context.Background(), cliAdmin, model.AdminActionUnlock, gid.String(), reason)
+	return nil
+}
+
+func agentDelete(cargs *cli.Context) error {
+	gid, err := agentArg(cargs)
+	if err != nil {
+		return err
+	}
+	if err := revokeSessions(gid); err != nil {
+		return err
+	}
+	if err := gid.Delete(context.Background(), "", model.AuditSourceAdmin); err != nil {
+		return err
+	}
+	model.RecordAdminAction(context.Background(), cliAdmin, model.AdminActionPurge, gid.String(), "")
+	return nil
+}
+
+func teamList(cargs *cli.Context) error {
+	if err := connect(cargs); err != nil {
+		return err
+	}
+	teams, err := model.AdminTeams(context.Background())
+	if err != nil {
+		return err
+	}
+	return printJSON(teams)
+}
+
+func teamShow(cargs *cli.Context) error {
+	if err := args(cargs, 1); err != nil {
+		return err
+	}
+	if err := connect(cargs); err != nil {
+		return err
+	}
+	team := model.TeamID(cargs.Args().First())
+	if !team.Valid(context.Background()) {
+		return cli.NewExitError("team not found", 1)
+	}
+	data, err := team.FetchTeam(context.Background())
+	if err != nil {
+		return err
+	}
+	return printJSON(data)
+}
+
+func teamChown(cargs *cli.Context) error {
+	if err := args(cargs, 2); err != nil {
+		return err
+	}
+	if err := connect(cargs); err != nil {
+		return err
+	}
+	team := model.TeamID(cargs.Args().Get(0))
+	if !team.Valid(context.Background()) {
+		return cli.NewExitError("team not found", 1)
+	}
+	to, err := model.ToGid(context.Background(), cargs.Args().Get(1))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	if err := team.Chown(context.Background(), to); err != nil {
+		return err
+	}
+	model.RecordAdminAction(context.Background(), cliAdmin, model.AdminActionTeamChown, team.String(), to.String())
+	return nil
+}
+
+func opExport(cargs *cli.Context) error {
+	if err := args(cargs, 1); err != nil {
+		return err
+	}
+	if err := connect(cargs); err != nil {
+		return err
+	}
+	o := model.Operation{ID: model.OperationID(cargs.Args().First())}
+	owner, err := o.ID.Owner(context.Background())
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	// the owner sees the whole operation
+	if err := o.Populate(context.Background(), owner); err != nil {
+		return err
+	}
+	return printJSON(o)
+}
+
+func opImport(cargs *cli.Context) error {
+	if err := args(cargs, 2); err != nil {
+		return err
+	}
+	if err := connect(cargs); err != nil {
+		return err
+	}
+
+	// #nosec
+	raw, err := os.ReadFile(cargs.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	var o model.Operation
+	if err := json.Unmarshal(raw, &o); err != nil {
+		return err
+	}
+	owner, err := model.ToGid(context.Background(), cargs.Args().Get(1))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	if err := model.DrawInsert(context.Background(), &o, owner); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	model.RecordAdminAction(context.Background(), cliAdmin, model.AdminActionOpImport, string(o.ID), owner.String())
+	return nil
+}
+
+func opDelete(cargs *cli.Context) error {
+	if err := args(cargs, 1); err != nil {
+		return err
+	}
+	if err := connect(cargs); err != nil {
+		return err
+	}
+	opID := model.OperationID(cargs.Args().First())
+	if !opID.Valid(context.Background()) {
+		return cli.NewExitError(model.ErrOpNotFound, 1)
+	}
+	if err := opID.AdminDelete(context.Background(), cliAdmin); err != nil {
+		return err
+	}
+	model.RecordAdminAction(context.Background(), cliAdmin, model.AdminActionOpDelete, string(opID), "")
+	return nil
+}
+
+func opChown(cargs *cli.Context) error {
+	if err := args(cargs, 2); err != nil {
+		return err
+	}
+	if err := connect(cargs); err != nil {
+		return err
+	}
+	opID := model.OperationID(cargs.Args().Get(0))
+	if !opID.Valid(context.Background()) {
+		return cli.NewExitError(model.ErrOpNotFound, 1)
+	}
+	to, err := model.ToGid(context.Background(), cargs.Args().Get(1))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	if err := opID.SetOwner(context.Background(), to); err != nil {
+		return err
+	}
+	model.RecordAdminAction(context.Background(), cliAdmin, model.AdminActionOpChown, string(opID), to.String())
+	return nil
+}
+
+func revokeJWT(cargs *cli.Context) error {
+	if err := args(cargs, 1); err != nil {
+		return err
+	}
+	if err := connect(cargs); err != nil {
+		return err
+	}
+	for _, id := range cargs.Args() {
+		if err := model.RecordRevokedJWT(context.Background(), id); err != nil {
+			return err
+		}
+		model.RecordAdminAction(context.Background(), cliAdmin, model.AdminActionRevokeJWT, id, "")
+	}
+	return nil
+}
+
+func configCheck(cargs *cli.Context) error {
+	log.Start(context.Background(), &log.Configuration{Console: true, ConsoleLevel: zap.WarnLevel})
+
+	filename := cargs.GlobalString("config")
+	errs := config.Check(filename)
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if len(errs) > 0 {
+		return cli.NewExitError(fmt.Sprintf("%s: %d problems", filename, len(errs)), 1)
+	}
+	fmt.Printf("%s: ok\n", filename)
+	return nil
+}
@@ -22,9 +22,13 @@ import (
 	"github.com/wasabee-project/Wasabee-Server/federation"
 	"github.com/wasabee-project/Wasabee-Server/http"
 	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/metrics"
 	"github.com/wasabee-project/Wasabee-Server/model"
+	"github.com/wasabee-project/Wasabee-Server/oidc"
 	"github.com/wasabee-project/Wasabee-Server/rocks"
+	"github.com/wasabee-project/Wasabee-Server/roster"
 	"github.com/wasabee-project/Wasabee-Server/templates"
+	"github.com/wasabee-project/Wasabee-Server/tracing"
 	"github.com/wasabee-project/Wasabee-Server/util"
 	"github.com/wasabee-project/Wasabee-Server/v"
 
@@ -68,6 +72,7 @@ func main() {
 	cli.AppHelpTemplate = strings.Replace(cli.AppHelpTemplate, "GLOBAL OPTIONS:", "OPTIONS:", 1)
 
 	app.Action = run
+	app.Commands = commands
 
 	_ = app.Run(os.Args)
 }
@@ -146,6 +151,13 @@ func run(cargs *cli.Context) error {
 	// the waitgroup which must be completed before shutting down
 	var wg sync.WaitGroup
 
+	// export traces, started first so the others' spans are not dropped
+	wg.Add(1)
+	go func(ctx context.Context) {
+		defer wg.Done()
+		tracing.Start(ctx)
+	}(ctx)
+
 	// start background tasks
 	wg.Add(1)
 	go func(ctx context.Context) {
@@ -153,6 +165,13 @@ func run(cargs *cli.Context) error {
 		background.Start(ctx)
 	}(ctx)
 
+	// keep the JWT keys current: rotation, retirement and federation peers' keys
+	wg.Add(1)
+	go func(ctx context.Context) {
+		defer wg.Done()
+		config.StartJWK(ctx)
+	}(ctx)
+
 	// start authorization
 	wg.Add(1)
 	go func(ctx context.Context) {
@@ -167,6 +186,13 @@ func run(cargs *cli.Context) error {
 		wfb.Start(ctx)
 	}(ctx)
 
+	// serve /metrics on its own listener
+	wg.Add(1)
+	go func(ctx context.Context) {
+		defer wg.Done()
+		metrics.Start(ctx)
+	}(ctx)
+
 	// Serve HTTPS -- does not use the context
 	go wasabeehttps.Start()
 
@@ -204,6 +230,20 @@ func run(cargs *cli.Context) error {
 		rocks.Start(ctx)
 	}(ctx)
 
+	// start the generic roster URL provider
+	wg.Add(1)
+	go func(ctx context.Context) {
+		defer wg.Done()
+		roster.Start(ctx)
+	}(ctx)
+
+	// start the generic OpenID Connect login providers
+	wg.Add(1)
+	go func(ctx context.Context) {
+		defer wg.Done()
+		oidc.Start(ctx)
+	}(ctx)
+
 	// everything is running. Wait for the OS to signal time to stop
 	sigch := make(chan os.Signal, 1)
 	signal.Notify(sigch, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGHUP, os.Interrupt)
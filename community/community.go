@@ -48,7 +48,7 @@ const xme = "x-me"   // custom claim name for "name"
 const aud = "c2g"    // short for: community to GoogleID
 
 // Validate checks the community website for the token and makes sure the token is correct
-func Validate(gid model.GoogleID, name string) (bool, error) {
+func Validate(ctx context.Context, gid model.GoogleID, name string) (bool, error) {
 	profile, err := fetch(name)
 	if err != nil {
 		return false, err
@@ -64,7 +64,7 @@ func Validate(gid model.GoogleID, name string) (bool, error) {
 		return false, nil // nil to trigger NotAcceptable rather than InternalServerError
 	}
 
-	if err := gid.SetCommunityName(profile.Name); err != nil {
+	if err := gid.SetCommunityName(ctx, profile.Name); err != nil {
 		return false, err
 	}
 	message := fmt.Sprintf("validated community name for %s", name)
@@ -134,8 +134,8 @@ func checkJWT(raw, name string, gid model.GoogleID) error {
 }
 
 // BuildToken generates a token to be posted on the community site to verify the agent's name
-func BuildToken(gid model.GoogleID, name string) (string, error) {
-	t, err := model.CommunityNameToGID(name)
+func BuildToken(ctx context.Context, gid model.GoogleID, name string) (string, error) {
+	t, err := model.CommunityNameToGID(ctx, name)
 	if err != nil {
 		log.Error(err)
 		return "", err
@@ -151,7 +151,7 @@ func BuildToken(gid model.GoogleID, name string) (string, error) {
 		return "", err
 	}
 
-	key, ok := config.JWSigningKeys().Key(0)
+	key, ok := config.JWSigningKey()
 	if !ok {
 		err := fmt.Errorf("encryption jwk not set")
 		log.Error(err)
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+)
+
+// Check reads a config file and reports everything wrong with it, without making it the running configuration
+func Check(filename string) []error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	// #nosec
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		return []error{err}
+	}
+	in := *defaults
+	if err := json.Unmarshal(raw, &in); err != nil {
+		return []error{fmt.Errorf("%s: %w", filename, err)}
+	}
+	if o := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); o != "" {
+		in.GoogleCreds = o
+	}
+
+	if in.DB == "" {
+		fail("DB is not set")
+	}
+	exists := func(name, p string) {
+		if _, err := os.Stat(p); err != nil {
+			fail("%s: %v", name, err)
+		}
+	}
+	exists("WordListFile", in.WordListFile)
+	exists("FrontendPath", in.FrontendPath)
+	if in.GoogleCreds != "" {
+		exists("GoogleCreds", in.GoogleCreds)
+	}
+	if in.StoreRevisions {
+		exists("RevisionsDir", in.RevisionsDir)
+	}
+
+	certs, err := filepath.Abs(in.Certs)
+	if err != nil {
+		fail("Certs: %v", err)
+	}
+	if _, err := tls.LoadX509KeyPair(filepath.Join(certs, in.CertFile), filepath.Join(certs, in.CertKey)); err != nil {
+		fail("CertFile/CertKey: %v", err)
+	}
+	exists("FirebaseKey", filepath.Join(certs, in.FirebaseKey))
+	if k, err := jwk.ReadFile(filepath.Join(certs, in.JWKpriv)); err != nil {
+		fail("JWKpriv: %v", err)
+	} else if _, ok := ActiveJWK(k, time.Now()); !ok {
+		fail("JWKpriv: no active signing key")
+	}
+	if k, err := jwk.ReadFile(filepath.Join(certs, in.JWKpub)); err != nil {
+		fail("JWKpub: %v", err)
+	} else if k.Len() == 0 {
+		fail("JWKpub: no keys")
+	}
+
+	if u, err := url.Parse(in.HTTP.Webroot); err != nil || u.Scheme != "https" || u.Host == "" {
+		fail("HTTP.Webroot must be an https URL: %q", in.HTTP.Webroot)
+	}
+	if _, _, err := net.SplitHostPort(in.HTTP.ListenHTTPS); err != nil {
+		fail("HTTP.ListenHTTPS: %v", err)
+	}
+	if in.HTTP.ListenMetrics != "" {
+		if _, _, err := net.SplitHostPort(in.HTTP.ListenMetrics); err != nil {
+			fail("HTTP.ListenMetrics: %v", err)
+		}
+	}
+	if in.Tracing.Endpoint != "" {
+		if _, _, err := net.SplitHostPort(in.Tracing.Endpoint); err != nil {
+			fail("Tracing.Endpoint: %v", err)
+		}
+	}
+	if in.Tracing.SampleRatio < 0 || in.Tracing.SampleRatio > 1 {
+		fail("Tracing.SampleRatio must be between 0 and 1")
+	}
+	rl := in.HTTP.RateLimit
+	for i, b := range []wbudget{rl.IP, rl.Agent, rl.Heavy} {
+		name := []string{"IP", "Agent", "Heavy"}[i]
+		if b.Rate < 0 {
+			fail("HTTP.RateLimit.%s.Rate must not be negative", name)
+		}
+		if b.Rate > 0 && b.Burst < 1 {
+			fail("HTTP.RateLimit.%s.Burst must be at least 1", name)
+		}
+	}
+	if in.HTTP.OauthClientID == "" || in.HTTP.OauthSecret == "" {
+		fail("HTTP.OauthClientID and HTTP.OauthSecret are required")
+	}
+
+	for _, p := range in.Peers {
+		host, port, err := net.SplitHostPort(p)
+		if err != nil {
+			fail("Peers: %v", err)
+			continue
+		}
+		if n, err := strconv.ParseUint(port, 10, 16); err != nil || n == 0 || host == "" {
+			fail("Peers: %q is not host:port", p)
+		}
+	}
+
+	for _, u := range in.PeerJKUs {
+		if p, err := url.Parse(u); err != nil || p.Scheme != "https" || p.Host == "" {
+			fail("PeerJKUs: %q is not an https URL", u)
+		}
+	}
+
+	for _, a := range in.Admins {
+		if len(a) != 21 {
+			fail("Admins: %q is not a GoogleID", a)
+		}
+	}
+
+	names := make(map[string]bool)
+	for _, o := range in.OIDC {
+		if o.Name == "" || o.Issuer == "" || o.ClientID == "" {
+			fail("OIDC: provider %q requires Name, Issuer and ClientID", o.Name)
+		}
+		if names[o.Name] {
+			fail("OIDC: provider %q configured twice", o.Name)
+		}
+		names[o.Name] = true
+	}
+
+	return errs
+}
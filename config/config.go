@@ -4,14 +4,12 @@ import (
 	// "context"
 	"encoding/json"
 	"os"
-	"path"
 	"path/filepath"
 	"sync"
 
 	"golang.org/x/oauth2"
 
 	"github.com/gorilla/mux"
-	"github.com/lestrrat-go/jwx/v2/jwk"
 
 	"github.com/wasabee-project/Wasabee-Server/log"
 )
@@ -20,10 +18,9 @@ import (
 type WasabeeConf struct {
 	HTTP whttp
 
-	// loaded by LoadFile()
-	jwSigningKeys jwk.Set
-	jwParsingKeys jwk.Set
-	Apple         apple
+	Apple apple
+	// generic OpenID Connect login providers
+	OIDC []OIDCProvider
 
 	RISC              wrisc
 	GoogleCreds       string // path to file.json
@@ -47,7 +44,10 @@ type WasabeeConf struct {
 	V              wv
 	Rocks          wrocks
 	Peers          []string // hostname/ip of servers to update
+	Admins         []string // GoogleIDs of server administrators
+	PeerJKUs       []string // URLs of federation peers' published JWK sets, refreshed so their rotated keys are accepted
 	Telegram       wtg
+	Tracing        wtracing
 	GRPCPort       uint16 // Port on which to send and receive gRPC messages
 	StoreRevisions bool   // keep a copy of each upload
 
@@ -74,6 +74,13 @@ type wtg struct {
 	running        bool
 }
 
+// Configure OpenTelemetry tracing
+type wtracing struct {
+	Endpoint    string  // OTLP gRPC collector, "localhost:4317", empty disables
+	Insecure    bool    // plain gRPC, for a collector on the same host
+	SampleRatio float64 // fraction of new traces recorded, use default (1)
+}
+
 // Configure Google RISC
 type wrisc struct {
 	Cert      string // filename to cert.json
@@ -98,6 +105,9 @@ type whttp struct {
 	Logfile     string // https logs
 	SessionName string // JWT aud name
 
+	// plain HTTP /metrics for Prometheus, on a private address: "127.0.0.1:9100", empty disables
+	ListenMetrics string
+
 	// defined by Google
 	OauthClientID    string // required
 	OauthSecret      string // required
@@ -112,6 +122,34 @@ type whttp struct {
 
 	CORS []string // list of sites for which browsers will make API request
 
+	RateLimit wratelimit
+}
+
+// Configure the API rate limits
+type wratelimit struct {
+	IP    wbudget // every request, per client address
+	Agent wbudget // API requests, per agent
+	Heavy wbudget // op uploads and bulk imports, per agent, instead of the Agent budget
+}
+
+// a token bucket: Rate requests per second sustained, up to Burst at once; a zero Rate disables the limit
+type wbudget struct {
+	Rate  float64
+	Burst int
+}
+
+// OIDCProvider configures a generic OpenID Connect identity provider, e.g. a community's own SSO
+type OIDCProvider struct {
+	Name         string // used in the login URLs: /oidc/{name}/login
+	Issuer       string // discovery is at Issuer + "/.well-known/openid-configuration"
+	ClientID     string // from the identity provider
+	ClientSecret string // from the identity provider
+	RedirectURL  string // use default: Webroot + "/oidc/{name}/callback"
+	Scopes       []string
+	SubjectClaim string // use default: "sub"
+	NameClaim    string // use default: "preferred_username"
+	PictureClaim string // use default: "picture"
+	CreateAgents bool   // create agents for subjects not yet linked to an agent
 }
 
 type apple struct {
@@ -219,6 +257,16 @@ func IsTelegramRunning() bool {
 	return c.Telegram.running
 }
 
+// IsAdmin reports if a GoogleID is configured as a server administrator
+func IsAdmin(gid string) bool {
+	for _, a := range c.Admins {
+		if a == gid {
+			return true
+		}
+	}
+	return false
+}
+
 // TelegramBotName returns the name of the running telegram bot
 func TelegramBotName() string {
 	return c.Telegram.name
@@ -229,31 +277,6 @@ func TelegramBotID() int {
 	return c.Telegram.id
 }
 
-// setupJWK loads the keys used for the JWK signing and verification, set the file paths
-func setupJWK(certdir, signers, parsers string) error {
-	var err error
-	c.jwSigningKeys, err = jwk.ReadFile(path.Join(certdir, signers))
-	if err != nil {
-		log.Error(err)
-		return err
-	}
-	log.Debugw("loaded JWT signing keys", "count", c.jwSigningKeys.Len(), "path", signers)
-
-	/* for iter := c.jwSigningKeys.Iterate(context.TODO()); iter.Next(context.TODO()); {
-		x := iter.Pair()
-		log.Debugw("jwk signer", "key", x)
-	} */
-
-	c.jwParsingKeys, err = jwk.ReadFile(path.Join(certdir, parsers))
-	if err != nil {
-		log.Error(err)
-		return err
-	}
-	log.Debugw("loaded JWT parsing keys", "count", c.jwParsingKeys.Len(), "path", parsers)
-
-	return nil
-}
-
 // SetVRunning sets the current running state of V integration
 func SetVRunning(v bool) {
 	c.V.running = v
@@ -274,16 +297,6 @@ func IsRocksRunning() bool {
 	return c.Rocks.running
 }
 
-// JWParsingKeys returns the public keys uses to verify the JWT
-func JWParsingKeys() jwk.Set {
-	return c.jwParsingKeys
-}
-
-// JWSigningKeys returns the private keys used to sign the JWT
-func JWSigningKeys() jwk.Set {
-	return c.jwSigningKeys
-}
-
 // GetWebroot is used by telegram templates
 func GetWebroot() string {
 	return c.HTTP.Webroot
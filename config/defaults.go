@@ -30,6 +30,9 @@ var defaults *WasabeeConf = &WasabeeConf{
 		StatusEndpoint: "https://status.enl.one/api/location",
 		TeamEndpoint:   "https://v.enl.one/api/v2/teams",
 	},
+	Tracing: wtracing{
+		SampleRatio: 1,
+	},
 	RISC: wrisc{
 		Cert:      "risc.json",
 		Webhook:   "/GoogleRISC",
@@ -51,6 +54,11 @@ var defaults *WasabeeConf = &WasabeeConf{
 		OauthAuthURL:     google.Endpoint.AuthURL,
 		OauthTokenURL:    google.Endpoint.TokenURL,
 		CORS:             []string{"https://intel.ingress.com", "https://wasabee-project.github.io", "https://cdn2.wasabee.rocks", "https://webui.wasabee.rocks"},
+		RateLimit: wratelimit{
+			IP:    wbudget{Rate: 20, Burst: 200}, // carriers put many agents behind one address
+			Agent: wbudget{Rate: 5, Burst: 120},
+			Heavy: wbudget{Rate: 0.1, Burst: 5},
+		},
 	},
 	Telegram: wtg{
 		HookPath: "/tg",
@@ -0,0 +1,211 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+)
+
+// JWKActivatesKey is the JWK parameter holding the unix time a key starts signing JWTs, keys without it are active from the start
+const JWKActivatesKey = "activates"
+
+// JWKRetireAfter is how long a key is still accepted once a newer key is signing: a day past the longest a JWT can live
+const JWKRetireAfter = 8 * 24 * time.Hour
+
+// how often the key files are re-read and peers' published keys are re-fetched
+const (
+	jwkReloadInterval      = time.Minute
+	jwkPeerRefreshInterval = 15 * time.Minute
+)
+
+var jwks struct {
+	sync.RWMutex
+	signing  jwk.Set // all our private keys, including the next key
+	parsing  jwk.Set // the public keys currently accepted, ours and our peers'
+	public   jwk.Set // our public keys currently accepted, as published
+	privPath string
+	pubPath  string
+	peers    *jwk.Cache
+}
+
+// setupJWK loads the keys used for the JWK signing and verification, set the file paths
+func setupJWK(certdir, signers, parsers string) error {
+	jwks.privPath = path.Join(certdir, signers)
+	jwks.pubPath = path.Join(certdir, parsers)
+	return loadJWK(context.Background())
+}
+
+// loadJWK (re)reads the key files and rebuilds the set of accepted keys, the running keys are kept on error
+func loadJWK(ctx context.Context) error {
+	now := time.Now()
+
+	signing, err := jwk.ReadFile(jwks.privPath)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	if _, ok := ActiveJWK(signing, now); !ok {
+		err := fmt.Errorf("no active JWT signing key in %s", jwks.privPath)
+		log.Error(err)
+		return err
+	}
+
+	pub, err := jwk.ReadFile(jwks.pubPath)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	public := LiveJWK(pub, now)
+	parsing := LiveJWK(pub, now)
+
+	jwks.RLock()
+	peers := jwks.peers
+	jwks.RUnlock()
+	if peers != nil {
+		for _, u := range c.PeerJKUs {
+			set, err := peers.Get(ctx, u)
+			if err != nil {
+				log.Warnw("peer JWK set unavailable", "url", u, "error", err.Error())
+				continue
+			}
+			live := LiveJWK(set, now)
+			for i := 0; i < live.Len(); i++ {
+				k, _ := live.Key(i)
+				_ = parsing.AddKey(k)
+			}
+		}
+	}
+
+	jwks.Lock()
+	jwks.signing = signing
+	jwks.parsing = parsing
+	jwks.public = public
+	jwks.Unlock()
+	log.Debugw("loaded JWT keys", "signing", signing.Len(), "parsing", parsing.Len())
+	return nil
+}
+
+// StartJWK keeps the JWT keys current: re-reading the key files, retiring old keys and fetching peers' rotated keys
+func StartJWK(ctx context.Context) {
+	if len(c.PeerJKUs) > 0 {
+		cache := jwk.NewCache(ctx)
+		for _, u := range c.PeerJKUs {
+			if err := cache.Register(u, jwk.WithMinRefreshInterval(jwkPeerRefreshInterval)); err != nil {
+				log.Errorw(err.Error(), "url", u)
+			}
+		}
+		jwks.Lock()
+		jwks.peers = cache
+		jwks.Unlock()
+		_ = loadJWK(ctx)
+	}
+
+	ticker := time.NewTicker(jwkReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Infow("shutdown", "message", "JWK refresh shutting down")
+			return
+		case <-ticker.C:
+			_ = loadJWK(ctx)
+		}
+	}
+}
+
+// JWParsingKeys returns the public keys used to verify JWTs, ours (including the next key) and our peers'
+func JWParsingKeys() jwk.Set {
+	jwks.RLock()
+	defer jwks.RUnlock()
+	return jwks.parsing
+}
+
+// JWPublicKeys returns our public keys which are not retired, including the next key, for publishing at the JKU
+func JWPublicKeys() jwk.Set {
+	jwks.RLock()
+	defer jwks.RUnlock()
+	return jwks.public
+}
+
+// JWSigningKeys returns all our private keys, including the next key
+func JWSigningKeys() jwk.Set {
+	jwks.RLock()
+	defer jwks.RUnlock()
+	return jwks.signing
+}
+
+// JWSigningKey returns the private key which signs JWTs now
+func JWSigningKey() (jwk.Key, bool) {
+	return ActiveJWK(JWSigningKeys(), time.Now())
+}
+
+// jwkActivates reads the time a key starts signing
+func jwkActivates(k jwk.Key) int64 {
+	v, ok := k.Get(JWKActivatesKey)
+	if !ok {
+		return 0
+	}
+	switch a := v.(type) {
+	case float64:
+		return int64(a)
+	case int64:
+		return a
+	case int:
+		return int64(a)
+	case json.Number:
+		n, _ := a.Int64()
+		return n
+	}
+	return 0
+}
+
+// ActiveJWK returns the most recently activated key in the set, the one which signs JWTs at now
+func ActiveJWK(set jwk.Set, now time.Time) (jwk.Key, bool) {
+	var active jwk.Key
+	var activated int64
+
+	for i := 0; i < set.Len(); i++ {
+		k, _ := set.Key(i)
+		a := jwkActivates(k)
+		if a > now.Unix() {
+			continue // the next key
+		}
+		if active == nil || a >= activated {
+			active = k
+			activated = a
+		}
+	}
+	return active, active != nil
+}
+
+// LiveJWK returns the keys in the set which are not retired at now
+// a key retires JWKRetireAfter after a newer key starts signing, by then every JWT it signed has expired
+func LiveJWK(set jwk.Set, now time.Time) jwk.Set {
+	live := jwk.NewSet()
+	cutoff := now.Add(-JWKRetireAfter).Unix()
+
+	for i := 0; i < set.Len(); i++ {
+		k, _ := set.Key(i)
+		a := jwkActivates(k)
+		retired := false
+		for j := 0; j < set.Len(); j++ {
+			o, _ := set.Key(j)
+			if oa := jwkActivates(o); oa > a && oa <= cutoff {
+				retired = true
+				break
+			}
+		}
+		if !retired {
+			_ = live.AddKey(k)
+		}
+	}
+	return live
+}
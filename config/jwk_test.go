@@ -0,0 +1,78 @@
+package config
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+)
+
+func testKey(t *testing.T, kid string, activates time.Time) jwk.Key {
+	raw, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := jwk.FromRaw(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = k.Set(jwk.KeyIDKey, kid)
+	if !activates.IsZero() {
+		_ = k.Set(JWKActivatesKey, activates.Unix())
+	}
+	return k
+}
+
+func TestRotation(t *testing.T) {
+	now := time.Now()
+	set := jwk.NewSet()
+	_ = set.AddKey(testKey(t, "old", time.Time{}))
+	_ = set.AddKey(testKey(t, "next", now.Add(time.Hour)))
+
+	// the next key is published but does not sign until it activates
+	if k, _ := ActiveJWK(set, now); k.KeyID() != "old" {
+		t.Errorf("signing with %s before the next key activates", k.KeyID())
+	}
+	if k, _ := ActiveJWK(set, now.Add(2*time.Hour)); k.KeyID() != "next" {
+		t.Errorf("signing with %s after the next key activates", k.KeyID())
+	}
+	if LiveJWK(set, now).Len() != 2 {
+		t.Error("next key not accepted for parsing")
+	}
+
+	// the old key is accepted until every JWT it signed has expired
+	if LiveJWK(set, now.Add(JWKRetireAfter)).Len() != 2 {
+		t.Error("old key retired too soon")
+	}
+	live := LiveJWK(set, now.Add(time.Hour+JWKRetireAfter+time.Minute))
+	if _, ok := live.LookupKeyID("old"); ok || live.Len() != 1 {
+		t.Error("old key not retired")
+	}
+}
+
+func TestActiveJWKRoundTrip(t *testing.T) {
+	// activation times read back from JSON are float64
+	set := jwk.NewSet()
+	_ = set.AddKey(testKey(t, "a", time.Now().Add(-time.Hour)))
+	buf, err := jwk.PublicSetOf(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := json.Marshal(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := jwk.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ActiveJWK(parsed, time.Now()); !ok {
+		t.Error("no active key after a round trip")
+	}
+	if _, ok := ActiveJWK(parsed, time.Now().Add(-2*time.Hour)); ok {
+		t.Error("key active before its activation time")
+	}
+}
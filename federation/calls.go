@@ -16,10 +16,10 @@ func (w *wafed) SetCommunityID(ctx context.Context, in *pb.CommunityID) (*pb.Err
 
 	gid := model.GoogleID(in.Googleid)
 
-	err := gid.SetCommunityName(in.Communityname)
+	err := gid.SetCommunityName(ctx, in.Communityname)
 	if err != nil && strings.Contains(err.Error(), "Error 1452") {
-		_ = gid.FirstLogin()
-		err = gid.SetCommunityName(in.Communityname)
+		_ = gid.FirstLogin(ctx)
+		err = gid.SetCommunityName(ctx, in.Communityname)
 	}
 	if err != nil && !strings.Contains(err.Error(), "Error 1452") {
 		log.Error(err)
@@ -39,10 +39,10 @@ func (w *wafed) SetAgentLocation(ctx context.Context, in *pb.AgentLocation) (*pb
 	lat := strconv.FormatFloat(float64(in.Lat), 'f', 7, 32)
 	lng := strconv.FormatFloat(float64(in.Lng), 'f', 7, 32)
 
-	err := gid.SetLocation(lat, lng)
+	err := gid.SetLocation(ctx, lat, lng)
 	if err != nil && strings.Contains(err.Error(), "Error 1452") {
-		_ = gid.FirstLogin()
-		err = gid.SetLocation(lat, lng)
+		_ = gid.FirstLogin(ctx)
+		err = gid.SetLocation(ctx, lat, lng)
 	}
 	if err != nil && !strings.Contains(err.Error(), "Error 1452") {
 		log.Error(err)
@@ -59,10 +59,10 @@ func (w *wafed) SetIntelData(ctx context.Context, in *pb.IntelData) (*pb.Error,
 
 	gid := model.GoogleID(in.Googleid)
 
-	err := gid.SetIntelData(in.Name, in.Faction)
+	err := gid.SetIntelData(ctx, in.Name, in.Faction)
 	if err != nil && strings.Contains(err.Error(), "Error 1452") {
-		_ = gid.FirstLogin()
-		err = gid.SetIntelData(in.Name, in.Faction)
+		_ = gid.FirstLogin(ctx)
+		err = gid.SetIntelData(ctx, in.Name, in.Faction)
 	}
 	if err != nil && !strings.Contains(err.Error(), "Error 1452") {
 		log.Error(err)
@@ -79,10 +79,10 @@ func (w *wafed) AddFirebaseToken(ctx context.Context, in *pb.FBData) (*pb.Error,
 
 	gid := model.GoogleID(in.Googleid)
 
-	err := gid.StoreFirebaseToken(in.Token)
+	err := gid.StoreFirebaseToken(ctx, in.Token)
 	if err != nil && strings.Contains(err.Error(), "Error 1452") {
-		_ = gid.FirstLogin()
-		err = gid.StoreFirebaseToken(in.Token)
+		_ = gid.FirstLogin(ctx)
+		err = gid.StoreFirebaseToken(ctx, in.Token)
 	}
 	if err != nil && !strings.Contains(err.Error(), "Error 1452") {
 		log.Error(err)
@@ -97,7 +97,7 @@ func (w *wafed) AddFirebaseToken(ctx context.Context, in *pb.FBData) (*pb.Error,
 func (w *wafed) RevokeJWT(ctx context.Context, in *pb.Token) (*pb.Error, error) {
 	var e pb.Error
 
-	auth.RevokeJWT(in.Tokenid)
+	auth.RevokeJWT(ctx, in.Tokenid)
 
 	e.Message = "ok"
 	return &e, nil
@@ -108,7 +108,7 @@ func (w *wafed) SetTelegramID(ctx context.Context, in *pb.TelegramID) (*pb.Error
 
 	gid := model.GoogleID(in.Googleid)
 
-	if err := gid.SetTelegramID(model.TelegramID(in.Telegramid), in.Name); err != nil {
+	if err := gid.SetTelegramID(ctx, model.TelegramID(in.Telegramid), in.Name); err != nil {
 		log.Error(err)
 		e.Message = err.Error()
 		return &e, err
@@ -7,13 +7,16 @@ import (
 	"net"
 	"path"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/lestrrat-go/jwx/v2/jwt"
 	// "github.com/lestrrat-go/jwx/v2/jws"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/oauth"
 	"google.golang.org/grpc/metadata"
@@ -34,6 +37,7 @@ var (
 )
 
 var peers []pb.WasabeeFederationClient
+var peerConns []*grpc.ClientConn
 
 func Start(ctx context.Context) {
 	c := config.Get()
@@ -54,7 +58,8 @@ func Start(ctx context.Context) {
 	}
 
 	s := grpc.NewServer(
-		grpc.UnaryInterceptor(ensureValidToken),
+		grpc.ChainUnaryInterceptor(serverMetrics, ensureValidToken),
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
 		grpc.Creds(credentials.NewServerTLSFromCert(&cert)),
 	)
 	pb.RegisterWasabeeFederationServer(s, &wafed{})
@@ -85,6 +90,8 @@ func Start(ctx context.Context) {
 			p,
 			grpc.WithPerRPCCredentials(perRPC),
 			grpc.WithTransportCredentials(clientcreds),
+			grpc.WithUnaryInterceptor(clientMetrics),
+			grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
 		)
 		if err != nil {
 			log.Info(err)
@@ -94,12 +101,51 @@ func Start(ctx context.Context) {
 
 		c := pb.NewWasabeeFederationClient(conn)
 		peers = append(peers, c)
+		peerConns = append(peerConns, conn)
 	}
 
 	<-ctx.Done()
 	log.Infow("shutdown", "message", "stopping gRPC listener")
 }
 
+// PeerStates reports the gRPC connection state of each peer, keyed by address
+// connections are made lazily, so idle peers are asked to connect and given until ctx is done to get there
+func PeerStates(ctx context.Context) map[string]string {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	states := make(map[string]string)
+
+	for i, conn := range peerConns {
+		p := config.Get().Peers[i]
+		if conn == nil {
+			states[p] = "UNAVAILABLE"
+			continue
+		}
+
+		wg.Add(1)
+		go func(p string, conn *grpc.ClientConn) {
+			defer wg.Done()
+
+			state := conn.GetState()
+			if state == connectivity.Idle {
+				conn.Connect()
+			}
+			for state == connectivity.Idle || state == connectivity.Connecting {
+				if !conn.WaitForStateChange(ctx, state) {
+					break
+				}
+				state = conn.GetState()
+			}
+
+			mu.Lock()
+			states[p] = state.String()
+			mu.Unlock()
+		}(p, conn)
+	}
+	wg.Wait()
+	return states
+}
+
 func ensureValidToken(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
@@ -0,0 +1,33 @@
+package federation
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	rpcSent     = promauto.NewCounterVec(prometheus.CounterOpts{Name: "wasabee_federation_sent_total", Help: "Federation RPCs sent to peers, by peer, method and gRPC status code."}, []string{"peer", "method", "code"})
+	rpcSentTime = promauto.NewHistogramVec(prometheus.HistogramOpts{Name: "wasabee_federation_sent_duration_seconds", Help: "Federation RPC latency to peers."}, []string{"peer"})
+	rpcReceived = promauto.NewCounterVec(prometheus.CounterOpts{Name: "wasabee_federation_received_total", Help: "Federation RPCs received from peers, by method and gRPC status code."}, []string{"method", "code"})
+)
+
+// clientMetrics counts the results of the calls made to each peer
+func clientMetrics(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	start := time.Now()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	rpcSent.WithLabelValues(cc.Target(), method, status.Code(err).String()).Inc()
+	rpcSentTime.WithLabelValues(cc.Target()).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// serverMetrics counts the results of the calls made by peers, including those rejected by ensureValidToken
+func serverMetrics(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	res, err := handler(ctx, req)
+	rpcReceived.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+	return res, err
+}
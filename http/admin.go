@@ -0,0 +1,380 @@
+package wasabeehttps
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wasabee-project/Wasabee-Server/auth"
+	"github.com/wasabee-project/Wasabee-Server/config"
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/messaging"
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+// adminMW limits the admin routes to configured administrators using a full login, never an API token or scoped JWT
+func adminMW(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		gid, err := getAgentID(req)
+		if err != nil {
+			http.Error(res, jsonError(err), http.StatusUnauthorized)
+			return
+		}
+
+		if !config.IsAdmin(gid.String()) || requestScope(req) != nil || req.Context().Value("X-Wasabee-APIToken") != nil {
+			err := fmt.Errorf("forbidden: server administrators only")
+			log.Warnw(err.Error(), "GID", gid, "path", req.URL.Path)
+			http.Error(res, jsonError(err), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(res, req)
+	})
+}
+
+// adminSearchAgentsRoute finds agents by GoogleID or name
+func adminSearchAgentsRoute(res http.ResponseWriter, req *http.Request) {
+	q := req.FormValue("q")
+	if q == "" {
+		http.Error(res, jsonStatusEmpty, http.StatusNotAcceptable)
+		return
+	}
+
+	agents, err := model.SearchAgents(req.Context(), q)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(res).Encode(agents)
+}
+
+// adminAgentRoute shows everything about an agent
+func adminAgentRoute(res http.ResponseWriter, req *http.Request) {
+	admin, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	target := model.GoogleID(mux.Vars(req)["gid"])
+	view, err := target.AdminView(req.Context())
+	if err != nil && err != sql.ErrNoRows {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	if err == sql.ErrNoRows {
+		err := fmt.Errorf(model.ErrUnknownUser)
+		log.Warnw(err.Error(), "GID", admin, "target", target)
+		http.Error(res, jsonError(err), http.StatusNotFound)
+		return
+	}
+	model.RecordAdminAction(req.Context(), admin, model.AdminActionView, target.String(), "")
+	json.NewEncoder(res).Encode(view)
+}
+
+// adminLockRoute locks an agent's account and ends all their sessions
+func adminLockRoute(res http.ResponseWriter, req *http.Request) {
+	admin, target, ok := adminTarget(res, req)
+	if !ok {
+		return
+	}
+
+	reason := req.FormValue("reason")
+	if err := target.Lock(req.Context(), reason); err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	auth.Logout(target, reason)
+	if _, err := revokeSessions(req.Context(), target, ""); err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	model.RecordAdminAction(req.Context(), admin, model.AdminActionLock, target.String(), reason)
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+// adminUnlockRoute unlocks an agent's account
+func adminUnlockRoute(res http.ResponseWriter, req *http.Request) {
+	admin, target, ok := adminTarget(res, req)
+	if !ok {
+		return
+	}
+
+	reason := req.FormValue("reason")
+	if err := target.Unlock(req.Context(), reason); err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	model.RecordAdminAction(req.Context(), admin, model.AdminActionUnlock, target.String(), reason)
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+// adminLogoutRoute ends all an agent's sessions
+func adminLogoutRoute(res http.ResponseWriter, req *http.Request) {
+	admin, target, ok := adminTarget(res, req)
+	if !ok {
+		return
+	}
+
+	count, err := revokeSessions(req.Context(), target, "")
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	auth.Logout(target, "admin requested")
+	model.RecordAdminAction(req.Context(), admin, model.AdminActionLogout, target.String(), fmt.Sprintf("%d sessions", count))
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+// adminPurgeRoute deletes an agent and everything they own
+func adminPurgeRoute(res http.ResponseWriter, req *http.Request) {
+	admin, target, ok := adminTarget(res, req)
+	if !ok {
+		return
+	}
+
+	if _, err := revokeSessions(req.Context(), target, ""); err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	if err := target.Delete(req.Context(), admin, model.AuditSourceAdmin); err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	model.RecordAdminAction(req.Context(), admin, model.AdminActionPurge, target.String(), req.FormValue("reason"))
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+// adminUnlinkTelegramRoute removes an agent's Telegram account
+func adminUnlinkTelegramRoute(res http.ResponseWriter, req *http.Request) {
+	admin, target, ok := adminTarget(res, req)
+	if !ok {
+		return
+	}
+
+	tgid, _ := target.TelegramID(req.Context())
+	if err := target.RemoveTelegramID(req.Context()); err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	model.RecordAdminAction(req.Context(), admin, model.AdminActionTelegram, target.String(), tgid.String())
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+// adminTarget reads the administrator and the agent the request is about
+func adminTarget(res http.ResponseWriter, req *http.Request) (model.GoogleID, model.GoogleID, bool) {
+	admin, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return "", "", false
+	}
+
+	target := model.GoogleID(mux.Vars(req)["gid"])
+	if !target.Valid(req.Context()) {
+		err := fmt.Errorf(model.ErrUnknownUser)
+		log.Warnw(err.Error(), "GID", admin, "target", target)
+		http.Error(res, jsonError(err), http.StatusNotFound)
+		return "", "", false
+	}
+	return admin, target, true
+}
+
+// adminNewOwner reads the new owner of an operation or team from the form
+func adminNewOwner(res http.ResponseWriter, req *http.Request, admin model.GoogleID) (model.GoogleID, bool) {
+	to, err := model.ToGid(req.Context(), req.FormValue("to"))
+	if err != nil || !to.Valid(req.Context()) {
+		err := fmt.Errorf(model.ErrUnknownUser)
+		log.Warnw(err.Error(), "GID", admin, "to", req.FormValue("to"))
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return "", false
+	}
+	return to, true
+}
+
+// adminOpChownRoute gives an operation to another agent
+func adminOpChownRoute(res http.ResponseWriter, req *http.Request) {
+	admin, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	opID := model.OperationID(mux.Vars(req)["opID"])
+	to, ok := adminNewOwner(res, req, admin)
+	if !ok {
+		return
+	}
+
+	if err := opID.SetOwner(req.Context(), to); err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	model.RecordAdminAction(req.Context(), admin, model.AdminActionOpChown, string(opID), to.String())
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+// adminOpDeleteRoute deletes an operation
+func adminOpDeleteRoute(res http.ResponseWriter, req *http.Request) {
+	admin, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	opID := model.OperationID(mux.Vars(req)["opID"])
+	if err := opID.AdminDelete(req.Context(), admin); err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	messaging.DeleteOperation(req.Context(), messaging.OperationID(opID)) // announces to EVERYONE to delete it
+	model.RecordAdminAction(req.Context(), admin, model.AdminActionOpDelete, string(opID), req.FormValue("reason"))
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+// adminTeamChownRoute gives a team to another agent
+func adminTeamChownRoute(res http.ResponseWriter, req *http.Request) {
+	admin, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	team := model.TeamID(mux.Vars(req)["team"])
+	to, ok := adminNewOwner(res, req, admin)
+	if !ok {
+		return
+	}
+
+	if err := team.Chown(req.Context(), to); err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	model.RecordAdminAction(req.Context(), admin, model.AdminActionTeamChown, team.String(), to.String())
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+// adminTeamDeleteRoute deletes a team
+func adminTeamDeleteRoute(res http.ResponseWriter, req *http.Request) {
+	admin, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	team := model.TeamID(mux.Vars(req)["team"])
+	if err := team.Delete(req.Context()); err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	model.RecordAdminAction(req.Context(), admin, model.AdminActionTeamDelete, team.String(), req.FormValue("reason"))
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+// adminRISCRoute lists the locked agents
+func adminRISCRoute(res http.ResponseWriter, req *http.Request) {
+	agents, err := model.RISCLockedAgents(req.Context())
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(res).Encode(agents)
+}
+
+// adminAuditRoute shows the administrator audit log, optionally only for one target
+func adminAuditRoute(res http.ResponseWriter, req *http.Request) {
+	actions, err := model.AdminAuditLog(req.Context(), req.FormValue("target"))
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(res).Encode(actions)
+}
+
+// adminBlocklistRoute lists the addresses and agents blocked from the server
+func adminBlocklistRoute(res http.ResponseWriter, req *http.Request) {
+	list, err := model.Blocklist(req.Context())
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(res).Encode(list)
+}
+
+// adminBlockRoute blocks an IP address or an agent, for some hours or until unblocked
+func adminBlockRoute(res http.ResponseWriter, req *http.Request) {
+	admin, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	target, err := blockTarget(req.Context(), req.FormValue("target"))
+	if err != nil {
+		log.Warnw(err.Error(), "GID", admin, "target", req.FormValue("target"))
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+	if config.IsAdmin(target) {
+		err := fmt.Errorf("server administrators cannot be blocked")
+		log.Warnw(err.Error(), "GID", admin, "target", target)
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+
+	var d time.Duration
+	if h := req.FormValue("hours"); h != "" {
+		hours, err := strconv.ParseFloat(h, 64)
+		if err != nil || hours < 0 {
+			err := fmt.Errorf("hours must be a positive number")
+			http.Error(res, jsonError(err), http.StatusNotAcceptable)
+			return
+		}
+		d = time.Duration(hours * float64(time.Hour))
+	}
+
+	reason := req.FormValue("reason")
+	if err := model.Block(req.Context(), target, reason, admin, d); err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	reloadBlocklist()
+	model.RecordAdminAction(req.Context(), admin, model.AdminActionBlock, target, reason)
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+// adminUnblockRoute lifts a block
+func adminUnblockRoute(res http.ResponseWriter, req *http.Request) {
+	admin, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	target := mux.Vars(req)["target"]
+	if err := model.Unblock(req.Context(), target); err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	reloadBlocklist()
+	model.RecordAdminAction(req.Context(), admin, model.AdminActionUnblock, target, req.FormValue("reason"))
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+// blockTarget normalizes what an administrator asked to block: an IP address, or an agent by GoogleID or name
+func blockTarget(ctx context.Context, in string) (string, error) {
+	if ip := net.ParseIP(in); ip != nil {
+		return ip.String(), nil
+	}
+
+	gid, err := model.ToGid(ctx, in)
+	if err != nil || !gid.Valid(ctx) {
+		return "", fmt.Errorf("target must be an IP address or a known agent")
+	}
+	return gid.String(), nil
+}
@@ -22,12 +22,12 @@ func agentProfileRoute(res http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	id := vars["id"]
 
-	togid, err := model.ToGid(id)
+	togid, err := model.ToGid(req.Context(), id)
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
-	agent, err := model.FetchAgent(togid, gid)
+	agent, err := model.FetchAgent(req.Context(), togid, gid)
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
@@ -46,7 +46,7 @@ func agentMessageRoute(res http.ResponseWriter, req *http.Request) {
 
 	vars := mux.Vars(req)
 	id := vars["id"]
-	togid, err := model.ToGid(id)
+	togid, err := model.ToGid(req.Context(), id)
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
@@ -57,7 +57,7 @@ func agentMessageRoute(res http.ResponseWriter, req *http.Request) {
 		message = "This is a toast notification"
 	}
 
-	ok, err := messaging.SendMessage(messaging.GoogleID(togid), message)
+	ok, err := messaging.SendMessage(req.Context(), messaging.GoogleID(togid), message)
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
@@ -87,7 +87,7 @@ func agentTargetRoute(res http.ResponseWriter, req *http.Request) {
 
 	vars := mux.Vars(req)
 	id := vars["id"]
-	togid, err := model.ToGid(id)
+	togid, err := model.ToGid(req.Context(), id)
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
@@ -99,13 +99,13 @@ func agentTargetRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	target.Sender, err = gid.IngressName()
+	target.Sender, err = gid.IngressName(req.Context())
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
 
-	err = messaging.SendTarget(messaging.GoogleID(togid), target)
+	err = messaging.SendTarget(req.Context(), messaging.GoogleID(togid), target)
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
@@ -120,12 +120,12 @@ func agentPictureRoute(res http.ResponseWriter, req *http.Request) {
 	}
 
 	vars := mux.Vars(req)
-	togid, err := model.ToGid(vars["id"])
+	togid, err := model.ToGid(req.Context(), vars["id"])
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusNotFound)
 		return
 	}
 
-	url := togid.GetPicture()
+	url := togid.GetPicture(req.Context())
 	http.Redirect(res, req, url, http.StatusPermanentRedirect)
 }
@@ -0,0 +1,219 @@
+package wasabeehttps
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wasabee-project/Wasabee-Server/auth"
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+// routes which can only be used with an unlimited JWT from a login, never with an API token or a scoped JWT
+var sessionOnlyRoutes = map[string]bool{
+	"/me/tokens":        true,
+	"/me/tokens/{id}":   true,
+	"/me/sessions":      true,
+	"/me/sessions/{id}": true,
+	"/me/delete":        true,
+	"/me/logout":        true,
+
+	"/me/identities":                       true,
+	"/me/identities/apple":                 true,
+	"/me/identities/telegram":              true,
+	"/me/identities/oidc/{provider}":       true,
+	"/me/identities/oidc/{provider}/start": true,
+	"/me/identities/{provider}":            true,
+	"/me/merge":                            true,
+}
+
+// the v1 GET routes which only read, anything else requested with GET (the deprecated routes which make changes) needs write access
+// new routes are treated as making changes until they are listed here
+var readGETRoutes = map[string]bool{
+	"/draw/{opID}":                 true,
+	"/draw/{opID}/link/{link}":     true,
+	"/draw/{opID}/marker/{marker}": true,
+	"/draw/{opID}/task/{taskID}":   true,
+	"/me":                          true, // unless setting the location, see readRequest
+	"/me/jwtrefresh":               true,
+	"/agent/{id}":                  true,
+	"/agent/{id}/image":            true,
+	"/team/{team}":                 true,
+	"/team/{team}/audit":           true,
+	"/d":                           true,
+	"/loc":                         true,
+
+	"/team/{team}/{provider:v|rocks|url}/preview": true,
+}
+
+// how long an agent authorized to use an API token stays authorized before the V and .rocks checks are run again
+const apiTokenAuthorizeTTL = 5 * time.Minute
+
+// when each agent using an API token was last authorized
+var apiTokenAuthorized = struct {
+	sync.Mutex
+	m map[model.GoogleID]time.Time
+}{m: make(map[model.GoogleID]time.Time)}
+
+// apiTokenAgentAuthorized applies the checks a JWT gets at login and refresh to the agent behind an API token, which never expires
+// successes are remembered for apiTokenAuthorizeTTL, failures are not
+func apiTokenAgentAuthorized(ctx context.Context, gid model.GoogleID) (bool, error) {
+	apiTokenAuthorized.Lock()
+	at, ok := apiTokenAuthorized.m[gid]
+	apiTokenAuthorized.Unlock()
+	if ok && time.Since(at) < apiTokenAuthorizeTTL {
+		return true, nil
+	}
+
+	authorized, err := auth.Authorize(ctx, gid)
+
+	apiTokenAuthorized.Lock()
+	defer apiTokenAuthorized.Unlock()
+	if authorized {
+		apiTokenAuthorized.m[gid] = time.Now()
+	} else {
+		delete(apiTokenAuthorized.m, gid)
+	}
+	return authorized, err
+}
+
+// apiTokenPermits checks a request against the limits of the API token used to make it
+func apiTokenPermits(t *model.APIToken, req *http.Request) error {
+	switch routeTemplate(req) {
+	case "/me/jwtrefresh", "/me/jwt":
+		return fmt.Errorf("API tokens cannot be used for this request")
+	}
+	return scopePermits(apiTokenScope(t), req)
+}
+
+// apiTokenScope expresses an API token's limits as a JWT scope
+func apiTokenScope(t *model.APIToken) *tokenScope {
+	s := tokenScope{}
+
+	switch {
+	case t.OpID != "":
+		s.Ops = []model.OperationID{t.OpID}
+		s.Scopes = []string{scopeOpsRead}
+		if !t.ReadOnly() {
+			s.Scopes = append(s.Scopes, scopeOpsWrite)
+		}
+	case t.TeamID != "":
+		s.Teams = []model.TeamID{t.TeamID}
+		s.Scopes = []string{scopeTeamsRead}
+		if !t.ReadOnly() {
+			s.Scopes = append(s.Scopes, scopeTeamsAdmin)
+		}
+	case t.ReadOnly():
+		s.Scopes = []string{scopeOpsRead, scopeTeamsRead}
+	default:
+		for sc := range knownScopes {
+			s.Scopes = append(s.Scopes, sc)
+		}
+	}
+	return &s
+}
+
+// meTokensRoute lists the agent's API tokens
+func meTokensRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	tokens, err := gid.APITokens(req.Context())
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(res).Encode(tokens)
+}
+
+// meNewTokenRoute creates an API token (form-data: name, scope, op, team), the secret is only returned here
+func meNewTokenRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	name := strings.TrimSpace(req.FormValue("name"))
+	if name == "" || len(name) > 64 {
+		err := fmt.Errorf("token name required, at most 64 characters")
+		log.Warnw(err.Error(), "GID", gid)
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+
+	scope := req.FormValue("scope")
+	if scope != model.APITokenScopeRead && scope != model.APITokenScopeWrite {
+		err := fmt.Errorf("scope must be read or write")
+		log.Warnw(err.Error(), "GID", gid)
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+
+	opID := model.OperationID(req.FormValue("op"))
+	if opID != "" {
+		o := model.Operation{ID: opID}
+		if read, _ := o.ReadAccess(req.Context(), gid); !read && !o.AssignedOnlyAccess(req.Context(), gid) {
+			err := fmt.Errorf("forbidden")
+			log.Warnw(err.Error(), "GID", gid, "resource", opID, "message", "API token for op without access")
+			http.Error(res, jsonError(err), http.StatusForbidden)
+			return
+		}
+	}
+
+	teamID := model.TeamID(req.FormValue("team"))
+	if teamID != "" {
+		if inteam, _ := gid.AgentInTeam(req.Context(), teamID); !inteam {
+			err := fmt.Errorf("forbidden")
+			log.Warnw(err.Error(), "GID", gid, "resource", teamID, "message", "API token for team not a member of")
+			http.Error(res, jsonError(err), http.StatusForbidden)
+			return
+		}
+	}
+
+	t, secret, err := gid.NewAPIToken(req.Context(), name, scope, opID, teamID)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+	log.Infow("API token created", "GID", gid, "id", t.ID, "scope", scope, "op", opID, "team", teamID)
+
+	json.NewEncoder(res).Encode(struct {
+		Token  *model.APIToken `json:"token"`
+		Secret string          `json:"secret"`
+	}{
+		Token:  t,
+		Secret: secret,
+	})
+}
+
+// meRevokeTokenRoute deletes one of the agent's API tokens
+func meRevokeTokenRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	vars := mux.Vars(req)
+	if err := gid.RevokeAPIToken(req.Context(), vars["id"]); err != nil {
+		if err.Error() == model.ErrAPITokenNotFound {
+			http.Error(res, jsonError(err), http.StatusNotFound)
+			return
+		}
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	log.Infow("API token revoked", "GID", gid, "id", vars["id"])
+	fmt.Fprint(res, jsonStatusOK)
+}
@@ -38,7 +38,7 @@ func appleRoute(res http.ResponseWriter, req *http.Request) {
 	}
 
 	// convert apple ID to GID
-	gid, err := model.AppleIDtoGID(id)
+	gid, err := model.AppleIDtoGID(req.Context(), id)
 	if err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
@@ -46,7 +46,7 @@ func appleRoute(res http.ResponseWriter, req *http.Request) {
 	}
 
 	// will this ever be helpful? only if we map AppleIDs to valid GIDs
-	authorized, err := auth.Authorize(gid) // V & .rocks authorization takes place here
+	authorized, err := auth.Authorize(req.Context(), gid) // V & .rocks authorization takes place here
 	if !authorized {
 		err = fmt.Errorf("access denied: %s", err.Error())
 		log.Error(err)
@@ -54,19 +54,19 @@ func appleRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	name, err := gid.IngressName()
+	name, err := gid.IngressName(req.Context())
 	if err != nil {
 		log.Error(err)
 	}
 
-	agent, err := gid.GetAgent()
+	agent, err := gid.GetAgent(req.Context())
 	if err != nil {
 		log.Error(err)
 		http.Error(res, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	agent.QueryToken = formValidationToken(req)
-	agent.JWT, err = mintjwt(gid)
+	agent.JWT, err = mintjwt(req, gid, "apple", nil)
 	if err != nil {
 		log.Error(err)
 		http.Error(res, err.Error(), http.StatusInternalServerError)
@@ -88,7 +88,7 @@ func appleRoute(res http.ResponseWriter, req *http.Request) {
 	)
 
 	// notify other teams of agent login
-	_ = wfb.AgentLogin(gid.TeamListEnabled(), gid)
+	_ = wfb.AgentLogin(req.Context(), gid.TeamListEnabled(req.Context()), gid)
 
 	fmt.Fprint(res, string(data))
 }
@@ -5,9 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	// "net/http/httputil"
-	"os"
+	"strings"
 	"time"
 
 	"github.com/lestrrat-go/jwx/v2/jwa"
@@ -68,6 +69,7 @@ func apTokenRoute(res http.ResponseWriter, req *http.Request) {
 	type token struct {
 		AccessToken string `json:"accessToken"`
 		BadAT       string `json:"access_token"` // some APIs use this name, have it here for logging
+		Scope       string `json:"scope"`        // optional, limits the JWT, e.g. "location:write" for location-only clients
 	}
 	var t token
 
@@ -119,7 +121,13 @@ func apTokenRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	authorized, err := auth.Authorize(m.Gid) // V & .rocks authorization takes place here
+	// a Google account merged into another agent logs in as that agent
+	if m.Gid, err = model.GoogleIDtoGID(req.Context(), m.Gid); err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	authorized, err := auth.Authorize(req.Context(), m.Gid) // V & .rocks authorization takes place here
 	if !authorized {
 		err = fmt.Errorf("access denied: %s", err.Error())
 		log.Error(err)
@@ -132,19 +140,25 @@ func apTokenRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	name, err := m.Gid.IngressName()
+	name, err := m.Gid.IngressName(req.Context())
 	if err != nil {
 		log.Error(err)
 	}
 
-	agent, err := m.Gid.GetAgent()
+	agent, err := m.Gid.GetAgent(req.Context())
 	if err != nil {
 		log.Error(err)
 		http.Error(res, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	agent.QueryToken = formValidationToken(req)
-	agent.JWT, err = mintjwt(m.Gid)
+	scope, err := parseScope(t.Scope, "", "")
+	if err != nil {
+		log.Warn(err)
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+	agent.JWT, err = mintjwt(req, m.Gid, "google", scope)
 	if err != nil {
 		log.Error(err)
 		http.Error(res, err.Error(), http.StatusInternalServerError)
@@ -166,27 +180,26 @@ func apTokenRoute(res http.ResponseWriter, req *http.Request) {
 	)
 
 	// notify other teams of agent login
-	_ = wfb.AgentLogin(m.Gid.TeamListEnabled(), m.Gid)
+	_ = wfb.AgentLogin(req.Context(), m.Gid.TeamListEnabled(req.Context()), m.Gid)
 
 	// res.Header().Set("Connection", "close") // no keep-alives so cookies get processed, go makes this work in HTTP/2
 	// res.Header().Set("Cache-Control", "no-store")
 
 	// update picture
-	_ = m.Gid.UpdatePicture(m.Pic)
+	_ = m.Gid.UpdatePicture(req.Context(), m.Pic)
 
 	fmt.Fprint(res, string(data))
 }
 
-func mintjwt(gid model.GoogleID) (string, error) {
-	sessionName := config.Get().HTTP.SessionName
+// how long a JWT is valid before it must be refreshed
+const jwtLifetime = time.Hour * 24 * 7
 
-	hostname, err := os.Hostname()
-	if err != nil {
-		return "", err
-	}
+// mintjwt creates a JWT for the agent, limited to scope if it is not nil
+// the session is recorded with the client details so the agent can see and revoke it later
+func mintjwt(req *http.Request, gid model.GoogleID, provider string, scope *tokenScope) (string, error) {
+	sessionName := config.Get().HTTP.SessionName
 
-	// XXX use last, rather than first?
-	key, ok := config.JWSigningKeys().Key(0)
+	key, ok := config.JWSigningKey()
 	if !ok {
 		return "", fmt.Errorf("encryption jwk not set")
 	}
@@ -194,13 +207,16 @@ func mintjwt(gid model.GoogleID) (string, error) {
 	// keyid, ok := key.Get("kid")
 	// if ok { log.Debug("using kid: ", keyid.(string), " to sign this token") }
 
-	jwts, err := jwt.NewBuilder().
+	jwtid := util.GenerateID(16)
+	expires := time.Now().Add(jwtLifetime)
+
+	jwts, err := scope.claims(jwt.NewBuilder().
 		IssuedAt(time.Now()).
 		Subject(string(gid)).
-		Issuer(hostname).
-		JwtID(util.GenerateID(16)).
+		Issuer(jwtIssuer()).
+		JwtID(jwtid).
 		Audience([]string{sessionName}).
-		Expiration(time.Now().Add(time.Hour * 24 * 7)).
+		Expiration(expires)).
 		Build()
 	if err != nil {
 		return "", err
@@ -215,6 +231,15 @@ func mintjwt(gid model.GoogleID) (string, error) {
 		return "", err
 	}
 
+	var scopes string
+	if scope != nil {
+		scopes = strings.Join(scope.Scopes, " ")
+	}
+	ip, _, _ := net.SplitHostPort(req.RemoteAddr)
+	if err := gid.RecordSession(req.Context(), jwtid, provider, req.Header.Get("User-Agent"), ip, scopes, expires); err != nil {
+		return "", err
+	}
+
 	// log.Infow("jwt", "signed", string(signed[:]))
 	return string(signed[:]), nil
 }
@@ -238,7 +263,7 @@ func oneTimeTokenRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	gid, err := token.Increment()
+	gid, err := token.Increment(req.Context())
 	if err != nil {
 		incrementScanner(req)
 		err := fmt.Errorf("invalid one-time token")
@@ -247,7 +272,7 @@ func oneTimeTokenRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	authorized, err := auth.Authorize(gid) // V & .rocks authorization takes place here
+	authorized, err := auth.Authorize(req.Context(), gid) // V & .rocks authorization takes place here
 	if !authorized {
 		err = fmt.Errorf("access denied: %s", err)
 		http.Error(res, jsonError(err), http.StatusForbidden)
@@ -259,12 +284,12 @@ func oneTimeTokenRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	name, err := gid.IngressName()
+	name, err := gid.IngressName(req.Context())
 	if err != nil {
 		log.Error(err)
 	}
 
-	agent, err := gid.GetAgent()
+	agent, err := gid.GetAgent(req.Context())
 	if err != nil {
 		log.Error(err)
 		http.Error(res, err.Error(), http.StatusInternalServerError)
@@ -272,7 +297,7 @@ func oneTimeTokenRoute(res http.ResponseWriter, req *http.Request) {
 	}
 	agent.QueryToken = formValidationToken(req)
 
-	agent.JWT, err = mintjwt(gid)
+	agent.JWT, err = mintjwt(req, gid, "onetimetoken", nil)
 	if err != nil {
 		log.Error(err)
 		http.Error(res, err.Error(), http.StatusInternalServerError)
@@ -292,7 +317,7 @@ func oneTimeTokenRoute(res http.ResponseWriter, req *http.Request) {
 		"message", name+" oneTimeToken login",
 		"client", req.Header.Get("User-Agent"))
 
-	if err := wfb.AgentLogin(gid.TeamListEnabled(), gid); err != nil {
+	if err := wfb.AgentLogin(req.Context(), gid.TeamListEnabled(req.Context()), gid); err != nil {
 		log.Error(err)
 	}
 
@@ -16,7 +16,7 @@ func getDefensiveKeys(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	dkl, err := gid.ListDefensiveKeys()
+	dkl, err := gid.ListDefensiveKeys(req.Context())
 	if err != nil {
 		log.Warn(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
@@ -62,7 +62,7 @@ func setDefensiveKey(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	err = gid.InsertDefensiveKey(dk)
+	err = gid.InsertDefensiveKey(req.Context(), dk)
 	if err != nil {
 		log.Warn(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
@@ -107,7 +107,7 @@ func setDefensiveKeyBulk(res http.ResponseWriter, req *http.Request) {
 			return
 		}
 
-		err = gid.InsertDefensiveKey(dk)
+		err = gid.InsertDefensiveKey(req.Context(), dk)
 		if err != nil {
 			http.Error(res, jsonError(err), http.StatusInternalServerError)
 			return
@@ -1,6 +1,7 @@
 package wasabeehttps
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	// "io"
@@ -49,7 +50,7 @@ func drawUploadRoute(res http.ResponseWriter, req *http.Request) {
 	}
 
 	// the IITC plugin wants the full /me data on draw POST so it can update its list of ops
-	agent, err := gid.GetAgent()
+	agent, err := gid.GetAgent(req.Context())
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
@@ -84,7 +85,7 @@ func drawUploadRoute(res http.ResponseWriter, req *http.Request) {
 		// get it from the database and do it again
 		var refetch model.Operation
 		refetch.ID = o.ID
-		_ = refetch.Populate(gid)
+		_ = refetch.Populate(req.Context(), gid)
 
 		fn = fmt.Sprintf("%s-POST-POPULATED.json", refetch.ID)
 		p = path.Join(c.RevisionsDir, fn)
@@ -116,31 +117,31 @@ func drawGetRoute(res http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	o.ID = model.OperationID(vars["opID"])
 
-	if o.ID.IsDeletedOp() {
+	if o.ID.IsDeletedOp(req.Context()) {
 		err := fmt.Errorf("requested deleted op")
 		log.Infow(err.Error(), "GID", gid, "resource", o.ID)
 		http.Error(res, jsonError(err), http.StatusGone)
 		return
 	}
 
-	read, _ := o.ReadAccess(gid)
-	assignOnly := o.AssignedOnlyAccess(gid)
+	read, zones := o.ReadAccess(req.Context(), gid)
+	assignOnly := o.AssignedOnlyAccess(req.Context(), gid)
 	if !read && !assignOnly {
 		err := fmt.Errorf("forbidden")
-		agent, _ := gid.IngressName()
+		agent, _ := gid.IngressName(req.Context())
 		log.Warnw(err.Error(), "GID", gid, "resource", o.ID, "message", "no access to operation", "agent", agent)
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
 	}
 
 	// don't do full populate (slow) just yet
-	stat, err := o.ID.Stat()
+	stat, err := o.ID.Stat(req.Context())
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusNotFound)
 		return
 	}
 
-	// basically the same as If-Modified-Since
+	// older clients send the bare LastEditID
 	im := req.Header.Get("If-None-Match")
 	if im != "" && im == stat.LastEditID {
 		err := fmt.Errorf("local copy matches server copy")
@@ -149,6 +150,12 @@ func drawGetRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// the tag is known before the populate, so unchanged ops cost only the access checks and the stat
+	tag := opETag(&o, stat.LastEditID, gid, read, zones, assignOnly)
+	if notModified(res, req, tag) {
+		return
+	}
+
 	lastModified, err := time.ParseInLocation("2006-01-02 15:04:05", stat.Modified, time.UTC)
 	if err != nil {
 		log.Error(err)
@@ -156,8 +163,9 @@ func drawGetRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// If-None-Match takes precedence, If-Modified-Since is only for clients without the tag
 	ims := req.Header.Get("If-Modified-Since")
-	if ims != "" && ims != "null" { // yes, the string "null", seen in the wild
+	if im == "" && ims != "" && ims != "null" { // yes, the string "null", seen in the wild
 		modifiedSince, err := time.ParseInLocation(time.RFC1123, ims, time.UTC)
 		if err != nil {
 			log.Error(err)
@@ -172,14 +180,17 @@ func drawGetRoute(res http.ResponseWriter, req *http.Request) {
 	}
 
 	// o.Populate determines all, zone, or assigned-only
-	if err = o.Populate(gid); err != nil {
+	if err = o.Populate(req.Context(), gid); err != nil {
 		http.Error(res, jsonError(err), http.StatusNotAcceptable)
 		return
 	}
 
 	res.Header().Set("Last-Modified", lastModified.Format(time.RFC1123))
 	res.Header().Set("Cache-Control", "no-store")
-	res.Header().Set("ETag", o.LastEditID)
+	if o.LastEditID != stat.LastEditID {
+		// edited between the stat and the populate, tag what is being sent
+		res.Header().Set("ETag", opETag(&o, o.LastEditID, gid, read, zones, assignOnly))
+	}
 	if err = json.NewEncoder(res).Encode(&o); err != nil {
 		log.Errorw("unable to encode & send operation to client", "error", err.Error())
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
@@ -199,19 +210,19 @@ func drawDeleteRoute(res http.ResponseWriter, req *http.Request) {
 	op.ID = model.OperationID(vars["opID"])
 
 	// op.Delete checks ownership, do we need this check? -- yes for good status codes
-	if !op.ID.IsOwner(gid) {
+	if !op.ID.IsOwner(req.Context(), gid) {
 		err = fmt.Errorf("forbidden: only the owner can delete an operation")
 		log.Warnw(err.Error(), "resource", op.ID, "GID", gid)
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
 	}
 
-	if err := op.Delete(gid); err != nil {
+	if err := op.Delete(req.Context(), gid); err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
-	messaging.DeleteOperation(messaging.OperationID(op.ID)) // announces to EVERYONE to delete it
+	messaging.DeleteOperation(req.Context(), messaging.OperationID(op.ID)) // announces to EVERYONE to delete it
 	log.Infow("deleted operation", "resource", op.ID, "GID", gid, "message", "deleted operation")
 	fmt.Fprint(res, jsonStatusOK)
 }
@@ -235,21 +246,23 @@ func drawUpdateRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if !op.WriteAccess(gid) {
+	if !op.WriteAccess(req.Context(), gid) {
 		err = fmt.Errorf("forbidden: write access required to update an operation")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
 	}
 
-	s, err := op.ID.Stat()
+	s, err := op.ID.Stat(req.Context())
 	if err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
+	// either the bare LastEditID or the ETag from drawGetRoute
 	im := req.Header.Get("If-Match")
-	if im != "" && im != s.LastEditID {
+	read, zones := op.ReadAccess(req.Context(), gid)
+	if im != "" && im != s.LastEditID && !etagMatch(im, opETag(&op, s.LastEditID, gid, read, zones, op.AssignedOnlyAccess(req.Context(), gid))) {
 		err := fmt.Errorf("local copy out-of-date")
 		log.Debugw(err.Error(), "GID", gid, "resource", s.ID, "If-Match", im, "LastEditID", s.LastEditID)
 		http.Error(res, jsonError(err), http.StatusPreconditionFailed)
@@ -276,7 +289,7 @@ func drawUpdateRoute(res http.ResponseWriter, req *http.Request) {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
-	uid := touch(op)
+	uid := touch(req.Context(), op)
 	fmt.Fprint(res, jsonOKUpdateID(uid))
 
 	// store backup revision -- used for testing
@@ -301,7 +314,7 @@ func drawUpdateRoute(res http.ResponseWriter, req *http.Request) {
 
 		var refetch model.Operation
 		refetch.ID = op.ID
-		_ = refetch.Populate(gid)
+		_ = refetch.Populate(req.Context(), gid)
 
 		fn = fmt.Sprintf("%s-%s-POPULATED.json", opID, uid)
 		p = path.Join(c.RevisionsDir, fn)
@@ -335,14 +348,14 @@ func drawChownRoute(res http.ResponseWriter, req *http.Request) {
 	var op model.Operation
 	op.ID = model.OperationID(vars["opID"])
 
-	if !op.ID.IsOwner(gid) {
+	if !op.ID.IsOwner(req.Context(), gid) {
 		err = fmt.Errorf("forbidden: only the owner can set operation ownership ")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
 	}
 
-	err = op.ID.Chown(gid, to)
+	err = op.ID.Chown(req.Context(), gid, to)
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
@@ -363,7 +376,7 @@ func drawPortalCommentRoute(res http.ResponseWriter, req *http.Request) {
 	var op model.Operation
 	op.ID = model.OperationID(vars["opID"])
 
-	if !op.WriteAccess(gid) {
+	if !op.WriteAccess(req.Context(), gid) {
 		err = fmt.Errorf("write access required to set portal comments")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
@@ -372,12 +385,12 @@ func drawPortalCommentRoute(res http.ResponseWriter, req *http.Request) {
 
 	portalID := model.PortalID(vars["portal"])
 	comment := req.FormValue("comment")
-	err = op.ID.PortalComment(portalID, comment)
+	err = op.ID.PortalComment(req.Context(), portalID, comment)
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
-	uid := touch(op)
+	uid := touch(req.Context(), op)
 	fmt.Fprint(res, jsonOKUpdateID(uid))
 }
 
@@ -393,7 +406,7 @@ func drawPortalHardnessRoute(res http.ResponseWriter, req *http.Request) {
 	var op model.Operation
 	op.ID = model.OperationID(vars["opID"])
 
-	if op.WriteAccess(gid) {
+	if op.WriteAccess(req.Context(), gid) {
 		err = fmt.Errorf("write access required to set portal hardness")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
@@ -401,13 +414,13 @@ func drawPortalHardnessRoute(res http.ResponseWriter, req *http.Request) {
 	}
 	portalID := model.PortalID(vars["portal"])
 	hardness := req.FormValue("hardness")
-	err = op.ID.PortalHardness(portalID, hardness)
+	err = op.ID.PortalHardness(req.Context(), portalID, hardness)
 	if err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
-	uid := touch(op)
+	uid := touch(req.Context(), op)
 	fmt.Fprint(res, jsonOKUpdateID(uid))
 }
 
@@ -422,7 +435,7 @@ func drawOrderRoute(res http.ResponseWriter, req *http.Request) {
 	var op model.Operation
 	op.ID = model.OperationID(vars["opID"])
 
-	if !op.WriteAccess(gid) {
+	if !op.WriteAccess(req.Context(), gid) {
 		err = fmt.Errorf("write access required to set operation order")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
@@ -430,19 +443,19 @@ func drawOrderRoute(res http.ResponseWriter, req *http.Request) {
 	}
 
 	order := req.FormValue("order")
-	err = op.LinkOrder(order)
+	err = op.LinkOrder(req.Context(), order)
 	if err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusUnauthorized)
 		return
 	}
-	err = op.MarkerOrder(order)
+	err = op.MarkerOrder(req.Context(), order)
 	if err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusUnauthorized)
 		return
 	}
-	uid := touch(op)
+	uid := touch(req.Context(), op)
 	fmt.Fprint(res, jsonOKUpdateID(uid))
 }
 
@@ -457,20 +470,20 @@ func drawInfoRoute(res http.ResponseWriter, req *http.Request) {
 	var op model.Operation
 	op.ID = model.OperationID(vars["opID"])
 
-	if !op.WriteAccess(gid) {
+	if !op.WriteAccess(req.Context(), gid) {
 		err = fmt.Errorf("write access required to set operation info")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
 	}
 	info := req.FormValue("info")
-	err = op.SetInfo(info, gid)
+	err = op.SetInfo(req.Context(), info, gid)
 	if err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
-	uid := touch(op)
+	uid := touch(req.Context(), op)
 	fmt.Fprint(res, jsonOKUpdateID(uid))
 }
 
@@ -500,14 +513,14 @@ func drawPortalKeysRoute(res http.ResponseWriter, req *http.Request) {
 	}
 	capsule := req.FormValue("capsule")
 
-	err = op.KeyOnHand(gid, portalID, int32(onhand), capsule)
+	err = op.KeyOnHand(req.Context(), gid, portalID, int32(onhand), capsule)
 	if err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusNotAcceptable)
 		return
 	}
 
-	uid := touch(op)
+	uid := touch(req.Context(), op)
 	fmt.Fprint(res, jsonOKUpdateID(uid))
 }
 
@@ -522,7 +535,7 @@ func drawPermsAddRoute(res http.ResponseWriter, req *http.Request) {
 	var op model.Operation
 	op.ID = model.OperationID(vars["opID"])
 
-	if !op.ID.IsOwner(gid) {
+	if !op.ID.IsOwner(req.Context(), gid) {
 		err = fmt.Errorf("permission to edit permissions denied")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
@@ -540,14 +553,14 @@ func drawPermsAddRoute(res http.ResponseWriter, req *http.Request) {
 	// Pass in "Zeta" and get a zone back... defaults to "All"
 	zone := model.ZoneFromString(req.FormValue("zone"))
 
-	err = op.ID.AddPerm(gid, teamID, role, zone)
+	err = op.ID.AddPerm(req.Context(), gid, teamID, role, zone)
 	if err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
 
-	uid := touch(op)
+	uid := touch(req.Context(), op)
 	fmt.Fprint(res, jsonOKUpdateID(uid))
 }
 
@@ -562,7 +575,7 @@ func drawPermsDeleteRoute(res http.ResponseWriter, req *http.Request) {
 	var op model.Operation
 	op.ID = model.OperationID(vars["opID"])
 
-	if !op.ID.IsOwner(gid) {
+	if !op.ID.IsOwner(req.Context(), gid) {
 		err = fmt.Errorf("permission to edit permissions denied")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
@@ -579,14 +592,14 @@ func drawPermsDeleteRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	err = op.ID.DelPerm(gid, teamID, role, zone)
+	err = op.ID.DelPerm(req.Context(), gid, teamID, role, zone)
 	if err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
 
-	uid := touch(op)
+	uid := touch(req.Context(), op)
 	fmt.Fprint(res, jsonOKUpdateID(uid))
 }
 
@@ -594,9 +607,9 @@ func jsonOKUpdateID(uid string) string {
 	return fmt.Sprintf("{\"status\":\"ok\", \"updateID\": \"%s\"}", uid)
 }
 
-func touch(op model.Operation) string {
+func touch(ctx context.Context, op model.Operation) string {
 	// update the timestamp and updateID
-	uid, err := op.Touch()
+	uid, err := op.Touch(ctx)
 	if err != nil {
 		return ""
 	}
@@ -612,7 +625,7 @@ func touch(op model.Operation) string {
 			ta = append(ta, t)
 		}
 		if len(ta) > 0 {
-			_ = wfb.MapChange(ta, op.ID, uid)
+			_ = wfb.MapChange(ctx, ta, op.ID, uid)
 		}
 	}()
 	return uid
@@ -1,6 +1,7 @@
 package wasabeehttps
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -23,7 +24,7 @@ func linkRequires(res http.ResponseWriter, req *http.Request) (model.GoogleID, *
 
 	vars := mux.Vars(req)
 	op.ID = model.OperationID(vars["opID"])
-	if err = op.Populate(gid); err != nil {
+	if err = op.Populate(req.Context(), gid); err != nil {
 		if err.Error() == model.ErrOpNotFound {
 			http.Error(res, jsonError(err), http.StatusNotFound)
 		} else {
@@ -32,8 +33,8 @@ func linkRequires(res http.ResponseWriter, req *http.Request) (model.GoogleID, *
 		return gid, &model.Link{}, &op, err
 	}
 
-	if err = op.Populate(gid); err != nil {
-		if op.ID.IsDeletedOp() {
+	if err = op.Populate(req.Context(), gid); err != nil {
+		if op.ID.IsDeletedOp(req.Context()) {
 			err := fmt.Errorf("requested deleted op")
 			log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 			http.Error(res, jsonError(err), http.StatusGone)
@@ -62,7 +63,7 @@ func drawLinkAssignRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if !op.WriteAccess(gid) {
+	if !op.WriteAccess(req.Context(), gid) {
 		err = fmt.Errorf("forbidden: write access required to assign agents")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
@@ -70,13 +71,13 @@ func drawLinkAssignRoute(res http.ResponseWriter, req *http.Request) {
 	}
 
 	agent := model.GoogleID(req.FormValue("agent"))
-	if err = link.SetAssignments([]model.GoogleID{agent}, nil); err != nil {
+	if err = link.SetAssignments(req.Context(), []model.GoogleID{agent}, nil); err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
 
-	uid := linkAssignTouch(gid, link.ID, op)
+	uid := linkAssignTouch(req.Context(), gid, link.ID, op)
 	fmt.Fprint(res, jsonOKUpdateID(uid))
 }
 
@@ -86,7 +87,7 @@ func drawLinkDescRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if !op.WriteAccess(gid) {
+	if !op.WriteAccess(req.Context(), gid) {
 		err = fmt.Errorf("write access required to set link descriptions")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
@@ -94,13 +95,13 @@ func drawLinkDescRoute(res http.ResponseWriter, req *http.Request) {
 	}
 
 	desc := req.FormValue("desc")
-	if err = link.SetComment(desc); err != nil {
+	if err = link.SetComment(req.Context(), desc); err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
 
-	uid := linkStatusTouch(op, link.ID, "comment")
+	uid := linkStatusTouch(req.Context(), op, link.ID, "comment")
 	fmt.Fprint(res, jsonOKUpdateID(uid))
 }
 
@@ -110,7 +111,7 @@ func drawLinkColorRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if !op.WriteAccess(gid) {
+	if !op.WriteAccess(req.Context(), gid) {
 		err = fmt.Errorf("forbidden: write access required to set link color")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
@@ -118,13 +119,13 @@ func drawLinkColorRoute(res http.ResponseWriter, req *http.Request) {
 	}
 
 	color := req.FormValue("color")
-	if err = link.SetColor(color); err != nil {
+	if err = link.SetColor(req.Context(), color); err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
 
-	uid := linkStatusTouch(op, link.ID, "color")
+	uid := linkStatusTouch(req.Context(), op, link.ID, "color")
 	fmt.Fprint(res, jsonOKUpdateID(uid))
 }
 
@@ -134,20 +135,20 @@ func drawLinkSwapRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if !op.WriteAccess(gid) {
+	if !op.WriteAccess(req.Context(), gid) {
 		err = fmt.Errorf("forbidden: write access required to swap link order")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
 	}
 
-	if err = link.Swap(); err != nil {
+	if err = link.Swap(req.Context()); err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
 
-	uid := linkStatusTouch(op, link.ID, "swap")
+	uid := linkStatusTouch(req.Context(), op, link.ID, "swap")
 	fmt.Fprint(res, jsonOKUpdateID(uid))
 }
 
@@ -157,7 +158,7 @@ func drawLinkZoneRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if !op.WriteAccess(gid) {
+	if !op.WriteAccess(req.Context(), gid) {
 		err = fmt.Errorf("forbidden: write access required to set zone")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
@@ -165,13 +166,13 @@ func drawLinkZoneRoute(res http.ResponseWriter, req *http.Request) {
 	}
 
 	zone := model.ZoneFromString(req.FormValue("zone"))
-	if err = link.SetZone(zone); err != nil {
+	if err = link.SetZone(req.Context(), zone); err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
 
-	uid := linkStatusTouch(op, link.ID, "zone")
+	uid := linkStatusTouch(req.Context(), op, link.ID, "zone")
 	fmt.Fprint(res, jsonOKUpdateID(uid))
 }
 
@@ -181,7 +182,7 @@ func drawLinkDeltaRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if !op.WriteAccess(gid) {
+	if !op.WriteAccess(req.Context(), gid) {
 		err = fmt.Errorf("forbidden: write access required to set delta")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
@@ -195,13 +196,13 @@ func drawLinkDeltaRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if err = link.SetDelta(int(delta)); err != nil {
+	if err = link.SetDelta(req.Context(), int(delta)); err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
 
-	uid := linkStatusTouch(op, link.ID, "delta")
+	uid := linkStatusTouch(req.Context(), op, link.ID, "delta")
 	fmt.Fprint(res, jsonOKUpdateID(uid))
 }
 
@@ -220,7 +221,7 @@ func drawLinkCompRoute(res http.ResponseWriter, req *http.Request, complete bool
 	}
 
 	// write access OR asignee
-	if !op.WriteAccess(gid) && !link.IsAssignedTo(gid) {
+	if !op.WriteAccess(req.Context(), gid) && !link.IsAssignedTo(req.Context(), gid) {
 		err = fmt.Errorf("permission to mark link as complete denied")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
@@ -228,20 +229,20 @@ func drawLinkCompRoute(res http.ResponseWriter, req *http.Request, complete bool
 	}
 
 	if complete {
-		if err = link.Complete(); err != nil {
+		if err = link.Complete(req.Context()); err != nil {
 			log.Error(err)
 			http.Error(res, jsonError(err), http.StatusInternalServerError)
 			return
 		}
 	} else {
-		if err = link.Incomplete(); err != nil {
+		if err = link.Incomplete(req.Context()); err != nil {
 			log.Error(err)
 			http.Error(res, jsonError(err), http.StatusInternalServerError)
 			return
 		}
 	}
 
-	uid := linkStatusTouch(op, link.ID, "complete")
+	uid := linkStatusTouch(req.Context(), op, link.ID, "complete")
 	fmt.Fprint(res, jsonOKUpdateID(uid))
 }
 
@@ -252,19 +253,19 @@ func drawLinkClaimRoute(res http.ResponseWriter, req *http.Request) {
 	}
 
 	// linkRequires runs Populate, which checks ReadAccess... this is redundant
-	if r, _ := op.ReadAccess(gid); !r {
+	if r, _ := op.ReadAccess(req.Context(), gid); !r {
 		err = fmt.Errorf("permission to claim link assignment denied")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
 	}
 
-	if err = link.Claim(gid); err != nil {
+	if err = link.Claim(req.Context(), gid); err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
 
-	uid := linkStatusTouch(op, link.ID, "assigned")
+	uid := linkStatusTouch(req.Context(), op, link.ID, "assigned")
 	fmt.Fprint(res, jsonOKUpdateID(uid))
 }
 
@@ -274,20 +275,20 @@ func drawLinkRejectRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if !link.IsAssignedTo(gid) {
+	if !link.IsAssignedTo(req.Context(), gid) {
 		err = fmt.Errorf("permission to reject link assignment denied")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
 	}
 
-	if err := link.Reject(gid); err != nil {
+	if err := link.Reject(req.Context(), gid); err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
 
-	uid := linkStatusTouch(op, link.ID, "pending")
+	uid := linkStatusTouch(req.Context(), op, link.ID, "pending")
 	fmt.Fprint(res, jsonOKUpdateID(uid))
 }
 
@@ -298,7 +299,7 @@ func drawLinkFetch(res http.ResponseWriter, req *http.Request) {
 	}
 
 	// linkRequires runs Populate, which checks ReadAccess... this is redundant
-	if r, _ := op.ReadAccess(gid); !r && !op.AssignedOnlyAccess(gid) {
+	if r, _ := op.ReadAccess(req.Context(), gid); !r && !op.AssignedOnlyAccess(req.Context(), gid) {
 		err := fmt.Errorf("forbidden")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
@@ -308,19 +309,19 @@ func drawLinkFetch(res http.ResponseWriter, req *http.Request) {
 }
 
 // linkAssignTouch updates the updateID and notifies ONLY the agent to whom the assigment was made
-func linkAssignTouch(gid model.GoogleID, linkID model.LinkID, op *model.Operation) string {
-	uid, err := op.Touch()
+func linkAssignTouch(ctx context.Context, gid model.GoogleID, linkID model.LinkID, op *model.Operation) string {
+	uid, err := op.Touch(ctx)
 	if err != nil {
 		log.Error(err)
 	}
 
-	_ = wfb.AssignLink(gid, model.TaskID(linkID), op.ID, uid)
+	_ = wfb.AssignLink(ctx, gid, model.TaskID(linkID), op.ID, uid)
 	return uid
 }
 
 // linkStatusTouch updates the updateID and notifies all teams of the update
-func linkStatusTouch(op *model.Operation, linkID model.LinkID, status string) string {
-	uid, err := op.Touch()
+func linkStatusTouch(ctx context.Context, op *model.Operation, linkID model.LinkID, status string) string {
+	uid, err := op.Touch(ctx)
 	if err != nil {
 		return ""
 	}
@@ -336,7 +337,7 @@ func linkStatusTouch(op *model.Operation, linkID model.LinkID, status string) st
 			ta = append(ta, t)
 		}
 		if len(ta) > 0 {
-			_ = wfb.LinkStatus(model.TaskID(linkID), op.ID, ta, status, uid)
+			_ = wfb.LinkStatus(ctx, model.TaskID(linkID), op.ID, ta, status, uid)
 		}
 	}()
 	return uid
@@ -1,6 +1,7 @@
 package wasabeehttps
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -23,8 +24,8 @@ func markerRequires(res http.ResponseWriter, req *http.Request) (model.GoogleID,
 
 	vars := mux.Vars(req)
 	op.ID = model.OperationID(vars["opID"])
-	if err = op.Populate(gid); err != nil {
-		if op.ID.IsDeletedOp() {
+	if err = op.Populate(req.Context(), gid); err != nil {
+		if op.ID.IsDeletedOp(req.Context()) {
 			err := fmt.Errorf("requested deleted op")
 			log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 			http.Error(res, jsonError(err), http.StatusGone)
@@ -39,7 +40,7 @@ func markerRequires(res http.ResponseWriter, req *http.Request) (model.GoogleID,
 	}
 
 	markerID := model.MarkerID(vars["marker"])
-	if err = op.Populate(gid); err != nil {
+	if err = op.Populate(req.Context(), gid); err != nil {
 		http.Error(res, jsonError(err), http.StatusNotAcceptable)
 		return gid, &model.Marker{}, &op, err
 	}
@@ -62,7 +63,7 @@ func drawMarkerAssignRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if !op.WriteAccess(gid) {
+	if !op.WriteAccess(req.Context(), gid) {
 		err = fmt.Errorf("write access required to assign targets")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
@@ -70,13 +71,13 @@ func drawMarkerAssignRoute(res http.ResponseWriter, req *http.Request) {
 	}
 
 	agent := model.GoogleID(req.FormValue("agent"))
-	if err = marker.SetAssignments([]model.GoogleID{agent}, nil); err != nil {
+	if err = marker.SetAssignments(req.Context(), []model.GoogleID{agent}, nil); err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
 
-	uid := markerAssignTouch(gid, marker.ID, op)
+	uid := markerAssignTouch(req.Context(), gid, marker.ID, op)
 	fmt.Fprint(res, jsonOKUpdateID(uid))
 }
 
@@ -87,20 +88,20 @@ func drawMarkerClaimRoute(res http.ResponseWriter, req *http.Request) {
 	}
 
 	// markerRequires does Populate, which checks for read access ... this is redundant
-	if read, _ := op.ReadAccess(gid); !read {
+	if read, _ := op.ReadAccess(req.Context(), gid); !read {
 		err = fmt.Errorf("read access required to claim targets")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
 	}
 
-	if err = marker.Claim(gid); err != nil {
+	if err = marker.Claim(req.Context(), gid); err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
 
-	uid := markerStatusTouch(op, marker.ID, "claimed")
+	uid := markerStatusTouch(req.Context(), op, marker.ID, "claimed")
 	fmt.Fprint(res, jsonOKUpdateID(uid))
 }
 
@@ -110,7 +111,7 @@ func drawMarkerCommentRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if !op.WriteAccess(gid) {
+	if !op.WriteAccess(req.Context(), gid) {
 		err = fmt.Errorf("write access required to set marker comments")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
@@ -118,12 +119,12 @@ func drawMarkerCommentRoute(res http.ResponseWriter, req *http.Request) {
 	}
 
 	comment := req.FormValue("comment")
-	if err = marker.SetComment(comment); err != nil {
+	if err = marker.SetComment(req.Context(), comment); err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
-	uid := markerStatusTouch(op, marker.ID, "comment")
+	uid := markerStatusTouch(req.Context(), op, marker.ID, "comment")
 	fmt.Fprint(res, jsonOKUpdateID(uid))
 }
 
@@ -133,7 +134,7 @@ func drawMarkerZoneRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if !op.WriteAccess(gid) {
+	if !op.WriteAccess(req.Context(), gid) {
 		err = fmt.Errorf("write access required to set marker zone")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
@@ -141,12 +142,12 @@ func drawMarkerZoneRoute(res http.ResponseWriter, req *http.Request) {
 	}
 
 	zone := model.ZoneFromString(req.FormValue("zone"))
-	if err := marker.SetZone(zone); err != nil {
+	if err := marker.SetZone(req.Context(), zone); err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
-	uid := markerStatusTouch(op, marker.ID, "zone")
+	uid := markerStatusTouch(req.Context(), op, marker.ID, "zone")
 	fmt.Fprint(res, jsonOKUpdateID(uid))
 }
 
@@ -156,7 +157,7 @@ func drawMarkerDeltaRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if !op.WriteAccess(gid) {
+	if !op.WriteAccess(req.Context(), gid) {
 		err = fmt.Errorf("forbidden: write access required to set delta")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
@@ -170,12 +171,12 @@ func drawMarkerDeltaRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if err = marker.SetDelta(int(delta)); err != nil {
+	if err = marker.SetDelta(req.Context(), int(delta)); err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
-	uid := markerStatusTouch(op, marker.ID, "delta")
+	uid := markerStatusTouch(req.Context(), op, marker.ID, "delta")
 	fmt.Fprint(res, jsonOKUpdateID(uid))
 }
 
@@ -186,9 +187,9 @@ func drawMarkerFetch(res http.ResponseWriter, req *http.Request) {
 	}
 
 	// markerRequires does Populate, which checks for read access ... this is redundant
-	read, _ := op.ReadAccess(gid)
-	if !read && !op.AssignedOnlyAccess(gid) {
-		if op.ID.IsDeletedOp() {
+	read, _ := op.ReadAccess(req.Context(), gid)
+	if !read && !op.AssignedOnlyAccess(req.Context(), gid) {
+		if op.ID.IsDeletedOp(req.Context()) {
 			err := fmt.Errorf("requested deleted op")
 			log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 			http.Error(res, jsonError(err), http.StatusGone)
@@ -210,20 +211,20 @@ func drawMarkerCompleteRoute(res http.ResponseWriter, req *http.Request) {
 	}
 
 	// markerRequires does Populate, which checks for read access ... this is redundant
-	if read, _ := op.ReadAccess(gid); !read && !op.AssignedOnlyAccess(gid) {
+	if read, _ := op.ReadAccess(req.Context(), gid); !read && !op.AssignedOnlyAccess(req.Context(), gid) {
 		err = fmt.Errorf("access required to claim targets")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
 	}
 
-	if err := marker.Complete(); err != nil {
+	if err := marker.Complete(req.Context()); err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
 
-	uid := markerStatusTouch(op, marker.ID, "completed")
+	uid := markerStatusTouch(req.Context(), op, marker.ID, "completed")
 	fmt.Fprint(res, jsonOKUpdateID(uid))
 }
 
@@ -234,20 +235,20 @@ func drawMarkerIncompleteRoute(res http.ResponseWriter, req *http.Request) {
 	}
 
 	// markerRequires does Populate, which checks for read access ... this is redundant
-	if read, _ := op.ReadAccess(gid); !read && !op.AssignedOnlyAccess(gid) {
+	if read, _ := op.ReadAccess(req.Context(), gid); !read && !op.AssignedOnlyAccess(req.Context(), gid) {
 		err = fmt.Errorf("access required to claim targets")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
 	}
 
-	if err = marker.Incomplete(); err != nil {
+	if err = marker.Incomplete(req.Context()); err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
 
-	uid := markerStatusTouch(op, marker.ID, "incomplete")
+	uid := markerStatusTouch(req.Context(), op, marker.ID, "incomplete")
 	fmt.Fprint(res, jsonOKUpdateID(uid))
 }
 
@@ -258,20 +259,20 @@ func drawMarkerRejectRoute(res http.ResponseWriter, req *http.Request) {
 	}
 
 	// markerRequires does Populate, which checks for read access ... this is redundant
-	if read, _ := op.ReadAccess(gid); !read && !op.AssignedOnlyAccess(gid) {
+	if read, _ := op.ReadAccess(req.Context(), gid); !read && !op.AssignedOnlyAccess(req.Context(), gid) {
 		err = fmt.Errorf("access required to claim targets")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
 	}
 
-	if err = marker.Reject(gid); err != nil {
+	if err = marker.Reject(req.Context(), gid); err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
 
-	uid := markerStatusTouch(op, marker.ID, "reject")
+	uid := markerStatusTouch(req.Context(), op, marker.ID, "reject")
 	fmt.Fprint(res, jsonOKUpdateID(uid))
 }
 
@@ -282,38 +283,38 @@ func drawMarkerAcknowledgeRoute(res http.ResponseWriter, req *http.Request) {
 	}
 
 	// markerRequires does Populate, which checks for read access ... this is redundant
-	if read, _ := op.ReadAccess(gid); !read && !op.AssignedOnlyAccess(gid) {
+	if read, _ := op.ReadAccess(req.Context(), gid); !read && !op.AssignedOnlyAccess(req.Context(), gid) {
 		err = fmt.Errorf("access required to claim targets")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
 	}
 
-	if err = marker.Acknowledge(); err != nil {
+	if err = marker.Acknowledge(req.Context()); err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
 
-	uid := markerStatusTouch(op, marker.ID, "acknowledge")
+	uid := markerStatusTouch(req.Context(), op, marker.ID, "acknowledge")
 	fmt.Fprint(res, jsonOKUpdateID(uid))
 }
 
 // markerAssignTouch updates the updateID and notifies ONLY the agent to whom the assigment was made
-func markerAssignTouch(gid model.GoogleID, markerID model.MarkerID, op *model.Operation) string {
-	uid, err := op.Touch()
+func markerAssignTouch(ctx context.Context, gid model.GoogleID, markerID model.MarkerID, op *model.Operation) string {
+	uid, err := op.Touch(ctx)
 	if err != nil {
 		log.Error(err)
 	}
 
-	_ = wfb.AssignMarker(gid, model.TaskID(markerID), op.ID, uid)
+	_ = wfb.AssignMarker(ctx, gid, model.TaskID(markerID), op.ID, uid)
 	return uid
 }
 
 // markerStatusTouch updates the updateID and notifies all teams of the update
-func markerStatusTouch(op *model.Operation, markerID model.MarkerID, status string) string {
+func markerStatusTouch(ctx context.Context, op *model.Operation, markerID model.MarkerID, status string) string {
 	// update the timestamp and updateID
-	uid, err := op.Touch()
+	uid, err := op.Touch(ctx)
 	if err != nil {
 		return ""
 	}
@@ -329,7 +330,7 @@ func markerStatusTouch(op *model.Operation, markerID model.MarkerID, status stri
 			ta = append(ta, t)
 		}
 		if len(ta) > 0 {
-			_ = wfb.MarkerStatus(model.TaskID(markerID), op.ID, ta, status, uid)
+			_ = wfb.MarkerStatus(ctx, model.TaskID(markerID), op.ID, ta, status, uid)
 		}
 	}()
 	return uid
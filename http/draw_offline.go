@@ -0,0 +1,133 @@
+package wasabeehttps
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/wasabee-project/Wasabee-Server/Firebase"
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+// maximum number of actions in one offline sync
+const maxOfflineActions = 500
+
+type offlineSync struct {
+	LastEditID string                `json:"lasteditid"` // of the client's copy of the op
+	Actions    []model.OfflineAction `json:"actions"`
+}
+
+// offlineDelta is what a reconnecting client needs to catch up on the op without fetching it again
+// Tasks are the agent's tasks as they are now: all of them if the op changed while the client was away, else only those acted on
+// geometry is not included; if Changed is set the client should fetch the op (with If-None-Match) to pick up new links and markers
+type offlineDelta struct {
+	Status     string                `json:"status"`
+	UpdateID   string                `json:"updateID,omitempty"`
+	LastEditID string                `json:"lasteditid"`
+	Changed    bool                  `json:"changed"`
+	Results    []model.OfflineResult `json:"results"`
+	Tasks      []model.Task          `json:"tasks"`
+	Keys       []model.KeyOnHand     `json:"keysonhand"`
+}
+
+// catchUp fills in the op's state from the agent's (reloaded) view of it
+func (d *offlineDelta) catchUp(op *model.Operation, actions []model.OfflineAction, changed bool) {
+	d.LastEditID = op.LastEditID
+
+	acted := make(map[model.TaskID]bool)
+	for _, a := range actions {
+		if a.Task != "" {
+			acted[a.Task] = true
+		}
+	}
+	d.Tasks = make([]model.Task, 0)
+	for _, m := range op.Markers {
+		if changed || acted[m.Task.ID] {
+			d.Tasks = append(d.Tasks, m.Task)
+		}
+	}
+	for _, l := range op.Links {
+		if changed || acted[l.Task.ID] {
+			d.Tasks = append(d.Tasks, l.Task)
+		}
+	}
+	d.Keys = op.Keys
+}
+
+// drawOfflineSyncRoute applies actions a client queued while it had no signal, see model.ApplyOfflineActions for the conflict rules
+func drawOfflineSyncRoute(res http.ResponseWriter, req *http.Request) {
+	gid, op, err := taskOpRequires(res, req)
+	if err != nil {
+		return
+	}
+
+	if !contentTypeIs(req, jsonTypeShort) {
+		err := fmt.Errorf("invalid request (needs to be application/json)")
+		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+
+	var sync offlineSync
+	if err := json.NewDecoder(req.Body).Decode(&sync); err != nil {
+		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+	if len(sync.Actions) > maxOfflineActions {
+		err := fmt.Errorf("too many offline actions: %d, limit is %d", len(sync.Actions), maxOfflineActions)
+		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
+		http.Error(res, jsonError(err), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	changed := sync.LastEditID != op.LastEditID
+	out := op.ApplyOfflineActions(req.Context(), gid, sync.Actions)
+
+	delta := offlineDelta{
+		Status:  "ok",
+		Changed: changed,
+		Results: out.Results,
+	}
+	if out.OpDirty {
+		delta.UpdateID = touch(req.Context(), *op)
+	}
+	// other clients hear about these as they would from the single task routes
+	announce := make(map[model.TaskID]string)
+	for i, r := range out.Results {
+		if r.Status != "applied" {
+			continue
+		}
+		switch r.Type {
+		case "complete":
+			announce[sync.Actions[i].Task] = "completed"
+		case "acknowledge":
+			// a completion in the same sync says more
+			if announce[sync.Actions[i].Task] == "" {
+				announce[sync.Actions[i].Task] = "acknowledge"
+			}
+		}
+	}
+	if out.Located {
+		go wfb.AgentLocation(req.Context(), gid)
+	}
+
+	// reload, the agent's view reflects what was just applied
+	if out.OpDirty {
+		if err := op.Populate(req.Context(), gid); err != nil {
+			log.Error(err)
+			http.Error(res, jsonError(err), http.StatusInternalServerError)
+			return
+		}
+	}
+	delta.catchUp(op, sync.Actions, changed)
+	for taskID, status := range announce {
+		go taskStatusAnnounce(req.Context(), op, taskID, status, delta.UpdateID)
+	}
+
+	log.Infow("offline sync", "GID", gid, "resource", op.ID, "actions", len(sync.Actions), "changed", changed)
+	if err := json.NewEncoder(res).Encode(&delta); err != nil {
+		log.Error(err)
+	}
+}
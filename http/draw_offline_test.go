@@ -0,0 +1,59 @@
+package wasabeehttps
+
+import (
+	"testing"
+
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+func TestOfflineDeltaCatchUp(t *testing.T) {
+	op := &model.Operation{
+		LastEditID: "edit2",
+		Markers: []model.Marker{
+			{ID: "m1", Task: model.Task{ID: "t1", State: "completed"}},
+			{ID: "m2", Task: model.Task{ID: "t2", State: "pending"}},
+		},
+		Links: []model.Link{
+			{ID: "l1", Task: model.Task{ID: "t3", State: "assigned"}},
+		},
+		Keys: []model.KeyOnHand{{ID: "p1", Gid: "agent", Onhand: 2}},
+	}
+	actions := []model.OfflineAction{
+		{ID: "a1", Type: "complete", Task: "t1"},
+		{ID: "a2", Type: "keys", Portal: "p1", Onhand: 2},
+	}
+
+	tests := []struct {
+		name    string
+		changed bool
+		want    []model.TaskID
+	}{
+		{"unchanged op sends the tasks acted on", false, []model.TaskID{"t1"}},
+		{"changed op sends every task", true, []model.TaskID{"t1", "t2", "t3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d offlineDelta
+			d.catchUp(op, actions, tt.changed)
+
+			var got []model.TaskID
+			for _, task := range d.Tasks {
+				got = append(got, task.ID)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("tasks %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("tasks %v, want %v", got, tt.want)
+				}
+			}
+			if d.Tasks[0].State != "completed" {
+				t.Errorf("task t1 is %q, want the reloaded state", d.Tasks[0].State)
+			}
+			if d.LastEditID != "edit2" || len(d.Keys) != 1 {
+				t.Errorf("lasteditid %q and %d keys, want edit2 and 1", d.LastEditID, len(d.Keys))
+			}
+		})
+	}
+}
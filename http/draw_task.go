@@ -1,6 +1,7 @@
 package wasabeehttps
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -12,48 +13,61 @@ import (
 	"github.com/wasabee-project/Wasabee-Server/model"
 )
 
+// maximum number of changes in one task batch
+const maxTaskBatch = 1000
+
 // setup common to all these calls
 func taskRequires(res http.ResponseWriter, req *http.Request) (model.GoogleID, *model.Operation, *model.Task, error) {
+	gid, op, err := taskOpRequires(res, req)
+	if err != nil {
+		return gid, op, &model.Task{}, err
+	}
+
+	vars := mux.Vars(req)
+	taskID := model.TaskID(vars["taskID"])
+	task, err := op.GetTask(taskID)
+	if err != nil {
+		if err.Error() == model.ErrTaskNotFound {
+			http.Error(res, jsonError(err), http.StatusNotFound)
+		} else {
+			http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		}
+		return gid, op, task, err
+	}
+	return gid, op, task, nil
+}
+
+// taskOpRequires loads the op as the agent sees it, the task calls can only reach tasks in that view
+func taskOpRequires(res http.ResponseWriter, req *http.Request) (model.GoogleID, *model.Operation, error) {
 	op := model.Operation{}
 
 	gid, err := getAgentID(req)
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusForbidden)
-		return gid, &op, &model.Task{}, err
+		return gid, &op, err
 	}
 
 	vars := mux.Vars(req)
 	op.ID = model.OperationID(vars["opID"])
-	if err = op.Populate(gid); err != nil {
-		if op.ID.IsDeletedOp() {
+	if err = op.Populate(req.Context(), gid); err != nil {
+		if op.ID.IsDeletedOp(req.Context()) {
 			err := fmt.Errorf("requested deleted op")
 			log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 			http.Error(res, jsonError(err), http.StatusGone)
-			return gid, &op, &model.Task{}, err
+			return gid, &op, err
 		}
 		if err.Error() == model.ErrOpNotFound {
 			http.Error(res, jsonError(err), http.StatusNotFound)
 		} else {
 			http.Error(res, jsonError(err), http.StatusNotAcceptable)
 		}
-		return gid, &op, &model.Task{}, err
+		return gid, &op, err
 	}
-
-	taskID := model.TaskID(vars["taskID"])
-	task, err := op.GetTask(taskID)
-	if err != nil {
-		if err.Error() == model.ErrTaskNotFound {
-			http.Error(res, jsonError(err), http.StatusNotFound)
-		} else {
-			http.Error(res, jsonError(err), http.StatusNotAcceptable)
-		}
-		return gid, &op, task, err
-	}
-	return gid, &op, task, nil
+	return gid, &op, nil
 }
 
 // taskStatusAnnounce send the fb annoucen to all relevant teams
-func taskStatusAnnounce(op *model.Operation, taskID model.TaskID, status string, updateID string) {
+func taskStatusAnnounce(ctx context.Context, op *model.Operation, taskID model.TaskID, status string, updateID string) {
 	teams := make(map[model.TeamID]bool)
 	for _, t := range op.Teams {
 		teams[t.TeamID] = true
@@ -64,7 +78,7 @@ func taskStatusAnnounce(op *model.Operation, taskID model.TaskID, status string,
 	}
 
 	if len(ta) > 0 {
-		_ = wfb.TaskStatus(taskID, op.ID, ta, status, updateID)
+		_ = wfb.TaskStatus(ctx, taskID, op.ID, ta, status, updateID)
 	}
 }
 
@@ -74,7 +88,7 @@ func drawTaskAssignRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if !op.WriteAccess(gid) {
+	if !op.WriteAccess(req.Context(), gid) {
 		err = fmt.Errorf("write access required to assign targets")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
@@ -96,13 +110,13 @@ func drawTaskAssignRoute(res http.ResponseWriter, req *http.Request) {
 		}
 	}
 
-	if err = task.SetAssignments(assignments, nil); err != nil {
+	if err = task.SetAssignments(req.Context(), assignments, nil); err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
 
-	uid, err := op.Touch()
+	uid, err := op.Touch(req.Context())
 	if err != nil {
 		log.Error(err)
 	}
@@ -110,7 +124,7 @@ func drawTaskAssignRoute(res http.ResponseWriter, req *http.Request) {
 
 	go func() {
 		for _, agent := range assignments {
-			_ = wfb.AssignTask(agent, task.ID, op.ID, uid)
+			_ = wfb.AssignTask(req.Context(), agent, task.ID, op.ID, uid)
 		}
 	}()
 }
@@ -122,25 +136,25 @@ func drawTaskClaimRoute(res http.ResponseWriter, req *http.Request) {
 	}
 
 	// taskRequires does Populate, which does this, ... this is redundant
-	if read, _ := op.ReadAccess(gid); !read {
+	if read, _ := op.ReadAccess(req.Context(), gid); !read {
 		err = fmt.Errorf("read access required to claim targets")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
 	}
 
-	if err = task.Claim(gid); err != nil {
+	if err = task.Claim(req.Context(), gid); err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
 
-	uid, err := op.Touch()
+	uid, err := op.Touch(req.Context())
 	if err != nil {
 		log.Error(err)
 	}
 	fmt.Fprint(res, jsonOKUpdateID(uid))
-	go taskStatusAnnounce(op, task.ID, "claimed", uid)
+	go taskStatusAnnounce(req.Context(), op, task.ID, "claimed", uid)
 }
 
 func drawTaskCommentRoute(res http.ResponseWriter, req *http.Request) {
@@ -149,7 +163,7 @@ func drawTaskCommentRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if !op.WriteAccess(gid) {
+	if !op.WriteAccess(req.Context(), gid) {
 		err = fmt.Errorf("write access required to set marker comments")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
@@ -157,17 +171,17 @@ func drawTaskCommentRoute(res http.ResponseWriter, req *http.Request) {
 	}
 
 	comment := req.FormValue("comment")
-	if err = task.SetComment(comment); err != nil {
+	if err = task.SetComment(req.Context(), comment); err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
-	uid, err := op.Touch()
+	uid, err := op.Touch(req.Context())
 	if err != nil {
 		log.Error(err)
 	}
 	fmt.Fprint(res, jsonOKUpdateID(uid))
-	go taskStatusAnnounce(op, task.ID, "comment", uid)
+	go taskStatusAnnounce(req.Context(), op, task.ID, "comment", uid)
 }
 
 func drawTaskZoneRoute(res http.ResponseWriter, req *http.Request) {
@@ -176,7 +190,7 @@ func drawTaskZoneRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if !op.WriteAccess(gid) {
+	if !op.WriteAccess(req.Context(), gid) {
 		err = fmt.Errorf("write access required to set marker zone")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
@@ -184,17 +198,17 @@ func drawTaskZoneRoute(res http.ResponseWriter, req *http.Request) {
 	}
 
 	zone := model.ZoneFromString(req.FormValue("zone"))
-	if err := task.SetZone(zone); err != nil {
+	if err := task.SetZone(req.Context(), zone); err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
-	uid, err := op.Touch()
+	uid, err := op.Touch(req.Context())
 	if err != nil {
 		log.Error(err)
 	}
 	fmt.Fprint(res, jsonOKUpdateID(uid))
-	go taskStatusAnnounce(op, task.ID, "zone", uid)
+	go taskStatusAnnounce(req.Context(), op, task.ID, "zone", uid)
 }
 
 func drawTaskDeltaRoute(res http.ResponseWriter, req *http.Request) {
@@ -203,7 +217,7 @@ func drawTaskDeltaRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if !op.WriteAccess(gid) {
+	if !op.WriteAccess(req.Context(), gid) {
 		err = fmt.Errorf("forbidden: write access required to set delta")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
@@ -217,17 +231,17 @@ func drawTaskDeltaRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if err = task.SetDelta(int(delta)); err != nil {
+	if err = task.SetDelta(req.Context(), int(delta)); err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
-	uid, err := op.Touch()
+	uid, err := op.Touch(req.Context())
 	if err != nil {
 		log.Error(err)
 	}
 	fmt.Fprint(res, jsonOKUpdateID(uid))
-	go taskStatusAnnounce(op, task.ID, "delta", uid)
+	go taskStatusAnnounce(req.Context(), op, task.ID, "delta", uid)
 }
 
 func drawTaskFetch(res http.ResponseWriter, req *http.Request) {
@@ -237,9 +251,9 @@ func drawTaskFetch(res http.ResponseWriter, req *http.Request) {
 	}
 
 	// taskRequires does Populate, which does this, ... this is redundant
-	read, _ := op.ReadAccess(gid)
-	if !read && !op.AssignedOnlyAccess(gid) {
-		if op.ID.IsDeletedOp() {
+	read, _ := op.ReadAccess(req.Context(), gid)
+	if !read && !op.AssignedOnlyAccess(req.Context(), gid) {
+		if op.ID.IsDeletedOp(req.Context()) {
 			err := fmt.Errorf("requested deleted op")
 			log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 			http.Error(res, jsonError(err), http.StatusGone)
@@ -261,25 +275,25 @@ func drawTaskCompleteRoute(res http.ResponseWriter, req *http.Request) {
 	}
 
 	// taskRequires does Populate, which does this, ... this is redundant
-	if read, _ := op.ReadAccess(gid); !read && !op.AssignedOnlyAccess(gid) {
+	if read, _ := op.ReadAccess(req.Context(), gid); !read && !op.AssignedOnlyAccess(req.Context(), gid) {
 		err = fmt.Errorf("access required to claim targets")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
 	}
 
-	if err := task.Complete(); err != nil {
+	if err := task.Complete(req.Context()); err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
 
-	uid, err := op.Touch()
+	uid, err := op.Touch(req.Context())
 	if err != nil {
 		log.Error(err)
 	}
 	fmt.Fprint(res, jsonOKUpdateID(uid))
-	go taskStatusAnnounce(op, task.ID, "completed", uid)
+	go taskStatusAnnounce(req.Context(), op, task.ID, "completed", uid)
 }
 
 func drawTaskIncompleteRoute(res http.ResponseWriter, req *http.Request) {
@@ -289,25 +303,25 @@ func drawTaskIncompleteRoute(res http.ResponseWriter, req *http.Request) {
 	}
 
 	// taskRequires does Populate, which does this, ... this is redundant
-	if read, _ := op.ReadAccess(gid); !read && !op.AssignedOnlyAccess(gid) {
+	if read, _ := op.ReadAccess(req.Context(), gid); !read && !op.AssignedOnlyAccess(req.Context(), gid) {
 		err = fmt.Errorf("access required to claim targets")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
 	}
 
-	if err = task.Incomplete(); err != nil {
+	if err = task.Incomplete(req.Context()); err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
 
-	uid, err := op.Touch()
+	uid, err := op.Touch(req.Context())
 	if err != nil {
 		log.Error(err)
 	}
 	fmt.Fprint(res, jsonOKUpdateID(uid))
-	go taskStatusAnnounce(op, task.ID, "incomplete", uid)
+	go taskStatusAnnounce(req.Context(), op, task.ID, "incomplete", uid)
 }
 
 func drawTaskRejectRoute(res http.ResponseWriter, req *http.Request) {
@@ -317,25 +331,25 @@ func drawTaskRejectRoute(res http.ResponseWriter, req *http.Request) {
 	}
 
 	// taskRequires does Populate, which does this, ... this is redundant
-	if read, _ := op.ReadAccess(gid); !read && !op.AssignedOnlyAccess(gid) {
+	if read, _ := op.ReadAccess(req.Context(), gid); !read && !op.AssignedOnlyAccess(req.Context(), gid) {
 		err = fmt.Errorf("access required to claim targets")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
 	}
 
-	if err = task.Reject(gid); err != nil {
+	if err = task.Reject(req.Context(), gid); err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
 
-	uid, err := op.Touch()
+	uid, err := op.Touch(req.Context())
 	if err != nil {
 		log.Error(err)
 	}
 	fmt.Fprint(res, jsonOKUpdateID(uid))
-	go taskStatusAnnounce(op, task.ID, "reject", uid)
+	go taskStatusAnnounce(req.Context(), op, task.ID, "reject", uid)
 }
 
 func drawTaskAcknowledgeRoute(res http.ResponseWriter, req *http.Request) {
@@ -345,25 +359,25 @@ func drawTaskAcknowledgeRoute(res http.ResponseWriter, req *http.Request) {
 	}
 
 	// taskRequires does Populate, which does this, ... this is redundant
-	if read, _ := op.ReadAccess(gid); !read && !op.AssignedOnlyAccess(gid) {
+	if read, _ := op.ReadAccess(req.Context(), gid); !read && !op.AssignedOnlyAccess(req.Context(), gid) {
 		err = fmt.Errorf("access required to claim targets")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
 	}
 
-	if err = task.Acknowledge(); err != nil {
+	if err = task.Acknowledge(req.Context()); err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
 
-	uid, err := op.Touch()
+	uid, err := op.Touch(req.Context())
 	if err != nil {
 		log.Error(err)
 	}
 	fmt.Fprint(res, jsonOKUpdateID(uid))
-	go taskStatusAnnounce(op, task.ID, "acknowledge", uid)
+	go taskStatusAnnounce(req.Context(), op, task.ID, "acknowledge", uid)
 }
 
 func drawTaskDependAddRoute(res http.ResponseWriter, req *http.Request) {
@@ -372,7 +386,7 @@ func drawTaskDependAddRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if !op.WriteAccess(gid) {
+	if !op.WriteAccess(req.Context(), gid) {
 		err = fmt.Errorf("forbidden: write access required to set dependency")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
@@ -388,18 +402,18 @@ func drawTaskDependAddRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if err = task.AddDepend(model.TaskID(dependsOn)); err != nil {
+	if err = task.AddDepend(req.Context(), model.TaskID(dependsOn)); err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
 
-	uid, err := op.Touch()
+	uid, err := op.Touch(req.Context())
 	if err != nil {
 		log.Error(err)
 	}
 	fmt.Fprint(res, jsonOKUpdateID(uid))
-	go taskStatusAnnounce(op, task.ID, "depends", uid)
+	go taskStatusAnnounce(req.Context(), op, task.ID, "depends", uid)
 }
 
 func drawTaskDependDelRoute(res http.ResponseWriter, req *http.Request) {
@@ -408,7 +422,7 @@ func drawTaskDependDelRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if !op.WriteAccess(gid) {
+	if !op.WriteAccess(req.Context(), gid) {
 		err = fmt.Errorf("forbidden: write access required to set dependency")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
@@ -424,19 +438,19 @@ func drawTaskDependDelRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	err = task.DelDepend(dependsOn)
+	err = task.DelDepend(req.Context(), dependsOn)
 	if err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
 
-	uid, err := op.Touch()
+	uid, err := op.Touch(req.Context())
 	if err != nil {
 		log.Error(err)
 	}
 	fmt.Fprint(res, jsonOKUpdateID(uid))
-	go taskStatusAnnounce(op, task.ID, "depends", uid)
+	go taskStatusAnnounce(req.Context(), op, task.ID, "depends", uid)
 }
 
 func drawTaskOrderRoute(res http.ResponseWriter, req *http.Request) {
@@ -445,7 +459,7 @@ func drawTaskOrderRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if !op.WriteAccess(gid) {
+	if !op.WriteAccess(req.Context(), gid) {
 		err = fmt.Errorf("forbidden: write access required to set task order")
 		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
 		http.Error(res, jsonError(err), http.StatusForbidden)
@@ -467,16 +481,82 @@ func drawTaskOrderRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if err = task.SetOrder(int16(order)); err != nil {
+	if err = task.SetOrder(req.Context(), int16(order)); err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
 
-	uid, err := op.Touch()
+	uid, err := op.Touch(req.Context())
 	if err != nil {
 		log.Error(err)
 	}
 	fmt.Fprint(res, jsonOKUpdateID(uid))
-	go taskStatusAnnounce(op, task.ID, "order", uid)
+	go taskStatusAnnounce(req.Context(), op, task.ID, "order", uid)
+}
+
+type taskBatchResponse struct {
+	Status   string                   `json:"status"`
+	UpdateID string                   `json:"updateID,omitempty"`
+	Error    string                   `json:"error,omitempty"`
+	Results  []model.TaskChangeResult `json:"results"`
+}
+
+// drawTaskBatchRoute applies a list of task changes in one go, with one touch and one map change notice
+// either the whole batch is applied or none of it is; the results say which entries failed
+func drawTaskBatchRoute(res http.ResponseWriter, req *http.Request) {
+	gid, op, err := taskOpRequires(res, req)
+	if err != nil {
+		return
+	}
+
+	if !contentTypeIs(req, jsonTypeShort) {
+		err := fmt.Errorf("invalid request (needs to be application/json)")
+		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+
+	var changes []model.TaskChange
+	if err := json.NewDecoder(req.Body).Decode(&changes); err != nil {
+		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+	if len(changes) == 0 {
+		http.Error(res, jsonStatusEmpty, http.StatusNotAcceptable)
+		return
+	}
+	if len(changes) > maxTaskBatch {
+		err := fmt.Errorf("too many changes in batch: %d, limit is %d", len(changes), maxTaskBatch)
+		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
+		http.Error(res, jsonError(err), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// taskOpRequires does Populate, which makes sure the agent can at least see the assigned tasks
+	write := op.WriteAccess(req.Context(), gid)
+	for i := range changes {
+		if changes[i].NeedsWrite() && !write {
+			err = fmt.Errorf("forbidden: write access required to %s tasks", changes[i].Action)
+			log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
+			http.Error(res, jsonError(err), http.StatusForbidden)
+			return
+		}
+	}
+
+	results, err := op.ApplyTaskChanges(req.Context(), gid, changes)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err.Error() == model.ErrTaskBatchFailed {
+			status = http.StatusNotAcceptable
+		}
+		res.WriteHeader(status)
+		_ = json.NewEncoder(res).Encode(taskBatchResponse{Status: "error", Error: err.Error(), Results: results})
+		return
+	}
+
+	uid := touch(req.Context(), *op)
+	log.Infow("task batch", "GID", gid, "resource", op.ID, "changes", len(changes))
+	_ = json.NewEncoder(res).Encode(taskBatchResponse{Status: "ok", UpdateID: uid, Results: results})
 }
@@ -0,0 +1,77 @@
+package wasabeehttps
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+// etag makes a strong entity tag from the values which determine a response
+func etag(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return `"` + base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:18]) + `"`
+}
+
+// etagMatch reports if an If-None-Match or If-Match header lists tag (or is "*")
+func etagMatch(header, tag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == "*" || t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified sets the ETag header and, if the client already has that version, sends 304 and returns true
+func notModified(res http.ResponseWriter, req *http.Request, tag string) bool {
+	res.Header().Set("ETag", tag)
+	if inm := req.Header.Get("If-None-Match"); inm != "" && etagMatch(inm, tag) {
+		res.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// opETag covers what gid sees of an op: the edit it is at, the teams it is shared with, and the agent's zone view
+// o.Teams must be populated (ReadAccess does it)
+func opETag(o *model.Operation, lastEditID string, gid model.GoogleID, read bool, zones []model.Zone, assignedOnly bool) string {
+	var teams []string
+	for _, t := range o.Teams {
+		teams = append(teams, fmt.Sprintf("%s/%s/%d", t.TeamID, t.Role, t.Zone))
+	}
+	sort.Strings(teams)
+
+	view := "all"
+	if !read {
+		view = "assigned " + gid.String()
+	} else if assignedOnly || !hasZoneAll(zones) {
+		// assigned tasks outside the agent's zones, and the agent's own keys, make the view personal
+		var zs []string
+		for _, z := range zones {
+			zs = append(zs, fmt.Sprint(z))
+		}
+		sort.Strings(zs)
+		view = fmt.Sprintf("%s %t %s", strings.Join(zs, ","), assignedOnly, gid)
+	}
+
+	return etag(lastEditID, strings.Join(teams, ","), view)
+}
+
+func hasZoneAll(zones []model.Zone) bool {
+	for _, z := range zones {
+		if z == model.ZoneAll {
+			return true
+		}
+	}
+	return false
+}
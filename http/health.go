@@ -0,0 +1,168 @@
+package wasabeehttps
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wasabee-project/Wasabee-Server/Firebase"
+	"github.com/wasabee-project/Wasabee-Server/RISC"
+	"github.com/wasabee-project/Wasabee-Server/Telegram"
+	"github.com/wasabee-project/Wasabee-Server/config"
+	"github.com/wasabee-project/Wasabee-Server/federation"
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/model"
+	"github.com/wasabee-project/Wasabee-Server/templates"
+)
+
+// check states, "down" on a required check makes the server not ready
+const (
+	healthOK       = "ok"
+	healthDegraded = "degraded"
+	healthDown     = "down"
+	healthDisabled = "disabled"
+)
+
+const healthDBTimeout = 2 * time.Second
+
+// how long idle federation peers are given to connect
+const healthPeerTimeout = 2 * time.Second
+
+type healthCheck struct {
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type healthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]healthCheck `json:"checks"`
+}
+
+// health checks the database and templates, which the server cannot run without, and the optional subsystems
+func health(ctx context.Context) healthReport {
+	r := healthReport{
+		Status: healthOK,
+		Checks: make(map[string]healthCheck),
+	}
+
+	dbctx, cancel := context.WithTimeout(ctx, healthDBTimeout)
+	defer cancel()
+	if err := model.Ping(dbctx); err != nil {
+		r.Checks["database"] = healthCheck{Status: healthDown, Detail: err.Error()}
+	} else {
+		r.Checks["database"] = healthCheck{Status: healthOK}
+	}
+
+	if templates.Loaded() {
+		r.Checks["templates"] = healthCheck{Status: healthOK}
+	} else {
+		r.Checks["templates"] = healthCheck{Status: healthDown, Detail: "no templates loaded"}
+	}
+
+	r.Checks["firebase"] = firebaseHealth()
+	r.Checks["telegram"] = telegramHealth()
+	r.Checks["risc"] = riscHealth()
+	r.Checks["federation"] = federationHealth(ctx)
+	r.Checks["v"] = runningHealth(config.IsVRunning())
+	r.Checks["rocks"] = runningHealth(config.IsRocksRunning())
+
+	for _, c := range r.Checks {
+		switch c.Status {
+		case healthDown:
+			r.Status = healthDown
+		case healthDegraded:
+			if r.Status == healthOK {
+				r.Status = healthDegraded
+			}
+		}
+	}
+	return r
+}
+
+func runningHealth(running bool) healthCheck {
+	if !running {
+		return healthCheck{Status: healthDisabled}
+	}
+	return healthCheck{Status: healthOK}
+}
+
+func firebaseHealth() healthCheck {
+	if !config.IsFirebaseRunning() {
+		return healthCheck{Status: healthDisabled}
+	}
+	if slowed, rate := wfb.Slowed(); slowed {
+		return healthCheck{Status: healthDegraded, Detail: fmt.Sprintf("quota exceeded, map changes slowed to one per %s", rate)}
+	}
+	return healthCheck{Status: healthOK}
+}
+
+func telegramHealth() healthCheck {
+	if !config.IsTelegramRunning() {
+		return healthCheck{Status: healthDisabled}
+	}
+	blocked, queued, held := wtg.SenderStatus()
+	detail := fmt.Sprintf("%d queued, %d held", queued, held)
+	if blocked {
+		return healthCheck{Status: healthDegraded, Detail: "send queue blocked by rate limits, " + detail}
+	}
+	return healthCheck{Status: healthOK, Detail: detail}
+}
+
+func riscHealth() healthCheck {
+	if config.Get().RISC.Cert == "" {
+		return healthCheck{Status: healthDisabled}
+	}
+	if !risc.Running() {
+		return healthCheck{Status: healthDegraded, Detail: "webhook not registered with Google"}
+	}
+	return healthCheck{Status: healthOK}
+}
+
+func federationHealth(ctx context.Context) healthCheck {
+	ctx, cancel := context.WithTimeout(ctx, healthPeerTimeout)
+	defer cancel()
+
+	states := federation.PeerStates(ctx)
+	if len(states) == 0 {
+		return healthCheck{Status: healthDisabled}
+	}
+
+	status := healthOK
+	var detail []string
+	for peer, state := range states {
+		// anything but READY, once the peer has been asked to connect, means it could not be reached in time
+		if state != "READY" {
+			status = healthDegraded
+		}
+		detail = append(detail, peer+" "+state)
+	}
+	sort.Strings(detail)
+	return healthCheck{Status: status, Detail: strings.Join(detail, ", ")}
+}
+
+// healthzRoute is the liveness check: if it answers, the process is alive
+// the report is included for on-call, but a broken dependency is not fixed by a restart, so it is always 200
+func healthzRoute(res http.ResponseWriter, req *http.Request) {
+	res.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(res).Encode(health(req.Context())); err != nil {
+		log.Error(err)
+	}
+}
+
+// readyzRoute is the readiness check: 503 while the database or templates are down
+// degraded optional subsystems do not stop the server taking traffic
+func readyzRoute(res http.ResponseWriter, req *http.Request) {
+	r := health(req.Context())
+
+	res.Header().Set("Cache-Control", "no-store")
+	if r.Status == healthDown {
+		res.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(res).Encode(r); err != nil {
+		log.Error(err)
+	}
+}
@@ -0,0 +1,165 @@
+package wasabeehttps
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+const idempotencyHeader = "Idempotency-Key"
+
+// longest key accepted, the size of the idempotency.idkey column
+const maxIdempotencyKey = 64
+
+// responses larger than this are not kept; retries of such requests run again
+const maxIdempotentBody = 1 << 20
+
+// how long a finished request has to store or release its claim
+const idempotencySettle = 5 * time.Second
+
+// the request body is read whole to fingerprint it, large ops are well under this
+const maxIdempotentRequest = 16 << 20
+
+var idempotencyRequests = promauto.NewCounterVec(prometheus.CounterOpts{Name: "wasabee_idempotency_requests_total", Help: "Requests sent with an Idempotency-Key, by result."}, []string{"result"})
+
+// idempotencyRecorder passes the response through while keeping a copy to store
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *idempotencyRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *idempotencyRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	if r.body.Len() <= maxIdempotentBody {
+		r.body.Write(b)
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// idempotencyMW lets clients on bad connections retry a POST, PUT or DELETE safely:
+// the first request with a given Idempotency-Key runs, later ones with the same key get the first response replayed
+// keys are per-agent and kept for model.IdempotencyWindow; it runs after authMW so the agent is known
+func idempotencyMW(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		key := req.Header.Get(idempotencyHeader)
+		if key == "" || !(req.Method == "POST" || req.Method == "PUT" || req.Method == "DELETE" || req.Method == "PATCH") {
+			next.ServeHTTP(res, req)
+			return
+		}
+
+		gid, ok := req.Context().Value("X-Wasabee-GID").(model.GoogleID)
+		if !ok || gid == "" {
+			next.ServeHTTP(res, req)
+			return
+		}
+
+		if len(key) > maxIdempotencyKey {
+			err := fmt.Errorf("%s too long, limit is %d", idempotencyHeader, maxIdempotencyKey)
+			apiFail(res, req, http.StatusBadRequest, err)
+			return
+		}
+
+		// the same key must come with the same request, the body is read here and put back for the handler
+		body, err := io.ReadAll(http.MaxBytesReader(res, req.Body, maxIdempotentRequest))
+		if err != nil {
+			log.Warnw(err.Error(), "GID", gid, "path", req.URL.Path)
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				apiFail(res, req, http.StatusRequestEntityTooLarge, err)
+				return
+			}
+			apiFail(res, req, http.StatusBadRequest, err)
+			return
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		h := sha256.New()
+		fmt.Fprintf(h, "%s %s?%s\n", req.Method, req.URL.Path, req.URL.RawQuery)
+		h.Write(body)
+		fingerprint := hex.EncodeToString(h.Sum(nil))
+
+		prev, err := gid.ClaimIdempotencyKey(req.Context(), key, fingerprint, requestTimeout+idempotencySettle)
+		if err != nil {
+			// without the store it is better to risk a duplicate than to refuse the request
+			idempotencyRequests.WithLabelValues("error").Inc()
+			next.ServeHTTP(res, req)
+			return
+		}
+		if prev != nil {
+			replayIdempotent(res, req, gid, key, fingerprint, prev)
+			return
+		}
+
+		idempotencyRequests.WithLabelValues("new").Inc()
+		rec := &idempotencyRecorder{ResponseWriter: res}
+		stored := false
+		// the request's context may be past its deadline by now, the claim has to be settled either way
+		ctx, cancel := context.WithTimeout(context.Background(), idempotencySettle)
+		defer cancel()
+		defer func() {
+			if !stored {
+				_ = gid.ReleaseIdempotencyKey(ctx, key)
+			}
+		}()
+
+		next.ServeHTTP(rec, req)
+
+		// server-side failures and oversized responses are not kept, so the retry runs again
+		if rec.status == 0 || rec.status >= 500 || rec.body.Len() > maxIdempotentBody {
+			return
+		}
+		if err := gid.StoreIdempotentResponse(ctx, key, rec.status, rec.Header().Get("Content-Type"), rec.body.Bytes()); err == nil {
+			stored = true
+		}
+	})
+}
+
+// replayIdempotent answers a repeated key: with the stored response, or an error if the key is busy or reused for something else
+func replayIdempotent(res http.ResponseWriter, req *http.Request, gid model.GoogleID, key, fingerprint string, prev *model.IdempotentResponse) {
+	if prev.Fingerprint != fingerprint {
+		idempotencyRequests.WithLabelValues("mismatch").Inc()
+		err := fmt.Errorf("%s already used for a different request", idempotencyHeader)
+		log.Infow(err.Error(), "GID", gid, "key", key)
+		apiFail(res, req, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	if prev.Status == 0 {
+		idempotencyRequests.WithLabelValues("inflight").Inc()
+		err := fmt.Errorf("request with this %s is still being processed", idempotencyHeader)
+		res.Header().Set("Retry-After", "1")
+		apiFail(res, req, http.StatusConflict, err)
+		return
+	}
+
+	idempotencyRequests.WithLabelValues("replay").Inc()
+	if prev.ContentType != "" {
+		res.Header().Set("Content-Type", prev.ContentType)
+	}
+	res.Header().Set("Idempotent-Replayed", "true")
+	res.WriteHeader(prev.Status)
+	if _, err := res.Write(prev.Body); err != nil {
+		log.Error(err)
+	}
+}
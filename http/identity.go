@@ -0,0 +1,328 @@
+package wasabeehttps
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+
+	wtg "github.com/wasabee-project/Wasabee-Server/Telegram"
+	"github.com/wasabee-project/Wasabee-Server/auth"
+	"github.com/wasabee-project/Wasabee-Server/config"
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/model"
+	"github.com/wasabee-project/Wasabee-Server/oidc"
+)
+
+// linking, unlinking and merging require a JWT from a login this recent
+const reauthWindow = 15 * time.Minute
+
+// recentLogin makes sure the agent logged in (not refreshed) recently before changing how they log in
+func recentLogin(res http.ResponseWriter, req *http.Request, gid model.GoogleID) bool {
+	fresh, err := gid.SessionFresh(req.Context(), currentJWTID(req), reauthWindow)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return false
+	}
+	if !fresh {
+		err := fmt.Errorf("log in again before changing linked logins")
+		log.Infow(err.Error(), "GID", gid)
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// linkIdentity links a verified login to the agent and writes the result
+func linkIdentity(ctx context.Context, res http.ResponseWriter, gid model.GoogleID, provider, subject string) {
+	if err := gid.LinkIdentity(ctx, provider, subject); err != nil {
+		http.Error(res, jsonError(err), http.StatusConflict)
+		return
+	}
+	log.Infow("linked login", "GID", gid, "provider", provider, "subject", subject)
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+// meIdentitiesRoute lists the logins linked to the agent
+func meIdentitiesRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	identities, err := gid.Identities(req.Context())
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(res).Encode(identities)
+}
+
+// meLinkAppleRoute links a Sign in with Apple login, the body is the code as sent to /apple
+func meLinkAppleRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	if !recentLogin(res, req, gid) {
+		return
+	}
+
+	code, err := io.ReadAll(req.Body)
+	if err != nil {
+		log.Error(err)
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	if len(code) == 0 {
+		http.Error(res, jsonStatusEmpty, http.StatusNotAcceptable)
+		return
+	}
+
+	id, err := appleAuth(string(code))
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+	linkIdentity(req.Context(), res, gid, model.IdentityApple, id)
+}
+
+// meLinkOIDCRoute links an OpenID Connect login from an ID token the client obtained itself
+func meLinkOIDCRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	vars := mux.Vars(req)
+	p, err := oidc.Get(vars["provider"])
+	if err != nil {
+		log.Warnw(err.Error(), "GID", gid, "provider", vars["provider"])
+		http.Error(res, jsonError(err), http.StatusNotFound)
+		return
+	}
+	if !recentLogin(res, req, gid) {
+		return
+	}
+
+	if !contentTypeIs(req, jsonTypeShort) {
+		err := fmt.Errorf("invalid request (needs to be application/json)")
+		log.Warnw(err.Error(), "GID", gid)
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+
+	var t struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&t); err != nil {
+		log.Warnw(err.Error(), "GID", gid)
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+
+	id, err := p.Verify(req.Context(), t.IDToken, "")
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+	linkIdentity(req.Context(), res, gid, model.IdentityOIDCPrefix+p.Name(), id.Subject)
+}
+
+// meLinkOIDCStartRoute returns the URL to send the browser to, the login is linked when the provider calls back
+func meLinkOIDCStartRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	vars := mux.Vars(req)
+	p, err := oidc.Get(vars["provider"])
+	if err != nil {
+		log.Warnw(err.Error(), "GID", gid, "provider", vars["provider"])
+		http.Error(res, jsonError(err), http.StatusNotFound)
+		return
+	}
+	if !recentLogin(res, req, gid) {
+		return
+	}
+
+	json.NewEncoder(res).Encode(struct {
+		URL string `json:"url"`
+	}{URL: oidcAuthURL(p, gid)})
+}
+
+// meLinkTelegramRoute links a Telegram account, the body is the JSON returned by the Telegram login widget
+func meLinkTelegramRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	if !recentLogin(res, req, gid) {
+		return
+	}
+
+	// the widget sends numbers for id and auth_date, the signature is over their string forms
+	var raw map[string]interface{}
+	dec := json.NewDecoder(req.Body)
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil {
+		log.Warnw(err.Error(), "GID", gid)
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+	fields := make(map[string]string, len(raw))
+	for k, v := range raw {
+		fields[k] = fmt.Sprint(v)
+	}
+
+	tgid, name, err := wtg.VerifyLogin(fields)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	existing, err := tgid.Gid(req.Context())
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	if existing == gid {
+		fmt.Fprint(res, jsonStatusOK)
+		return
+	}
+	if existing != "" {
+		err := fmt.Errorf(model.ErrIdentityLinked)
+		log.Warnw(err.Error(), "GID", gid, "provider", model.IdentityTelegram, "other", existing)
+		http.Error(res, jsonError(err), http.StatusConflict)
+		return
+	}
+
+	if current, _ := gid.TelegramID(req.Context()); current != 0 {
+		err := fmt.Errorf("unlink the current telegram account first")
+		log.Warnw(err.Error(), "GID", gid)
+		http.Error(res, jsonError(err), http.StatusConflict)
+		return
+	}
+
+	if err := gid.SetTelegramID(req.Context(), tgid, name); err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	log.Infow("linked login", "GID", gid, "provider", model.IdentityTelegram, "subject", tgid)
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+// meUnlinkIdentityRoute removes a linked login
+func meUnlinkIdentityRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	if !recentLogin(res, req, gid) {
+		return
+	}
+
+	vars := mux.Vars(req)
+	provider := vars["provider"]
+	subject := req.FormValue("subject")
+	if subject == "" && provider != model.IdentityTelegram {
+		err := fmt.Errorf("subject required")
+		log.Warnw(err.Error(), "GID", gid, "provider", provider)
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+
+	if err := gid.UnlinkIdentity(req.Context(), provider, subject); err != nil {
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+	log.Infow("unlinked login", "GID", gid, "provider", provider, "subject", subject)
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+// meMergeRoute merges another agent into this one, proven by a JWT from a recent login as the other agent
+func meMergeRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	if !recentLogin(res, req, gid) {
+		return
+	}
+
+	if !contentTypeIs(req, jsonTypeShort) {
+		err := fmt.Errorf("invalid request (needs to be application/json)")
+		log.Warnw(err.Error(), "GID", gid)
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+
+	var m struct {
+		JWT string `json:"jwt"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&m); err != nil {
+		log.Warnw(err.Error(), "GID", gid)
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+
+	token, err := jwt.Parse([]byte(m.JWT),
+		jwt.WithKeySet(config.JWParsingKeys(), jws.WithInferAlgorithmFromKey(true), jws.WithUseDefault(true)),
+		jwt.WithValidate(true),
+		jwt.WithAudience(config.Get().HTTP.SessionName),
+		jwt.WithAcceptableSkew(20*time.Second),
+	)
+	if err != nil {
+		log.Infow(err.Error(), "GID", gid)
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+	if auth.IsRevokedJWT(token.JwtID()) || scopeFromJWT(token) != nil {
+		err := fmt.Errorf("the other agent's login is not usable for a merge")
+		log.Infow(err.Error(), "GID", gid, "token ID", token.JwtID())
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	from := model.GoogleID(token.Subject())
+	fresh, err := from.SessionFresh(req.Context(), token.JwtID(), reauthWindow)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	if !fresh {
+		err := fmt.Errorf("log in again as the other agent before merging")
+		log.Infow(err.Error(), "GID", gid, "from", from)
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	// the other agent goes away, none of its logins may outlive it
+	// its sessions are deleted with it, so list them first and revoke them once the merge has succeeded
+	ids, err := from.SessionIDs(req.Context())
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := model.MergeAgents(req.Context(), from, gid); err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	revokeSessionIDs(req.Context(), from, ids, "")
+	fmt.Fprint(res, jsonStatusOK)
+}
@@ -9,8 +9,8 @@ import (
 	"io"
 	"net"
 	"net/http"
-	"os"
 	// "strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -39,7 +39,19 @@ func meRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	agent, err := gid.GetAgent()
+	// the stamp is cheap, GetAgent is not
+	stamp, err := gid.Stamp(req.Context())
+	if err != nil {
+		log.Error(err)
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	res.Header().Set("Cache-Control", "no-store")
+	if notModified(res, req, etag("me", stamp, formValidationToken(req))) {
+		return
+	}
+
+	agent, err := gid.GetAgent(req.Context())
 	if err != nil {
 		log.Error(err)
 		http.Error(res, err.Error(), http.StatusInternalServerError)
@@ -47,7 +59,6 @@ func meRoute(res http.ResponseWriter, req *http.Request) {
 	}
 	agent.QueryToken = formValidationToken(req)
 
-	res.Header().Set("Cache-Control", "no-store")
 	json.NewEncoder(res).Encode(&agent)
 }
 
@@ -75,7 +86,7 @@ func meToggleTeamRoute(res http.ResponseWriter, req *http.Request) {
 		b = true
 	}
 
-	if err = gid.SetTeamState(team, b); err != nil {
+	if err = gid.SetTeamState(req.Context(), team, b); err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
@@ -99,7 +110,7 @@ func meToggleTeamWDShareRoute(res http.ResponseWriter, req *http.Request) {
 		b = true
 	}
 
-	if err = gid.SetWDShare(team, b); err != nil {
+	if err = gid.SetWDShare(req.Context(), team, b); err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
@@ -121,7 +132,7 @@ func meToggleTeamWDLoadRoute(res http.ResponseWriter, req *http.Request) {
 		b = true
 	}
 
-	if err = gid.SetWDLoad(team, b); err != nil {
+	if err = gid.SetWDLoad(req.Context(), team, b); err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
@@ -138,10 +149,11 @@ func meRemoveTeamRoute(res http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	team := model.TeamID(vars["team"])
 
-	if err = team.RemoveAgent(gid); err != nil {
+	if err = team.RemoveAgent(req.Context(), gid); err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
+	team.AuditMembership(req.Context(), gid, model.AuditSourceSelf, gid, model.AuditActionRemove)
 
 	fmt.Fprint(res, jsonStatusOK)
 }
@@ -157,13 +169,13 @@ func meSetAgentLocationRoute(res http.ResponseWriter, req *http.Request) {
 	lat := vars["lat"]
 	lon := vars["lon"]
 
-	if err = gid.SetLocation(lat, lon); err != nil {
+	if err = gid.SetLocation(req.Context(), lat, lon); err != nil {
 		http.Error(res, jsonError(err), http.StatusNotAcceptable)
 		return
 	}
 
 	// announce to teams with which this agent is sharing location information
-	go wfb.AgentLocation(gid)
+	go wfb.AgentLocation(req.Context(), gid)
 
 	/*
 		flat, err := strconv.ParseFloat(lat, 32)
@@ -201,7 +213,7 @@ func meDeleteRoute(res http.ResponseWriter, req *http.Request) {
 	}
 
 	log.Warnw("agent requested delete", "GID", gid.String())
-	if err := gid.Delete(); err != nil {
+	if err := gid.Delete(req.Context(), gid, model.AuditSourceSelf); err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
@@ -260,7 +272,7 @@ func meFirebaseRoute(res http.ResponseWriter, req *http.Request) {
 		http.Error(res, jsonError(err), http.StatusNotAcceptable)
 		return
 	}
-	if err := gid.StoreFirebaseToken(token); err != nil {
+	if err := gid.StoreFirebaseToken(req.Context(), token); err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
@@ -294,7 +306,7 @@ func meIntelIDRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if err := gid.SetIntelData(name, faction); err != nil {
+	if err := gid.SetIntelData(req.Context(), name, faction); err != nil {
 		http.Error(res, jsonError(err), http.StatusNotAcceptable)
 		return
 	}
@@ -313,7 +325,7 @@ func meVAPIkeyRoute(res http.ResponseWriter, req *http.Request) {
 
 	v := req.FormValue("v")
 
-	if err = gid.SetVAPIkey(v); err != nil {
+	if err = gid.SetVAPIkey(req.Context(), v); err != nil {
 		http.Error(res, jsonError(err), http.StatusNotAcceptable)
 		return
 	}
@@ -328,7 +340,7 @@ func meJwtRefreshRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	ok, err := auth.Authorize(gid)
+	ok, err := auth.Authorize(req.Context(), gid)
 	if !ok {
 		err := fmt.Errorf("account disabled")
 		http.Error(res, jsonError(err), http.StatusForbidden)
@@ -340,7 +352,7 @@ func meJwtRefreshRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	key, ok := config.JWSigningKeys().Key(0)
+	key, ok := config.JWSigningKey()
 	if !ok {
 		err := fmt.Errorf("encryption jwk not set")
 		log.Error(err)
@@ -365,20 +377,14 @@ func meJwtRefreshRoute(res http.ResponseWriter, req *http.Request) {
 
 	jwtid := token.JwtID()
 
-	hostname, err := os.Hostname()
-	if err != nil {
-		log.Error(err)
-		http.Error(res, jsonError(err), http.StatusInternalServerError)
-		return
-	}
-
-	jwts, err := jwt.NewBuilder().
+	// a limited token stays limited
+	jwts, err := scopeFromJWT(token).claims(jwt.NewBuilder().
 		IssuedAt(time.Now()).
 		Subject(string(gid)).
-		Issuer(hostname).
+		Issuer(jwtIssuer()).
 		JwtID(jwtid).
 		Audience([]string{"wasabee"}).
-		Expiration(time.Now().Add(time.Hour * 24 * 7)).
+		Expiration(time.Now().Add(jwtLifetime))).
 		Build()
 	if err != nil {
 		log.Error(err)
@@ -400,11 +406,61 @@ func meJwtRefreshRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	var scopes string
+	if scope := scopeFromJWT(token); scope != nil {
+		scopes = strings.Join(scope.Scopes, " ")
+	}
+	ip, _, _ := net.SplitHostPort(req.RemoteAddr)
+	if err := gid.RefreshSession(req.Context(), jwtid, req.Header.Get("User-Agent"), ip, scopes, time.Now().Add(jwtLifetime)); err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
 	log.Infow("jwt Refresh", "gid", gid, "token ID", jwtid, "message", "jwt Token refreshed for "+gid)
 	s := fmt.Sprintf("{\"status\":\"ok\", \"jwt\":\"%s\"}", string(signed[:]))
 	fmt.Fprint(res, s)
 }
 
+// meScopedJwtRoute mints a new JWT limited to a scope (form-data: scope, ops, teams), e.g. for location-only clients
+// a limited token can only mint tokens within its own limits
+func meScopedJwtRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	scope, err := parseScope(req.FormValue("scope"), req.FormValue("ops"), req.FormValue("teams"))
+	if err != nil {
+		log.Warnw(err.Error(), "GID", gid)
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+	if scope == nil {
+		err := fmt.Errorf("scope required")
+		log.Warnw(err.Error(), "GID", gid)
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+	if !scope.within(requestScope(req)) {
+		err := fmt.Errorf("requested scope exceeds the current token")
+		log.Warnw(err.Error(), "GID", gid)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	signed, err := mintjwt(req, gid, "scoped", scope)
+	if err != nil {
+		log.Error(err)
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	log.Infow("scoped jwt", "gid", gid, "scope", scope.Scopes, "ops", scope.Ops, "teams", scope.Teams)
+	s := fmt.Sprintf("{\"status\":\"ok\", \"jwt\":\"%s\"}", signed)
+	fmt.Fprint(res, s)
+}
+
 func meCommProofRoute(res http.ResponseWriter, req *http.Request) {
 	gid, err := getAgentID(req)
 	if err != nil {
@@ -421,7 +477,7 @@ func meCommProofRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	signed, err := community.BuildToken(gid, name)
+	signed, err := community.BuildToken(req.Context(), gid, name)
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
@@ -448,7 +504,7 @@ func meCommVerifyRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	ok, err := community.Validate(gid, name)
+	ok, err := community.Validate(req.Context(), gid, name)
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
@@ -472,7 +528,7 @@ func meCommClearRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if err := gid.ClearCommunityName(); err != nil {
+	if err := gid.ClearCommunityName(req.Context()); err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
@@ -0,0 +1,61 @@
+package wasabeehttps
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{Name: "wasabee_http_requests_total", Help: "HTTP requests by route, method and status code."}, []string{"route", "method", "code"})
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{Name: "wasabee_http_request_duration_seconds", Help: "HTTP request latency by route and method."}, []string{"route", "method"})
+)
+
+// statusRecorder remembers the status code a handler sent
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// metricsMW counts and times requests by route template, not by path, so IDs do not each become a series
+func metricsMW(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: res, status: http.StatusOK}
+
+		next.ServeHTTP(rec, req)
+
+		route := routeName(req)
+		method := methodName(req)
+		httpRequests.WithLabelValues(route, method, strconv.Itoa(rec.status)).Inc()
+		httpDuration.WithLabelValues(route, method).Observe(time.Since(start).Seconds())
+	})
+}
+
+// methodName is the request method for metrics, anything unusual is "other" so clients cannot make up new series
+func methodName(req *http.Request) string {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return req.Method
+	}
+	return "other"
+}
+
+// routeName is the matched route's full path template, e.g. /api/v1/draw/{opID}, for metrics and traces
+func routeName(req *http.Request) string {
+	if r := mux.CurrentRoute(req); r != nil {
+		if t, err := r.GetPathTemplate(); err == nil {
+			return t
+		}
+	}
+	return "unknown"
+}
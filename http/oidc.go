@@ -0,0 +1,222 @@
+package wasabeehttps
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	wfb "github.com/wasabee-project/Wasabee-Server/Firebase"
+	"github.com/wasabee-project/Wasabee-Server/auth"
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/model"
+	"github.com/wasabee-project/Wasabee-Server/oidc"
+	"github.com/wasabee-project/Wasabee-Server/util"
+)
+
+// how long a browser has to complete the login at the identity provider
+const oidcStateLifetime = 10 * time.Minute
+
+type oidcState struct {
+	provider string
+	nonce    string
+	link     model.GoogleID // set when an agent is linking the login rather than logging in
+	created  time.Time
+}
+
+var oidcStates = struct {
+	sync.Mutex
+	m map[string]oidcState
+}{m: make(map[string]oidcState)}
+
+// oidcLoginRoute sends the browser to the identity provider
+func oidcLoginRoute(res http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	p, err := oidc.Get(vars["provider"])
+	if err != nil {
+		log.Warnw(err.Error(), "provider", vars["provider"])
+		http.Error(res, jsonError(err), http.StatusNotFound)
+		return
+	}
+
+	http.Redirect(res, req, oidcAuthURL(p, ""), http.StatusFound)
+}
+
+// oidcAuthURL records a new login attempt and returns the URL at the identity provider to start it
+func oidcAuthURL(p *oidc.Provider, link model.GoogleID) string {
+	state := util.GenerateID(32)
+	nonce := util.GenerateID(32)
+
+	oidcStates.Lock()
+	for k, s := range oidcStates.m {
+		if time.Since(s.created) > oidcStateLifetime {
+			delete(oidcStates.m, k)
+		}
+	}
+	oidcStates.m[state] = oidcState{provider: p.Name(), nonce: nonce, link: link, created: time.Now()}
+	oidcStates.Unlock()
+
+	return p.AuthCodeURL(state, nonce)
+}
+
+// oidcCallbackRoute receives the authorization code from the identity provider and logs the agent in
+func oidcCallbackRoute(res http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	p, err := oidc.Get(vars["provider"])
+	if err != nil {
+		log.Warnw(err.Error(), "provider", vars["provider"])
+		http.Error(res, jsonError(err), http.StatusNotFound)
+		return
+	}
+
+	if e := req.FormValue("error"); e != "" {
+		err := fmt.Errorf("login failed: %s", e)
+		log.Infow(err.Error(), "provider", p.Name())
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	state := req.FormValue("state")
+	oidcStates.Lock()
+	s, ok := oidcStates.m[state]
+	delete(oidcStates.m, state)
+	oidcStates.Unlock()
+	if !ok || s.provider != p.Name() || time.Since(s.created) > oidcStateLifetime {
+		err := fmt.Errorf("login expired, try again")
+		log.Infow(err.Error(), "provider", p.Name())
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	raw, err := p.Exchange(req.Context(), req.FormValue("code"))
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	id, err := p.Verify(req.Context(), raw, s.nonce)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+
+	if s.link != "" {
+		linkIdentity(req.Context(), res, s.link, model.IdentityOIDCPrefix+p.Name(), id.Subject)
+		return
+	}
+	oidcLogin(res, req, p, id)
+}
+
+// oidcTokenRoute accepts an ID token from a client which did the OIDC flow itself
+func oidcTokenRoute(res http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	p, err := oidc.Get(vars["provider"])
+	if err != nil {
+		log.Warnw(err.Error(), "provider", vars["provider"])
+		http.Error(res, jsonError(err), http.StatusNotFound)
+		return
+	}
+
+	if !contentTypeIs(req, jsonTypeShort) {
+		err := fmt.Errorf("invalid request (needs to be application/json)")
+		log.Warn(err)
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+
+	var t struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&t); err != nil {
+		log.Warn(err)
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+
+	id, err := p.Verify(req.Context(), t.IDToken, "")
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusUnauthorized)
+		return
+	}
+	oidcLogin(res, req, p, id)
+}
+
+// oidcLogin finds (or creates) the agent linked to the identity and returns the agent with a JWT, as aptok does
+func oidcLogin(res http.ResponseWriter, req *http.Request, p *oidc.Provider, id *oidc.Identity) {
+	provider := model.IdentityOIDCPrefix + p.Name()
+
+	gid, err := model.IdentityToGid(req.Context(), provider, id.Subject)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	if gid == "" {
+		if !p.CreateAgents() {
+			err := fmt.Errorf("this login is not linked to an agent, log in another way and link it first")
+			log.Infow(err.Error(), "provider", provider, "subject", id.Subject)
+			http.Error(res, jsonError(err), http.StatusForbidden)
+			return
+		}
+
+		// same shape as a GoogleID so it fits everywhere one does
+		gid = model.GoogleID("O-" + util.GenerateID(19))
+		if err := gid.FirstLogin(req.Context()); err != nil {
+			http.Error(res, jsonError(err), http.StatusInternalServerError)
+			return
+		}
+		if err := gid.LinkIdentity(req.Context(), provider, id.Subject); err != nil {
+			http.Error(res, jsonError(err), http.StatusInternalServerError)
+			return
+		}
+		log.Infow("created agent for OIDC login", "GID", gid, "provider", provider, "subject", id.Subject, "name", id.Name)
+	}
+
+	authorized, err := auth.Authorize(req.Context(), gid) // V & .rocks authorization takes place here
+	if !authorized {
+		err = fmt.Errorf("access denied: %s", err.Error())
+		log.Error(err)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	agent, err := gid.GetAgent(req.Context())
+	if err != nil {
+		log.Error(err)
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	agent.QueryToken = formValidationToken(req)
+	agent.JWT, err = mintjwt(req, gid, "oidc", nil)
+	if err != nil {
+		log.Error(err)
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	if id.Picture != "" {
+		_ = gid.UpdatePicture(req.Context(), id.Picture)
+	}
+
+	data, err := json.Marshal(agent)
+	if err != nil {
+		log.Error(err)
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	log.Infow("oidc login",
+		"gid", gid,
+		"provider", provider,
+		"message", id.Name+" login",
+		"client", req.Header.Get("User-Agent"),
+	)
+
+	// notify other teams of agent login
+	_ = wfb.AgentLogin(req.Context(), gid.TeamListEnabled(req.Context()), gid)
+
+	fmt.Fprint(res, string(data))
+}
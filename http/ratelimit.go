@@ -0,0 +1,249 @@
+package wasabeehttps
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/time/rate"
+
+	"github.com/wasabee-project/Wasabee-Server/config"
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+// a client address is treated as a scanner once it has this many 404s ...
+const scannerBurst = 20
+
+// ... and is forgiven one of them this often
+const scannerDecay = time.Minute
+
+// how often idle buckets are dropped and the blocklist is reloaded from the database
+const limitsInterval = time.Minute
+
+var rateLimited = promauto.NewCounterVec(prometheus.CounterOpts{Name: "wasabee_http_ratelimited_total", Help: "Requests refused by the abuse protections, by which limit."}, []string{"limit"})
+
+// limiter is a set of token buckets sharing a rate and a burst, one per key
+type limiter struct {
+	mu    sync.Mutex
+	limit rate.Limit
+	burst int
+	l     map[string]*rate.Limiter
+}
+
+func newLimiter(r float64, burst int) *limiter {
+	return &limiter{
+		limit: rate.Limit(r),
+		burst: burst,
+		l:     make(map[string]*rate.Limiter),
+	}
+}
+
+func (l *limiter) get(key string) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rl, ok := l.l[key]
+	if !ok {
+		rl = rate.NewLimiter(l.limit, l.burst)
+		l.l[key] = rl
+	}
+	return rl
+}
+
+// take uses a token from key's bucket; if there are none it returns false and how long until there is one
+func (l *limiter) take(key string) (bool, time.Duration) {
+	if l == nil || l.limit <= 0 {
+		return true, 0
+	}
+
+	now := time.Now()
+	r := l.get(key).ReserveN(now, 1)
+	if d := r.DelayFrom(now); d > 0 {
+		// not waiting, give the token back
+		r.CancelAt(now)
+		return false, d
+	}
+	return true, 0
+}
+
+// empty reports if key's bucket has no tokens, without using one
+func (l *limiter) empty(key string) bool {
+	if l == nil || l.limit <= 0 {
+		return false
+	}
+	return l.get(key).TokensAt(time.Now()) < 1
+}
+
+// sweep drops the buckets which have filled up again, they are the same as new ones
+func (l *limiter) sweep() {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	for k, rl := range l.l {
+		if rl.TokensAt(now) >= float64(l.burst) {
+			delete(l.l, k)
+		}
+	}
+}
+
+var (
+	ipLimit    *limiter
+	agentLimit *limiter
+	heavyLimit *limiter
+	scanners   *limiter // each 404 takes a token, an address with none left is a scanner
+)
+
+// the blocklist as of the last reload, IP addresses and GoogleIDs
+var blocked = struct {
+	sync.RWMutex
+	m map[string]bool
+}{m: make(map[string]bool)}
+
+// setupLimits creates the limiters from the configuration
+func setupLimits() {
+	rl := config.Get().HTTP.RateLimit
+	ipLimit = newLimiter(rl.IP.Rate, rl.IP.Burst)
+	agentLimit = newLimiter(rl.Agent.Rate, rl.Agent.Burst)
+	heavyLimit = newLimiter(rl.Heavy.Rate, rl.Heavy.Burst)
+	scanners = newLimiter(1/scannerDecay.Seconds(), scannerBurst)
+}
+
+// limitsLoop keeps the limiters' memory in check and picks up blocks made by other servers sharing the database
+func limitsLoop(ctx context.Context) {
+	reloadBlocklist()
+
+	ticker := time.NewTicker(limitsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, l := range []*limiter{ipLimit, agentLimit, heavyLimit, scanners} {
+				l.sweep()
+			}
+			reloadBlocklist()
+		}
+	}
+}
+
+// reloadBlocklist replaces the in-memory blocklist with what is in the database
+func reloadBlocklist() {
+	list, err := model.Blocklist(context.Background())
+	if err != nil {
+		// keep the old list rather than unblocking everyone
+		return
+	}
+
+	m := make(map[string]bool, len(list))
+	for _, b := range list {
+		m[b.Target] = true
+	}
+	blocked.Lock()
+	blocked.m = m
+	blocked.Unlock()
+}
+
+func isBlocked(target string) bool {
+	blocked.RLock()
+	defer blocked.RUnlock()
+	return blocked.m[target]
+}
+
+func clientIP(req *http.Request) string {
+	ip, _, _ := net.SplitHostPort(req.RemoteAddr)
+	return ip
+}
+
+// tooMany sends 429 with the time until the client may try again
+func tooMany(res http.ResponseWriter, req *http.Request, limit string, wait time.Duration) {
+	rateLimited.WithLabelValues(limit).Inc()
+	res.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(math.Max(wait.Seconds(), 1)))))
+	err := fmt.Errorf("rate limit exceeded, slow down")
+	apiFail(res, req, http.StatusTooManyRequests, err)
+}
+
+// abuseMW turns away blocked addresses and scanners, and limits each address's request rate
+// it runs after headersMW so the refusals carry the CORS headers and browser clients can read them
+func abuseMW(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		ip := clientIP(req)
+
+		if isBlocked(ip) {
+			rateLimited.WithLabelValues("blocked").Inc()
+			log.Infow("blocked address", "ip", ip, "path", req.URL.Path)
+			http.Error(res, "permission denied", http.StatusForbidden)
+			return
+		}
+
+		if isScanner(req) {
+			rateLimited.WithLabelValues("scanner").Inc()
+			log.Warnw("scanner detected", "ip", req.RemoteAddr)
+			http.Error(res, "permission denied", http.StatusForbidden)
+			return
+		}
+
+		if ok, wait := ipLimit.take(ip); !ok {
+			log.Infow("rate limited", "ip", ip, "path", req.URL.Path)
+			tooMany(res, req, "ip", wait)
+			return
+		}
+		next.ServeHTTP(res, req)
+	})
+}
+
+// the routes with their own, smaller, budget, as named by routeTemplate
+var heavyRoutes = map[string]bool{
+	"POST /draw":            true, // op upload
+	"PUT /draw/{opID}":      true, // op update
+	"GET /team/vbulkimport": true, // imports every V team
+	"POST /v2/ops":          true,
+	"PUT /v2/ops/{opID}":    true,
+}
+
+func isHeavy(req *http.Request) bool {
+	return heavyRoutes[req.Method+" "+routeTemplate(req)]
+}
+
+// agentLimitMW turns away blocked agents and limits each agent's API request rate, it runs after authMW
+func agentLimitMW(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		gid, ok := req.Context().Value("X-Wasabee-GID").(model.GoogleID)
+		if !ok || gid == "" {
+			next.ServeHTTP(res, req)
+			return
+		}
+
+		if isBlocked(string(gid)) {
+			rateLimited.WithLabelValues("blocked").Inc()
+			err := fmt.Errorf("forbidden: blocked by a server administrator")
+			log.Infow(err.Error(), "GID", gid, "path", req.URL.Path)
+			apiFail(res, req, http.StatusForbidden, err)
+			return
+		}
+
+		l, name := agentLimit, "agent"
+		if isHeavy(req) {
+			l, name = heavyLimit, "heavy"
+		}
+		if ok, wait := l.take(string(gid)); !ok {
+			log.Infow("rate limited", "GID", gid, "limit", name, "path", req.URL.Path)
+			tooMany(res, req, name, wait)
+			return
+		}
+		next.ServeHTTP(res, req)
+	})
+}
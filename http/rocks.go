@@ -20,7 +20,7 @@ func rocksPullTeamRoute(res http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	teamID := model.TeamID(vars["team"])
 
-	safe, err := gid.OwnsTeam(teamID)
+	safe, err := gid.OwnsTeam(req.Context(), teamID)
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
@@ -32,10 +32,12 @@ func rocksPullTeamRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if err := rocks.CommunityMemberPull(teamID); err != nil {
+	if err := rocks.CommunityMemberPull(req.Context(), teamID); err != nil {
+		_ = teamID.SetSyncStatus(req.Context(), err.Error())
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
+	_ = teamID.SetSyncStatus(req.Context(), "ok")
 	fmt.Fprint(res, jsonStatusOK)
 }
 
@@ -51,7 +53,7 @@ func rocksCfgTeamRoute(res http.ResponseWriter, req *http.Request) {
 	rc := vars["rockscomm"]
 	rk := vars["rockskey"]
 
-	safe, err := gid.OwnsTeam(team)
+	safe, err := gid.OwnsTeam(req.Context(), team)
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
@@ -63,7 +65,7 @@ func rocksCfgTeamRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if err = team.SetRocks(rk, rc); err != nil {
+	if err = team.SetRocks(req.Context(), rk, rc); err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
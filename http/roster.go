@@ -0,0 +1,95 @@
+package wasabeehttps
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/model"
+	"github.com/wasabee-project/Wasabee-Server/roster"
+)
+
+// rosterPreviewRoute shows the changes a sync with a roster provider (v, rocks, url) would make, apply them with POST /team/{team}/sync/{id}
+func rosterPreviewRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	vars := mux.Vars(req)
+	teamID := model.TeamID(vars["team"])
+
+	safe, err := gid.OwnsTeam(req.Context(), teamID)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	if !safe {
+		err := fmt.Errorf("forbidden: only the team owner can preview a sync")
+		log.Warnw(err.Error(), "GID", gid, "resource", teamID)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	p, err := roster.Get(model.TeamAuditSource(vars["provider"]))
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+
+	diff, err := roster.Preview(req.Context(), p, teamID)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	if diff == nil {
+		err := fmt.Errorf("team not linked to %s", p.Name())
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+	diff.Store()
+	json.NewEncoder(res).Encode(diff)
+}
+
+// rosterURLRoute links a team to a CSV/JSON roster URL, an empty url unlinks
+func rosterURLRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	vars := mux.Vars(req)
+	teamID := model.TeamID(vars["team"])
+
+	safe, err := gid.OwnsTeam(req.Context(), teamID)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	if !safe {
+		err := fmt.Errorf("forbidden: only the team owner can set the roster URL")
+		log.Warnw(err.Error(), "GID", gid, "resource", teamID)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	rurl := req.FormValue("url")
+	if rurl != "" {
+		if err := roster.ValidRosterURL(rurl); err != nil {
+			log.Warnw(err.Error(), "GID", gid, "resource", teamID)
+			http.Error(res, jsonError(err), http.StatusNotAcceptable)
+			return
+		}
+	}
+
+	if err := teamID.SetRosterURL(req.Context(), rurl); err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprint(res, jsonStatusOK)
+}
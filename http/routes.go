@@ -2,7 +2,6 @@ package wasabeehttps
 
 import (
 	"fmt"
-	"net"
 	"net/http"
 	// "net/http/httputil"
 	// "strings"
@@ -10,18 +9,18 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/wasabee-project/Wasabee-Server/config"
 	"github.com/wasabee-project/Wasabee-Server/log"
-	"github.com/wasabee-project/Wasabee-Server/util"
 )
 
-var scanners *util.Safemap
-
 func setupRouter() *mux.Router {
 	// Main Router
 	router := config.NewRouter()
 	c := config.Get().HTTP
 
 	// apply to all
+	router.Use(metricsMW)
 	router.Use(headersMW)
+	router.Use(abuseMW)
+	router.Use(deadlineMW)
 	// router.Use(debugMW)
 	router.Use(unrolled.Handler)
 	router.NotFoundHandler = http.HandlerFunc(notFoundRoute)
@@ -35,12 +34,21 @@ func setupRouter() *mux.Router {
 	// Apple Authentication routes
 	router.HandleFunc("/apple", appleRoute) // need more details, good enough for now
 
+	// generic OpenID Connect providers
+	router.HandleFunc("/oidc/{provider}/login", oidcLoginRoute).Methods("GET")       // redirect to the identity provider
+	router.HandleFunc("/oidc/{provider}/callback", oidcCallbackRoute).Methods("GET") // the identity provider sends the browser back here
+	router.HandleFunc("/oidc/{provider}/token", oidcTokenRoute).Methods("POST")      // post an ID token obtained by the client, get JWT
+
 	// common files that live under /static
 	router.Path("/favicon.ico").Handler(http.RedirectHandler("/static/favicon.ico", http.StatusFound))
 	router.Path("/robots.txt").Handler(http.RedirectHandler("/static/robots.txt", http.StatusFound))
 	router.Path("/sitemap.xml").Handler(http.RedirectHandler("/static/sitemap.xml", http.StatusFound))
 	router.Path("/.well-known/security.txt").Handler(http.RedirectHandler("/static/.well-known/security.txt", http.StatusFound))
 
+	// published keys, for third parties and federation peers to verify our JWTs
+	router.HandleFunc(jwksPath, jwksRoute).Methods("GET", "HEAD")                                           // our JWK set
+	router.HandleFunc("/.well-known/openid-configuration", openIDConfigurationRoute).Methods("GET", "HEAD") // discovery document
+
 	// this cannot be a redirect -- sent it raw
 	router.HandleFunc("/firebase-messaging-sw.js", fbmswRoute).Methods("GET")
 	router.HandleFunc("/", frontRoute).Methods("GET")
@@ -50,10 +58,22 @@ func setupRouter() *mux.Router {
 	api.Methods("OPTIONS").HandlerFunc(optionsRoute)
 	setupAuthRoutes(api)
 	api.Use(authMW)
+	api.Use(agentLimitMW)
+	api.Use(idempotencyMW)
 	api.NotFoundHandler = http.HandlerFunc(notFoundJSONRoute)
 	api.MethodNotAllowedHandler = http.HandlerFunc(notFoundJSONRoute)
 	api.PathPrefix("/api").HandlerFunc(notFoundJSONRoute)
 
+	// /api/v2/... route
+	v2 := config.Subrouter(v2PathURL)
+	v2.Methods("OPTIONS").HandlerFunc(optionsRoute)
+	setupV2Routes(v2)
+	v2.Use(authMW)
+	v2.Use(agentLimitMW)
+	v2.Use(idempotencyMW)
+	v2.NotFoundHandler = http.HandlerFunc(notFoundJSONRoute)
+	v2.MethodNotAllowedHandler = http.HandlerFunc(notFoundJSONRoute)
+
 	// /static files
 	static := config.Subrouter("/static")
 	static.PathPrefix("/").Handler(http.FileServer(http.Dir(config.Get().FrontendPath)))
@@ -111,6 +131,8 @@ func setupAuthRoutes(r *mux.Router) {
 	r.HandleFunc("/draw/{opID}/portal/{portal}/keyonhand", drawPortalKeysRoute).Methods("POST", "PUT")    // prefer PUT
 
 	// tasks -- TODO unify between markers, links and generic tasks -- note changes from POST/GET to PUT
+	r.HandleFunc("/draw/{opID}/tasks/batch", drawTaskBatchRoute).Methods("POST")                            // []TaskChange
+	r.HandleFunc("/draw/{opID}/offline", drawOfflineSyncRoute).Methods("POST")                              // offline action queue
 	r.HandleFunc("/draw/{opID}/task/{taskID}", drawTaskFetch).Methods("GET")                                // none
 	r.HandleFunc("/draw/{opID}/task/{taskID}/order", drawTaskOrderRoute).Methods("PUT")                     // order int16
 	r.HandleFunc("/draw/{opID}/task/{taskID}/assign", drawTaskAssignRoute).Methods("PUT")                   // assign []GoogleID
@@ -126,6 +148,23 @@ func setupAuthRoutes(r *mux.Router) {
 	r.HandleFunc("/draw/{opID}/task/{taskID}/depend/{dependsOn}", drawTaskDependAddRoute).Methods("PUT")    // none
 	r.HandleFunc("/draw/{opID}/task/{taskID}/depend/{dependsOn}", drawTaskDependDelRoute).Methods("DELETE") // none
 
+	// these must come before /me/{team}
+	r.HandleFunc("/me/tokens", meTokensRoute).Methods("GET")              // list personal API tokens
+	r.HandleFunc("/me/tokens", meNewTokenRoute).Methods("POST")           // create an API token (form-data: name, scope, op, team)
+	r.HandleFunc("/me/tokens/{id}", meRevokeTokenRoute).Methods("DELETE") // revoke an API token
+
+	r.HandleFunc("/me/sessions", meSessionsRoute).Methods("GET")              // list active JWTs
+	r.HandleFunc("/me/sessions", meRevokeAllSessionsRoute).Methods("DELETE")  // revoke all other JWTs, or all with current=true
+	r.HandleFunc("/me/sessions/{id}", meRevokeSessionRoute).Methods("DELETE") // revoke a JWT
+
+	r.HandleFunc("/me/identities", meIdentitiesRoute).Methods("GET")                          // list linked logins
+	r.HandleFunc("/me/identities/apple", meLinkAppleRoute).Methods("POST")                    // link a Sign in with Apple login (body: code)
+	r.HandleFunc("/me/identities/telegram", meLinkTelegramRoute).Methods("POST")              // link a Telegram account (JSON: login widget result)
+	r.HandleFunc("/me/identities/oidc/{provider}", meLinkOIDCRoute).Methods("POST")           // link an OpenID Connect login (JSON: id_token)
+	r.HandleFunc("/me/identities/oidc/{provider}/start", meLinkOIDCStartRoute).Methods("GET") // URL to link an OpenID Connect login in a browser
+	r.HandleFunc("/me/identities/{provider}", meUnlinkIdentityRoute).Methods("DELETE")        // unlink a login (subject)
+	r.HandleFunc("/me/merge", meMergeRoute).Methods("POST")                                   // merge another agent into this one (JSON: jwt)
+
 	r.HandleFunc("/me", meSetAgentLocationRoute).Methods("GET", "PUT").Queries("lat", "{lat}", "lon", "{lon}") // prefer PUT
 	r.HandleFunc("/me", meRoute).Methods("GET", "POST", "HEAD")
 	r.HandleFunc("/me/delete", meDeleteRoute).Methods("DELETE")                                     // purge all info for a agent, requires query token
@@ -139,6 +178,7 @@ func setupAuthRoutes(r *mux.Router) {
 	r.HandleFunc("/me/intelid", meIntelIDRoute).Methods("PUT", "POST")                                             // get ID from intel (not trusted)
 	r.HandleFunc("/me/VAPIkey", meVAPIkeyRoute).Methods("POST")                                                    // send an V API key for team sync
 	r.HandleFunc("/me/jwtrefresh", meJwtRefreshRoute).Methods("GET")                                               // returns a new JWT with the current token ID
+	r.HandleFunc("/me/jwt", meScopedJwtRoute).Methods("POST")                                                      // returns a new JWT limited to a scope (form-data: scope, ops, teams)
 	r.HandleFunc("/me/commproof", meCommProofRoute).Methods("GET").Queries("name", "{name}")                       // generate a JWT to post on niantic's community to prove identity
 	r.HandleFunc("/me/commverify", meCommVerifyRoute).Methods("GET").Queries("name", "{name}")                     // fetch and verify the JWT posted on niantic's community
 	r.HandleFunc("/me/commverify", meCommClearRoute).Methods("DELETE")                                             // clear it
@@ -168,8 +208,17 @@ func setupAuthRoutes(r *mux.Router) {
 	r.HandleFunc("/team/{team}/rockscfg", rocksCfgTeamRoute).Methods("GET").Queries("rockscomm", "{rockscomm}", "rockskey", "{rockskey}") // configure team link to enl.rocks community
 	r.HandleFunc("/team/{team}/v", vPullTeamRoute).Methods("GET")
 	r.HandleFunc("/team/{team}/v", vConfigureTeamRoute).Methods("POST")
+
+	r.HandleFunc("/team/{team}/{provider:v|rocks|url}/preview", rosterPreviewRoute).Methods("GET")            // show what a sync with a roster provider would change
+	r.HandleFunc("/team/{team}/rosterurl", rosterURLRoute).Methods("PUT")                                     // link the team to a CSV/JSON roster (form-data: url)
+	r.HandleFunc("/team/{team}/sync/{id}", applySyncRoute).Methods("POST")                                    // apply a previewed sync
+	r.HandleFunc("/team/{team}/neverremove", neverRemoveTeamRoute).Methods("PUT").Queries("state", "{state}") // prevent syncs from removing agents
+
 	r.HandleFunc("/team/{team}/announce", announceTeamRoute).Methods("POST")             // broadcast a message to the team (form-data: m)
 	r.HandleFunc("/team/{team}/rename", renameTeamRoute).Methods("PUT")                  // rename the team, (form-data: teamname)
+	r.HandleFunc("/team/{team}/parent", setTeamParentRoute).Methods("PUT")               // place the team in a team group (form-data: parent)
+	r.HandleFunc("/team/{team}/parent", clearTeamParentRoute).Methods("DELETE")          // remove the team from its team group
+	r.HandleFunc("/team/{team}/audit", teamAuditRoute).Methods("GET")                    // membership change log
 	r.HandleFunc("/team/{team}/{key}", addAgentToTeamRoute).Methods("GET", "POST")       // key can be gid/name/enlid
 	r.HandleFunc("/team/{team}/{key}", delAgentFmTeamRoute).Methods("DELETE")            // remove agent from team
 	r.HandleFunc("/team/{team}/{key}/delete", delAgentFmTeamRoute).Methods("GET")        // deprecated
@@ -183,11 +232,60 @@ func setupAuthRoutes(r *mux.Router) {
 	r.HandleFunc("/d/bulk", setDefensiveKeyBulk).Methods("POST")
 	r.HandleFunc("/loc", getAgentsLocation).Methods("GET")
 
+	// server administrators only, every change is recorded in the admin audit log
+	admin := r.PathPrefix("/admin").Subrouter()
+	admin.Use(adminMW)
+	admin.HandleFunc("/agents", adminSearchAgentsRoute).Methods("GET")                    // search agents by gid or name (q)
+	admin.HandleFunc("/agent/{gid}", adminAgentRoute).Methods("GET")                      // everything about an agent
+	admin.HandleFunc("/agent/{gid}", adminPurgeRoute).Methods("DELETE")                   // delete an agent and all they own (reason)
+	admin.HandleFunc("/agent/{gid}/lock", adminLockRoute).Methods("POST")                 // lock the account and end all sessions (form-data: reason)
+	admin.HandleFunc("/agent/{gid}/unlock", adminUnlockRoute).Methods("POST")             // unlock the account (form-data: reason)
+	admin.HandleFunc("/agent/{gid}/logout", adminLogoutRoute).Methods("POST")             // end all sessions
+	admin.HandleFunc("/agent/{gid}/telegram", adminUnlinkTelegramRoute).Methods("DELETE") // unlink the agent's telegram account
+	admin.HandleFunc("/op/{opID}", adminOpDeleteRoute).Methods("DELETE")                  // delete an operation (reason)
+	admin.HandleFunc("/op/{opID}/chown", adminOpChownRoute).Methods("POST")               // give an operation to another agent (form-data: to)
+	admin.HandleFunc("/team/{team}", adminTeamDeleteRoute).Methods("DELETE")              // delete a team (reason)
+	admin.HandleFunc("/team/{team}/chown", adminTeamChownRoute).Methods("POST")           // give a team to another agent (form-data: to)
+	admin.HandleFunc("/risc", adminRISCRoute).Methods("GET")                              // list locked accounts
+	admin.HandleFunc("/audit", adminAuditRoute).Methods("GET")                            // admin audit log (target)
+	admin.HandleFunc("/blocklist", adminBlocklistRoute).Methods("GET")                    // addresses and agents blocked from the server
+	admin.HandleFunc("/blocklist", adminBlockRoute).Methods("POST")                       // block an address or agent (form-data: target, reason, hours)
+	admin.HandleFunc("/blocklist/{target}", adminUnblockRoute).Methods("DELETE")          // lift a block (reason)
+	admin.NotFoundHandler = http.HandlerFunc(notFoundJSONRoute)
+
 	r.NotFoundHandler = http.HandlerFunc(notFoundJSONRoute)
 }
 
+// implied /api/v2, every route here is described in docs/wasabee-server-api.yaml (checked by TestV2RoutesDocumented)
+func setupV2Routes(r *mux.Router) {
+	r.HandleFunc("/me", v2MeRoute).Methods("GET", "HEAD")                  // the logged in agent
+	r.HandleFunc("/me/location", v2MeLocationRoute).Methods("PUT")         // {lat, lng}
+	r.HandleFunc("/me/teams", v2MeTeamsRoute).Methods("GET")               // paged
+	r.HandleFunc("/me/teams/{team}", v2MeTeamRoute).Methods("PATCH")       // {shareLocation, shareWD, loadWD}
+	r.HandleFunc("/me/teams/{team}", v2MeLeaveTeamRoute).Methods("DELETE") // leave the team
+
+	r.HandleFunc("/ops", v2OpsRoute).Methods("GET")                          // paged
+	r.HandleFunc("/ops", v2OpCreateRoute).Methods("POST")                    // Operation
+	r.HandleFunc("/ops/{opID}", v2OpRoute).Methods("GET", "HEAD")            // If-None-Match
+	r.HandleFunc("/ops/{opID}", v2OpUpdateRoute).Methods("PUT")              // Operation, If-Match
+	r.HandleFunc("/ops/{opID}", v2OpDeleteRoute).Methods("DELETE")           // owner only
+	r.HandleFunc("/ops/{opID}/owner", v2OpOwnerRoute).Methods("PUT")         // {owner}
+	r.HandleFunc("/ops/{opID}/tasks", v2TasksRoute).Methods("GET")           // paged
+	r.HandleFunc("/ops/{opID}/tasks", v2TasksBatchRoute).Methods("PATCH")    // []TaskChange, all or none
+	r.HandleFunc("/ops/{opID}/tasks/{taskID}", v2TaskRoute).Methods("PATCH") // TaskChange
+
+	r.HandleFunc("/teams", v2TeamCreateRoute).Methods("POST")                 // {name}
+	r.HandleFunc("/teams/{team}", v2TeamRoute).Methods("GET", "HEAD")         // without the agents
+	r.HandleFunc("/teams/{team}", v2TeamRenameRoute).Methods("PATCH")         // {name}
+	r.HandleFunc("/teams/{team}", v2TeamDeleteRoute).Methods("DELETE")        // owner only
+	r.HandleFunc("/teams/{team}/owner", v2TeamOwnerRoute).Methods("PUT")      // {owner}
+	r.HandleFunc("/teams/{team}/agents", v2TeamAgentsRoute).Methods("GET")    // paged
+	r.HandleFunc("/teams/{team}/agents", v2TeamAddAgentRoute).Methods("POST") // {agent}
+	r.HandleFunc("/teams/{team}/agents/{gid}", v2TeamRemoveAgentRoute).Methods("DELETE")
+}
+
 func optionsRoute(res http.ResponseWriter, req *http.Request) {
-	res.Header().Add("Allow", "GET, PUT, POST, OPTIONS, HEAD, DELETE")
+	res.Header().Add("Allow", "GET, PUT, POST, OPTIONS, HEAD, DELETE, PATCH")
 	res.WriteHeader(200)
 }
 
@@ -211,23 +309,17 @@ func notFoundJSONRoute(res http.ResponseWriter, req *http.Request) {
 	incrementScanner(req)
 	err := fmt.Errorf("file not found")
 	// log.Debugw(err.Error(), "URL", req.URL)
-	http.Error(res, jsonError(err), http.StatusNotFound)
+	apiFail(res, req, http.StatusNotFound, err)
 }
 
+// incrementScanner counts a 404 against the client's address, the count decays over time
 func incrementScanner(req *http.Request) {
-	ip, _, _ := net.SplitHostPort(req.RemoteAddr)
-	scanners.Increment(ip)
+	scanners.take(clientIP(req))
 }
 
 // true == block, false == permit
 func isScanner(req *http.Request) bool {
-	ip, _, _ := net.SplitHostPort(req.RemoteAddr)
-
-	i, ok := scanners.Get(ip)
-	if ok && i > 20 {
-		return true
-	}
-	return false
+	return scanners.empty(clientIP(req))
 }
 
 func fbmswRoute(res http.ResponseWriter, req *http.Request) {
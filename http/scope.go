@@ -0,0 +1,351 @@
+package wasabeehttps
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+
+	"github.com/wasabee-project/Wasabee-Server/config"
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+// the scopes a JWT can be limited to, a JWT without a scope claim can do anything the agent can
+const (
+	scopeOpsRead       = "ops:read"
+	scopeOpsWrite      = "ops:write"
+	scopeTeamsRead     = "teams:read"
+	scopeTeamsAdmin    = "teams:admin"
+	scopeLocationWrite = "location:write"
+	scopeProfileWrite  = "profile:write"
+	scopeMessagesSend  = "messages:send"
+)
+
+var knownScopes = map[string]bool{
+	scopeOpsRead:       true,
+	scopeOpsWrite:      true,
+	scopeTeamsRead:     true,
+	scopeTeamsAdmin:    true,
+	scopeLocationWrite: true,
+	scopeProfileWrite:  true,
+	scopeMessagesSend:  true,
+}
+
+// the private claims used to carry the scope in a JWT
+const (
+	claimScope = "scope" // space separated, as in OAuth
+	claimOps   = "ops"   // op IDs the token is limited to
+	claimTeams = "teams" // team IDs the token is limited to
+)
+
+// routes requested with POST which only read
+var readPOSTRoutes = map[string]bool{
+	"/teams": true,
+}
+
+// tokenScope is what a limited token is permitted to do, a nil *tokenScope is unlimited
+type tokenScope struct {
+	Scopes []string
+	Ops    []model.OperationID
+	Teams  []model.TeamID
+}
+
+// parseScope reads a space separated scope and comma separated op and team lists, an empty scope is unlimited
+func parseScope(scope, ops, teams string) (*tokenScope, error) {
+	if strings.TrimSpace(scope) == "" {
+		return nil, nil
+	}
+
+	s := tokenScope{}
+	for _, sc := range strings.Fields(scope) {
+		if !knownScopes[sc] {
+			return nil, fmt.Errorf("unknown scope: %s", sc)
+		}
+		s.Scopes = append(s.Scopes, sc)
+	}
+	for _, op := range strings.Split(ops, ",") {
+		if op = strings.TrimSpace(op); op != "" {
+			s.Ops = append(s.Ops, model.OperationID(op))
+		}
+	}
+	for _, team := range strings.Split(teams, ",") {
+		if team = strings.TrimSpace(team); team != "" {
+			s.Teams = append(s.Teams, model.TeamID(team))
+		}
+	}
+	return &s, nil
+}
+
+// scopeFromJWT reads the scope claims from a parsed JWT
+func scopeFromJWT(token jwt.Token) *tokenScope {
+	raw, ok := token.Get(claimScope)
+	if !ok {
+		return nil
+	}
+	scope, _ := raw.(string)
+
+	s := tokenScope{Scopes: strings.Fields(scope)}
+	for _, op := range claimList(token, claimOps) {
+		s.Ops = append(s.Ops, model.OperationID(op))
+	}
+	for _, team := range claimList(token, claimTeams) {
+		s.Teams = append(s.Teams, model.TeamID(team))
+	}
+	return &s
+}
+
+func claimList(token jwt.Token, claim string) []string {
+	var list []string
+
+	raw, ok := token.Get(claim)
+	if !ok {
+		return list
+	}
+	switch v := raw.(type) {
+	case []string:
+		list = v
+	case []interface{}:
+		for _, i := range v {
+			if s, ok := i.(string); ok {
+				list = append(list, s)
+			}
+		}
+	}
+	return list
+}
+
+// claims adds the scope to a JWT being built, an unlimited scope adds nothing
+func (s *tokenScope) claims(b *jwt.Builder) *jwt.Builder {
+	if s == nil {
+		return b
+	}
+
+	b = b.Claim(claimScope, strings.Join(s.Scopes, " "))
+	if len(s.Ops) > 0 {
+		ops := make([]string, 0, len(s.Ops))
+		for _, op := range s.Ops {
+			ops = append(ops, string(op))
+		}
+		b = b.Claim(claimOps, ops)
+	}
+	if len(s.Teams) > 0 {
+		teams := make([]string, 0, len(s.Teams))
+		for _, team := range s.Teams {
+			teams = append(teams, string(team))
+		}
+		b = b.Claim(claimTeams, teams)
+	}
+	return b
+}
+
+func (s *tokenScope) has(scope string) bool {
+	if s == nil {
+		return true
+	}
+	for _, sc := range s.Scopes {
+		if sc == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *tokenScope) allowsOp(opID model.OperationID) bool {
+	if s == nil || len(s.Ops) == 0 {
+		return true
+	}
+	for _, op := range s.Ops {
+		if op == opID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *tokenScope) allowsTeam(teamID model.TeamID) bool {
+	if s == nil || len(s.Teams) == 0 {
+		return true
+	}
+	for _, team := range s.Teams {
+		if team == teamID {
+			return true
+		}
+	}
+	return false
+}
+
+// within reports if s grants nothing beyond parent, used when a limited token requests another token
+func (s *tokenScope) within(parent *tokenScope) bool {
+	if parent == nil {
+		return true
+	}
+	if s == nil {
+		return false
+	}
+	for _, sc := range s.Scopes {
+		if !parent.has(sc) {
+			return false
+		}
+	}
+	if len(parent.Ops) > 0 {
+		if len(s.Ops) == 0 {
+			return false
+		}
+		for _, op := range s.Ops {
+			if !parent.allowsOp(op) {
+				return false
+			}
+		}
+	}
+	if len(parent.Teams) > 0 {
+		if len(s.Teams) == 0 {
+			return false
+		}
+		for _, team := range s.Teams {
+			if !parent.allowsTeam(team) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// routeTemplate is the matched route without the API prefix, e.g. /draw/{opID}; v2 routes keep /v2, e.g. /v2/ops/{opID}
+func routeTemplate(req *http.Request) string {
+	var tmpl string
+	if route := mux.CurrentRoute(req); route != nil {
+		tmpl, _ = route.GetPathTemplate()
+	}
+	if strings.HasPrefix(tmpl, v2PathURL+"/") {
+		return strings.TrimPrefix(tmpl, "/api")
+	}
+	return strings.TrimPrefix(tmpl, config.Get().HTTP.APIPathURL)
+}
+
+// readRequest reports if a request only reads data
+func readRequest(req *http.Request, tmpl string) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		// v2 has no GETs with side effects
+		if strings.HasPrefix(tmpl, "/v2/") {
+			return true
+		}
+		if tmpl == "/me" && req.URL.Query().Has("lat") {
+			return false
+		}
+		return readGETRoutes[tmpl]
+	case http.MethodPost:
+		return readPOSTRoutes[tmpl]
+	}
+	return false
+}
+
+// scopePermits checks a request against the scope of the token used to make it
+func scopePermits(s *tokenScope, req *http.Request) error {
+	if s == nil {
+		return nil
+	}
+
+	tmpl := routeTemplate(req)
+	if sessionOnlyRoutes[tmpl] {
+		return fmt.Errorf("limited tokens cannot be used for this request")
+	}
+
+	read := readRequest(req, tmpl)
+	vars := mux.Vars(req)
+	opID := model.OperationID(vars["opID"])
+	teamID := model.TeamID(vars["team"])
+
+	var need string
+	switch {
+	case strings.HasPrefix(tmpl, "/v2/"):
+		var err error
+		if need, err = v2ScopeNeeds(s, tmpl, read, opID, teamID); err != nil {
+			return err
+		}
+	case tmpl == "/me" && !read:
+		need = scopeLocationWrite
+	case tmpl == "/me", tmpl == "/me/jwtrefresh", tmpl == "/me/jwt":
+		// who am I, and refreshing or narrowing the token, are always permitted
+	case strings.HasPrefix(tmpl, "/me/"):
+		if !read {
+			need = scopeProfileWrite
+		}
+	case strings.HasPrefix(tmpl, "/draw"), strings.HasPrefix(tmpl, "/d"):
+		need = scopeOpsWrite
+		if read {
+			need = scopeOpsRead
+		}
+		if opID == "" && len(s.Ops) > 0 {
+			return fmt.Errorf("token limited to specific operations")
+		}
+	case strings.HasPrefix(tmpl, "/agent/"):
+		need = scopeMessagesSend
+		if read {
+			need = scopeTeamsRead
+		}
+	case strings.HasPrefix(tmpl, "/team"), tmpl == "/loc":
+		need = scopeTeamsAdmin
+		if read {
+			need = scopeTeamsRead
+		}
+		// the bulk fetch filters the list itself
+		if teamID == "" && len(s.Teams) > 0 && tmpl != "/teams" {
+			return fmt.Errorf("token limited to specific teams")
+		}
+	default:
+		return fmt.Errorf("limited tokens cannot be used for this request")
+	}
+
+	if need != "" && !s.has(need) {
+		return fmt.Errorf("token missing scope %s", need)
+	}
+	if opID != "" && !s.allowsOp(opID) {
+		return fmt.Errorf("token limited to other operations")
+	}
+	if teamID != "" && !s.allowsTeam(teamID) {
+		return fmt.Errorf("token limited to other teams")
+	}
+	return nil
+}
+
+// v2ScopeNeeds is the scope a v2 request needs, v2 has no GETs with side effects so read is only the method
+func v2ScopeNeeds(s *tokenScope, tmpl string, read bool, opID model.OperationID, teamID model.TeamID) (string, error) {
+	switch {
+	case tmpl == "/v2/me" && read:
+		return "", nil
+	case tmpl == "/v2/me/location":
+		return scopeLocationWrite, nil
+	case strings.HasPrefix(tmpl, "/v2/me"):
+		if read {
+			return "", nil
+		}
+		return scopeProfileWrite, nil
+	case strings.HasPrefix(tmpl, "/v2/ops"):
+		// the op list filters itself, but a token limited to some ops cannot make new ones
+		if opID == "" && !read && len(s.Ops) > 0 {
+			return "", fmt.Errorf("token limited to specific operations")
+		}
+		if read {
+			return scopeOpsRead, nil
+		}
+		return scopeOpsWrite, nil
+	case strings.HasPrefix(tmpl, "/v2/teams"):
+		if teamID == "" && len(s.Teams) > 0 {
+			return "", fmt.Errorf("token limited to specific teams")
+		}
+		if read {
+			return scopeTeamsRead, nil
+		}
+		return scopeTeamsAdmin, nil
+	}
+	return "", fmt.Errorf("limited tokens cannot be used for this request")
+}
+
+// requestScope returns the scope authMW found on the request's token
+func requestScope(req *http.Request) *tokenScope {
+	s, _ := req.Context().Value("X-Wasabee-Scope").(*tokenScope)
+	return s
+}
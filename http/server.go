@@ -3,7 +3,9 @@ package wasabeehttps
 import (
 	"context"
 	"crypto/tls"
+	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"os"
@@ -16,13 +18,20 @@ import (
 	// "github.com/lestrrat-go/jwx/v2/jws"
 	"github.com/lestrrat-go/jwx/v2/jws"
 	"github.com/lestrrat-go/jwx/v2/jwt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
 
 	// "github.com/gorilla/sessions"
 	"github.com/wasabee-project/Wasabee-Server/auth"
 	"github.com/wasabee-project/Wasabee-Server/config"
 	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/metrics"
 	"github.com/wasabee-project/Wasabee-Server/model"
-	"github.com/wasabee-project/Wasabee-Server/util"
+	"github.com/wasabee-project/Wasabee-Server/tracing"
 
 	// XXX gorilla has logging middleware, use that instead?
 	"github.com/unrolled/logger"
@@ -30,6 +39,9 @@ import (
 
 var srv *http.Server
 
+// cancelled at shutdown, so database work for requests still running is abandoned
+var baseCtx, cancelBase = context.WithCancel(context.Background())
+
 var unrolled *logger.Logger
 
 // var oauthStateString string
@@ -39,13 +51,20 @@ const jsonTypeShort = "application/json"
 const jsonStatusOK = `{"status":"ok"}`
 const jsonStatusEmpty = `{"status":"error","error":"Empty JSON"}`
 
+// requestTimeout bounds the database work for a request, a little under the server's WriteTimeout since nobody will get the response after that
+const requestTimeout = 25 * time.Second
+
+// how long Shutdown waits for running requests before cancelling them
+const shutdownGrace = 10 * time.Second
+
 // Start launches the HTTP server which is responsible for the frontend and the HTTP API.
 func Start() {
 	c := config.Get()
 	c.HTTP.Webroot = strings.TrimSuffix(c.HTTP.Webroot, "/")
 
-	// set up the scanners list
-	scanners = util.NewSafemap()
+	// set up the rate limits, scanner counts and blocklist
+	setupLimits()
+	go limitsLoop(baseCtx)
 
 	oc := config.GetOauthConfig()
 	if oc.ClientID == "" || oc.ClientSecret == "" {
@@ -73,6 +92,10 @@ func Start() {
 			"/apple-touch-icon.png"},
 	})
 
+	// for the container orchestrator and on-call, on the private metrics listener since the reports include error text and peer addresses
+	metrics.Handle("/healthz", http.HandlerFunc(healthzRoute)) // liveness, always 200 with the subsystem report
+	metrics.Handle("/readyz", http.HandlerFunc(readyzRoute))   // readiness, 503 if the database or templates are down
+
 	// setup the main router an built-in subrouters
 	router := setupRouter()
 
@@ -83,6 +106,7 @@ func Start() {
 		WriteTimeout:      (30 * time.Second),
 		ReadTimeout:       (30 * time.Second),
 		ReadHeaderTimeout: (2 * time.Second),
+		BaseContext:       func(net.Listener) context.Context { return baseCtx },
 		TLSConfig: &tls.Config{
 			MinVersion:               tls.VersionTLS12,
 			CurvePreferences:         []tls.CurveID{tls.CurveP521, tls.CurveP384, tls.CurveP256},
@@ -101,20 +125,44 @@ func Start() {
 // Shutdown forces a graceful shutdown of the https server
 func Shutdown() error {
 	log.Infow("shutdown", "message", "shutting down HTTPS server")
-	if err := srv.Shutdown(context.Background()); err != nil {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownGrace)
+	defer cancel()
+	defer cancelBase()
+	if err := srv.Shutdown(ctx); err != nil {
 		log.Error(err)
 		return err
 	}
 	return nil
 }
 
+// deadlineMW gives each request a deadline, a client disconnecting cancels it sooner
+// model calls made with req.Context() stop when either happens, freeing their database connections
+func deadlineMW(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		ctx, cancel := context.WithTimeout(req.Context(), requestTimeout)
+		defer cancel()
+		next.ServeHTTP(res, req.WithContext(ctx))
+	})
+}
+
 func headersMW(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
-		if isScanner(req) {
-			log.Warnw("scanner detected", "ip", req.RemoteAddr)
-			http.Error(res, "permission denied", http.StatusForbidden)
-			return
-		}
+		// continue the caller's trace, if they sent one
+		route := routeName(req)
+		ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+		ctx, span := tracing.Span(ctx, req.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPMethod(req.Method), semconv.HTTPRoute(route), semconv.URLPath(req.URL.Path), semconv.ClientAddress(req.RemoteAddr)))
+		defer span.End()
+		req = req.WithContext(ctx)
+		rec := &statusRecorder{ResponseWriter: res, status: http.StatusOK}
+		res = rec
+		defer func() {
+			span.SetAttributes(semconv.HTTPStatusCode(rec.status))
+			if rec.status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(rec.status))
+			}
+		}()
 
 		permitted := config.Get().HTTP.CORS
 		ref := permitted[0]
@@ -131,7 +179,7 @@ func headersMW(next http.Handler) http.Handler {
 		res.Header().Add("Access-Control-Allow-Origin", ref)
 		res.Header().Add("Access-Control-Allow-Methods", "POST, GET, PUT, OPTIONS, HEAD, DELETE, PATCH")
 		res.Header().Add("Access-Control-Allow-Credentials", "true")
-		res.Header().Add("Access-Control-Allow-Headers", "Content-Type, Accept, If-Modified-Since, If-Match, If-None-Match, Authorization")
+		res.Header().Add("Access-Control-Allow-Headers", "Content-Type, Accept, If-Modified-Since, If-Match, If-None-Match, Authorization, Idempotency-Key")
 		res.Header().Add("Content-Type", jsonType)
 		next.ServeHTTP(res, req)
 	})
@@ -155,7 +203,46 @@ func authMW(next http.Handler) http.Handler {
 		h := req.Header.Get("Authorization")
 		if h == "" {
 			log.Infow("JWT missing")
-			http.Error(res, "JWT missing", http.StatusUnauthorized)
+			apiFail(res, req, http.StatusUnauthorized, fmt.Errorf("JWT missing"))
+			return
+		}
+
+		// personal API tokens for scripts and bots
+		if strings.HasPrefix(h, "Bearer "+model.APITokenPrefix) {
+			t, err := model.LookupAPIToken(req.Context(), strings.TrimPrefix(h, "Bearer "))
+			if err != nil {
+				log.Infow("API token rejected", "error", err)
+				apiFail(res, req, http.StatusUnauthorized, err)
+				return
+			}
+			if t.Gid.RISC(req.Context()) {
+				err := fmt.Errorf("account locked")
+				log.Infow(err.Error(), "GID", t.Gid, "token ID", t.ID)
+				apiFail(res, req, http.StatusForbidden, err)
+				return
+			}
+			// the blacklists apply to API tokens as they do to logins
+			if authorized, err := apiTokenAgentAuthorized(req.Context(), t.Gid); !authorized {
+				if err == nil {
+					err = fmt.Errorf("access denied")
+				}
+				log.Infow("API token agent not authorized", "GID", t.Gid, "token ID", t.ID, "error", err)
+				apiFail(res, req, http.StatusForbidden, err)
+				return
+			}
+			if err := apiTokenPermits(t, req); err != nil {
+				log.Infow(err.Error(), "GID", t.Gid, "token ID", t.ID, "path", req.URL.Path)
+				apiFail(res, req, http.StatusForbidden, err)
+				return
+			}
+
+			trace.SpanFromContext(req.Context()).SetAttributes(semconv.EnduserID(string(t.Gid)), attribute.String("wasabee.auth", "apitoken"), attribute.String("wasabee.apitoken", t.ID))
+
+			ctx := context.WithValue(req.Context(), "X-Wasabee-GID", t.Gid)
+			ctx = context.WithValue(ctx, "X-Wasabee-APIToken", t)
+			ctx = context.WithValue(ctx, "X-Wasabee-Scope", apiTokenScope(t))
+			req = req.WithContext(ctx)
+			next.ServeHTTP(res, req)
 			return
 		}
 
@@ -168,43 +255,68 @@ func authMW(next http.Handler) http.Handler {
 		)
 		if err != nil {
 			log.Info(err)
-			http.Error(res, err.Error(), http.StatusUnauthorized)
+			apiFail(res, req, http.StatusUnauthorized, err)
 			return
 		}
 
 		// expiration validation is implicit -- redundant with above now
 		if err := jwt.Validate(token, jwt.WithAudience(sessionName)); err != nil {
 			log.Infow("JWT validate failed", "error", err, "sub", token.Subject())
-			http.Error(res, err.Error(), http.StatusUnauthorized)
+			apiFail(res, req, http.StatusUnauthorized, err)
 			return
 		}
 
 		if auth.IsRevokedJWT(token.JwtID()) {
-			log.Infow("JWT revoked", "sub", token.Subject(), "token ID", token.JwtID())
-			http.Error(res, err.Error(), http.StatusUnauthorized)
+			err := fmt.Errorf("JWT revoked")
+			log.Infow(err.Error(), "sub", token.Subject(), "token ID", token.JwtID())
+			apiFail(res, req, http.StatusUnauthorized, err)
 			return
 		}
 
 		gid := model.GoogleID(token.Subject())
 		// too db intensive? -- cache it?
-		if !gid.Valid() {
+		if !gid.Valid(req.Context()) {
 			// token minted on another server, never logged in to this server
-			if err := gid.FirstLogin(); err != nil {
+			if err := gid.FirstLogin(req.Context()); err != nil {
 				log.Info(err)
-				http.Error(res, err.Error(), http.StatusUnauthorized)
+				apiFail(res, req, http.StatusUnauthorized, err)
 				return
 			}
 		}
 
+		// limited tokens, e.g. for location-only clients
+		scope := scopeFromJWT(token)
+		if err := scopePermits(scope, req); err != nil {
+			log.Infow(err.Error(), "GID", gid, "token ID", token.JwtID(), "path", req.URL.Path)
+			apiFail(res, req, http.StatusForbidden, err)
+			return
+		}
+
+		span := trace.SpanFromContext(req.Context())
+		span.SetAttributes(semconv.EnduserID(string(gid)), attribute.String("wasabee.auth", "jwt"), attribute.String("wasabee.jwtid", token.JwtID()))
+		if scope != nil {
+			span.SetAttributes(attribute.StringSlice("wasabee.scope", scope.Scopes))
+		}
+
 		// pass the GoogleID around so subsequent functions can easily access it
 		ctx := context.WithValue(req.Context(), "X-Wasabee-GID", gid)
+		ctx = context.WithValue(ctx, "X-Wasabee-Scope", scope)
+		ctx = context.WithValue(ctx, "X-Wasabee-JWTID", token.JwtID())
 		req = req.WithContext(ctx)
 		next.ServeHTTP(res, req)
 	})
 }
 
 func jsonError(e error) string {
-	return fmt.Sprintf(`{"status":"error","error":"%s"}`, e.Error())
+	// marshalled rather than formatted, error text may hold quotes
+	b, err := json.Marshal(struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+	}{"error", e.Error()})
+	if err != nil {
+		return `{"status":"error"}`
+	}
+	return string(b)
 }
 
 func debugMW(next http.Handler) http.Handler {
@@ -0,0 +1,113 @@
+package wasabeehttps
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wasabee-project/Wasabee-Server/auth"
+	"github.com/wasabee-project/Wasabee-Server/federation"
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+// currentJWTID is the ID of the JWT used to make the request
+func currentJWTID(req *http.Request) string {
+	id, _ := req.Context().Value("X-Wasabee-JWTID").(string)
+	return id
+}
+
+// meSessionsRoute lists the agent's active JWTs
+func meSessionsRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	sessions, err := gid.Sessions(req.Context())
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	current := currentJWTID(req)
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+	json.NewEncoder(res).Encode(sessions)
+}
+
+// meRevokeSessionRoute revokes one of the agent's JWTs, here and on federated servers
+func meRevokeSessionRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	vars := mux.Vars(req)
+	id := vars["id"]
+
+	ok, err := gid.HasSession(req.Context(), id)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		err := fmt.Errorf("session not found")
+		log.Warnw(err.Error(), "GID", gid, "token ID", id)
+		http.Error(res, jsonError(err), http.StatusNotFound)
+		return
+	}
+
+	auth.RevokeJWT(req.Context(), id)
+	go federation.RevokeJWT(context.Background(), id)
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+// meRevokeAllSessionsRoute revokes all the agent's JWTs except the one making the request, unless current=true
+func meRevokeAllSessionsRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	keep := currentJWTID(req)
+	if req.FormValue("current") == "true" {
+		keep = ""
+	}
+	if _, err := revokeSessions(req.Context(), gid, keep); err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+// revokeSessions revokes all an agent's JWTs except keep, here and on federated servers
+func revokeSessions(ctx context.Context, gid model.GoogleID, keep string) (int, error) {
+	ids, err := gid.SessionIDs(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return revokeSessionIDs(ctx, gid, ids, keep), nil
+}
+
+// revokeSessionIDs revokes the listed JWTs except keep, for when the agent's sessions are gone by the time they can be revoked
+func revokeSessionIDs(ctx context.Context, gid model.GoogleID, ids []string, keep string) int {
+	var count int
+	for _, id := range ids {
+		if id == keep {
+			continue
+		}
+		auth.RevokeJWT(ctx, id)
+		go federation.RevokeJWT(context.Background(), id)
+		count++
+	}
+	log.Infow("revoked sessions", "GID", gid, "count", count)
+	return count
+}
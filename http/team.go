@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
 
@@ -23,19 +24,19 @@ func getTeamRoute(res http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	team := model.TeamID(vars["team"])
 
-	if !team.Valid() {
+	if !team.Valid(req.Context()) {
 		err := fmt.Errorf("team not found")
 		http.Error(res, jsonError(err), http.StatusNotFound)
 		return
 	}
 
-	isowner, err := gid.OwnsTeam(team)
+	isowner, err := gid.OwnsTeam(req.Context(), team)
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
 
-	onteam, err := gid.AgentInTeam(team)
+	onteam, err := gid.AgentInTeam(req.Context(), team)
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
@@ -47,7 +48,16 @@ func getTeamRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	teamList, err := team.FetchTeam()
+	stamp, err := team.Stamp(req.Context())
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	if notModified(res, req, etag("team", stamp, strconv.FormatBool(isowner))) {
+		return
+	}
+
+	teamList, err := team.FetchTeam(req.Context())
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
@@ -57,6 +67,7 @@ func getTeamRoute(res http.ResponseWriter, req *http.Request) {
 		teamList.RocksComm = ""
 		teamList.RocksKey = ""
 		teamList.JoinLinkToken = ""
+		teamList.RosterURL = ""
 	}
 	json.NewEncoder(res).Encode(&teamList)
 }
@@ -77,7 +88,7 @@ func newTeamRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	_, err = gid.NewTeam(name)
+	_, err = gid.NewTeam(req.Context(), name)
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
@@ -94,7 +105,7 @@ func deleteTeamRoute(res http.ResponseWriter, req *http.Request) {
 
 	vars := mux.Vars(req)
 	team := model.TeamID(vars["team"])
-	safe, err := gid.OwnsTeam(team)
+	safe, err := gid.OwnsTeam(req.Context(), team)
 	if err != nil {
 		log.Error(err)
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
@@ -106,7 +117,7 @@ func deleteTeamRoute(res http.ResponseWriter, req *http.Request) {
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
 	}
-	if err = team.Delete(); err != nil {
+	if err = team.Delete(req.Context()); err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
@@ -122,7 +133,7 @@ func chownTeamRoute(res http.ResponseWriter, req *http.Request) {
 
 	vars := mux.Vars(req)
 	team := model.TeamID(vars["team"])
-	safe, err := gid.OwnsTeam(team)
+	safe, err := gid.OwnsTeam(req.Context(), team)
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
@@ -134,12 +145,12 @@ func chownTeamRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	togid, err := model.ToGid(vars["to"])
+	togid, err := model.ToGid(req.Context(), vars["to"])
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
-	if err = team.Chown(togid); err != nil {
+	if err = team.Chown(req.Context(), togid); err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
@@ -157,7 +168,7 @@ func addAgentToTeamRoute(res http.ResponseWriter, req *http.Request) {
 	team := model.TeamID(vars["team"])
 	key := vars["key"]
 
-	safe, err := gid.OwnsTeam(team)
+	safe, err := gid.OwnsTeam(req.Context(), team)
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
@@ -170,7 +181,7 @@ func addAgentToTeamRoute(res http.ResponseWriter, req *http.Request) {
 	}
 
 	if key != "" { // prevents a bit of log spam
-		togid, err := model.ToGid(key)
+		togid, err := model.ToGid(req.Context(), key)
 		if err != nil && err.Error() == model.ErrAgentNotFound {
 			http.Error(res, jsonError(err), http.StatusNotAcceptable)
 			return
@@ -178,10 +189,11 @@ func addAgentToTeamRoute(res http.ResponseWriter, req *http.Request) {
 			http.Error(res, jsonError(err), http.StatusInternalServerError)
 			return
 		}
-		if err = team.AddAgent(togid); err != nil {
+		if err = team.AddAgent(req.Context(), togid); err != nil {
 			http.Error(res, jsonError(err), http.StatusInternalServerError)
 			return
 		}
+		team.AuditMembership(req.Context(), gid, model.AuditSourceOwner, togid, model.AuditActionAdd)
 	}
 	fmt.Fprint(res, jsonStatusOK)
 }
@@ -195,12 +207,12 @@ func delAgentFmTeamRoute(res http.ResponseWriter, req *http.Request) {
 
 	vars := mux.Vars(req)
 	team := model.TeamID(vars["team"])
-	togid, err := model.ToGid(vars["key"])
+	togid, err := model.ToGid(req.Context(), vars["key"])
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
-	safe, err := gid.OwnsTeam(team)
+	safe, err := gid.OwnsTeam(req.Context(), team)
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
@@ -217,10 +229,11 @@ func delAgentFmTeamRoute(res http.ResponseWriter, req *http.Request) {
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
 	}
-	if err = team.RemoveAgent(togid); err != nil {
+	if err = team.RemoveAgent(req.Context(), togid); err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
+	team.AuditMembership(req.Context(), gid, model.AuditSourceOwner, togid, model.AuditActionRemove)
 	fmt.Fprint(res, jsonStatusOK)
 }
 
@@ -233,7 +246,7 @@ func announceTeamRoute(res http.ResponseWriter, req *http.Request) {
 
 	vars := mux.Vars(req)
 	team := model.TeamID(vars["team"])
-	safe, err := gid.OwnsTeam(team)
+	safe, err := gid.OwnsTeam(req.Context(), team)
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
@@ -250,7 +263,7 @@ func announceTeamRoute(res http.ResponseWriter, req *http.Request) {
 		message = "This is a toast notification"
 	}
 
-	messaging.SendAnnounce(messaging.TeamID(team), messaging.Announce{
+	messaging.SendAnnounce(req.Context(), messaging.TeamID(team), messaging.Announce{
 		Text:   message,
 		Sender: messaging.GoogleID(gid),
 		TeamID: messaging.TeamID(team),
@@ -268,7 +281,7 @@ func setAgentTeamCommentRoute(res http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	teamID := model.TeamID(vars["team"])
 
-	if owns, _ := gid.OwnsTeam(teamID); !owns {
+	if owns, _ := gid.OwnsTeam(req.Context(), teamID); !owns {
 		err = fmt.Errorf("forbidden: only the team owner can set comments")
 		log.Warnw(err.Error(), "resource", teamID, "gid", gid)
 		http.Error(res, jsonError(err), http.StatusForbidden)
@@ -277,7 +290,7 @@ func setAgentTeamCommentRoute(res http.ResponseWriter, req *http.Request) {
 
 	inGid := model.GoogleID(vars["gid"])
 	squad := util.Sanitize(req.FormValue("squad"))
-	if err = teamID.SetComment(inGid, squad); err != nil {
+	if err = teamID.SetComment(req.Context(), inGid, squad); err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
@@ -294,7 +307,7 @@ func renameTeamRoute(res http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	teamID := model.TeamID(vars["team"])
 
-	if owns, _ := gid.OwnsTeam(teamID); !owns {
+	if owns, _ := gid.OwnsTeam(req.Context(), teamID); !owns {
 		err = fmt.Errorf("only the team owner can rename a team")
 		log.Warnw(err.Error(), "resource", teamID, "gid", gid)
 		http.Error(res, jsonError(err), http.StatusForbidden)
@@ -308,7 +321,7 @@ func renameTeamRoute(res http.ResponseWriter, req *http.Request) {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
-	if err := teamID.Rename(teamname); err != nil {
+	if err := teamID.Rename(req.Context(), teamname); err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
@@ -326,8 +339,8 @@ func genJoinKeyRoute(res http.ResponseWriter, req *http.Request) {
 	teamID := model.TeamID(vars["team"])
 
 	var key string
-	if owns, _ := gid.OwnsTeam(teamID); owns {
-		key, err = teamID.GenerateJoinToken()
+	if owns, _ := gid.OwnsTeam(req.Context(), teamID); owns {
+		key, err = teamID.GenerateJoinToken(req.Context())
 		if err != nil {
 			http.Error(res, jsonError(err), http.StatusInternalServerError)
 			return
@@ -360,14 +373,14 @@ func delJoinKeyRoute(res http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	teamID := model.TeamID(vars["team"])
 
-	if owns, _ := gid.OwnsTeam(teamID); !owns {
+	if owns, _ := gid.OwnsTeam(req.Context(), teamID); !owns {
 		err = fmt.Errorf("forbidden: only the team owner can remove join links")
 		log.Warnw(err.Error(), "resource", teamID, "gid", gid)
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
 	}
 
-	if err := teamID.DeleteJoinToken(); err != nil {
+	if err := teamID.DeleteJoinToken(req.Context()); err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
@@ -386,7 +399,7 @@ func joinLinkRoute(res http.ResponseWriter, req *http.Request) {
 	teamID := model.TeamID(vars["team"])
 	key := vars["key"]
 
-	if err = teamID.JoinToken(gid, key); err != nil {
+	if err = teamID.JoinToken(req.Context(), gid, key); err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
@@ -401,7 +414,7 @@ func getAgentsLocation(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	list, err := gid.GetAgentLocations()
+	list, err := gid.GetAgentLocations(req.Context())
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
@@ -432,22 +445,27 @@ func bulkTeamFetchRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	scope := requestScope(req)
 	var list []model.TeamData
 	for _, team := range requestedteams.TeamIDs {
-		isowner, err := gid.OwnsTeam(team)
+		if !scope.allowsTeam(team) {
+			continue
+		}
+
+		isowner, err := gid.OwnsTeam(req.Context(), team)
 		if err != nil {
 			log.Error(err)
 			continue
 		}
 
-		onteam, err := gid.AgentInTeam(team)
+		onteam, err := gid.AgentInTeam(req.Context(), team)
 		if err != nil {
 			continue
 		}
 		if !isowner && !onteam {
 			continue
 		}
-		t, err := team.FetchTeam()
+		t, err := team.FetchTeam(req.Context())
 		if err != nil {
 			log.Errorw(err.Error(), "teamID", team, "gid", gid)
 			continue
@@ -457,6 +475,7 @@ func bulkTeamFetchRoute(res http.ResponseWriter, req *http.Request) {
 			t.RocksComm = ""
 			t.RocksKey = ""
 			t.JoinLinkToken = ""
+			t.RosterURL = ""
 		}
 
 		list = append(list, *t)
@@ -470,3 +489,176 @@ func bulkTeamFetchRoute(res http.ResponseWriter, req *http.Request) {
 
 	json.NewEncoder(res).Encode(list)
 }
+
+// setTeamParentRoute places a team under a parent team; the caller must own both teams since the members of the child gain access to the parent's ops
+func setTeamParentRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	vars := mux.Vars(req)
+	teamID := model.TeamID(vars["team"])
+	parent := model.TeamID(req.FormValue("parent"))
+
+	ownsChild, err := gid.OwnsTeam(req.Context(), teamID)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	ownsParent, err := gid.OwnsTeam(req.Context(), parent)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	if !ownsChild || !ownsParent {
+		err = fmt.Errorf("only the owner of both teams can group them")
+		log.Warnw(err.Error(), "resource", teamID, "parent", parent, "gid", gid)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	if err := teamID.SetParent(req.Context(), parent); err != nil {
+		http.Error(res, jsonError(err), http.StatusNotAcceptable)
+		return
+	}
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+// clearTeamParentRoute removes a team from its group; either the team's owner or the parent's owner may do this
+func clearTeamParentRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	vars := mux.Vars(req)
+	teamID := model.TeamID(vars["team"])
+
+	parent, err := teamID.Parent(req.Context())
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	if parent == "" {
+		fmt.Fprint(res, jsonStatusOK)
+		return
+	}
+
+	ownsChild, err := gid.OwnsTeam(req.Context(), teamID)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	ownsParent, err := gid.OwnsTeam(req.Context(), parent)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	if !ownsChild && !ownsParent {
+		err = fmt.Errorf("forbidden")
+		log.Warnw(err.Error(), "resource", teamID, "parent", parent, "gid", gid)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	if err := teamID.ClearParent(req.Context()); err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+func teamAuditRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	vars := mux.Vars(req)
+	team := model.TeamID(vars["team"])
+	safe, err := gid.OwnsTeam(req.Context(), team)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	if !safe {
+		err := fmt.Errorf("forbidden")
+		log.Warnw(err.Error(), "resource", team, "gid", gid)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	entries, err := team.AuditLog(req.Context())
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(res).Encode(entries)
+}
+
+// applySyncRoute applies a previously previewed V or .rocks sync
+func applySyncRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	vars := mux.Vars(req)
+	team := model.TeamID(vars["team"])
+	safe, err := gid.OwnsTeam(req.Context(), team)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	if !safe {
+		err := fmt.Errorf("forbidden")
+		log.Warnw(err.Error(), "resource", team, "gid", gid)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	diff, err := team.TakeSyncDiff(vars["id"])
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusNotFound)
+		return
+	}
+	if err := diff.Apply(req.Context(), gid); err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprint(res, jsonStatusOK)
+}
+
+func neverRemoveTeamRoute(res http.ResponseWriter, req *http.Request) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+
+	vars := mux.Vars(req)
+	team := model.TeamID(vars["team"])
+	safe, err := gid.OwnsTeam(req.Context(), team)
+	if err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	if !safe {
+		err := fmt.Errorf("forbidden")
+		log.Warnw(err.Error(), "resource", team, "gid", gid)
+		http.Error(res, jsonError(err), http.StatusForbidden)
+		return
+	}
+
+	state := vars["state"]
+	if err := team.SetNeverRemove(req.Context(), state == "On" || state == "on"); err != nil {
+		http.Error(res, jsonError(err), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprint(res, jsonStatusOK)
+}
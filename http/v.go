@@ -8,6 +8,7 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/wasabee-project/Wasabee-Server/log"
 	"github.com/wasabee-project/Wasabee-Server/model"
+	"github.com/wasabee-project/Wasabee-Server/roster"
 	"github.com/wasabee-project/Wasabee-Server/v"
 )
 
@@ -21,7 +22,7 @@ func vPullTeamRoute(res http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	team := model.TeamID(vars["team"])
 
-	owns, err := gid.OwnsTeam(team)
+	owns, err := gid.OwnsTeam(req.Context(), team)
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
@@ -33,22 +34,18 @@ func vPullTeamRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	vkey, err := gid.GetVAPIkey()
+	p, err := roster.Get(model.AuditSourceV)
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusNotAcceptable)
 		return
 	}
-	if vkey == "" {
-		err := fmt.Errorf("V API key not configured")
-		log.Errorw(err.Error(), "GID", gid)
-		http.Error(res, jsonError(err), http.StatusForbidden)
-		return
-	}
 
-	if err := v.Sync(req.Context(), team, vkey); err != nil {
+	if err := roster.Sync(req.Context(), p, team); err != nil {
+		_ = team.SetSyncStatus(req.Context(), err.Error())
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
+	_ = team.SetSyncStatus(req.Context(), "ok")
 
 	fmt.Fprint(res, jsonStatusOK)
 }
@@ -63,7 +60,7 @@ func vConfigureTeamRoute(res http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	team := model.TeamID(vars["team"])
 
-	owns, err := gid.OwnsTeam(team)
+	owns, err := gid.OwnsTeam(req.Context(), team)
 	if err != nil {
 		http.Error(res, jsonError(err), http.StatusForbidden)
 		return
@@ -91,7 +88,7 @@ func vConfigureTeamRoute(res http.ResponseWriter, req *http.Request) {
 	role := uint8(r)
 
 	log.Infow("linking team to V", "GID", gid, "teamID", team, "vteam", vteam, "role", role)
-	if err := team.VConfigure(vteam, role); err != nil {
+	if err := team.VConfigure(req.Context(), vteam, role); err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
@@ -108,7 +105,7 @@ func vBulkImportRoute(res http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	mode := vars["mode"]
 
-	if err = v.BulkImport(gid, mode); err != nil {
+	if err = v.BulkImport(req.Context(), gid, mode); err != nil {
 		http.Error(res, jsonError(err), http.StatusInternalServerError)
 		return
 	}
@@ -0,0 +1,200 @@
+package wasabeehttps
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+// v2PathURL is the prefix of the second version of the API: resource-oriented routes, JSON bodies and structured errors
+const v2PathURL = "/api/v2"
+
+// the error codes of the v2 API, clients should switch on these rather than on the message
+const (
+	codeBadRequest         = "bad_request"         // the body or a parameter could not be parsed
+	codeUnauthenticated    = "unauthenticated"     // no valid JWT or API token
+	codeForbidden          = "forbidden"           // the agent may not do this
+	codeNotFound           = "not_found"           // no such agent, operation, team or task
+	codeConflict           = "conflict"            // the request clashes with the current state, e.g. a busy Idempotency-Key
+	codeGone               = "gone"                // the operation was deleted
+	codePreconditionFailed = "precondition_failed" // If-Match did not match, fetch the resource again
+	codeTooLarge           = "too_large"           // too many items in one request
+	codeUnsupportedMedia   = "unsupported_media"   // the body is not application/json
+	codeInvalid            = "invalid"             // the request was understood but the values are not acceptable
+	codeRateLimited        = "rate_limited"        // slow down, see Retry-After
+	codeInternal           = "internal"            // something went wrong on the server
+)
+
+// the code sent when a handler does not give a more specific one
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            codeBadRequest,
+	http.StatusUnauthorized:          codeUnauthenticated,
+	http.StatusForbidden:             codeForbidden,
+	http.StatusNotFound:              codeNotFound,
+	http.StatusMethodNotAllowed:      codeNotFound,
+	http.StatusNotAcceptable:         codeInvalid,
+	http.StatusConflict:              codeConflict,
+	http.StatusGone:                  codeGone,
+	http.StatusPreconditionFailed:    codePreconditionFailed,
+	http.StatusRequestEntityTooLarge: codeTooLarge,
+	http.StatusUnsupportedMediaType:  codeUnsupportedMedia,
+	http.StatusUnprocessableEntity:   codeInvalid,
+	http.StatusTooManyRequests:       codeRateLimited,
+}
+
+// apiError is the body of every v2 error response
+type apiError struct {
+	Status  int         `json:"status"`
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"` // e.g. which entries of a batch failed
+}
+
+// v2Error sends err as an apiError, an empty code is derived from the status
+func v2Error(res http.ResponseWriter, status int, code string, err error) {
+	v2ErrorDetails(res, status, code, err, nil)
+}
+
+// v2ErrorDetails is v2Error with more about what went wrong
+func v2ErrorDetails(res http.ResponseWriter, status int, code string, err error, details interface{}) {
+	if code == "" {
+		code = statusCodes[status]
+		if code == "" {
+			code = codeInternal
+		}
+	}
+
+	res.Header().Set("Content-Type", jsonType)
+	res.Header().Set("X-Content-Type-Options", "nosniff")
+	res.WriteHeader(status)
+	if err := json.NewEncoder(res).Encode(apiError{Status: status, Code: code, Message: err.Error(), Details: details}); err != nil {
+		log.Error(err)
+	}
+}
+
+func isV2(req *http.Request) bool {
+	return strings.HasPrefix(req.URL.Path, v2PathURL+"/")
+}
+
+// apiFail sends err in the error format of the API version requested, for the middleware shared by both versions
+func apiFail(res http.ResponseWriter, req *http.Request, status int, err error) {
+	if isV2(req) {
+		v2Error(res, status, "", err)
+		return
+	}
+	http.Error(res, jsonError(err), status)
+}
+
+// v2Decode reads a JSON request body into v, on failure the error has been sent
+func v2Decode(res http.ResponseWriter, req *http.Request, v interface{}) bool {
+	if !contentTypeIs(req, jsonTypeShort) {
+		v2Error(res, http.StatusUnsupportedMediaType, "", fmt.Errorf("request body must be %s", jsonTypeShort))
+		return false
+	}
+	if err := json.NewDecoder(req.Body).Decode(v); err != nil {
+		log.Infow(err.Error(), "path", req.URL.Path)
+		v2Error(res, http.StatusBadRequest, "", err)
+		return false
+	}
+	return true
+}
+
+// v2JSON sends v with the given status
+func v2JSON(res http.ResponseWriter, status int, v interface{}) {
+	res.Header().Set("Content-Type", jsonType)
+	res.WriteHeader(status)
+	if err := json.NewEncoder(res).Encode(v); err != nil {
+		log.Error(err)
+	}
+}
+
+// v2Agent is the logged in agent, on failure the error has been sent
+func v2Agent(res http.ResponseWriter, req *http.Request) (model.GoogleID, bool) {
+	gid, err := getAgentID(req)
+	if err != nil {
+		v2Error(res, http.StatusUnauthorized, "", err)
+		return gid, false
+	}
+	return gid, true
+}
+
+// v2Resolve finds the agent named in a request body by GoogleID or name, on failure the error has been sent
+func v2Resolve(ctx context.Context, res http.ResponseWriter, agent string) (model.GoogleID, bool) {
+	gid, err := model.ToGid(ctx, agent)
+	if err != nil {
+		if err.Error() == model.ErrAgentNotFound || err.Error() == model.ErrEmptyAgent {
+			v2Error(res, http.StatusUnprocessableEntity, codeNotFound, err)
+		} else {
+			v2Error(res, http.StatusInternalServerError, "", err)
+		}
+		return gid, false
+	}
+	return gid, true
+}
+
+// page sizes for the v2 lists
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 500
+)
+
+// page is one slice of a list, Next is the offset of the following page and absent on the last one
+type page struct {
+	Items  interface{} `json:"items"`
+	Total  int         `json:"total"`
+	Offset int         `json:"offset"`
+	Limit  int         `json:"limit"`
+	Next   *int        `json:"next,omitempty"`
+}
+
+// pageParams reads the offset and limit query parameters, on failure the error has been sent
+func pageParams(res http.ResponseWriter, req *http.Request) (offset, limit int, ok bool) {
+	limit = defaultPageLimit
+
+	q := req.URL.Query()
+	if s := q.Get("offset"); s != "" {
+		o, err := strconv.Atoi(s)
+		if err != nil || o < 0 {
+			v2Error(res, http.StatusBadRequest, "", fmt.Errorf("offset must be a number, 0 or more"))
+			return 0, 0, false
+		}
+		offset = o
+	}
+	if s := q.Get("limit"); s != "" {
+		l, err := strconv.Atoi(s)
+		if err != nil || l < 1 || l > maxPageLimit {
+			v2Error(res, http.StatusBadRequest, "", fmt.Errorf("limit must be a number from 1 to %d", maxPageLimit))
+			return 0, 0, false
+		}
+		limit = l
+	}
+	return offset, limit, true
+}
+
+// window is the part of a list of total items a page covers, as slice bounds
+func window(total, offset, limit int) (start, end int) {
+	start = offset
+	if start > total {
+		start = total
+	}
+	end = start + limit
+	if end > total {
+		end = total
+	}
+	return start, end
+}
+
+// newPage describes items, the [start:end] slice of a list of total items
+func newPage(items interface{}, total, start, end, limit int) page {
+	p := page{Items: items, Total: total, Offset: start, Limit: limit}
+	if end < total {
+		p.Next = &end
+	}
+	return p
+}
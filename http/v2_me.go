@@ -0,0 +1,166 @@
+package wasabeehttps
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wasabee-project/Wasabee-Server/Firebase"
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+// v2Location is the body of PUT /me/location
+type v2Location struct {
+	Lat string `json:"lat"`
+	Lon string `json:"lng"`
+}
+
+// v2TeamSettings is the body of PATCH /me/teams/{team}, only the fields sent are changed
+type v2TeamSettings struct {
+	ShareLocation *bool `json:"shareLocation"`
+	ShareWD       *bool `json:"shareWD"`
+	LoadWD        *bool `json:"loadWD"`
+}
+
+// v2MeRoute is the logged in agent
+func v2MeRoute(res http.ResponseWriter, req *http.Request) {
+	gid, ok := v2Agent(res, req)
+	if !ok {
+		return
+	}
+
+	// the stamp is cheap, GetAgent is not
+	stamp, err := gid.Stamp(req.Context())
+	if err != nil {
+		log.Error(err)
+		v2Error(res, http.StatusInternalServerError, "", err)
+		return
+	}
+	res.Header().Set("Cache-Control", "no-store")
+	if notModified(res, req, etag("v2me", stamp, formValidationToken(req))) {
+		return
+	}
+
+	agent, err := gid.GetAgent(req.Context())
+	if err != nil {
+		log.Error(err)
+		v2Error(res, http.StatusInternalServerError, "", err)
+		return
+	}
+	agent.QueryToken = formValidationToken(req)
+
+	v2JSON(res, http.StatusOK, &agent)
+}
+
+// v2MeLocationRoute sets the agent's location and tells the teams they share it with
+func v2MeLocationRoute(res http.ResponseWriter, req *http.Request) {
+	gid, ok := v2Agent(res, req)
+	if !ok {
+		return
+	}
+
+	var loc v2Location
+	if !v2Decode(res, req, &loc) {
+		return
+	}
+	if err := gid.SetLocation(req.Context(), loc.Lat, loc.Lon); err != nil {
+		v2Error(res, http.StatusUnprocessableEntity, "", err)
+		return
+	}
+	go wfb.AgentLocation(req.Context(), gid)
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// v2MeTeamsRoute lists the teams the agent is on
+func v2MeTeamsRoute(res http.ResponseWriter, req *http.Request) {
+	gid, ok := v2Agent(res, req)
+	if !ok {
+		return
+	}
+	offset, limit, ok := pageParams(res, req)
+	if !ok {
+		return
+	}
+
+	agent, err := gid.GetAgent(req.Context())
+	if err != nil {
+		log.Error(err)
+		v2Error(res, http.StatusInternalServerError, "", err)
+		return
+	}
+
+	teams := agent.Teams
+	if teams == nil {
+		teams = make([]model.AdTeam, 0)
+	}
+	start, end := window(len(teams), offset, limit)
+	v2JSON(res, http.StatusOK, newPage(teams[start:end], len(teams), start, end, limit))
+}
+
+// v2MeTeamRoute changes what the agent shares with a team and loads from it
+func v2MeTeamRoute(res http.ResponseWriter, req *http.Request) {
+	gid, ok := v2Agent(res, req)
+	if !ok {
+		return
+	}
+	team := model.TeamID(mux.Vars(req)["team"])
+
+	var s v2TeamSettings
+	if !v2Decode(res, req, &s) {
+		return
+	}
+
+	onteam, err := gid.AgentInTeam(req.Context(), team)
+	if err != nil {
+		v2Error(res, http.StatusInternalServerError, "", err)
+		return
+	}
+	if !onteam {
+		err := fmt.Errorf("not on team")
+		v2Error(res, http.StatusNotFound, "", err)
+		return
+	}
+
+	if s.ShareLocation != nil {
+		if err := gid.SetTeamState(req.Context(), team, *s.ShareLocation); err != nil {
+			v2Error(res, http.StatusInternalServerError, "", err)
+			return
+		}
+	}
+	if s.ShareWD != nil {
+		if err := gid.SetWDShare(req.Context(), team, *s.ShareWD); err != nil {
+			v2Error(res, http.StatusInternalServerError, "", err)
+			return
+		}
+	}
+	if s.LoadWD != nil {
+		if err := gid.SetWDLoad(req.Context(), team, *s.LoadWD); err != nil {
+			v2Error(res, http.StatusInternalServerError, "", err)
+			return
+		}
+	}
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// v2MeLeaveTeamRoute takes the agent off a team
+func v2MeLeaveTeamRoute(res http.ResponseWriter, req *http.Request) {
+	gid, ok := v2Agent(res, req)
+	if !ok {
+		return
+	}
+	team := model.TeamID(mux.Vars(req)["team"])
+
+	if owns, _ := gid.OwnsTeam(req.Context(), team); owns {
+		err := fmt.Errorf("the owner cannot leave the team, give it to another agent first")
+		v2Error(res, http.StatusConflict, "", err)
+		return
+	}
+	if err := team.RemoveAgent(req.Context(), gid); err != nil {
+		v2Error(res, http.StatusInternalServerError, "", err)
+		return
+	}
+	team.AuditMembership(req.Context(), gid, model.AuditSourceSelf, gid, model.AuditActionRemove)
+	res.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,336 @@
+package wasabeehttps
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/messaging"
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+// v2Created is the body of a 201, the new resource is also in the Location header
+type v2Created struct {
+	ID string `json:"id"`
+}
+
+// v2Updated is the body sent after an operation changes, clients compare the updateID with the ones in map change notices
+type v2Updated struct {
+	UpdateID string `json:"updateID"`
+}
+
+// v2TaskResults is the body sent after task changes are applied
+type v2TaskResults struct {
+	UpdateID string                   `json:"updateID"`
+	Results  []model.TaskChangeResult `json:"results"`
+}
+
+// v2Owner is the body of the PUT .../owner routes
+type v2Owner struct {
+	Owner string `json:"owner"` // GoogleID or agent name
+}
+
+// v2PopulatedOp loads the op named in the URL as the agent sees it, on failure the error has been sent
+func v2PopulatedOp(res http.ResponseWriter, req *http.Request, gid model.GoogleID) (*model.Operation, bool) {
+	op := model.Operation{ID: model.OperationID(mux.Vars(req)["opID"])}
+
+	if err := op.Populate(req.Context(), gid); err != nil {
+		switch {
+		case op.ID.IsDeletedOp(req.Context()):
+			v2Error(res, http.StatusGone, "", fmt.Errorf("operation deleted"))
+		case err.Error() == model.ErrOpNotFound:
+			v2Error(res, http.StatusNotFound, "", err)
+		case strings.HasPrefix(err.Error(), "unauthorized"):
+			v2Error(res, http.StatusForbidden, "", err)
+		default:
+			v2Error(res, http.StatusInternalServerError, "", err)
+		}
+		return &op, false
+	}
+	return &op, true
+}
+
+// v2OpsRoute lists the operations the agent can see
+func v2OpsRoute(res http.ResponseWriter, req *http.Request) {
+	gid, ok := v2Agent(res, req)
+	if !ok {
+		return
+	}
+	offset, limit, ok := pageParams(res, req)
+	if !ok {
+		return
+	}
+
+	agent, err := gid.GetAgent(req.Context())
+	if err != nil {
+		log.Error(err)
+		v2Error(res, http.StatusInternalServerError, "", err)
+		return
+	}
+
+	// a token limited to some ops only lists those
+	scope := requestScope(req)
+	ops := make([]model.AdOperation, 0, len(agent.Ops))
+	for _, o := range agent.Ops {
+		if scope.allowsOp(o.ID) {
+			ops = append(ops, o)
+		}
+	}
+	start, end := window(len(ops), offset, limit)
+	v2JSON(res, http.StatusOK, newPage(ops[start:end], len(ops), start, end, limit))
+}
+
+// v2OpCreateRoute stores a new operation, owned by the agent
+func v2OpCreateRoute(res http.ResponseWriter, req *http.Request) {
+	gid, ok := v2Agent(res, req)
+	if !ok {
+		return
+	}
+
+	var o model.Operation
+	if !v2Decode(res, req, &o) {
+		return
+	}
+	if err := model.DrawInsert(req.Context(), &o, gid); err != nil {
+		log.Infow(err.Error(), "GID", gid)
+		v2Error(res, http.StatusUnprocessableEntity, "", err)
+		return
+	}
+
+	res.Header().Set("Location", fmt.Sprintf("%s/ops/%s", v2PathURL, o.ID))
+	v2JSON(res, http.StatusCreated, v2Created{ID: string(o.ID)})
+}
+
+// v2OpRoute sends an operation as the agent sees it, with an ETag for conditional requests
+func v2OpRoute(res http.ResponseWriter, req *http.Request) {
+	gid, ok := v2Agent(res, req)
+	if !ok {
+		return
+	}
+
+	op := model.Operation{ID: model.OperationID(mux.Vars(req)["opID"])}
+	if op.ID.IsDeletedOp(req.Context()) {
+		v2Error(res, http.StatusGone, "", fmt.Errorf("operation deleted"))
+		return
+	}
+
+	read, zones := op.ReadAccess(req.Context(), gid)
+	assignOnly := op.AssignedOnlyAccess(req.Context(), gid)
+	if !read && !assignOnly {
+		err := fmt.Errorf("no access to operation")
+		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
+		v2Error(res, http.StatusForbidden, "", err)
+		return
+	}
+
+	stat, err := op.ID.Stat(req.Context())
+	if err != nil {
+		v2Error(res, http.StatusNotFound, "", err)
+		return
+	}
+	tag := opETag(&op, stat.LastEditID, gid, read, zones, assignOnly)
+	if notModified(res, req, tag) {
+		return
+	}
+
+	if err := op.Populate(req.Context(), gid); err != nil {
+		v2Error(res, http.StatusInternalServerError, "", err)
+		return
+	}
+	res.Header().Set("Cache-Control", "no-store")
+	if op.LastEditID != stat.LastEditID {
+		res.Header().Set("ETag", opETag(&op, op.LastEditID, gid, read, zones, assignOnly))
+	}
+	v2JSON(res, http.StatusOK, &op)
+}
+
+// v2OpUpdateRoute replaces an operation, If-Match with the ETag from GET guards against overwriting someone else's changes
+func v2OpUpdateRoute(res http.ResponseWriter, req *http.Request) {
+	gid, ok := v2Agent(res, req)
+	if !ok {
+		return
+	}
+
+	op := model.Operation{ID: model.OperationID(mux.Vars(req)["opID"])}
+	opID := op.ID
+	if !op.WriteAccess(req.Context(), gid) {
+		err := fmt.Errorf("write access required to update an operation")
+		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
+		v2Error(res, http.StatusForbidden, "", err)
+		return
+	}
+
+	stat, err := op.ID.Stat(req.Context())
+	if err != nil {
+		v2Error(res, http.StatusNotFound, "", err)
+		return
+	}
+	if im := req.Header.Get("If-Match"); im != "" {
+		read, zones := op.ReadAccess(req.Context(), gid)
+		if !etagMatch(im, opETag(&op, stat.LastEditID, gid, read, zones, op.AssignedOnlyAccess(req.Context(), gid))) {
+			v2Error(res, http.StatusPreconditionFailed, "", fmt.Errorf("operation changed since it was fetched"))
+			return
+		}
+	}
+
+	if !v2Decode(res, req, &op) {
+		return
+	}
+	if op.ID != opID {
+		v2Error(res, http.StatusUnprocessableEntity, "", fmt.Errorf("operation ID in the body does not match the URL"))
+		return
+	}
+
+	if err := model.DrawUpdate(req.Context(), &op, gid); err != nil {
+		v2Error(res, http.StatusInternalServerError, "", err)
+		return
+	}
+	v2JSON(res, http.StatusOK, v2Updated{UpdateID: touch(req.Context(), op)})
+}
+
+// v2OpDeleteRoute deletes an operation, only its owner can
+func v2OpDeleteRoute(res http.ResponseWriter, req *http.Request) {
+	gid, ok := v2Agent(res, req)
+	if !ok {
+		return
+	}
+
+	op := model.Operation{ID: model.OperationID(mux.Vars(req)["opID"])}
+	if !op.ID.IsOwner(req.Context(), gid) {
+		err := fmt.Errorf("only the owner can delete an operation")
+		log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
+		v2Error(res, http.StatusForbidden, "", err)
+		return
+	}
+	if err := op.Delete(req.Context(), gid); err != nil {
+		log.Error(err)
+		v2Error(res, http.StatusInternalServerError, "", err)
+		return
+	}
+	messaging.DeleteOperation(req.Context(), messaging.OperationID(op.ID))
+	log.Infow("deleted operation", "resource", op.ID, "GID", gid)
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// v2OpOwnerRoute gives an operation to another agent
+func v2OpOwnerRoute(res http.ResponseWriter, req *http.Request) {
+	gid, ok := v2Agent(res, req)
+	if !ok {
+		return
+	}
+
+	opID := model.OperationID(mux.Vars(req)["opID"])
+	if !opID.IsOwner(req.Context(), gid) {
+		err := fmt.Errorf("only the owner can give an operation away")
+		log.Warnw(err.Error(), "GID", gid, "resource", opID)
+		v2Error(res, http.StatusForbidden, "", err)
+		return
+	}
+
+	var o v2Owner
+	if !v2Decode(res, req, &o) {
+		return
+	}
+	to, ok := v2Resolve(req.Context(), res, o.Owner)
+	if !ok {
+		return
+	}
+	if err := opID.Chown(req.Context(), gid, string(to)); err != nil {
+		v2Error(res, http.StatusInternalServerError, "", err)
+		return
+	}
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// v2TasksRoute lists the operation's tasks the agent can see
+func v2TasksRoute(res http.ResponseWriter, req *http.Request) {
+	gid, ok := v2Agent(res, req)
+	if !ok {
+		return
+	}
+	offset, limit, ok := pageParams(res, req)
+	if !ok {
+		return
+	}
+	op, ok := v2PopulatedOp(res, req, gid)
+	if !ok {
+		return
+	}
+
+	tasks := make([]model.Task, 0, len(op.Markers)+len(op.Links))
+	for _, m := range op.Markers {
+		tasks = append(tasks, m.Task)
+	}
+	for _, l := range op.Links {
+		tasks = append(tasks, l.Task)
+	}
+	start, end := window(len(tasks), offset, limit)
+	v2JSON(res, http.StatusOK, newPage(tasks[start:end], len(tasks), start, end, limit))
+}
+
+// v2TaskRoute changes one task, the body is a TaskChange without the task ID
+func v2TaskRoute(res http.ResponseWriter, req *http.Request) {
+	var change model.TaskChange
+	if !v2Decode(res, req, &change) {
+		return
+	}
+	change.Task = model.TaskID(mux.Vars(req)["taskID"])
+	v2ApplyTaskChanges(res, req, []model.TaskChange{change})
+}
+
+// v2TasksBatchRoute changes several tasks at once, all or none of them
+func v2TasksBatchRoute(res http.ResponseWriter, req *http.Request) {
+	var changes []model.TaskChange
+	if !v2Decode(res, req, &changes) {
+		return
+	}
+	if len(changes) == 0 {
+		v2Error(res, http.StatusBadRequest, "", fmt.Errorf("no changes"))
+		return
+	}
+	if len(changes) > maxTaskBatch {
+		err := fmt.Errorf("too many changes in batch: %d, limit is %d", len(changes), maxTaskBatch)
+		v2Error(res, http.StatusRequestEntityTooLarge, "", err)
+		return
+	}
+	v2ApplyTaskChanges(res, req, changes)
+}
+
+// v2ApplyTaskChanges checks permissions and applies changes, see model.ApplyTaskChanges
+func v2ApplyTaskChanges(res http.ResponseWriter, req *http.Request, changes []model.TaskChange) {
+	gid, ok := v2Agent(res, req)
+	if !ok {
+		return
+	}
+	op, ok := v2PopulatedOp(res, req, gid)
+	if !ok {
+		return
+	}
+
+	write := op.WriteAccess(req.Context(), gid)
+	for i := range changes {
+		if changes[i].NeedsWrite() && !write {
+			err := fmt.Errorf("write access required to %s tasks", changes[i].Action)
+			log.Warnw(err.Error(), "GID", gid, "resource", op.ID)
+			v2Error(res, http.StatusForbidden, "", err)
+			return
+		}
+	}
+
+	results, err := op.ApplyTaskChanges(req.Context(), gid, changes)
+	if err != nil {
+		if err.Error() != model.ErrTaskBatchFailed {
+			v2Error(res, http.StatusInternalServerError, "", err)
+			return
+		}
+		// the details say which changes failed and why
+		v2ErrorDetails(res, http.StatusUnprocessableEntity, "", err, results)
+		return
+	}
+
+	uid := touch(req.Context(), *op)
+	v2JSON(res, http.StatusOK, v2TaskResults{UpdateID: uid, Results: results})
+}
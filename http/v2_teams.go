@@ -0,0 +1,271 @@
+package wasabeehttps
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/model"
+	"github.com/wasabee-project/Wasabee-Server/util"
+)
+
+// v2TeamName is the body of POST /teams and PATCH /teams/{team}
+type v2TeamName struct {
+	Name string `json:"name"`
+}
+
+// v2TeamAgent is the body of POST /teams/{team}/agents
+type v2TeamAgent struct {
+	Agent string `json:"agent"` // GoogleID or agent name
+}
+
+// v2TeamAccess checks the agent may see the team named in the URL, or own it if owner is set; on failure the error has been sent
+func v2TeamAccess(res http.ResponseWriter, req *http.Request, gid model.GoogleID, owner bool) (model.TeamID, bool, bool) {
+	team := model.TeamID(mux.Vars(req)["team"])
+	if !team.Valid(req.Context()) {
+		v2Error(res, http.StatusNotFound, "", fmt.Errorf("team not found"))
+		return team, false, false
+	}
+
+	isowner, err := gid.OwnsTeam(req.Context(), team)
+	if err != nil {
+		v2Error(res, http.StatusInternalServerError, "", err)
+		return team, false, false
+	}
+	if isowner {
+		return team, true, true
+	}
+	if owner {
+		err := fmt.Errorf("only the team owner can do this")
+		log.Warnw(err.Error(), "resource", team, "GID", gid)
+		v2Error(res, http.StatusForbidden, "", err)
+		return team, false, false
+	}
+
+	onteam, err := gid.AgentInTeam(req.Context(), team)
+	if err != nil {
+		v2Error(res, http.StatusInternalServerError, "", err)
+		return team, false, false
+	}
+	if !onteam {
+		err := fmt.Errorf("not on team")
+		log.Infow(err.Error(), "resource", team, "GID", gid)
+		v2Error(res, http.StatusForbidden, "", err)
+		return team, false, false
+	}
+	return team, false, true
+}
+
+// v2TeamCreateRoute makes a new team, owned by the agent
+func v2TeamCreateRoute(res http.ResponseWriter, req *http.Request) {
+	gid, ok := v2Agent(res, req)
+	if !ok {
+		return
+	}
+
+	var t v2TeamName
+	if !v2Decode(res, req, &t) {
+		return
+	}
+	name := util.Sanitize(t.Name)
+	if name == "" {
+		v2Error(res, http.StatusUnprocessableEntity, "", fmt.Errorf("empty team name"))
+		return
+	}
+
+	team, err := gid.NewTeam(req.Context(), name)
+	if err != nil {
+		v2Error(res, http.StatusInternalServerError, "", err)
+		return
+	}
+	res.Header().Set("Location", fmt.Sprintf("%s/teams/%s", v2PathURL, team))
+	v2JSON(res, http.StatusCreated, v2Created{ID: string(team)})
+}
+
+// v2TeamRoute sends a team, without its agents; they are paged at /teams/{team}/agents
+func v2TeamRoute(res http.ResponseWriter, req *http.Request) {
+	gid, ok := v2Agent(res, req)
+	if !ok {
+		return
+	}
+	team, isowner, ok := v2TeamAccess(res, req, gid, false)
+	if !ok {
+		return
+	}
+
+	stamp, err := team.Stamp(req.Context())
+	if err != nil {
+		v2Error(res, http.StatusInternalServerError, "", err)
+		return
+	}
+	if notModified(res, req, etag("v2team", stamp, strconv.FormatBool(isowner))) {
+		return
+	}
+
+	t, err := team.FetchTeam(req.Context())
+	if err != nil {
+		v2Error(res, http.StatusInternalServerError, "", err)
+		return
+	}
+	if !isowner {
+		t.RocksComm = ""
+		t.RocksKey = ""
+		t.JoinLinkToken = ""
+		t.RosterURL = ""
+	}
+	t.TeamMembers = nil
+	v2JSON(res, http.StatusOK, &t)
+}
+
+// v2TeamRenameRoute renames a team
+func v2TeamRenameRoute(res http.ResponseWriter, req *http.Request) {
+	gid, ok := v2Agent(res, req)
+	if !ok {
+		return
+	}
+	team, _, ok := v2TeamAccess(res, req, gid, true)
+	if !ok {
+		return
+	}
+
+	var t v2TeamName
+	if !v2Decode(res, req, &t) {
+		return
+	}
+	name := util.Sanitize(t.Name)
+	if name == "" {
+		v2Error(res, http.StatusUnprocessableEntity, "", fmt.Errorf("empty team name"))
+		return
+	}
+	if err := team.Rename(req.Context(), name); err != nil {
+		v2Error(res, http.StatusInternalServerError, "", err)
+		return
+	}
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// v2TeamDeleteRoute deletes a team
+func v2TeamDeleteRoute(res http.ResponseWriter, req *http.Request) {
+	gid, ok := v2Agent(res, req)
+	if !ok {
+		return
+	}
+	team, _, ok := v2TeamAccess(res, req, gid, true)
+	if !ok {
+		return
+	}
+
+	if err := team.Delete(req.Context()); err != nil {
+		v2Error(res, http.StatusInternalServerError, "", err)
+		return
+	}
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// v2TeamOwnerRoute gives a team to another agent
+func v2TeamOwnerRoute(res http.ResponseWriter, req *http.Request) {
+	gid, ok := v2Agent(res, req)
+	if !ok {
+		return
+	}
+	team, _, ok := v2TeamAccess(res, req, gid, true)
+	if !ok {
+		return
+	}
+
+	var o v2Owner
+	if !v2Decode(res, req, &o) {
+		return
+	}
+	to, ok := v2Resolve(req.Context(), res, o.Owner)
+	if !ok {
+		return
+	}
+	if err := team.Chown(req.Context(), to); err != nil {
+		v2Error(res, http.StatusInternalServerError, "", err)
+		return
+	}
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// v2TeamAgentsRoute lists a team's agents
+func v2TeamAgentsRoute(res http.ResponseWriter, req *http.Request) {
+	gid, ok := v2Agent(res, req)
+	if !ok {
+		return
+	}
+	offset, limit, ok := pageParams(res, req)
+	if !ok {
+		return
+	}
+	team, _, ok := v2TeamAccess(res, req, gid, false)
+	if !ok {
+		return
+	}
+
+	t, err := team.FetchTeam(req.Context())
+	if err != nil {
+		v2Error(res, http.StatusInternalServerError, "", err)
+		return
+	}
+	agents := t.TeamMembers
+	if agents == nil {
+		agents = make([]model.TeamMember, 0)
+	}
+	start, end := window(len(agents), offset, limit)
+	v2JSON(res, http.StatusOK, newPage(agents[start:end], len(agents), start, end, limit))
+}
+
+// v2TeamAddAgentRoute puts an agent on a team
+func v2TeamAddAgentRoute(res http.ResponseWriter, req *http.Request) {
+	gid, ok := v2Agent(res, req)
+	if !ok {
+		return
+	}
+	team, _, ok := v2TeamAccess(res, req, gid, true)
+	if !ok {
+		return
+	}
+
+	var a v2TeamAgent
+	if !v2Decode(res, req, &a) {
+		return
+	}
+	togid, ok := v2Resolve(req.Context(), res, a.Agent)
+	if !ok {
+		return
+	}
+	if err := team.AddAgent(req.Context(), togid); err != nil {
+		v2Error(res, http.StatusInternalServerError, "", err)
+		return
+	}
+	team.AuditMembership(req.Context(), gid, model.AuditSourceOwner, togid, model.AuditActionAdd)
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// v2TeamRemoveAgentRoute takes an agent off a team
+func v2TeamRemoveAgentRoute(res http.ResponseWriter, req *http.Request) {
+	gid, ok := v2Agent(res, req)
+	if !ok {
+		return
+	}
+	team, _, ok := v2TeamAccess(res, req, gid, true)
+	if !ok {
+		return
+	}
+
+	togid := model.GoogleID(mux.Vars(req)["gid"])
+	if togid == gid {
+		v2Error(res, http.StatusConflict, "", fmt.Errorf("cannot remove the owner"))
+		return
+	}
+	if err := team.RemoveAgent(req.Context(), togid); err != nil {
+		v2Error(res, http.StatusInternalServerError, "", err)
+		return
+	}
+	team.AuditMembership(req.Context(), gid, model.AuditSourceOwner, togid, model.AuditActionRemove)
+	res.WriteHeader(http.StatusNoContent)
+}
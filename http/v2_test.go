@@ -0,0 +1,161 @@
+package wasabeehttps
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+)
+
+const apiDocs = "../docs/wasabee-server-api.yaml"
+
+// v2Routes lists "METHOD /api/v2/path" for every v2 route, HEAD and OPTIONS are implied by GET and the router
+func v2Routes(t *testing.T) map[string]bool {
+	r := mux.NewRouter()
+	setupV2Routes(r.PathPrefix(v2PathURL).Subrouter())
+
+	routes := make(map[string]bool)
+	err := r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		tmpl, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil // the prefix
+		}
+		for _, m := range methods {
+			if m != http.MethodHead && m != http.MethodOptions {
+				routes[m+" "+tmpl] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return routes
+}
+
+type docOperation struct {
+	Responses map[string]interface{} `yaml:"responses"`
+}
+
+// documentedV2 lists "METHOD /api/v2/path" for every v2 operation in the API docs
+func documentedV2(t *testing.T) map[string]docOperation {
+	raw, err := os.ReadFile(apiDocs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var docs struct {
+		Paths map[string]map[string]yaml.Node `yaml:"paths"`
+	}
+	if err := yaml.Unmarshal(raw, &docs); err != nil {
+		t.Fatal(err)
+	}
+
+	ops := make(map[string]docOperation)
+	for path, item := range docs.Paths {
+		if !strings.HasPrefix(path, v2PathURL+"/") {
+			continue
+		}
+		for method, node := range item {
+			if method == "parameters" {
+				continue
+			}
+			var op docOperation
+			if err := node.Decode(&op); err != nil {
+				t.Fatalf("%s %s: %v", method, path, err)
+			}
+			ops[strings.ToUpper(method)+" "+path] = op
+		}
+	}
+	return ops
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// TestV2RoutesDocumented keeps docs/wasabee-server-api.yaml in step with setupV2Routes
+func TestV2RoutesDocumented(t *testing.T) {
+	routes := v2Routes(t)
+	docs := documentedV2(t)
+
+	if len(routes) == 0 {
+		t.Fatal("no v2 routes found")
+	}
+	for _, r := range sortedKeys(routes) {
+		op, ok := docs[r]
+		if !ok {
+			t.Errorf("%s is not in %s", r, apiDocs)
+			continue
+		}
+		if _, ok := op.Responses["default"]; !ok {
+			t.Errorf("%s has no default (error) response in %s", r, apiDocs)
+		}
+	}
+	for d := range docs {
+		if !routes[d] {
+			t.Errorf("%s is in %s but not routed", d, apiDocs)
+		}
+	}
+}
+
+func TestJSONError(t *testing.T) {
+	msg := `bad "name" \ here`
+	var out struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(jsonError(fmt.Errorf("%s", msg))), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Status != "error" || out.Error != msg {
+		t.Errorf("got %+v", out)
+	}
+}
+
+func TestV2Error(t *testing.T) {
+	rec := httptest.NewRecorder()
+	v2Error(rec, http.StatusPreconditionFailed, "", fmt.Errorf(`op "x" changed`))
+
+	var out apiError
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusPreconditionFailed || out.Status != http.StatusPreconditionFailed || out.Code != codePreconditionFailed || out.Message != `op "x" changed` {
+		t.Errorf("got %d %+v", rec.Code, out)
+	}
+}
+
+func TestPaging(t *testing.T) {
+	for _, c := range []struct {
+		total, offset, limit int
+		start, end           int
+		next                 bool
+	}{
+		{10, 0, 4, 0, 4, true},
+		{10, 8, 4, 8, 10, false},
+		{10, 20, 4, 10, 10, false},
+		{0, 0, 100, 0, 0, false},
+	} {
+		start, end := window(c.total, c.offset, c.limit)
+		p := newPage(nil, c.total, start, end, c.limit)
+		if start != c.start || end != c.end || (p.Next != nil) != c.next {
+			t.Errorf("window(%d, %d, %d) = %d, %d, next %v", c.total, c.offset, c.limit, start, end, p.Next)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package wasabeehttps
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+
+	"github.com/wasabee-project/Wasabee-Server/config"
+	"github.com/wasabee-project/Wasabee-Server/log"
+)
+
+// the next key is published a day before it signs and peers refresh every 15 minutes, an hour of caching is safe
+const wellKnownMaxAge = 3600
+
+const jwksPath = "/.well-known/jwks.json"
+
+// wellKnownHeaders lets any third party fetch and cache the documents, they carry no credentials
+func wellKnownHeaders(res http.ResponseWriter) {
+	res.Header().Set("Access-Control-Allow-Origin", "*")
+	res.Header().Del("Access-Control-Allow-Credentials")
+	res.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", wellKnownMaxAge))
+}
+
+// jwksRoute publishes our public keys so third parties and federation peers can verify the JWTs we sign
+// only our own keys are published, peers' keys are accepted here but are not ours to vouch for
+func jwksRoute(res http.ResponseWriter, req *http.Request) {
+	set := config.JWPublicKeys()
+	if set == nil {
+		set = jwk.NewSet()
+	}
+
+	wellKnownHeaders(res)
+	if err := json.NewEncoder(res).Encode(set); err != nil {
+		log.Error(err)
+	}
+}
+
+type discovery struct {
+	Issuer                           string   `json:"issuer"`
+	JWKSURI                          string   `json:"jwks_uri"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+	SubjectTypesSupported            []string `json:"subject_types_supported"`
+	ResponseTypesSupported           []string `json:"response_types_supported"`
+}
+
+// jwtIssuer is the iss of the JWTs minted here, the same on every server behind the webroot
+func jwtIssuer() string {
+	return config.Get().HTTP.Webroot
+}
+
+// openIDConfigurationRoute is an OpenID Connect style discovery document, pointing to the keys
+func openIDConfigurationRoute(res http.ResponseWriter, req *http.Request) {
+	webroot := config.Get().HTTP.Webroot
+	d := discovery{
+		Issuer:                           jwtIssuer(),
+		JWKSURI:                          webroot + jwksPath,
+		IDTokenSigningAlgValuesSupported: []string{"RS256"},
+		SubjectTypesSupported:            []string{"public"},
+		ResponseTypesSupported:           []string{"id_token"},
+	}
+
+	wellKnownHeaders(res)
+	if err := json.NewEncoder(res).Encode(d); err != nil {
+		log.Error(err)
+	}
+}
@@ -1,9 +1,14 @@
 package messaging
 
 import (
+	"context"
 	"fmt"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
 	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/tracing"
 )
 
 // model includes this package, so it can't include model, to enforce type-consistency, we re-define some types from model and rely on the callers to cast them
@@ -39,16 +44,17 @@ type Announce struct {
 }
 
 // Bus is the type that services use to register with the messaging framework
+// the context carries the caller's trace, services should not use it to cancel sends
 type Bus struct {
-	SendMessage          func(GoogleID, string) (bool, error)              // send a message to an individual agent
-	SendTarget           func(GoogleID, Target) error                      // send a formatted target to an individual agent
-	CanSendTo            func(fromGID GoogleID, toGID GoogleID) bool       // determine if one agent can send to another
-	SendAnnounce         func(TeamID, Announce) error                      // send a messaage to a team
-	AddToRemote          func(GoogleID, TeamID) error                      // add an agent to a services chat/community/team/channel/whatever
-	RemoveFromRemote     func(GoogleID, TeamID) error                      // remove an agent from a service's X
-	SendAssignment       func(GoogleID, TaskID, OperationID, string) error // Send a formatted assignment to an individual agent
-	AgentDeleteOperation func(GoogleID, OperationID) error                 // instruct a single agent to delete an operation
-	DeleteOperation      func(OperationID) error                           // instruct EVERYONE to delete an operation
+	SendMessage          func(context.Context, GoogleID, string) (bool, error)              // send a message to an individual agent
+	SendTarget           func(context.Context, GoogleID, Target) error                      // send a formatted target to an individual agent
+	CanSendTo            func(fromGID GoogleID, toGID GoogleID) bool                        // determine if one agent can send to another
+	SendAnnounce         func(context.Context, TeamID, Announce) error                      // send a messaage to a team
+	AddToRemote          func(context.Context, GoogleID, TeamID) error                      // add an agent to a services chat/community/team/channel/whatever
+	RemoveFromRemote     func(context.Context, GoogleID, TeamID) error                      // remove an agent from a service's X
+	SendAssignment       func(context.Context, GoogleID, TaskID, OperationID, string) error // Send a formatted assignment to an individual agent
+	AgentDeleteOperation func(context.Context, GoogleID, OperationID) error                 // instruct a single agent to delete an operation
+	DeleteOperation      func(context.Context, OperationID) error                           // instruct EVERYONE to delete an operation
 }
 
 var busses map[string]Bus
@@ -57,8 +63,21 @@ func init() {
 	busses = make(map[string]Bus)
 }
 
+// span starts the span for a call fanned out to every bus
+func span(ctx context.Context, call string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracing.Span(ctx, "messaging."+call, trace.WithAttributes(attrs...))
+}
+
+// busSpan starts the span for one bus's part of a call
+func busSpan(ctx context.Context, call, bus string) (context.Context, trace.Span) {
+	return tracing.Span(ctx, call+" "+bus, trace.WithSpanKind(trace.SpanKindProducer), trace.WithAttributes(attribute.String("messaging.system", bus)))
+}
+
 // SendTarget is called to send target information to agents
-func SendTarget(toGID GoogleID, target Target) error {
+func SendTarget(ctx context.Context, toGID GoogleID, target Target) error {
+	ctx, s := span(ctx, "SendTarget", attribute.String("wasabee.gid", string(toGID)))
+	defer s.End()
+
 	if target.Name == "" {
 		err := fmt.Errorf("portal not set")
 		log.Warnw(err.Error(), "GID", toGID)
@@ -71,9 +90,12 @@ func SendTarget(toGID GoogleID, target Target) error {
 		return err
 	}
 
-	for _, bus := range busses {
+	for name, bus := range busses {
 		if bus.SendTarget != nil {
-			if err := bus.SendTarget(toGID, target); err != nil {
+			bctx, bs := busSpan(ctx, "SendTarget", name)
+			err := bus.SendTarget(bctx, toGID, target)
+			tracing.End(bs, err)
+			if err != nil {
 				log.Error(err)
 			}
 		}
@@ -83,12 +105,16 @@ func SendTarget(toGID GoogleID, target Target) error {
 }
 
 // SendMessage is used to send a generic message to a single agent
-func SendMessage(toGID GoogleID, message string) (bool, error) {
+func SendMessage(ctx context.Context, toGID GoogleID, message string) (bool, error) {
 	var sent bool
+	ctx, s := span(ctx, "SendMessage", attribute.String("wasabee.gid", string(toGID)))
+	defer s.End()
 
 	for name, bus := range busses {
 		if bus.SendMessage != nil {
-			success, err := bus.SendMessage(toGID, message)
+			bctx, bs := busSpan(ctx, "SendMessage", name)
+			success, err := bus.SendMessage(bctx, toGID, message)
+			tracing.End(bs, err)
 			if err != nil {
 				log.Error(err)
 			}
@@ -103,10 +129,16 @@ func SendMessage(toGID GoogleID, message string) (bool, error) {
 
 // SendAnnounce sends a generic message to a team
 // if opID is nil, it is not used
-func SendAnnounce(teamID TeamID, a Announce) {
-	for _, bus := range busses {
+func SendAnnounce(ctx context.Context, teamID TeamID, a Announce) {
+	ctx, s := span(ctx, "SendAnnounce", attribute.String("wasabee.team", string(teamID)))
+	defer s.End()
+
+	for name, bus := range busses {
 		if bus.SendAnnounce != nil {
-			if err := bus.SendAnnounce(teamID, a); err != nil {
+			bctx, bs := busSpan(ctx, "SendAnnounce", name)
+			err := bus.SendAnnounce(bctx, teamID, a)
+			tracing.End(bs, err)
+			if err != nil {
 				log.Error(err)
 			}
 		}
@@ -124,10 +156,16 @@ func RemoveMessageBus(busname string) {
 }
 
 // AddToRemote is called to add an agent to various services
-func AddToRemote(gid GoogleID, teamID TeamID) {
-	for _, bus := range busses {
+func AddToRemote(ctx context.Context, gid GoogleID, teamID TeamID) {
+	ctx, s := span(ctx, "AddToRemote", attribute.String("wasabee.gid", string(gid)), attribute.String("wasabee.team", string(teamID)))
+	defer s.End()
+
+	for name, bus := range busses {
 		if bus.AddToRemote != nil {
-			if err := bus.AddToRemote(gid, teamID); err != nil {
+			bctx, bs := busSpan(ctx, "AddToRemote", name)
+			err := bus.AddToRemote(bctx, gid, teamID)
+			tracing.End(bs, err)
+			if err != nil {
 				log.Error(err)
 			}
 		}
@@ -135,10 +173,16 @@ func AddToRemote(gid GoogleID, teamID TeamID) {
 }
 
 // RemoveFromRemote is called to remove an agent from various services
-func RemoveFromRemote(gid GoogleID, teamID TeamID) {
-	for _, bus := range busses {
+func RemoveFromRemote(ctx context.Context, gid GoogleID, teamID TeamID) {
+	ctx, s := span(ctx, "RemoveFromRemote", attribute.String("wasabee.gid", string(gid)), attribute.String("wasabee.team", string(teamID)))
+	defer s.End()
+
+	for name, bus := range busses {
 		if bus.RemoveFromRemote != nil {
-			if err := bus.RemoveFromRemote(gid, teamID); err != nil {
+			bctx, bs := busSpan(ctx, "RemoveFromRemote", name)
+			err := bus.RemoveFromRemote(bctx, gid, teamID)
+			tracing.End(bs, err)
+			if err != nil {
 				log.Error(err)
 			}
 		}
@@ -146,10 +190,16 @@ func RemoveFromRemote(gid GoogleID, teamID TeamID) {
 }
 
 // SendAssignment sends a task to an agent
-func SendAssignment(gid GoogleID, taskID TaskID, opID OperationID, status string) {
-	for _, bus := range busses {
+func SendAssignment(ctx context.Context, gid GoogleID, taskID TaskID, opID OperationID, status string) {
+	ctx, s := span(ctx, "SendAssignment", attribute.String("wasabee.gid", string(gid)), attribute.String("wasabee.op", string(opID)), attribute.String("wasabee.task", string(taskID)))
+	defer s.End()
+
+	for name, bus := range busses {
 		if bus.SendAssignment != nil {
-			if err := bus.SendAssignment(gid, taskID, opID, status); err != nil {
+			bctx, bs := busSpan(ctx, "SendAssignment", name)
+			err := bus.SendAssignment(bctx, gid, taskID, opID, status)
+			tracing.End(bs, err)
+			if err != nil {
 				log.Error(err)
 			}
 		}
@@ -157,10 +207,16 @@ func SendAssignment(gid GoogleID, taskID TaskID, opID OperationID, status string
 }
 
 // AgentDeleteOperation instructs a single agent to delete an operation (e.g. at removal from team)
-func AgentDeleteOperation(gid GoogleID, opID OperationID) {
-	for _, bus := range busses {
+func AgentDeleteOperation(ctx context.Context, gid GoogleID, opID OperationID) {
+	ctx, s := span(ctx, "AgentDeleteOperation", attribute.String("wasabee.gid", string(gid)), attribute.String("wasabee.op", string(opID)))
+	defer s.End()
+
+	for name, bus := range busses {
 		if bus.AgentDeleteOperation != nil {
-			if err := bus.AgentDeleteOperation(gid, opID); err != nil {
+			bctx, bs := busSpan(ctx, "AgentDeleteOperation", name)
+			err := bus.AgentDeleteOperation(bctx, gid, opID)
+			tracing.End(bs, err)
+			if err != nil {
 				log.Error(err)
 			}
 		}
@@ -168,10 +224,16 @@ func AgentDeleteOperation(gid GoogleID, opID OperationID) {
 }
 
 // DeleteOperation is called to broadcst a delete operation command to all agents (e.g. Firebase)
-func DeleteOperation(opID OperationID) {
-	for _, bus := range busses {
+func DeleteOperation(ctx context.Context, opID OperationID) {
+	ctx, s := span(ctx, "DeleteOperation", attribute.String("wasabee.op", string(opID)))
+	defer s.End()
+
+	for name, bus := range busses {
 		if bus.DeleteOperation != nil {
-			if err := bus.DeleteOperation(opID); err != nil {
+			bctx, bs := busSpan(ctx, "DeleteOperation", name)
+			err := bus.DeleteOperation(bctx, opID)
+			tracing.End(bs, err)
+			if err != nil {
 				log.Error(err)
 			}
 		}
@@ -0,0 +1,56 @@
+// Package metrics serves the Prometheus metrics registered with promauto throughout the server
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/wasabee-project/Wasabee-Server/config"
+	"github.com/wasabee-project/Wasabee-Server/log"
+)
+
+// private is what the metrics listener serves, other packages add their private endpoints with Handle
+var private = http.NewServeMux()
+
+func init() {
+	private.Handle("/metrics", promhttp.Handler())
+}
+
+// Handle serves an endpoint on the metrics listener, for things which should not be on the public server
+func Handle(pattern string, handler http.Handler) {
+	private.Handle(pattern, handler)
+}
+
+// Start serves /metrics, and whatever else was given to Handle, on its own listener, kept apart from the public HTTPS server
+// it is plain HTTP: listen on a private address
+func Start(ctx context.Context) {
+	listen := config.Get().HTTP.ListenMetrics
+	if listen == "" {
+		log.Debugw("startup", "message", "metrics listener not configured")
+		return
+	}
+
+	srv := &http.Server{
+		Handler:           private,
+		Addr:              listen,
+		WriteTimeout:      (30 * time.Second),
+		ReadTimeout:       (30 * time.Second),
+		ReadHeaderTimeout: (2 * time.Second),
+	}
+
+	go func() {
+		log.Infow("startup", "port", listen, "message", "metrics listener online")
+		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+			log.Error(err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Infow("shutdown", "message", "shutting down metrics listener")
+	if err := srv.Shutdown(context.Background()); err != nil {
+		log.Error(err)
+	}
+}
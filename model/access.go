@@ -1,6 +1,7 @@
 package model
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 
@@ -8,13 +9,13 @@ import (
 )
 
 // PopulateTeams loads the permissions from the database into the op data
-func (o *Operation) PopulateTeams() error {
+func (o *Operation) PopulateTeams(ctx context.Context) error {
 	// do not do duplicate work
 	if len(o.Teams) > 0 {
 		return nil
 	}
 
-	rows, err := db.Query("SELECT teamID, permission, zone FROM permissions WHERE opID = ?", o.ID)
+	rows, err := db.QueryContext(ctx, "SELECT teamID, permission, zone FROM permissions WHERE opID = ?", o.ID)
 	if err != nil && err != sql.ErrNoRows {
 		log.Error(err)
 		return err
@@ -40,16 +41,16 @@ func (o *Operation) PopulateTeams() error {
 }
 
 // ReadAccess determines if an agent has read acces to an op, if zone limitations are present, return those as well
-func (o *Operation) ReadAccess(gid GoogleID) (bool, []Zone) {
+func (o *Operation) ReadAccess(ctx context.Context, gid GoogleID) (bool, []Zone) {
 	var zones []Zone
 	var permitted bool
 
-	if o.ID.IsOwner(gid) {
+	if o.ID.IsOwner(ctx, gid) {
 		zones = append(zones, ZoneAll)
 		return true, zones
 	}
 
-	if err := o.PopulateTeams(); err != nil {
+	if err := o.PopulateTeams(ctx); err != nil {
 		log.Error(err)
 		return false, zones
 	}
@@ -59,7 +60,7 @@ func (o *Operation) ReadAccess(gid GoogleID) (bool, []Zone) {
 		case opPermRoleAssignedOnly:
 			continue
 		case opPermRoleRead:
-			if inteam, _ := gid.AgentInTeam(t.TeamID); inteam {
+			if inteam, _ := gid.AgentInTeamGroup(ctx, t.TeamID); inteam {
 				permitted = true
 				zones = append(zones, t.Zone)
 				if t.Zone == ZoneAll {
@@ -67,7 +68,7 @@ func (o *Operation) ReadAccess(gid GoogleID) (bool, []Zone) {
 				}
 			}
 		case opPermRoleWrite:
-			if inteam, _ := gid.AgentInTeam(t.TeamID); inteam {
+			if inteam, _ := gid.AgentInTeamGroup(ctx, t.TeamID); inteam {
 				permitted = true
 				zones = append(zones, ZoneAll)
 				return permitted, zones // fast-path
@@ -78,12 +79,12 @@ func (o *Operation) ReadAccess(gid GoogleID) (bool, []Zone) {
 }
 
 // WriteAccess determines if an agent has write access to an op
-func (o *Operation) WriteAccess(gid GoogleID) bool {
-	if o.ID.IsOwner(gid) {
+func (o *Operation) WriteAccess(ctx context.Context, gid GoogleID) bool {
+	if o.ID.IsOwner(ctx, gid) {
 		return true
 	}
 
-	if err := o.PopulateTeams(); err != nil {
+	if err := o.PopulateTeams(ctx); err != nil {
 		log.Error(err)
 		return false
 	}
@@ -93,7 +94,7 @@ func (o *Operation) WriteAccess(gid GoogleID) bool {
 			continue
 		}
 		// write teams
-		if inteam, _ := gid.AgentInTeam(t.TeamID); inteam {
+		if inteam, _ := gid.AgentInTeamGroup(ctx, t.TeamID); inteam {
 			return true
 		}
 	}
@@ -101,9 +102,9 @@ func (o *Operation) WriteAccess(gid GoogleID) bool {
 }
 
 // IsOwner returns a bool value determining if the operation is owned by the specified googleID
-func (opID OperationID) IsOwner(gid GoogleID) bool {
+func (opID OperationID) IsOwner(ctx context.Context, gid GoogleID) bool {
 	var c int
-	err := db.QueryRow("SELECT COUNT(*) FROM operation WHERE ID = ? and gid = ?", opID, gid).Scan(&c)
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM operation WHERE ID = ? and gid = ?", opID, gid).Scan(&c)
 	if err != nil {
 		log.Error(err)
 		return false
@@ -114,28 +115,49 @@ func (opID OperationID) IsOwner(gid GoogleID) bool {
 	return true
 }
 
+// Owner returns the GoogleID of the operation's owner
+func (opID OperationID) Owner(ctx context.Context) (GoogleID, error) {
+	var gid GoogleID
+	err := db.QueryRowContext(ctx, "SELECT gid FROM operation WHERE ID = ?", opID).Scan(&gid)
+	if err == sql.ErrNoRows {
+		err := fmt.Errorf(ErrOpNotFound)
+		log.Infow(err.Error(), "resource", opID)
+		return "", err
+	}
+	if err != nil {
+		log.Error(err)
+		return "", err
+	}
+	return gid, nil
+}
+
 // Chown changes an operation's owner
-func (opID OperationID) Chown(gid GoogleID, to string) error {
-	if !opID.IsOwner(gid) {
+func (opID OperationID) Chown(ctx context.Context, gid GoogleID, to string) error {
+	if !opID.IsOwner(ctx, gid) {
 		err := fmt.Errorf(ErrNotOpOwner)
 		log.Errorw(err.Error(), "GID", gid, "resource", opID)
 		return err
 	}
 
-	togid, err := ToGid(to)
+	togid, err := ToGid(ctx, to)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
 
-	if !togid.Valid() {
+	return opID.SetOwner(ctx, togid)
+}
+
+// SetOwner changes an operation's owner
+// caller must verify permissions
+func (opID OperationID) SetOwner(ctx context.Context, togid GoogleID) error {
+	if !togid.Valid(ctx) {
 		err := fmt.Errorf(ErrUnknownUser)
-		log.Errorw(err.Error(), "to", to)
+		log.Errorw(err.Error(), "to", togid)
 		return err
 	}
 
-	_, err = db.Exec("UPDATE operation SET gid = ? WHERE ID = ?", togid, opID)
-	if err != nil {
+	if _, err := db.ExecContext(ctx, "UPDATE operation SET gid = ? WHERE ID = ?", togid, opID); err != nil {
 		log.Error(err)
 		return err
 	}
@@ -144,8 +166,8 @@ func (opID OperationID) Chown(gid GoogleID, to string) error {
 }
 
 // AssignedOnlyAccess verifies if an agent has AO access to an op
-func (o *Operation) AssignedOnlyAccess(gid GoogleID) bool {
-	if err := o.PopulateTeams(); err != nil {
+func (o *Operation) AssignedOnlyAccess(ctx context.Context, gid GoogleID) bool {
+	if err := o.PopulateTeams(ctx); err != nil {
 		log.Error(err)
 		return false
 	}
@@ -154,7 +176,7 @@ func (o *Operation) AssignedOnlyAccess(gid GoogleID) bool {
 		if t.Role != opPermRoleAssignedOnly {
 			continue
 		}
-		if inteam, _ := gid.AgentInTeam(t.TeamID); inteam {
+		if inteam, _ := gid.AgentInTeamGroup(ctx, t.TeamID); inteam {
 			return true
 		}
 	}
@@ -162,14 +184,14 @@ func (o *Operation) AssignedOnlyAccess(gid GoogleID) bool {
 }
 
 // AddPerm adds a new permission to an op
-func (opID OperationID) AddPerm(gid GoogleID, teamID TeamID, perm string, zone Zone) error {
-	if !opID.IsOwner(gid) {
+func (opID OperationID) AddPerm(ctx context.Context, gid GoogleID, teamID TeamID, perm string, zone Zone) error {
+	if !opID.IsOwner(ctx, gid) {
 		err := fmt.Errorf(ErrNotOpOwner)
 		log.Errorw(err.Error(), "GID", gid, "resource", opID)
 		return err
 	}
 
-	inteam, err := gid.AgentInTeam(teamID)
+	inteam, err := gid.AgentInTeam(ctx, teamID)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -191,7 +213,7 @@ func (opID OperationID) AddPerm(gid GoogleID, teamID TeamID, perm string, zone Z
 	if opp != opPermRoleRead {
 		zone = ZoneAll
 	}
-	if _, err = db.Exec("INSERT INTO permissions VALUES (?,?,?,?)", teamID, opID, opp, zone); err != nil {
+	if _, err = db.ExecContext(ctx, "INSERT INTO permissions VALUES (?,?,?,?)", teamID, opID, opp, zone); err != nil {
 		log.Error(err)
 		return err
 	}
@@ -199,20 +221,20 @@ func (opID OperationID) AddPerm(gid GoogleID, teamID TeamID, perm string, zone Z
 }
 
 // DelPerm removes a permission from an op
-func (opID OperationID) DelPerm(gid GoogleID, teamID TeamID, perm OpPermRole, zone Zone) error {
-	if !opID.IsOwner(gid) {
+func (opID OperationID) DelPerm(ctx context.Context, gid GoogleID, teamID TeamID, perm OpPermRole, zone Zone) error {
+	if !opID.IsOwner(ctx, gid) {
 		err := fmt.Errorf(ErrNotOpOwner)
 		log.Errorw(err.Error(), "GID", gid, "resource", opID)
 		return err
 	}
 
 	if perm != opPermRoleRead {
-		if _, err := db.Exec("DELETE FROM permissions WHERE teamID = ? AND opID = ? AND permission = ? LIMIT 1", teamID, opID, perm); err != nil {
+		if _, err := db.ExecContext(ctx, "DELETE FROM permissions WHERE teamID = ? AND opID = ? AND permission = ? LIMIT 1", teamID, opID, perm); err != nil {
 			log.Error(err)
 			return err
 		}
 	} else {
-		if _, err := db.Exec("DELETE FROM permissions WHERE teamID = ? AND opID = ? AND permission = ? AND zone = ? LIMIT 1", teamID, opID, perm, zone); err != nil {
+		if _, err := db.ExecContext(ctx, "DELETE FROM permissions WHERE teamID = ? AND opID = ? AND permission = ? AND zone = ? LIMIT 1", teamID, opID, perm, zone); err != nil {
 			log.Error(err)
 			return err
 		}
@@ -220,38 +242,47 @@ func (opID OperationID) DelPerm(gid GoogleID, teamID TeamID, perm OpPermRole, zo
 	return nil
 }
 
-// Operations returns a slice containing all the OpPermissions which reference this team
-func (teamID TeamID) Operations() ([]OpPermission, error) {
+// Operations returns a slice containing all the OpPermissions which reference this team, including those granted to its parent teams
+func (teamID TeamID) Operations(ctx context.Context) ([]OpPermission, error) {
 	var perms []OpPermission
-	rows, err := db.Query("SELECT opID, permission, zone FROM permissions WHERE teamID = ?", teamID)
-	if err != nil && err != sql.ErrNoRows {
+
+	ancestors, err := teamID.Ancestors(ctx)
+	if err != nil {
 		log.Error(err)
 		return perms, err
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var opid, role string
-		var zone Zone
-		err := rows.Scan(&opid, &role, &zone)
-		if err != nil {
+	for _, t := range append([]TeamID{teamID}, ancestors...) {
+		rows, err := db.QueryContext(ctx, "SELECT opID, permission, zone FROM permissions WHERE teamID = ?", t)
+		if err != nil && err != sql.ErrNoRows {
 			log.Error(err)
-			continue
+			return perms, err
 		}
-		perms = append(perms, OpPermission{
-			OpID:   OperationID(opid),
-			TeamID: teamID,
-			Role:   OpPermRole(role),
-			Zone:   zone,
-		})
+
+		for rows.Next() {
+			var opid, role string
+			var zone Zone
+			err := rows.Scan(&opid, &role, &zone)
+			if err != nil {
+				log.Error(err)
+				continue
+			}
+			perms = append(perms, OpPermission{
+				OpID:   OperationID(opid),
+				TeamID: t,
+				Role:   OpPermRole(role),
+				Zone:   zone,
+			})
+		}
+		rows.Close()
 	}
 	return perms, nil
 }
 
 // Teams returns a list of every team with access to this operation
-func (opID OperationID) Teams() ([]TeamID, error) {
+func (opID OperationID) Teams(ctx context.Context) ([]TeamID, error) {
 	var teams []TeamID
-	rows, err := db.Query("SELECT DISTINCT teamID FROM permissions WHERE opID = ?", opID)
+	rows, err := db.QueryContext(ctx, "SELECT DISTINCT teamID FROM permissions WHERE opID = ?", opID)
 	if err != nil && err != sql.ErrNoRows {
 		log.Error(err)
 		return teams, err
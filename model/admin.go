@@ -0,0 +1,236 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+)
+
+// the actions recorded in the administrator audit log
+const (
+	AdminActionView       = "view"
+	AdminActionLock       = "lock"
+	AdminActionUnlock     = "unlock"
+	AdminActionLogout     = "logout"
+	AdminActionPurge      = "purge"
+	AdminActionTelegram   = "unlink-telegram"
+	AdminActionOpChown    = "op-chown"
+	AdminActionOpDelete   = "op-delete"
+	AdminActionOpImport   = "op-import"
+	AdminActionTeamChown  = "team-chown"
+	AdminActionTeamDelete = "team-delete"
+	AdminActionRevokeJWT  = "revoke-jwt"
+	AdminActionBlock      = "block"
+	AdminActionUnblock    = "unblock"
+)
+
+// AdminAction is a single action taken by a server administrator
+type AdminAction struct {
+	Admin     GoogleID `json:"admin"`
+	Action    string   `json:"action"`
+	Target    string   `json:"target"`
+	Detail    string   `json:"detail,omitempty"`
+	Timestamp string   `json:"timestamp"`
+}
+
+// AgentSummary is what administrators see of an agent in search results
+type AgentSummary struct {
+	Gid           GoogleID `json:"gid"`
+	Name          string   `json:"name"`
+	IntelName     string   `json:"intelname,omitempty"`
+	CommunityName string   `json:"communityname,omitempty"`
+	Telegram      string   `json:"telegram,omitempty"`
+	RISC          bool     `json:"RISC"`
+}
+
+// AdminAgentView is everything administrators see of a single agent
+type AdminAgentView struct {
+	AgentSummary
+	OwnedOps   []string   `json:"ownedOps"`
+	OwnedTeams []string   `json:"ownedTeams"`
+	Teams      []string   `json:"teams"`
+	Identities []Identity `json:"identities"`
+	Sessions   []Session  `json:"sessions"`
+	APITokens  []APIToken `json:"apiTokens"`
+}
+
+// TeamSummary is what administrators see of a team in a list
+type TeamSummary struct {
+	ID      TeamID   `json:"id"`
+	Name    string   `json:"name"`
+	Owner   GoogleID `json:"owner"`
+	Members int      `json:"members"`
+}
+
+// the most rows returned by SearchAgents and AdminAuditLog
+const (
+	maxAgentSearch     = 100
+	maxAdminAuditItems = 1000
+)
+
+const agentSummarySQL = "SELECT a.gid, a.intelname, a.communityname, a.RISC, v.agent, r.agent, t.telegramName FROM agent a LEFT JOIN v ON a.gid = v.gid LEFT JOIN rocks r ON a.gid = r.gid LEFT JOIN telegram t ON a.gid = t.gid "
+
+// RecordAdminAction adds an action to the administrator audit log
+// errors are logged but not returned, failing to record the action should not block it
+func RecordAdminAction(ctx context.Context, admin GoogleID, action, target, detail string) {
+	log.Infow("admin action", "admin", admin, "action", action, "target", target, "detail", detail)
+	if _, err := db.ExecContext(ctx, "INSERT INTO adminaudit (admin, action, target, detail) VALUES (?, ?, ?, ?)", admin, action, target, makeNullString(detail)); err != nil {
+		log.Error(err)
+	}
+}
+
+// AdminAuditLog returns the most recent administrator actions, newest first, optionally only those on a target
+func AdminAuditLog(ctx context.Context, target string) ([]AdminAction, error) {
+	actions := make([]AdminAction, 0)
+
+	var rows *sql.Rows
+	var err error
+	if target == "" {
+		rows, err = db.QueryContext(ctx, "SELECT admin, action, target, detail, timestamp FROM adminaudit ORDER BY timestamp DESC LIMIT ?", maxAdminAuditItems)
+	} else {
+		rows, err = db.QueryContext(ctx, "SELECT admin, action, target, detail, timestamp FROM adminaudit WHERE target = ? ORDER BY timestamp DESC LIMIT ?", target, maxAdminAuditItems)
+	}
+	if err != nil && err != sql.ErrNoRows {
+		log.Error(err)
+		return actions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a AdminAction
+		var detail sql.NullString
+		if err := rows.Scan(&a.Admin, &a.Action, &a.Target, &detail, &a.Timestamp); err != nil {
+			log.Error(err)
+			continue
+		}
+		a.Detail = detail.String
+		actions = append(actions, a)
+	}
+	return actions, nil
+}
+
+func agentSummaries(rows *sql.Rows) []AgentSummary {
+	agents := make([]AgentSummary, 0)
+
+	for rows.Next() {
+		var a AgentSummary
+		var intel, community, vname, rocksname, tg sql.NullString
+		if err := rows.Scan(&a.Gid, &intel, &community, &a.RISC, &vname, &rocksname, &tg); err != nil {
+			log.Error(err)
+			continue
+		}
+		a.Name = a.Gid.bestname(intel, vname, rocksname, community)
+		a.IntelName = intel.String
+		a.CommunityName = community.String
+		a.Telegram = tg.String
+		agents = append(agents, a)
+	}
+	return agents
+}
+
+// SearchAgents finds agents by GoogleID or any part of any of their names
+func SearchAgents(ctx context.Context, query string) ([]AgentSummary, error) {
+	like := "%" + query + "%"
+
+	rows, err := db.QueryContext(ctx, agentSummarySQL+"WHERE a.gid = ? OR a.intelname LIKE ? OR a.communityname LIKE ? OR v.agent LIKE ? OR r.agent LIKE ? OR t.telegramName LIKE ? ORDER BY a.gid LIMIT ?", query, like, like, like, like, like, maxAgentSearch)
+	if err != nil {
+		log.Error(err)
+		return make([]AgentSummary, 0), err
+	}
+	defer rows.Close()
+	return agentSummaries(rows), nil
+}
+
+// RISCLockedAgents lists the agents whose accounts are locked
+func RISCLockedAgents(ctx context.Context) ([]AgentSummary, error) {
+	rows, err := db.QueryContext(ctx, agentSummarySQL+"WHERE a.RISC = 1 ORDER BY a.gid")
+	if err != nil {
+		log.Error(err)
+		return make([]AgentSummary, 0), err
+	}
+	defer rows.Close()
+	return agentSummaries(rows), nil
+}
+
+// AdminView gathers everything an administrator needs to see about an agent
+func (gid GoogleID) AdminView(ctx context.Context) (*AdminAgentView, error) {
+	rows, err := db.QueryContext(ctx, agentSummarySQL+"WHERE a.gid = ?", gid)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	defer rows.Close()
+	summaries := agentSummaries(rows)
+	if len(summaries) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	v := AdminAgentView{AgentSummary: summaries[0]}
+
+	if v.OwnedOps, err = gidColumn(ctx, "SELECT ID FROM operation WHERE gid = ?", gid); err != nil {
+		return nil, err
+	}
+	if v.OwnedTeams, err = gidColumn(ctx, "SELECT teamID FROM team WHERE owner = ?", gid); err != nil {
+		return nil, err
+	}
+	if v.Teams, err = gidColumn(ctx, "SELECT teamID FROM agentteams WHERE gid = ?", gid); err != nil {
+		return nil, err
+	}
+	if v.Identities, err = gid.Identities(ctx); err != nil {
+		return nil, err
+	}
+	if v.Sessions, err = gid.Sessions(ctx); err != nil {
+		return nil, err
+	}
+	if v.APITokens, err = gid.APITokens(ctx); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// gidColumn reads a single column of IDs for an agent
+func gidColumn(ctx context.Context, query string, gid GoogleID) ([]string, error) {
+	ids := make([]string, 0)
+
+	rows, err := db.QueryContext(ctx, query, gid)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error(err)
+		return ids, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			log.Error(err)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// AdminTeams lists every team on the server
+func AdminTeams(ctx context.Context) ([]TeamSummary, error) {
+	teams := make([]TeamSummary, 0)
+
+	rows, err := db.QueryContext(ctx, "SELECT t.teamID, t.name, t.owner, COUNT(a.gid) FROM team t LEFT JOIN agentteams a ON t.teamID = a.teamID GROUP BY t.teamID, t.name, t.owner ORDER BY t.name")
+	if err != nil && err != sql.ErrNoRows {
+		log.Error(err)
+		return teams, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t TeamSummary
+		var name sql.NullString
+		if err := rows.Scan(&t.ID, &name, &t.Owner, &t.Members); err != nil {
+			log.Error(err)
+			continue
+		}
+		t.Name = name.String
+		teams = append(teams, t)
+	}
+	return teams, nil
+}
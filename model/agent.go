@@ -1,9 +1,11 @@
 package model
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/wasabee-project/Wasabee-Server/config"
 	"github.com/wasabee-project/Wasabee-Server/log"
@@ -72,7 +74,7 @@ type AdOperation struct {
 
 // AgentID is anything that can be converted to a GoogleID or a string
 type AgentID interface {
-	Gid() (GoogleID, error)
+	Gid(ctx context.Context) (GoogleID, error)
 	fmt.Stringer
 }
 
@@ -85,19 +87,19 @@ type AgentLocation struct {
 }
 
 // Gid just satisfies the AgentID interface
-func (gid GoogleID) Gid() (GoogleID, error) {
+func (gid GoogleID) Gid(ctx context.Context) (GoogleID, error) {
 	return gid, nil
 }
 
 // GetAgent populates an Agent struct based on the gid
-func (gid GoogleID) GetAgent() (*Agent, error) {
+func (gid GoogleID) GetAgent(ctx context.Context) (*Agent, error) {
 	var a Agent
 	a.GoogleID = gid
 	var level, vname, vid, pic, vapi, intelname, rocksname, communityname sql.NullString
 	var vverified, vblacklisted, rocksverified sql.NullBool
 	var ifac IntelFaction
 
-	err := db.QueryRow("SELECT v.agent AS Vname, rocks.agent AS Rocksname, a.intelname, v.level, a.OneTimeToken, v.verified AS VVerified, v.Blacklisted AS VBlacklisted, v.enlid AS Vid, rocks.verified AS RockVerified, a.RISC, a.intelfaction, a.communityname, a.picurl, v.VAPIkey FROM agent=a LEFT JOIN rocks ON a.gid = rocks.gid LEFT JOIN v ON a.gid = v.gid WHERE a.gid = ?", gid).Scan(&vname, &rocksname, &intelname, &level, &a.OneTimeToken, &vverified, &vblacklisted, &vid, &rocksverified, &a.RISC, &ifac, &communityname, &pic, &vapi)
+	err := db.QueryRowContext(ctx, "SELECT v.agent AS Vname, rocks.agent AS Rocksname, a.intelname, v.level, a.OneTimeToken, v.verified AS VVerified, v.Blacklisted AS VBlacklisted, v.enlid AS Vid, rocks.verified AS RockVerified, a.RISC, a.intelfaction, a.communityname, a.picurl, v.VAPIkey FROM agent=a LEFT JOIN rocks ON a.gid = rocks.gid LEFT JOIN v ON a.gid = v.gid WHERE a.gid = ?", gid).Scan(&vname, &rocksname, &intelname, &level, &a.OneTimeToken, &vverified, &vblacklisted, &vid, &rocksverified, &a.RISC, &ifac, &communityname, &pic, &vapi)
 	if err != nil && err == sql.ErrNoRows {
 		err = fmt.Errorf(ErrUnknownGID)
 		return &a, err
@@ -153,15 +155,15 @@ func (gid GoogleID) GetAgent() (*Agent, error) {
 		a.Level = uint8(l)
 	}
 
-	if err = adTeams(&a); err != nil {
+	if err = adTeams(ctx, &a); err != nil {
 		return &a, err
 	}
 
-	if err = adTelegram(&a); err != nil {
+	if err = adTelegram(ctx, &a); err != nil {
 		return &a, err
 	}
 
-	if err = adOps(&a); err != nil {
+	if err = adOps(ctx, &a); err != nil {
 		return &a, err
 	}
 
@@ -179,8 +181,8 @@ func (gid GoogleID) GetAgent() (*Agent, error) {
 	return &a, nil
 }
 
-func adTeams(ad *Agent) error {
-	rows, err := db.Query("SELECT x.teamID, team.name, x.shareLoc, x.shareWD, x.loadWD, team.rockscomm, team.rockskey, team.owner, team.joinLinkToken, team.vteam, team.vrole FROM agentteams=x JOIN team ON x.teamID = team.teamID WHERE x.gid = ?", ad.GoogleID)
+func adTeams(ctx context.Context, ad *Agent) error {
+	rows, err := db.QueryContext(ctx, "SELECT x.teamID, team.name, x.shareLoc, x.shareWD, x.loadWD, team.rockscomm, team.rockskey, team.owner, team.joinLinkToken, team.vteam, team.vrole FROM agentteams=x JOIN team ON x.teamID = team.teamID WHERE x.gid = ?", ad.GoogleID)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -234,9 +236,9 @@ func adTeams(ad *Agent) error {
 	return nil
 }
 
-func adTelegram(ad *Agent) error {
+func adTelegram(ctx context.Context, ad *Agent) error {
 	var authtoken sql.NullString
-	err := db.QueryRow("SELECT telegramID, telegramName, verified, authtoken FROM telegram WHERE gid = ?", ad.GoogleID).Scan(&ad.Telegram.ID, &ad.Telegram.Name, &ad.Telegram.Verified, &authtoken)
+	err := db.QueryRowContext(ctx, "SELECT telegramID, telegramName, verified, authtoken FROM telegram WHERE gid = ?", ad.GoogleID).Scan(&ad.Telegram.ID, &ad.Telegram.Name, &ad.Telegram.Verified, &authtoken)
 	if err != nil && err == sql.ErrNoRows {
 		ad.Telegram.ID = 0
 		ad.Telegram.Name = ""
@@ -252,10 +254,10 @@ func adTelegram(ad *Agent) error {
 	return nil
 }
 
-func adOps(ad *Agent) error {
+func adOps(ctx context.Context, ad *Agent) error {
 	seen := make(map[OperationID]bool)
 
-	rowOwned, err := db.Query("SELECT ID, Name, Color, modified, lasteditid FROM operation WHERE gid = ?", ad.GoogleID)
+	rowOwned, err := db.QueryContext(ctx, "SELECT ID, Name, Color, modified, lasteditid FROM operation WHERE gid = ?", ad.GoogleID)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -277,7 +279,7 @@ func adOps(ad *Agent) error {
 		seen[op.ID] = true
 	}
 
-	rowTeam, err := db.Query("SELECT operation.ID, operation.Name, operation.Color, permissions.teamID, operation.modified, operation.lasteditid FROM agentteams JOIN permissions ON agentteams.teamID = permissions.teamID JOIN operation ON permissions.opID = operation.ID WHERE agentteams.gid = ?", ad.GoogleID)
+	rowTeam, err := db.QueryContext(ctx, "SELECT operation.ID, operation.Name, operation.Color, permissions.teamID, operation.modified, operation.lasteditid FROM agentteams JOIN permissions ON agentteams.teamID = permissions.teamID JOIN operation ON permissions.opID = operation.ID WHERE agentteams.gid = ?", ad.GoogleID)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -297,44 +299,104 @@ func adOps(ad *Agent) error {
 		ad.Ops = append(ad.Ops, op)
 		seen[op.ID] = true
 	}
+
+	// ops shared with a team group apply to the teams under it
+	for _, t := range ad.Teams {
+		ancestors, err := t.ID.Ancestors(ctx)
+		if err != nil {
+			log.Error(err)
+			return err
+		}
+		for _, a := range ancestors {
+			if err := adGroupOps(ctx, ad, a, seen); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func adGroupOps(ctx context.Context, ad *Agent, teamID TeamID, seen map[OperationID]bool) error {
+	rows, err := db.QueryContext(ctx, "SELECT operation.ID, operation.Name, operation.Color, permissions.teamID, operation.modified, operation.lasteditid FROM permissions JOIN operation ON permissions.opID = operation.ID WHERE permissions.teamID = ?", teamID)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var op AdOperation
+		if err := rows.Scan(&op.ID, &op.Name, &op.Color, &op.TeamID, &op.Modified, &op.LastEditID); err != nil {
+			log.Error(err)
+			return err
+		}
+		if seen[op.ID] {
+			continue
+		}
+		ad.Ops = append(ad.Ops, op)
+		seen[op.ID] = true
+	}
 	return nil
 }
 
 // SetLocation updates the database to reflect a agent's current location
-func (gid GoogleID) SetLocation(lat, lon string) error {
+func (gid GoogleID) SetLocation(ctx context.Context, lat, lon string) error {
 	if lat == "" || lon == "" {
 		return nil
 	}
 
-	// convert to float64 and back to reduce the garbage input
-	var flat, flon float64
+	if _, err := db.ExecContext(ctx, "UPDATE locations SET loc = PointFromText(?), upTime = UTC_TIMESTAMP() WHERE gid = ?", locationPoint(lat, lon), gid); err != nil {
+		log.Error(err)
+		return err
+	}
 
-	flat, err := strconv.ParseFloat(lat, 64)
+	return nil
+}
+
+// SetLocationAt records a location the agent was at some time ago, e.g. queued while offline
+// it is only stored if it is newer than the one on record, the bool reports if it was
+func (gid GoogleID) SetLocationAt(ctx context.Context, lat, lon string, at time.Time) (bool, error) {
+	if lat == "" || lon == "" {
+		return false, nil
+	}
+
+	// a device clock ahead of ours must not pin the location into the future
+	if now := time.Now().UTC(); at.After(now) {
+		at = now
+	}
+	when := at.UTC().Format("2006-01-02 15:04:05")
+
+	r, err := db.ExecContext(ctx, "UPDATE locations SET loc = PointFromText(?), upTime = ? WHERE gid = ? AND upTime < ?", locationPoint(lat, lon), when, gid, when)
 	if err != nil {
 		log.Error(err)
-		flat = float64(0)
+		return false, err
 	}
+	n, _ := r.RowsAffected()
+	return n == 1, nil
+}
 
-	flon, err = strconv.ParseFloat(lon, 64)
+// locationPoint makes the WKT point for a location, converting to float64 and back to reduce the garbage input
+func locationPoint(lat, lon string) string {
+	flat, err := strconv.ParseFloat(lat, 64)
 	if err != nil {
 		log.Error(err)
-		flon = float64(0)
+		flat = float64(0)
 	}
 
-	point := fmt.Sprintf("POINT(%s %s)", strconv.FormatFloat(flon, 'f', 7, 64), strconv.FormatFloat(flat, 'f', 7, 64))
-	if _, err := db.Exec("UPDATE locations SET loc = PointFromText(?), upTime = UTC_TIMESTAMP() WHERE gid = ?", point, gid); err != nil {
+	flon, err := strconv.ParseFloat(lon, 64)
+	if err != nil {
 		log.Error(err)
-		return err
+		flon = float64(0)
 	}
 
-	return nil
+	return fmt.Sprintf("POINT(%s %s)", strconv.FormatFloat(flon, 'f', 7, 64), strconv.FormatFloat(flat, 'f', 7, 64))
 }
 
 // IngressName returns an agent's name for a given GoogleID.
 // returns err == sql.ErrNoRows if there is no such agent.
-func (gid GoogleID) IngressName() (string, error) {
+func (gid GoogleID) IngressName(ctx context.Context) (string, error) {
 	var intelname, rocksname, vname, communityname sql.NullString
-	err := db.QueryRow("SELECT rocks.agent, v.agent, agent.intelname, agent.communityname FROM agent LEFT JOIN rocks ON agent.gid = rocks.gid LEFT JOIN v ON agent.gid = v.gid WHERE agent.gid = ?", gid).Scan(&rocksname, &vname, &intelname, &communityname)
+	err := db.QueryRowContext(ctx, "SELECT rocks.agent, v.agent, agent.intelname, agent.communityname FROM agent LEFT JOIN rocks ON agent.gid = rocks.gid LEFT JOIN v ON agent.gid = v.gid WHERE agent.gid = ?", gid).Scan(&rocksname, &vname, &intelname, &communityname)
 
 	if err != nil && err == sql.ErrNoRows {
 		log.Error("getting ingressname for unknown gid")
@@ -350,7 +412,7 @@ func (gid GoogleID) IngressName() (string, error) {
 
 // IngressName is used for templates
 func IngressName(g messaging.GoogleID) string {
-	name, _ := GoogleID(string(g)).IngressName()
+	name, _ := GoogleID(string(g)).IngressName(context.Background()) // templates have no request to hand
 	return name
 }
 
@@ -375,9 +437,9 @@ func (gid GoogleID) bestname(intel, v, rocks, communityname sql.NullString) stri
 }
 
 // Valid returns "true" if the GoogleID is known to wasabee
-func (gid GoogleID) Valid() bool {
+func (gid GoogleID) Valid(ctx context.Context) bool {
 	var count int
-	err := db.QueryRow("SELECT COUNT(*) FROM agent WHERE gid = ?", gid).Scan(&count)
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM agent WHERE gid = ?", gid).Scan(&count)
 	if err != nil {
 		log.Error(err)
 		return false
@@ -391,13 +453,13 @@ func (gid GoogleID) String() string {
 
 // SearchAgentName gets a GoogleID from an Agent's name, searching local name, V name (if known), Rocks name (if known) and telegram name (if known)
 // returns "" on no match
-func SearchAgentName(agent string) (GoogleID, error) {
+func SearchAgentName(ctx context.Context, agent string) (GoogleID, error) {
 	var gid GoogleID
 	var count int
 
 	// if it starts with an @ search tg
 	if agent[0] == '@' {
-		err := db.QueryRow("SELECT gid FROM telegram WHERE LOWER(telegramName) = LOWER(?)", agent[1:]).Scan(&gid)
+		err := db.QueryRowContext(ctx, "SELECT gid FROM telegram WHERE LOWER(telegramName) = LOWER(?)", agent[1:]).Scan(&gid)
 		if err != nil && err != sql.ErrNoRows {
 			log.Error(err)
 			return "", err
@@ -407,7 +469,7 @@ func SearchAgentName(agent string) (GoogleID, error) {
 		}
 	}
 
-	err := db.QueryRow("SELECT gid FROM agent WHERE LOWER(communityname) = LOWER(?)", agent).Scan(&gid)
+	err := db.QueryRowContext(ctx, "SELECT gid FROM agent WHERE LOWER(communityname) = LOWER(?)", agent).Scan(&gid)
 	if err != nil && err != sql.ErrNoRows {
 		log.Error(err)
 		return "", err
@@ -417,13 +479,13 @@ func SearchAgentName(agent string) (GoogleID, error) {
 	}
 
 	// v.agent does NOT have a unique key
-	err = db.QueryRow("SELECT COUNT(gid) FROM v WHERE LOWER(agent) = LOWER(?)", agent).Scan(&count)
+	err = db.QueryRowContext(ctx, "SELECT COUNT(gid) FROM v WHERE LOWER(agent) = LOWER(?)", agent).Scan(&count)
 	if err != nil {
 		log.Error(err)
 		return "", err
 	}
 	if count == 1 {
-		err := db.QueryRow("SELECT gid FROM v WHERE LOWER(agent) = LOWER(?)", agent).Scan(&gid)
+		err := db.QueryRowContext(ctx, "SELECT gid FROM v WHERE LOWER(agent) = LOWER(?)", agent).Scan(&gid)
 		if err != nil {
 			log.Error(err)
 			return "", err
@@ -436,14 +498,14 @@ func SearchAgentName(agent string) (GoogleID, error) {
 	}
 
 	// rocks.agent does NOT have a unique key
-	err = db.QueryRow("SELECT COUNT(gid) FROM rocks WHERE LOWER(agent) = LOWER(?)", agent).Scan(&count)
+	err = db.QueryRowContext(ctx, "SELECT COUNT(gid) FROM rocks WHERE LOWER(agent) = LOWER(?)", agent).Scan(&count)
 
 	if err != nil {
 		log.Error(err)
 		return "", err
 	}
 	if count == 1 {
-		err := db.QueryRow("SELECT gid FROM rocks WHERE LOWER(agent) = LOWER(?)", agent).Scan(&gid)
+		err := db.QueryRowContext(ctx, "SELECT gid FROM rocks WHERE LOWER(agent) = LOWER(?)", agent).Scan(&gid)
 		if err != nil {
 			log.Error(err)
 			return "", err
@@ -456,13 +518,13 @@ func SearchAgentName(agent string) (GoogleID, error) {
 	}
 
 	// intelname does NOT have a unique key
-	err = db.QueryRow("SELECT COUNT(gid) FROM agent WHERE LOWER(intelname) = LOWER(?)", agent).Scan(&count)
+	err = db.QueryRowContext(ctx, "SELECT COUNT(gid) FROM agent WHERE LOWER(intelname) = LOWER(?)", agent).Scan(&count)
 	if err != nil {
 		log.Error(err)
 		return "", err
 	}
 	if count == 1 {
-		err := db.QueryRow("SELECT gid FROM agent WHERE LOWER(intelname) = LOWER(?)", agent).Scan(&gid)
+		err := db.QueryRowContext(ctx, "SELECT gid FROM agent WHERE LOWER(intelname) = LOWER(?)", agent).Scan(&gid)
 		if err != nil {
 			log.Error(err)
 			return "", err
@@ -479,10 +541,14 @@ func SearchAgentName(agent string) (GoogleID, error) {
 }
 
 // Delete removes an agent and all associated data
-func (gid GoogleID) Delete() error {
+// the agent's removal from each team is recorded in the team's audit log as done by actor through source
+func (gid GoogleID) Delete(ctx context.Context, actor GoogleID, source TeamAuditSource) error {
+	// their assignments and keys are in ops
+	defer uncacheAllOps()
+
 	// teams require special attention since they might be linked to .rocks communities
 	var teamID TeamID
-	rows, err := db.Query("SELECT teamID FROM team WHERE owner = ?", gid)
+	rows, err := db.QueryContext(ctx, "SELECT teamID FROM team WHERE owner = ?", gid)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -495,14 +561,14 @@ func (gid GoogleID) Delete() error {
 			log.Error(err)
 			continue
 		}
-		err = teamID.Delete()
+		err = teamID.Delete(ctx)
 		if err != nil {
 			log.Error(err)
 			continue
 		}
 	}
 
-	teamrows, err := db.Query("SELECT teamID FROM agentteams WHERE gid = ?", gid)
+	teamrows, err := db.QueryContext(ctx, "SELECT teamID FROM agentteams WHERE gid = ?", gid)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -514,30 +580,33 @@ func (gid GoogleID) Delete() error {
 			log.Error(err)
 			continue
 		}
-		_ = teamID.RemoveAgent(gid)
+		if err := teamID.RemoveAgent(ctx, gid); err != nil {
+			continue
+		}
+		teamID.AuditMembership(ctx, actor, source, gid, AuditActionRemove)
 	}
 
 	// brute force delete everyhing else
-	_, err = db.Exec("DELETE FROM agent WHERE gid = ?", gid)
+	_, err = db.ExecContext(ctx, "DELETE FROM agent WHERE gid = ?", gid)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
 
 	// the foreign key constraints should take care of these, but just in case...
-	_, _ = db.Exec("DELETE FROM locations WHERE gid = ?", gid)
-	_, _ = db.Exec("DELETE FROM telegram WHERE gid = ?", gid)
-	_, _ = db.Exec("DELETE FROM firebase WHERE gid = ?", gid)
-	_, _ = db.Exec("DELETE FROM v WHERE gid = ?", gid)
-	_, _ = db.Exec("DELETE FROM rocks WHERE gid = ?", gid)
+	_, _ = db.ExecContext(ctx, "DELETE FROM locations WHERE gid = ?", gid)
+	_, _ = db.ExecContext(ctx, "DELETE FROM telegram WHERE gid = ?", gid)
+	_, _ = db.ExecContext(ctx, "DELETE FROM firebase WHERE gid = ?", gid)
+	_, _ = db.ExecContext(ctx, "DELETE FROM v WHERE gid = ?", gid)
+	_, _ = db.ExecContext(ctx, "DELETE FROM rocks WHERE gid = ?", gid)
 
 	return nil
 }
 
 // Lock disables an account -- called by RISC system
-func (gid GoogleID) Lock(reason string) error {
+func (gid GoogleID) Lock(ctx context.Context, reason string) error {
 	log.Infow("RISC locking", "gid", gid, "reason", reason)
-	if _, err := db.Exec("UPDATE agent SET RISC = 1 WHERE gid = ?", gid); err != nil {
+	if _, err := db.ExecContext(ctx, "UPDATE agent SET RISC = 1 WHERE gid = ?", gid); err != nil {
 		log.Error(err)
 		return err
 	}
@@ -545,9 +614,9 @@ func (gid GoogleID) Lock(reason string) error {
 }
 
 // Unlock enables a disabled account -- called by RISC system
-func (gid GoogleID) Unlock(reason string) error {
+func (gid GoogleID) Unlock(ctx context.Context, reason string) error {
 	log.Infow("RISC unlocking", "gid", gid, "reason", reason)
-	if _, err := db.Exec("UPDATE agent SET RISC = 0 WHERE gid = ?", gid); err != nil {
+	if _, err := db.ExecContext(ctx, "UPDATE agent SET RISC = 0 WHERE gid = ?", gid); err != nil {
 		log.Error(err)
 		return err
 	}
@@ -555,10 +624,10 @@ func (gid GoogleID) Unlock(reason string) error {
 }
 
 // RISC checks to see if the user was marked as compromised by Google
-func (gid GoogleID) RISC() bool {
+func (gid GoogleID) RISC(ctx context.Context) bool {
 	var RISC bool
 
-	err := db.QueryRow("SELECT RISC FROM agent WHERE gid = ?", gid).Scan(&RISC)
+	err := db.QueryRowContext(ctx, "SELECT RISC FROM agent WHERE gid = ?", gid).Scan(&RISC)
 	if err == sql.ErrNoRows {
 		log.Warnw("agent does not exist, checking RISC flag", "GID", gid)
 	} else if err != nil {
@@ -568,8 +637,8 @@ func (gid GoogleID) RISC() bool {
 }
 
 // UpdatePicture sets/updates the agent's google picture URL
-func (gid GoogleID) UpdatePicture(picurl string) error {
-	if _, err := db.Exec("UPDATE agent SET picurl = ? WHERE gid = ?", picurl, gid); err != nil {
+func (gid GoogleID) UpdatePicture(ctx context.Context, picurl string) error {
+	if _, err := db.ExecContext(ctx, "UPDATE agent SET picurl = ? WHERE gid = ?", picurl, gid); err != nil {
 		log.Error(err)
 		return err
 	}
@@ -577,10 +646,10 @@ func (gid GoogleID) UpdatePicture(picurl string) error {
 }
 
 // GetPicture returns the agent's Google Picture URL
-func (gid GoogleID) GetPicture() string {
+func (gid GoogleID) GetPicture(ctx context.Context) string {
 	var url sql.NullString
 
-	err := db.QueryRow("SELECT picurl FROM agent WHERE gid = ?", gid).Scan(&url)
+	err := db.QueryRowContext(ctx, "SELECT picurl FROM agent WHERE gid = ?", gid).Scan(&url)
 	if err == sql.ErrNoRows || !url.Valid || url.String == "" {
 		return config.Get().DefaultPictureURL
 	}
@@ -593,7 +662,7 @@ func (gid GoogleID) GetPicture() string {
 }
 
 // ToGid takes a string and returns a Gid for it -- for reasonable values of a string; it must look like a GoogleID otherwise it defaults to agent name
-func ToGid(in string) (GoogleID, error) {
+func ToGid(ctx context.Context, in string) (GoogleID, error) {
 	var gid GoogleID
 	var err error
 
@@ -603,7 +672,7 @@ func ToGid(in string) (GoogleID, error) {
 	case 21:
 		gid = GoogleID(in)
 	default:
-		gid, err = SearchAgentName(in) // telegram @names covered here
+		gid, err = SearchAgentName(ctx, in) // telegram @names covered here
 	}
 	if err == sql.ErrNoRows || gid == "" {
 		err = fmt.Errorf(ErrAgentNotFound)
@@ -619,7 +688,7 @@ func ToGid(in string) (GoogleID, error) {
 
 // SetIntelData sets the untrusted data from IITC - do not depend on these values for authorization
 // but if someone says they are a smurf, who are we to deny their self-identity?
-func (gid GoogleID) SetIntelData(name, faction string) error {
+func (gid GoogleID) SetIntelData(ctx context.Context, name, faction string) error {
 	name = util.Sanitize(name) // don't trust this too much
 
 	if name == "" {
@@ -632,7 +701,7 @@ func (gid GoogleID) SetIntelData(name, faction string) error {
 
 	ifac := FactionFromString(faction)
 
-	_, err := db.Exec("UPDATE agent SET intelname = LEFT(?, 15), intelfaction = ? WHERE GID = ?", name, ifac, gid)
+	_, err := db.ExecContext(ctx, "UPDATE agent SET intelname = LEFT(?, 15), intelfaction = ? WHERE GID = ?", name, ifac, gid)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -645,10 +714,10 @@ func (gid GoogleID) SetIntelData(name, faction string) error {
 }
 
 // IntelSmurf checks to see if the agent has self-proclaimed to be a smurf (unset is OK)
-func (gid GoogleID) IntelSmurf() bool {
+func (gid GoogleID) IntelSmurf(ctx context.Context) bool {
 	var ifac IntelFaction
 
-	if err := db.QueryRow("SELECT intelfaction FROM agent WHERE GID = ?", gid).Scan(&ifac); err != nil {
+	if err := db.QueryRowContext(ctx, "SELECT intelfaction FROM agent WHERE GID = ?", gid).Scan(&ifac); err != nil {
 		log.Error(err)
 		return false
 	}
@@ -659,21 +728,21 @@ func (gid GoogleID) IntelSmurf() bool {
 }
 
 // FirstLogin sets the required database records for a new agent
-func (gid GoogleID) FirstLogin() error {
+func (gid GoogleID) FirstLogin(ctx context.Context) error {
 	log.Infow("first login", "GID", gid, "message", "first login for "+gid)
 
-	ott, err := GenerateSafeName()
+	ott, err := GenerateSafeName(ctx)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
 
-	if _, err := db.Exec("INSERT IGNORE INTO agent (gid, OneTimeToken) VALUES (?,?)", gid, ott); err != nil {
+	if _, err := db.ExecContext(ctx, "INSERT IGNORE INTO agent (gid, OneTimeToken) VALUES (?,?)", gid, ott); err != nil {
 		log.Error(err)
 		return err
 	}
 
-	if _, err = db.Exec("INSERT IGNORE INTO locations (gid, upTime, loc) VALUES (?,UTC_TIMESTAMP(),POINT(0,0))", gid); err != nil {
+	if _, err = db.ExecContext(ctx, "INSERT IGNORE INTO locations (gid, upTime, loc) VALUES (?,UTC_TIMESTAMP(),POINT(0,0))", gid); err != nil {
 		log.Error(err)
 		return err
 	}
@@ -682,13 +751,13 @@ func (gid GoogleID) FirstLogin() error {
 }
 
 // GetAgentLocations is a fast-path to get all available agent locations
-func (gid GoogleID) GetAgentLocations() ([]AgentLocation, error) {
+func (gid GoogleID) GetAgentLocations(ctx context.Context) ([]AgentLocation, error) {
 	var list []AgentLocation
 	var tmpL AgentLocation
 	var lat, lon string
 
 	var rows *sql.Rows
-	rows, err := db.Query("SELECT x.gid, Y(l.loc), X(l.loc), l.upTime "+
+	rows, err := db.QueryContext(ctx, "SELECT x.gid, Y(l.loc), X(l.loc), l.upTime "+
 		"FROM agentteams=x, locations=l "+
 		"WHERE x.teamID IN (SELECT teamID FROM agentteams WHERE gid = ?) "+
 		"AND x.shareLoc= 1 AND x.gid = l.gid", gid)
@@ -716,16 +785,16 @@ func (gid GoogleID) GetAgentLocations() ([]AgentLocation, error) {
 }
 
 // SetCommunityName sets the name the agent is known as on the Niantic Community -- this is the most trustworthy source of agent identity
-func (gid GoogleID) SetCommunityName(name string) error {
+func (gid GoogleID) SetCommunityName(ctx context.Context, name string) error {
 	if name == "" {
-		return gid.ClearCommunityName()
+		return gid.ClearCommunityName(ctx)
 	}
 
 	if len(name) > 15 {
 		log.Infow("community name too long", "gid", gid, "name", name)
 	}
 
-	if _, err := db.Exec("UPDATE agent SET communityname = LEFT(?,15) WHERE gid = ?", name, gid); err != nil {
+	if _, err := db.ExecContext(ctx, "UPDATE agent SET communityname = LEFT(?,15) WHERE gid = ?", name, gid); err != nil {
 		log.Error(err)
 		return err
 	}
@@ -733,10 +802,10 @@ func (gid GoogleID) SetCommunityName(name string) error {
 }
 
 // CommunityNameToGID takes a community name and returns a GoogleID
-func CommunityNameToGID(name string) (GoogleID, error) {
+func CommunityNameToGID(ctx context.Context, name string) (GoogleID, error) {
 	var gid GoogleID
 
-	err := db.QueryRow("SELECT gid FROM agent WHERE communityname = ?", name).Scan(&gid)
+	err := db.QueryRowContext(ctx, "SELECT gid FROM agent WHERE communityname = ?", name).Scan(&gid)
 	if err != nil && err != sql.ErrNoRows {
 		log.Error(err)
 		return "", err
@@ -745,8 +814,8 @@ func CommunityNameToGID(name string) (GoogleID, error) {
 }
 
 // ClearCommunityName removes an agent's community name verification
-func (gid GoogleID) ClearCommunityName() error {
-	if _, err := db.Exec("UPDATE agent SET communityname = NULL WHERE gid = ?", gid); err != nil {
+func (gid GoogleID) ClearCommunityName(ctx context.Context) error {
+	if _, err := db.ExecContext(ctx, "UPDATE agent SET communityname = NULL WHERE gid = ?", gid); err != nil {
 		log.Error(err)
 		return err
 	}
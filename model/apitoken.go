@@ -0,0 +1,158 @@
+package model
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/util"
+)
+
+// APITokenPrefix marks a bearer token as a personal API token rather than a JWT
+const APITokenPrefix = "wsb_"
+
+// the scopes an API token can have
+const (
+	APITokenScopeRead  = "read"
+	APITokenScopeWrite = "write"
+)
+
+// maxAPITokens is the most tokens an agent may have at once
+const maxAPITokens = 20
+
+// APIToken is a long-lived token an agent creates for scripts and bots
+// only the hash of the secret is stored, the secret is shown once when the token is created
+type APIToken struct {
+	ID       string      `json:"id"`
+	Gid      GoogleID    `json:"gid"`
+	Name     string      `json:"name"`
+	Scope    string      `json:"scope"`
+	OpID     OperationID `json:"opID,omitempty"`
+	TeamID   TeamID      `json:"teamID,omitempty"`
+	Created  string      `json:"created"`
+	LastUsed string      `json:"lastused,omitempty"`
+}
+
+// ReadOnly reports if the token is limited to reading data
+func (t *APIToken) ReadOnly() bool {
+	return t.Scope != APITokenScopeWrite
+}
+
+func hashAPIToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewAPIToken creates a token for the agent, optionally limited to a single op or team, and returns the secret
+// does not check op/team access -- caller should take care of authorization
+func (gid GoogleID) NewAPIToken(ctx context.Context, name, scope string, opID OperationID, teamID TeamID) (*APIToken, string, error) {
+	if scope != APITokenScopeWrite {
+		scope = APITokenScopeRead
+	}
+
+	var count int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(ID) FROM apitoken WHERE gid = ?", gid).Scan(&count); err != nil {
+		log.Error(err)
+		return nil, "", err
+	}
+	if count >= maxAPITokens {
+		err := fmt.Errorf(ErrAPITokenLimit)
+		log.Warnw(err.Error(), "GID", gid)
+		return nil, "", err
+	}
+
+	t := APIToken{
+		ID:     util.GenerateID(16),
+		Gid:    gid,
+		Name:   name,
+		Scope:  scope,
+		OpID:   opID,
+		TeamID: teamID,
+	}
+	secret := APITokenPrefix + util.GenerateID(40)
+
+	if _, err := db.ExecContext(ctx, "INSERT INTO apitoken (ID, gid, name, hash, scope, opID, teamID) VALUES (?, ?, ?, ?, ?, ?, ?)", t.ID, gid, name, hashAPIToken(secret), scope, makeNullString(string(opID)), makeNullString(string(teamID))); err != nil {
+		log.Error(err)
+		return nil, "", err
+	}
+	return &t, secret, nil
+}
+
+// APITokens lists the agent's tokens
+func (gid GoogleID) APITokens(ctx context.Context) ([]APIToken, error) {
+	tokens := make([]APIToken, 0)
+
+	rows, err := db.QueryContext(ctx, "SELECT ID, gid, name, scope, opID, teamID, created, lastused FROM apitoken WHERE gid = ? ORDER BY created", gid)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error(err)
+		return tokens, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t, err := scanAPIToken(rows)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		tokens = append(tokens, *t)
+	}
+	return tokens, nil
+}
+
+func scanAPIToken(row interface{ Scan(...any) error }) (*APIToken, error) {
+	var t APIToken
+	var opID, teamID, lastused sql.NullString
+
+	if err := row.Scan(&t.ID, &t.Gid, &t.Name, &t.Scope, &opID, &teamID, &t.Created, &lastused); err != nil {
+		return nil, err
+	}
+	t.OpID = OperationID(opID.String)
+	t.TeamID = TeamID(teamID.String)
+	t.LastUsed = lastused.String
+	return &t, nil
+}
+
+// RevokeAPIToken deletes one of the agent's tokens
+func (gid GoogleID) RevokeAPIToken(ctx context.Context, id string) error {
+	r, err := db.ExecContext(ctx, "DELETE FROM apitoken WHERE ID = ? AND gid = ?", id, gid)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	n, err := r.RowsAffected()
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf(ErrAPITokenNotFound)
+	}
+	return nil
+}
+
+// LookupAPIToken finds the token for a secret and records its use
+func LookupAPIToken(ctx context.Context, secret string) (*APIToken, error) {
+	if !strings.HasPrefix(secret, APITokenPrefix) {
+		return nil, fmt.Errorf(ErrInvalidAPIToken)
+	}
+
+	t, err := scanAPIToken(db.QueryRowContext(ctx, "SELECT ID, gid, name, scope, opID, teamID, created, lastused FROM apitoken WHERE hash = ?", hashAPIToken(secret)))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf(ErrInvalidAPIToken)
+	}
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	// only write once a minute for busy bots
+	if _, err := db.ExecContext(ctx, "UPDATE apitoken SET lastused = UTC_TIMESTAMP() WHERE ID = ? AND (lastused IS NULL OR lastused < UTC_TIMESTAMP() - INTERVAL 1 MINUTE)", t.ID); err != nil {
+		log.Error(err)
+	}
+	return t, nil
+}
@@ -1,13 +1,21 @@
 package model
 
 import (
+	"context"
 	"fmt"
 )
 
 // AppleIDtoGID returns a GoogleID for a given AppleID
-// for now this is very dumb and doesn't try to do anything other than ensure the database doesn't throw an error
-// if we want to manually map
-func AppleIDtoGID(id string) (GoogleID, error) {
+// an AppleID linked to an agent returns that agent, otherwise it is mapped to an agent of its own
+func AppleIDtoGID(ctx context.Context, id string) (GoogleID, error) {
+	gid, err := IdentityToGid(ctx, IdentityApple, id)
+	if err != nil {
+		return "", err
+	}
+	if gid != "" {
+		return gid, nil
+	}
+
 	if len(id) > 18 {
 		id = id[:18]
 	}
@@ -0,0 +1,74 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+)
+
+// BlockEntry is a client address or agent barred from the server by an administrator
+type BlockEntry struct {
+	Target  string   `json:"target"` // an IP address or a GoogleID
+	Reason  string   `json:"reason,omitempty"`
+	Admin   GoogleID `json:"admin,omitempty"`
+	Created string   `json:"created"`
+	Expires string   `json:"expires,omitempty"` // empty for blocks which do not expire
+}
+
+// Blocklist returns the blocks in force
+func Blocklist(ctx context.Context) ([]BlockEntry, error) {
+	list := make([]BlockEntry, 0)
+
+	rows, err := db.QueryContext(ctx, "SELECT target, reason, admin, created, expires FROM blocklist WHERE expires IS NULL OR expires > UTC_TIMESTAMP() ORDER BY created")
+	if err != nil {
+		log.Error(err)
+		return list, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var b BlockEntry
+		var reason, admin, expires sql.NullString
+		if err := rows.Scan(&b.Target, &reason, &admin, &b.Created, &expires); err != nil {
+			log.Error(err)
+			continue
+		}
+		b.Reason = reason.String
+		b.Admin = GoogleID(admin.String)
+		b.Expires = expires.String
+		list = append(list, b)
+	}
+	return list, nil
+}
+
+// Block bars target, for d or until unblocked if d is zero; blocking an existing target replaces the block
+func Block(ctx context.Context, target, reason string, admin GoogleID, d time.Duration) error {
+	var expires sql.NullString
+	if d > 0 {
+		expires = makeNullString(time.Now().UTC().Add(d).Format("2006-01-02 15:04:05"))
+	}
+
+	if _, err := db.ExecContext(ctx, "REPLACE INTO blocklist (target, reason, admin, created, expires) VALUES (?, ?, ?, UTC_TIMESTAMP(), ?)", target, makeNullString(reason), makeNullString(admin), expires); err != nil {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// Unblock lifts a block
+func Unblock(ctx context.Context, target string) error {
+	if _, err := db.ExecContext(ctx, "DELETE FROM blocklist WHERE target = ?", target); err != nil {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// BlocklistClean is called from the background process to remove expired blocks
+func BlocklistClean() {
+	if _, err := db.Exec("DELETE FROM blocklist WHERE expires IS NOT NULL AND expires < UTC_TIMESTAMP()"); err != nil {
+		log.Error(err)
+	}
+}
@@ -5,8 +5,7 @@ import (
 	"database/sql"
 	"fmt"
 
-	// need a comment here to make lint happy
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 	"github.com/wasabee-project/Wasabee-Server/log"
 )
 
@@ -15,13 +14,31 @@ var db *sql.DB
 
 // Connect tries to establish a connection to a MySQL/MariaDB database under the given URI and initializes the tables if they don"t exist yet.
 func Connect(ctx context.Context, uri string) error {
+	if err := Open(uri); err != nil {
+		return err
+	}
+
+	setupTables(ctx)
+	upgradeTables(ctx)
+	optimizeTables(ctx)
+	return nil
+}
+
+// Open connects to the database without creating, upgrading or optimizing tables
+// used by the command line tools, which should not hold up a running server
+func Open(uri string) error {
 	// log.Debugw("startup", "database uri", uri)
-	result, err := sql.Open("mysql", uri)
+	cfg, err := mysql.ParseDSN(uri)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	connector, err := mysql.NewConnector(cfg)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
-	db = result
+	db = sql.OpenDB(timedConnector{connector})
 
 	var version string
 	if err := db.QueryRow("SELECT VERSION()").Scan(&version); err != nil {
@@ -29,13 +46,17 @@ func Connect(ctx context.Context, uri string) error {
 		return err
 	}
 	log.Infow("startup", "database", "connected", "version", version, "message", "connected to database")
-
-	setupTables(ctx)
-	upgradeTables(ctx)
-	optimizeTables(ctx)
 	return nil
 }
 
+// Ping checks that the database is reachable
+func Ping(ctx context.Context) error {
+	if db == nil {
+		return fmt.Errorf("database not connected")
+	}
+	return db.PingContext(ctx)
+}
+
 // Disconnect closes the database connection
 // called only at server shutdown
 func Disconnect() {
@@ -50,18 +71,24 @@ var tabledefs = []struct {
 	creation  string
 }{
 	// agent must come first, team must come second, operation must come third, task fourth, the rest can be in alphabetical order
-	{"agent", `CREATE TABLE agent (gid char(21) NOT NULL, OneTimeToken varchar(64) NOT NULL DEFAULT "", RISC tinyint(1) NOT NULL DEFAULT 0, intelname varchar(16) DEFAULT NULL, intelfaction tinyint(1) NOT NULL DEFAULT -1, communityname varchar(16) DEFAULT NULL, picurl text DEFAULT NULL, PRIMARY KEY (gid), UNIQUE KEY OneTimeToken (OneTimeToken), UNIQUE KEY communityname (communityname)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
-	{"team", `CREATE TABLE team (teamID varchar(64) NOT NULL, owner char(21) NOT NULL, name varchar(64) DEFAULT NULL, rockskey varchar(32) DEFAULT NULL, rockscomm varchar(32) DEFAULT NULL, joinLinkToken varchar(64) DEFAULT NULL, vteam int(11) unsigned DEFAULT 0, vrole int(11) unsigned DEFAULT 0, PRIMARY KEY (teamID), KEY fk_team_owner (owner), CONSTRAINT fk_team_owner FOREIGN KEY (owner) REFERENCES agent (gid) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
+	{"agent", `CREATE TABLE agent (gid char(21) NOT NULL, OneTimeToken varchar(64) NOT NULL DEFAULT "", RISC tinyint(1) NOT NULL DEFAULT 0, intelname varchar(16) DEFAULT NULL, intelfaction tinyint(1) NOT NULL DEFAULT -1, communityname varchar(16) DEFAULT NULL, picurl text DEFAULT NULL, modified timestamp(6) NOT NULL DEFAULT current_timestamp(6) ON UPDATE current_timestamp(6), PRIMARY KEY (gid), UNIQUE KEY OneTimeToken (OneTimeToken), UNIQUE KEY communityname (communityname)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
+	{"team", `CREATE TABLE team (teamID varchar(64) NOT NULL, owner char(21) NOT NULL, name varchar(64) DEFAULT NULL, rockskey varchar(32) DEFAULT NULL, rockscomm varchar(32) DEFAULT NULL, joinLinkToken varchar(64) DEFAULT NULL, vteam int(11) unsigned DEFAULT 0, vrole int(11) unsigned DEFAULT 0, neverremove tinyint(1) NOT NULL DEFAULT 0, lastsync timestamp NULL DEFAULT NULL, lastsyncstatus varchar(255) DEFAULT NULL, rosterurl varchar(255) DEFAULT NULL, modified timestamp(6) NOT NULL DEFAULT current_timestamp(6) ON UPDATE current_timestamp(6), PRIMARY KEY (teamID), KEY fk_team_owner (owner), CONSTRAINT fk_team_owner FOREIGN KEY (owner) REFERENCES agent (gid) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 	{"operation", `CREATE TABLE operation (ID char(40) NOT NULL, name varchar(128) NOT NULL DEFAULT 'new op', gid char(21) NOT NULL, color varchar(16) NOT NULL DEFAULT 'purple', modified timestamp NOT NULL DEFAULT current_timestamp(), comment text DEFAULT NULL, referencetime timestamp NOT NULL DEFAULT current_timestamp(), lasteditid char(40) NOT NULL DEFAULT 'unset', PRIMARY KEY (ID), KEY gid (gid), CONSTRAINT fk_operation_agent FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 	{"task", `CREATE TABLE task(ID char(40) NOT NULL, opID char(40) NOT NULL, comment text DEFAULT NULL, taskorder int(11) NOT NULL DEFAULT 0, state enum('pending','assigned','acknowledged','completed') NOT NULL DEFAULT 'pending', zone tinyint(4) NOT NULL DEFAULT 1, delta int(11) NOT NULL DEFAULT 0, PRIMARY KEY (ID,opID), KEY fk_operation_id_task (opID), CONSTRAINT fk_operation_id_task FOREIGN KEY (opID) REFERENCES operation (ID) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 
+	{"adminaudit", `CREATE TABLE adminaudit (admin char(21) NOT NULL, action varchar(32) NOT NULL, target varchar(64) NOT NULL, detail varchar(255) DEFAULT NULL, timestamp timestamp NOT NULL DEFAULT current_timestamp(), KEY timestamp (timestamp), KEY target (target)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
+	{"agentidentity", `CREATE TABLE agentidentity (provider varchar(32) NOT NULL, subject varchar(255) NOT NULL, gid char(21) NOT NULL, linked timestamp NOT NULL DEFAULT current_timestamp(), PRIMARY KEY (provider, subject), KEY gid (gid), CONSTRAINT fk_agentidentity_agent FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 	{"agentteams", `CREATE TABLE agentteams (teamID varchar(64) NOT NULL, gid char(21) NOT NULL, shareLoc tinyint(4) NOT NULL DEFAULT 0, shareWD tinyint(4) NOT NULL DEFAULT 0, loadWD tinyint(4) NOT NULL DEFAULT 0, comment varchar(32), PRIMARY KEY (teamID,gid), KEY gidkey (gid), CONSTRAINT fk_agent_teams FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE, CONSTRAINT fk_t_teams FOREIGN KEY (teamID) REFERENCES team (teamID) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
+	{"apitoken", `CREATE TABLE apitoken (ID char(16) NOT NULL, gid char(21) NOT NULL, name varchar(64) NOT NULL, hash char(64) NOT NULL, scope varchar(16) NOT NULL DEFAULT 'read', opID char(40) DEFAULT NULL, teamID varchar(64) DEFAULT NULL, created timestamp NOT NULL DEFAULT current_timestamp(), lastused timestamp NULL DEFAULT NULL, PRIMARY KEY (ID), UNIQUE KEY hash (hash), KEY gid (gid), CONSTRAINT fk_apitoken_agent FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 	{"assignments", `CREATE TABLE assignments (opID char(40) NOT NULL, taskID char(40) NOT NULL, gid char(21) NOT NULL, KEY opID (opID), KEY gid (gid), CONSTRAINT fk_assignments_gid FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE, CONSTRAINT fk_assignments_opid FOREIGN KEY (opID) REFERENCES operation (ID) ON DELETE CASCADE, KEY taskID (taskID,opID), CONSTRAINT fk_assignments_taskid FOREIGN KEY (taskID,opID) REFERENCES task (ID, opID) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
+	{"blocklist", `CREATE TABLE blocklist (target varchar(64) NOT NULL, reason varchar(255) DEFAULT NULL, admin char(21) DEFAULT NULL, created timestamp NOT NULL DEFAULT current_timestamp(), expires timestamp NULL DEFAULT NULL, PRIMARY KEY (target)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 	{"defensivekeys", `CREATE TABLE defensivekeys (gid char(21) NOT NULL, portalID varchar(41) NOT NULL, capID varchar(16) DEFAULT NULL, count int(3) NOT NULL DEFAULT 0, name varchar(128) DEFAULT NULL, loc point DEFAULT NULL, PRIMARY KEY (portalID,gid), KEY fk_dk_gid (gid), CONSTRAINT fk_dk_gid FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 	{"deletedops", `CREATE TABLE deletedops (opID char(40) NOT NULL, deletedate timestamp NOT NULL DEFAULT current_timestamp(), gid char(21) DEFAULT NULL, PRIMARY KEY (opID)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 	{"depends", `CREATE TABLE depends (opID char(40) NOT NULL, taskID char(40) NOT NULL, dependsOn char(40) DEFAULT NULL, KEY fk_depends_opID (opID), PRIMARY KEY key_optask (opID,taskID), CONSTRAINT fk_depends_opID FOREIGN KEY (opID) REFERENCES operation (ID) ON DELETE CASCADE, CONSTRAINT fk_depends_pk FOREIGN KEY (taskID, opID) REFERENCES task (ID, opID) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 	{"firebase", `CREATE TABLE firebase (gid char(21) NOT NULL, token varchar(256) NOT NULL, KEY fk_gid (gid), CONSTRAINT fk_gid FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 
+	{"idempotency", `CREATE TABLE idempotency (gid char(21) NOT NULL, idkey varchar(64) NOT NULL, fingerprint char(64) NOT NULL, status smallint(6) NOT NULL DEFAULT 0, contenttype varchar(128) DEFAULT NULL, body mediumblob DEFAULT NULL, created timestamp NOT NULL DEFAULT current_timestamp(), PRIMARY KEY (gid,idkey), KEY created (created), CONSTRAINT fk_idempotency_agent FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
+	{"jwtsession", `CREATE TABLE jwtsession (tokenID varchar(64) NOT NULL, gid char(21) NOT NULL, provider varchar(16) NOT NULL, useragent varchar(255) DEFAULT NULL, ip varchar(45) DEFAULT NULL, scope varchar(255) DEFAULT NULL, issued timestamp NOT NULL DEFAULT current_timestamp(), refreshed timestamp NULL DEFAULT NULL, expires timestamp NOT NULL, PRIMARY KEY (tokenID), KEY gid (gid), CONSTRAINT fk_jwtsession_agent FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 	{"link", `CREATE TABLE link (ID char(40) NOT NULL, opID char(40) NOT NULL, fromPortalID varchar(41) NOT NULL, toPortalID varchar(41) NOT NULL, color varchar(16) NOT NULL DEFAULT 'main', mu bigint(20) unsigned NOT NULL DEFAULT 0, PRIMARY KEY (ID,opID), KEY fk_operation_id_link (opID), KEY fk_task_link (ID) , CONSTRAINT fk_operation_id_link FOREIGN KEY (opID) REFERENCES operation (ID) ON DELETE CASCADE, CONSTRAINT fk_task_link FOREIGN KEY (ID) REFERENCES task (ID) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 	{"locations", `CREATE TABLE locations (gid char(21) NOT NULL, upTime timestamp NOT NULL DEFAULT current_timestamp(), loc point NOT NULL, PRIMARY KEY (gid), CONSTRAINT fk_location_agent FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 	{"marker", `CREATE TABLE marker (ID char(40) NOT NULL, opID char(40) NOT NULL, portalID varchar(41) NOT NULL, type varchar(24) NOT NULL, PRIMARY KEY (ID,opID), KEY fk_operation_marker (opID), CONSTRAINT fk_operation_marker FOREIGN KEY (opID) REFERENCES operation (ID) ON DELETE CASCADE, KEY fk_task_marker (ID), CONSTRAINT fk_task_marker FOREIGN KEY (ID) REFERENCES task (ID) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
@@ -70,7 +97,10 @@ var tabledefs = []struct {
 	{"opkeys", `CREATE TABLE opkeys (opID char(40) NOT NULL, portalID varchar(41) NOT NULL, gid char(21) NOT NULL, onhand int(11) unsigned NOT NULL DEFAULT 0, capsule varchar(16) DEFAULT NULL, UNIQUE KEY key_unique (opID,portalID,gid,capsule), KEY fk_operation_id_keys (opID), CONSTRAINT fk_operation_id_keys FOREIGN KEY (opID) REFERENCES operation (ID) ON DELETE CASCADE, KEY fk_agent_keys (gid), CONSTRAINT fk_agent_keys FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 	{"permissions", `CREATE TABLE permissions (teamID varchar(64) NOT NULL, opID char(40) NOT NULL, permission enum('read','write','assignedonly') NOT NULL DEFAULT 'read', zone tinyint(4) NOT NULL DEFAULT 0, KEY opID (opID), KEY teamID (teamID), CONSTRAINT fk_ops_teamID FOREIGN KEY (opID) REFERENCES operation (ID) ON DELETE CASCADE, CONSTRAINT fk_teamIDs_op FOREIGN KEY (teamID) REFERENCES team (teamID) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 	{"portal", `CREATE TABLE portal (ID varchar(41) NOT NULL, opID char(40) NOT NULL, name varchar(128) NOT NULL, loc point NOT NULL, comment text DEFAULT NULL, hardness varchar(64) DEFAULT NULL, PRIMARY KEY (ID,opID), KEY fk_operation_id (opID), CONSTRAINT FOREIGN KEY fk_operation_id (opID) REFERENCES operation (ID) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
+	{"revokedjwt", `CREATE TABLE revokedjwt (tokenID varchar(64) NOT NULL, revoked timestamp NOT NULL DEFAULT current_timestamp(), PRIMARY KEY (tokenID)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 	{"rocks", `CREATE TABLE rocks (gid char(21) NOT NULL, tgid int(11) DEFAULT NULL, agent varchar(16) DEFAULT NULL, verified tinyint(4) NOT NULL DEFAULT 0, smurf tinyint(4) NOT NULL DEFAULT 0, fetched timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY (gid), CONSTRAINT fk_rocks_gid FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
+	{"teamaudit", `CREATE TABLE teamaudit (teamID varchar(64) NOT NULL, actor char(21) DEFAULT NULL, source varchar(16) NOT NULL, gid char(21) NOT NULL, action varchar(16) NOT NULL, timestamp timestamp NOT NULL DEFAULT current_timestamp(), KEY teamID (teamID, timestamp), CONSTRAINT fk_teamaudit_team FOREIGN KEY (teamID) REFERENCES team (teamID) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
+	{"teamgroup", `CREATE TABLE teamgroup (child varchar(64) NOT NULL, parent varchar(64) NOT NULL, PRIMARY KEY (child), KEY parent (parent), CONSTRAINT fk_teamgroup_child FOREIGN KEY (child) REFERENCES team (teamID) ON DELETE CASCADE, CONSTRAINT fk_teamgroup_parent FOREIGN KEY (parent) REFERENCES team (teamID) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 	{"telegram", `CREATE TABLE telegram (telegramID bigint(20) NOT NULL, telegramName varchar(32) NOT NULL, gid char(21) NOT NULL, verified tinyint(1) NOT NULL DEFAULT 0, authtoken varchar(32) DEFAULT NULL, PRIMARY KEY (telegramID), UNIQUE KEY gid (gid), CONSTRAINT fk_agent_telegram FOREIGN KEY (gid) REFERENCES agent (gid) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 	{"telegramteam", `CREATE TABLE telegramteam (teamID varchar(64) NOT NULL, telegram bigint(20) NOT NULL, opID char(40) DEFAULT NULL, PRIMARY KEY (telegram), UNIQUE KEY (teamID), CONSTRAINT fk_tt_team FOREIGN KEY (teamID) REFERENCES team (teamID) ON DELETE CASCADE, KEY (opID), CONSTRAINT fk_tt_op FOREIGN KEY (opID) REFERENCES operation (ID) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
 	{"telegramchatmembers", `CREATE TABLE telegramchatmembers (agent bigint(20) NOT NULL, chat bigint(20) NOT NULL, PRIMARY KEY (agent,chat), KEY (chat), CONSTRAINT fk_tg_chat FOREIGN KEY (chat) REFERENCES telegramteam (telegram) ON DELETE CASCADE) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`},
@@ -137,6 +167,12 @@ func upgradeTables(ctx context.Context) {
 		upgrade string // the query to run to make the upgrade
 	}{
 		{"SHOW FIELDS FROM zonepoints where field='position' and type like '%unsigned%'", "alter table zonepoints MODIFY COLUMN position tinyint(4) unsigned"},
+		{"SELECT COUNT(neverremove) FROM team", "ALTER TABLE team ADD COLUMN neverremove tinyint(1) NOT NULL DEFAULT 0 AFTER vrole"},
+		{"SELECT COUNT(lastsync) FROM team", "ALTER TABLE team ADD COLUMN lastsync timestamp NULL DEFAULT NULL AFTER neverremove"},
+		{"SELECT COUNT(lastsyncstatus) FROM team", "ALTER TABLE team ADD COLUMN lastsyncstatus varchar(255) DEFAULT NULL AFTER lastsync"},
+		{"SELECT COUNT(rosterurl) FROM team", "ALTER TABLE team ADD COLUMN rosterurl varchar(255) DEFAULT NULL AFTER lastsyncstatus"},
+		{"SELECT COUNT(modified) FROM team", "ALTER TABLE team ADD COLUMN modified timestamp(6) NOT NULL DEFAULT current_timestamp(6) ON UPDATE current_timestamp(6) AFTER rosterurl"},
+		{"SELECT COUNT(modified) FROM agent", "ALTER TABLE agent ADD COLUMN modified timestamp(6) NOT NULL DEFAULT current_timestamp(6) ON UPDATE current_timestamp(6) AFTER picurl"},
 	}
 
 	tx, err := db.BeginTx(ctx, nil)
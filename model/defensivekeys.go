@@ -1,6 +1,7 @@
 package model
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strconv"
@@ -27,11 +28,11 @@ type DefensiveKey struct {
 }
 
 // ListDefensiveKeys gets all keys an agent is authorized to know about.
-func (gid GoogleID) ListDefensiveKeys() (DefensiveKeyList, error) {
+func (gid GoogleID) ListDefensiveKeys(ctx context.Context) (DefensiveKeyList, error) {
 	var dkl DefensiveKeyList
 	var name, lat, lon sql.NullString
 
-	rows, err := db.Query("SELECT gid, portalID, capID, count, name, Y(loc) AS lat, X(loc) AS lon FROM defensivekeys WHERE gid IN (SELECT DISTINCT other.gid FROM agentteams=other, agentteams=me WHERE me.gid = ? AND me.loadWD = 1 AND other.teamID = me.teamID AND other.shareWD = 1)", gid)
+	rows, err := db.QueryContext(ctx, "SELECT gid, portalID, capID, count, name, Y(loc) AS lat, X(loc) AS lon FROM defensivekeys WHERE gid IN (SELECT DISTINCT other.gid FROM agentteams=other, agentteams=me WHERE me.gid = ? AND me.loadWD = 1 AND other.teamID = me.teamID AND other.shareWD = 1)", gid)
 
 	if err != nil && err != sql.ErrNoRows {
 		log.Error(err)
@@ -70,9 +71,9 @@ func (gid GoogleID) ListDefensiveKeys() (DefensiveKeyList, error) {
 }
 
 // InsertDefensiveKey adds a new key to the list
-func (gid GoogleID) InsertDefensiveKey(dk DefensiveKey) error {
+func (gid GoogleID) InsertDefensiveKey(ctx context.Context, dk DefensiveKey) error {
 	if dk.Count < 1 {
-		if _, err := db.Exec("DELETE FROM defensivekeys WHERE gid = ? AND portalID = ?", gid, dk.PortalID); err != nil {
+		if _, err := db.ExecContext(ctx, "DELETE FROM defensivekeys WHERE gid = ? AND portalID = ?", gid, dk.PortalID); err != nil {
 			log.Error(err)
 			return err
 		}
@@ -93,7 +94,7 @@ func (gid GoogleID) InsertDefensiveKey(dk DefensiveKey) error {
 		}
 		point := fmt.Sprintf("POINT(%s %s)", strconv.FormatFloat(flon, 'f', 7, 64), strconv.FormatFloat(flat, 'f', 7, 64))
 
-		if _, err := db.Exec("INSERT INTO defensivekeys (gid, portalID, capID, count, name, loc) VALUES (?, ?, ?, ?, ?, PointFromText(?)) ON DUPLICATE KEY UPDATE capID = ?, count = ?", gid, dk.PortalID, dk.CapID, dk.Count, dk.Name, point, dk.CapID, dk.Count); err != nil {
+		if _, err := db.ExecContext(ctx, "INSERT INTO defensivekeys (gid, portalID, capID, count, name, loc) VALUES (?, ?, ?, ?, ?, PointFromText(?)) ON DUPLICATE KEY UPDATE capID = ?, count = ?", gid, dk.PortalID, dk.CapID, dk.Count, dk.Name, point, dk.CapID, dk.Count); err != nil {
 			log.Error(err)
 			return err
 		}
@@ -3,9 +3,14 @@ package model
 // These error values are error strings visible to users, they need to be migrated to the translation system
 const (
 	ErrAgentNotFound        = "agent not registered with this wasabee server"
+	ErrAPITokenLimit        = "too many API tokens, revoke one first"
+	ErrAPITokenNotFound     = "API token not found"
 	ErrEmptyAgent           = "empty agent request"
 	ErrGetLinkUnpopulated   = "attempt to use GetLink on unpopulated *Operation"
 	ErrGetMarkerUnpopulated = "attempt to use GetMarker on unpopulated *Operation"
+	ErrIdentityLast         = "cannot remove the only way to log in to this agent"
+	ErrIdentityLinked       = "this login is already linked to another agent, merge the agents instead"
+	ErrInvalidAPIToken      = "invalid API token"
 	ErrInvalidOTT           = "invalid OneTimeToken"
 	ErrKeyUnableToRemove    = "unable to remove key count for portal"
 	ErrKeyUnableToRecord    = "unable to record keys, ensure the op on the server is up-to-date"
@@ -20,6 +25,7 @@ const (
 	ErrNotOpOwner           = "not owner of op"
 	ErrPortalNotFound       = "portal not found"
 	ErrTaskNotFound         = "task not found"
+	ErrTeamGroupLoop        = "a team cannot be placed under itself or one of its sub-teams"
 	ErrUnknownGID           = "unknown GoogleID"
 	ErrUnknownPermType      = "unknown permission type"
 	ErrUnknownUser          = "unknown user"
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"context"
 	"database/sql"
 
 	"github.com/wasabee-project/Wasabee-Server/log"
@@ -8,11 +9,11 @@ import (
 )
 
 // GetFirebaseTokens gets an agents FirebaseToken from the database
-func (gid GoogleID) GetFirebaseTokens() ([]string, error) {
+func (gid GoogleID) GetFirebaseTokens(ctx context.Context) ([]string, error) {
 	var token string
 	var toks []string
 
-	rows, err := db.Query("SELECT DISTINCT token FROM firebase WHERE gid = ?", gid)
+	rows, err := db.QueryContext(ctx, "SELECT DISTINCT token FROM firebase WHERE gid = ?", gid)
 	if err != nil && err != sql.ErrNoRows {
 		log.Error(err)
 		return toks, err
@@ -38,11 +39,11 @@ func (gid GoogleID) GetFirebaseTokens() ([]string, error) {
 // StoreFirebaseToken adds a token in the database for an agent.
 // gid is not unique, an agent may have any number of tokens (e.g. multiple devices/browsers).
 // Pruning of dead tokens takes place in the senders upon error.
-func (gid GoogleID) StoreFirebaseToken(token string) error {
+func (gid GoogleID) StoreFirebaseToken(ctx context.Context, token string) error {
 	g := GoogleID(gid)
 
 	var count int
-	err := db.QueryRow("SELECT COUNT(gid) FROM firebase WHERE token = ? AND gid = ?", token, gid).Scan(&count)
+	err := db.QueryRowContext(ctx, "SELECT COUNT(gid) FROM firebase WHERE token = ? AND gid = ?", token, gid).Scan(&count)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -53,7 +54,7 @@ func (gid GoogleID) StoreFirebaseToken(token string) error {
 	}
 
 	// log.Debugw("adding token", "subsystem", "Firebase", "GID", gid, "token", token)
-	_, err = db.Exec("INSERT INTO firebase (gid, token) VALUES (?, ?)", gid, token)
+	_, err = db.ExecContext(ctx, "INSERT INTO firebase (gid, token) VALUES (?, ?)", gid, token)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -61,16 +62,16 @@ func (gid GoogleID) StoreFirebaseToken(token string) error {
 
 	// Subscribe this token to all team topics
 	// TODO: This isn't right -- each token sub now triggers messages in Telegram teams...
-	for _, teamID := range g.teamList() {
-		messaging.AddToRemote(messaging.GoogleID(gid), messaging.TeamID(teamID))
+	for _, teamID := range g.teamList(ctx) {
+		messaging.AddToRemote(ctx, messaging.GoogleID(gid), messaging.TeamID(teamID))
 	}
 
 	return nil
 }
 
 // RemoveFirebaseToken removes a given token from the database
-func RemoveFirebaseToken(token string) error {
-	_, err := db.Exec("DELETE FROM firebase WHERE token = ?", token)
+func RemoveFirebaseToken(ctx context.Context, token string) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM firebase WHERE token = ?", token)
 	if err != nil {
 		log.Error(err)
 	}
@@ -78,8 +79,8 @@ func RemoveFirebaseToken(token string) error {
 }
 
 // RemoveAllFirebaseTokens removes all tokens for a given agent
-func (gid GoogleID) RemoveAllFirebaseTokens() error {
-	_, err := db.Exec("DELETE FROM firebase WHERE gid = ?", gid)
+func (gid GoogleID) RemoveAllFirebaseTokens(ctx context.Context) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM firebase WHERE gid = ?", gid)
 	if err != nil {
 		log.Error(err)
 	}
@@ -89,10 +90,10 @@ func (gid GoogleID) RemoveAllFirebaseTokens() error {
 // FirebaseBroadcastList returns all known firebase tokens for messaging all agents
 // Firebase Multicast messages are limited to 500 tokens each, the caller must
 // break the list up if necessary.
-func FirebaseBroadcastList() ([]string, error) {
+func FirebaseBroadcastList(ctx context.Context) ([]string, error) {
 	var out []string
 
-	rows, err := db.Query("SELECT DISTINCT token FROM firebase")
+	rows, err := db.QueryContext(ctx, "SELECT DISTINCT token FROM firebase")
 	if err != nil && err == sql.ErrNoRows {
 		return out, nil
 	}
@@ -122,10 +123,10 @@ type TeamToken struct {
 
 // FirebaserLocationTokens returns a list all tokens for the agents on the teams with which this agent is sharing location
 // instead of sending to the team topics, we do the fanout manually -- to avoid hitting the (small) fanout quota
-func (gid GoogleID) FirebaseLocationTokens() ([]TeamToken, error) {
+func (gid GoogleID) FirebaseLocationTokens(ctx context.Context) ([]TeamToken, error) {
 	var out []TeamToken
 
-	rows, err := db.Query("SELECT DISTINCT teamid, token FROM firebase JOIN agentteams ON firebase.gid = agentteams.gid WHERE agentteams.teamID IN (SELECT teamID FROM agentteams WHERE gid = ? AND shareLoc = 1)", gid)
+	rows, err := db.QueryContext(ctx, "SELECT DISTINCT teamid, token FROM firebase JOIN agentteams ON firebase.gid = agentteams.gid WHERE agentteams.teamID IN (SELECT teamID FROM agentteams WHERE gid = ? AND shareLoc = 1)", gid)
 	if err != nil && err == sql.ErrNoRows {
 		return out, nil
 	}
@@ -0,0 +1,76 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+)
+
+// IdempotencyWindow is how long a response is kept for replay to a client retrying with the same Idempotency-Key
+const IdempotencyWindow = 24 * time.Hour
+
+// IdempotentResponse is a stored response, a zero Status means the first request is still running
+type IdempotentResponse struct {
+	Fingerprint string
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+// ClaimIdempotencyKey reserves key for a request; if the agent already used the key within the window, the earlier response is returned instead
+// the claim is made by the insert, so two servers racing on the same retry cannot both run it
+// a claim still in flight after timeout is taken to be abandoned (the server died, or the release failed) and is claimed anew
+func (gid GoogleID) ClaimIdempotencyKey(ctx context.Context, key, fingerprint string, timeout time.Duration) (*IdempotentResponse, error) {
+	// a key from outside the window, or one abandoned mid-request, is fair game again
+	if _, err := db.ExecContext(ctx, "DELETE FROM idempotency WHERE gid = ? AND idkey = ? AND (created < DATE_SUB(UTC_TIMESTAMP(), INTERVAL ? SECOND) OR (status = 0 AND created < DATE_SUB(UTC_TIMESTAMP(), INTERVAL ? SECOND)))",
+		gid, key, int(IdempotencyWindow.Seconds()), int(timeout.Seconds())); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	r, err := db.ExecContext(ctx, "INSERT IGNORE INTO idempotency (gid, idkey, fingerprint, created) VALUES (?, ?, ?, UTC_TIMESTAMP())", gid, key, fingerprint)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	if n, _ := r.RowsAffected(); n == 1 {
+		return nil, nil
+	}
+
+	var ir IdempotentResponse
+	var ct sql.NullString
+	err = db.QueryRowContext(ctx, "SELECT fingerprint, status, contenttype, body FROM idempotency WHERE gid = ? AND idkey = ?", gid, key).Scan(&ir.Fingerprint, &ir.Status, &ct, &ir.Body)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	ir.ContentType = ct.String
+	return &ir, nil
+}
+
+// StoreIdempotentResponse saves the response to a claimed key for replay
+func (gid GoogleID) StoreIdempotentResponse(ctx context.Context, key string, status int, contentType string, body []byte) error {
+	if _, err := db.ExecContext(ctx, "UPDATE idempotency SET status = ?, contenttype = ?, body = ? WHERE gid = ? AND idkey = ?", status, makeNullString(contentType), body, gid, key); err != nil {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey gives up a claim, so a retry runs the request again
+func (gid GoogleID) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	if _, err := db.ExecContext(ctx, "DELETE FROM idempotency WHERE gid = ? AND idkey = ?", gid, key); err != nil {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// IdempotencyClean is called from the background process to remove responses past the replay window
+func IdempotencyClean() {
+	if _, err := db.Exec("DELETE FROM idempotency WHERE created < DATE_SUB(UTC_TIMESTAMP(), INTERVAL ? SECOND)", int(IdempotencyWindow.Seconds())); err != nil {
+		log.Error(err)
+	}
+}
@@ -0,0 +1,143 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+)
+
+// the identity providers an agent can link, OpenID Connect providers are IdentityOIDCPrefix + the configured name
+const (
+	IdentityApple      = "apple"
+	IdentityTelegram   = "telegram"
+	IdentityOIDCPrefix = "oidc:"
+	IdentityGoogle     = "google" // a Google account whose agent was merged into another
+)
+
+// Identity is an external login linked to an agent
+type Identity struct {
+	Provider string `json:"provider"`
+	Subject  string `json:"subject"`
+	Linked   string `json:"linked,omitempty"`
+}
+
+// IdentityToGid returns the agent an external login (provider and subject) is linked to, "" if it is not linked
+func IdentityToGid(ctx context.Context, provider, subject string) (GoogleID, error) {
+	var gid GoogleID
+
+	err := db.QueryRowContext(ctx, "SELECT gid FROM agentidentity WHERE provider = ? AND subject = ?", provider, subject).Scan(&gid)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		log.Error(err)
+		return "", err
+	}
+	return gid, nil
+}
+
+// GoogleIDtoGID returns the agent a Google login belongs to: the agent it was merged into, if it was, otherwise its own
+func GoogleIDtoGID(ctx context.Context, id GoogleID) (GoogleID, error) {
+	gid, err := IdentityToGid(ctx, IdentityGoogle, string(id))
+	if err != nil {
+		return "", err
+	}
+	if gid != "" {
+		return gid, nil
+	}
+	return id, nil
+}
+
+// LinkIdentity links an external login to the agent
+func (gid GoogleID) LinkIdentity(ctx context.Context, provider, subject string) error {
+	existing, err := IdentityToGid(ctx, provider, subject)
+	if err != nil {
+		return err
+	}
+	if existing == gid {
+		return nil
+	}
+	if existing != "" {
+		err := fmt.Errorf(ErrIdentityLinked)
+		log.Warnw(err.Error(), "GID", gid, "provider", provider, "other", existing)
+		return err
+	}
+
+	if _, err := db.ExecContext(ctx, "INSERT INTO agentidentity (provider, subject, gid) VALUES (?, ?, ?)", provider, subject, gid); err != nil {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// UnlinkIdentity removes an external login from the agent
+// agents created by an OpenID Connect login cannot remove their last identity, they would be unable to log in
+func (gid GoogleID) UnlinkIdentity(ctx context.Context, provider, subject string) error {
+	if provider == IdentityTelegram {
+		return gid.RemoveTelegramID(ctx)
+	}
+
+	if strings.HasPrefix(string(gid), "O-") {
+		var count int
+		if err := db.QueryRowContext(ctx, "SELECT COUNT(subject) FROM agentidentity WHERE gid = ?", gid).Scan(&count); err != nil {
+			log.Error(err)
+			return err
+		}
+		if count <= 1 {
+			err := fmt.Errorf(ErrIdentityLast)
+			log.Warnw(err.Error(), "GID", gid, "provider", provider)
+			return err
+		}
+	}
+
+	if _, err := db.ExecContext(ctx, "DELETE FROM agentidentity WHERE gid = ? AND provider = ? AND subject = ?", gid, provider, subject); err != nil {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// Identities lists the external logins linked to the agent, including Telegram
+func (gid GoogleID) Identities(ctx context.Context) ([]Identity, error) {
+	identities := make([]Identity, 0)
+
+	rows, err := db.QueryContext(ctx, "SELECT provider, subject, linked FROM agentidentity WHERE gid = ? ORDER BY linked", gid)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error(err)
+		return identities, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i Identity
+		if err := rows.Scan(&i.Provider, &i.Subject, &i.Linked); err != nil {
+			log.Error(err)
+			continue
+		}
+		identities = append(identities, i)
+	}
+
+	tgid, err := gid.TelegramID(ctx)
+	if err != nil {
+		return identities, err
+	}
+	if tgid != 0 {
+		identities = append(identities, Identity{Provider: IdentityTelegram, Subject: tgid.String()})
+	}
+	return identities, nil
+}
+
+// SessionFresh reports if a JWT was minted by a login within the last age, refreshes do not count
+func (gid GoogleID) SessionFresh(ctx context.Context, tokenID string, age time.Duration) (bool, error) {
+	var count int
+
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(tokenID) FROM jwtsession WHERE tokenID = ? AND gid = ? AND issued > DATE_SUB(UTC_TIMESTAMP(), INTERVAL ? SECOND)", tokenID, gid, int(age.Seconds())).Scan(&count); err != nil {
+		log.Error(err)
+		return false, err
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,208 @@
+package model
+
+import (
+	"context"
+	"database/sql/driver"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/tracing"
+)
+
+var dbDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{Name: "wasabee_db_query_duration_seconds", Help: "Database query latency by kind (query or exec)."}, []string{"kind"})
+
+func init() {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{Name: "wasabee_db_connections_in_use", Help: "Database connections currently in use."}, func() float64 {
+		if db == nil {
+			return 0
+		}
+		return float64(db.Stats().InUse)
+	})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{Name: "wasabee_db_connections_open", Help: "Database connections open, in use or idle."}, func() float64 {
+		if db == nil {
+			return 0
+		}
+		return float64(db.Stats().OpenConnections)
+	})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{Name: "wasabee_agents_located", Help: "Agents who have shared a location in the past three hours."}, func() float64 {
+		if db == nil {
+			return 0
+		}
+		return float64(LocatedAgentCount())
+	})
+}
+
+// LocatedAgentCount is the number of agents with a location not yet cleared by LocationClean
+func LocatedAgentCount() int {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM locations WHERE loc != POINTFROMTEXT(?) AND upTime > DATE_SUB(UTC_TIMESTAMP(), INTERVAL 3 HOUR)", "POINT(0 0)").Scan(&count); err != nil {
+		log.Error(err)
+		return 0
+	}
+	return count
+}
+
+// observe records a query's duration and, if ctx carries a span, a child span with the SQL (placeholders, not values)
+// only the kind goes in the metrics, not the SQL, to keep the number of series small
+func observe(ctx context.Context, kind, query string, start time.Time, err error) {
+	dbDuration.WithLabelValues(kind).Observe(time.Since(start).Seconds())
+
+	// calls made without a request's context would each start a new trace, skip them
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return
+	}
+	_, span := tracing.Span(ctx, "db."+kind,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(start),
+		trace.WithAttributes(semconv.DBSystemMySQL, semconv.DBStatement(query)))
+	tracing.End(span, err)
+}
+
+// timedConnector wraps the mysql connector so every query is timed and traced without touching the callers
+type timedConnector struct {
+	driver.Connector
+}
+
+func (t timedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	c, err := t.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &timedConn{Conn: c}, nil
+}
+
+// timedConn passes through every optional interface the mysql driver implements
+type timedConn struct {
+	driver.Conn
+}
+
+func (t *timedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := t.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := q.QueryContext(ctx, query, args)
+	if err != driver.ErrSkip { // not run here, it will be prepared
+		observe(ctx, "query", query, start, err)
+	}
+	return rows, err
+}
+
+func (t *timedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := t.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	res, err := e.ExecContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		observe(ctx, "exec", query, start, err)
+	}
+	return res, err
+}
+
+func (t *timedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var s driver.Stmt
+	var err error
+	if p, ok := t.Conn.(driver.ConnPrepareContext); ok {
+		s, err = p.PrepareContext(ctx, query)
+	} else {
+		s, err = t.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &timedStmt{Stmt: s, query: query}, nil
+}
+
+func (t *timedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := t.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return t.Conn.Begin()
+}
+
+func (t *timedConn) Ping(ctx context.Context) error {
+	if p, ok := t.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (t *timedConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if c, ok := t.Conn.(driver.NamedValueChecker); ok {
+		return c.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func (t *timedConn) ResetSession(ctx context.Context) error {
+	if r, ok := t.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (t *timedConn) IsValid() bool {
+	if v, ok := t.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+type timedStmt struct {
+	driver.Stmt
+	query string
+}
+
+func (t *timedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (rows driver.Rows, err error) {
+	start := time.Now()
+	defer func() { observe(ctx, "query", t.query, start, err) }()
+
+	if q, ok := t.Stmt.(driver.StmtQueryContext); ok {
+		return q.QueryContext(ctx, args)
+	}
+	values, err := namedToValues(args)
+	if err != nil {
+		return nil, err
+	}
+	return t.Stmt.Query(values)
+}
+
+func (t *timedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (res driver.Result, err error) {
+	start := time.Now()
+	defer func() { observe(ctx, "exec", t.query, start, err) }()
+
+	if e, ok := t.Stmt.(driver.StmtExecContext); ok {
+		return e.ExecContext(ctx, args)
+	}
+	values, err := namedToValues(args)
+	if err != nil {
+		return nil, err
+	}
+	return t.Stmt.Exec(values)
+}
+
+func (t *timedStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if c, ok := t.Stmt.(driver.NamedValueChecker); ok {
+		return c.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func namedToValues(named []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(named))
+	for i, n := range named {
+		if n.Name != "" {
+			return nil, driver.ErrSkip
+		}
+		values[i] = n.Value
+	}
+	return values, nil
+}
@@ -0,0 +1,120 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+)
+
+// Session is a JWT minted by this server and the client it was minted for
+type Session struct {
+	ID        string `json:"id"`
+	Provider  string `json:"provider"`
+	UserAgent string `json:"useragent,omitempty"`
+	IP        string `json:"ip,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	Issued    string `json:"issued"`
+	Refreshed string `json:"refreshed,omitempty"`
+	Expires   string `json:"expires"`
+	Current   bool   `json:"current"`
+}
+
+// the size of the jwtsession.useragent column
+const maxUserAgentLength = 255
+
+// RecordSession saves a newly minted JWT
+func (gid GoogleID) RecordSession(ctx context.Context, tokenID, provider, useragent, ip, scope string, expires time.Time) error {
+	if len(useragent) > maxUserAgentLength {
+		useragent = useragent[:maxUserAgentLength]
+	}
+
+	if _, err := db.ExecContext(ctx, "INSERT INTO jwtsession (tokenID, gid, provider, useragent, ip, scope, issued, expires) VALUES (?, ?, ?, ?, ?, ?, UTC_TIMESTAMP(), ?)",
+		tokenID, gid, provider, makeNullString(useragent), makeNullString(ip), makeNullString(scope), expires.UTC().Format("2006-01-02 15:04:05")); err != nil {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// RefreshSession records that a JWT was refreshed with a new expiration
+// tokens minted before sessions were recorded, or by a federation peer, get their row here so they can be listed and revoked
+func (gid GoogleID) RefreshSession(ctx context.Context, tokenID, useragent, ip, scope string, expires time.Time) error {
+	if len(useragent) > maxUserAgentLength {
+		useragent = useragent[:maxUserAgentLength]
+	}
+
+	if _, err := db.ExecContext(ctx, "INSERT INTO jwtsession (tokenID, gid, provider, useragent, ip, scope, issued, refreshed, expires) VALUES (?, ?, 'refresh', ?, ?, ?, UTC_TIMESTAMP(), UTC_TIMESTAMP(), ?) ON DUPLICATE KEY UPDATE refreshed = IF(gid = VALUES(gid), VALUES(refreshed), refreshed), expires = IF(gid = VALUES(gid), VALUES(expires), expires), useragent = IF(gid = VALUES(gid), VALUES(useragent), useragent), ip = IF(gid = VALUES(gid), VALUES(ip), ip)",
+		tokenID, gid, makeNullString(useragent), makeNullString(ip), makeNullString(scope), expires.UTC().Format("2006-01-02 15:04:05")); err != nil {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// Sessions lists the agent's unexpired JWTs
+func (gid GoogleID) Sessions(ctx context.Context) ([]Session, error) {
+	sessions := make([]Session, 0)
+
+	rows, err := db.QueryContext(ctx, "SELECT tokenID, provider, useragent, ip, scope, issued, refreshed, expires FROM jwtsession WHERE gid = ? AND expires > UTC_TIMESTAMP() ORDER BY issued DESC", gid)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error(err)
+		return sessions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s Session
+		var useragent, ip, scope, refreshed sql.NullString
+		if err := rows.Scan(&s.ID, &s.Provider, &useragent, &ip, &scope, &s.Issued, &refreshed, &s.Expires); err != nil {
+			log.Error(err)
+			continue
+		}
+		s.UserAgent = useragent.String
+		s.IP = ip.String
+		s.Scope = scope.String
+		s.Refreshed = refreshed.String
+		sessions = append(sessions, s)
+	}
+	return sessions, nil
+}
+
+// HasSession reports if a JWT ID belongs to one of the agent's sessions
+func (gid GoogleID) HasSession(ctx context.Context, tokenID string) (bool, error) {
+	var count int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(tokenID) FROM jwtsession WHERE tokenID = ? AND gid = ?", tokenID, gid).Scan(&count); err != nil {
+		log.Error(err)
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// SessionIDs lists the IDs of all the agent's JWTs, used to revoke them all
+func (gid GoogleID) SessionIDs(ctx context.Context) ([]string, error) {
+	var ids []string
+
+	rows, err := db.QueryContext(ctx, "SELECT tokenID FROM jwtsession WHERE gid = ?", gid)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error(err)
+		return ids, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tokenID string
+		if err := rows.Scan(&tokenID); err != nil {
+			log.Error(err)
+			continue
+		}
+		ids = append(ids, tokenID)
+	}
+	return ids, nil
+}
+
+// SessionClean is called from the background process to remove expired sessions
+func SessionClean() {
+	if _, err := db.Exec("DELETE FROM jwtsession WHERE expires < UTC_TIMESTAMP()"); err != nil {
+		log.Error(err)
+	}
+}
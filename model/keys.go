@@ -19,15 +19,15 @@ type KeyOnHand struct {
 }
 
 // insertKey adds a user keycount to the database
-func (o *Operation) insertKey(k KeyOnHand, tx *sql.Tx) error {
-	details, err := o.ID.portalDetails(k.ID, tx)
+func (o *Operation) insertKey(ctx context.Context, k KeyOnHand, tx *sql.Tx) error {
+	details, err := o.ID.portalDetails(ctx, k.ID, tx)
 	if err != nil {
 		log.Error(err.Error())
 		return err
 	}
 	if details.Name == "" {
 		log.Infow("attempt to assign key count to portal not in op", "GID", k.Gid, "resource", o.ID, "portal", k.ID)
-		if _, err = tx.Exec("DELETE FROM opkeys WHERE opID = ? AND portalID = ?", o.ID, k.ID); err != nil {
+		if _, err = tx.ExecContext(ctx, "DELETE FROM opkeys WHERE opID = ? AND portalID = ?", o.ID, k.ID); err != nil {
 			log.Info(err)
 			err := fmt.Errorf(ErrKeyUnableToRemove)
 			return err
@@ -37,13 +37,13 @@ func (o *Operation) insertKey(k KeyOnHand, tx *sql.Tx) error {
 
 	k.Capsule = util.Sanitize(k.Capsule) // can be NULL, but NULL causes the unique key to not work as intended
 	if k.Onhand == 0 {
-		if _, err = tx.Exec("DELETE FROM opkeys WHERE opID = ? AND portalID = ? AND gid = ? AND capsule = ?", o.ID, k.ID, k.Gid, k.Capsule); err != nil {
+		if _, err = tx.ExecContext(ctx, "DELETE FROM opkeys WHERE opID = ? AND portalID = ? AND gid = ? AND capsule = ?", o.ID, k.ID, k.Gid, k.Capsule); err != nil {
 			log.Info(err)
 			err := fmt.Errorf(ErrKeyUnableToRemove)
 			return err
 		}
 	} else {
-		_, err = tx.Exec("REPLACE INTO opkeys (opID, portalID, gid, onhand, capsule) VALUES (?, ?, ?, ?, ?)", o.ID, k.ID, k.Gid, k.Onhand, k.Capsule) // REPLACE OK SCB
+		_, err = tx.ExecContext(ctx, "REPLACE INTO opkeys (opID, portalID, gid, onhand, capsule) VALUES (?, ?, ?, ?, ?)", o.ID, k.ID, k.Gid, k.Onhand, k.Capsule) // REPLACE OK SCB
 		if err != nil && strings.Contains(err.Error(), "Error 1452") {
 			log.Info(err)
 			return fmt.Errorf(ErrKeyUnableToRecord)
@@ -58,9 +58,9 @@ func (o *Operation) insertKey(k KeyOnHand, tx *sql.Tx) error {
 
 // PopulateKeys fills in the Keys on hand list for the Operation. No authorization takes place.
 // TODO: filter based on zones
-func (o *Operation) populateKeys() error {
+func (o *Operation) populateKeys(ctx context.Context) error {
 	var k KeyOnHand
-	rows, err := db.Query("SELECT portalID, gid, onhand, capsule FROM opkeys WHERE opID = ?", o.ID)
+	rows, err := db.QueryContext(ctx, "SELECT portalID, gid, onhand, capsule FROM opkeys WHERE opID = ?", o.ID)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -84,37 +84,9 @@ func (o *Operation) populateKeys() error {
 	return nil
 }
 
-// PopulateKeys fills in the Keys on hand list for the Operation. No authorization takes place.
-func (o *Operation) populateMyKeys(gid GoogleID) error {
-	var k KeyOnHand
-	k.Gid = gid
-
-	rows, err := db.Query("SELECT portalID, onhand, capsule FROM opkeys WHERE opID = ? AND gid = ?", o.ID, gid)
-	if err != nil {
-		log.Error(err)
-		return err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var cap sql.NullString
-		err := rows.Scan(&k.ID, &k.Onhand, &cap)
-		if err != nil {
-			log.Error(err)
-			continue
-		}
-		if cap.Valid {
-			k.Capsule = cap.String
-		} else {
-			k.Capsule = ""
-		}
-		o.Keys = append(o.Keys, k)
-	}
-	return nil
-}
-
 // KeyOnHand updates a user's key-count for linking
-func (o *Operation) KeyOnHand(gid GoogleID, portalID PortalID, count int32, capsule string) error {
+func (o *Operation) KeyOnHand(ctx context.Context, gid GoogleID, portalID PortalID, count int32, capsule string) error {
+	defer o.ID.uncache()
 	k := KeyOnHand{
 		ID:      portalID,
 		Gid:     gid,
@@ -123,7 +95,7 @@ func (o *Operation) KeyOnHand(gid GoogleID, portalID PortalID, count int32, caps
 	}
 
 	// get ctx from request?
-	tx, err := db.BeginTx(context.Background(), nil)
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -135,7 +107,7 @@ func (o *Operation) KeyOnHand(gid GoogleID, portalID PortalID, count int32, caps
 		}
 	}()
 
-	if err := o.insertKey(k, tx); err != nil {
+	if err := o.insertKey(ctx, k, tx); err != nil {
 		log.Error(err)
 		return err
 	}
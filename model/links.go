@@ -1,6 +1,7 @@
 package model
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
@@ -29,7 +30,7 @@ type Link struct {
 // TODO use the logic from insertZone to unify insertLink and updateLink
 
 // insertLink adds a link to the database
-func (opID OperationID) insertLink(l Link, tx *sql.Tx) error {
+func (opID OperationID) insertLink(ctx context.Context, l Link, tx *sql.Tx) error {
 	if l.To == l.From {
 		log.Infow("source and destination the same, ignoring link", "resource", opID)
 		return nil
@@ -60,14 +61,14 @@ func (opID OperationID) insertLink(l Link, tx *sql.Tx) error {
 
 	comment := makeNullString(util.Sanitize(l.Comment))
 
-	_, err := tx.Exec("INSERT INTO task (ID, opID, comment, taskorder, state, zone, delta) VALUES (?, ?, ?, ?, ?, ?, ?)",
+	_, err := tx.ExecContext(ctx, "INSERT INTO task (ID, opID, comment, taskorder, state, zone, delta) VALUES (?, ?, ?, ?, ?, ?, ?)",
 		l.ID, opID, comment, l.Order, l.State, l.Zone, l.DeltaMinutes)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
 
-	_, err = tx.Exec("INSERT INTO link (ID, opID, fromPortalID, toPortalID, color, mu) VALUES (?, ?, ?, ?, ?, ?)",
+	_, err = tx.ExecContext(ctx, "INSERT INTO link (ID, opID, fromPortalID, toPortalID, color, mu) VALUES (?, ?, ?, ?, ?, ?)",
 		l.ID, opID, l.From, l.To, l.Color, l.MuCaptured)
 	if err != nil {
 		log.Error(err)
@@ -75,14 +76,14 @@ func (opID OperationID) insertLink(l Link, tx *sql.Tx) error {
 	}
 
 	// clears if none set
-	if err := l.SetAssignments(l.Assignments, tx); err != nil {
+	if err := l.SetAssignments(ctx, l.Assignments, tx); err != nil {
 		log.Error(err)
 		return err
 	}
 
 	// do not clear if old client (yet)
 	if len(l.DependsOn) > 0 {
-		err = l.SetDepends(l.DependsOn, tx)
+		err = l.SetDepends(ctx, l.DependsOn, tx)
 		if err != nil {
 			log.Error(err)
 			return err
@@ -92,14 +93,14 @@ func (opID OperationID) insertLink(l Link, tx *sql.Tx) error {
 	return nil
 }
 
-func (opID OperationID) deleteLink(lid LinkID, tx *sql.Tx) error {
-	_, err := tx.Exec("DELETE FROM task WHERE OpID = ? and ID = ?", opID, lid)
+func (opID OperationID) deleteLink(ctx context.Context, lid LinkID, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, "DELETE FROM task WHERE OpID = ? and ID = ?", opID, lid)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
 
-	_, err = tx.Exec("DELETE FROM link WHERE OpID = ? and ID = ?", opID, lid)
+	_, err = tx.ExecContext(ctx, "DELETE FROM link WHERE OpID = ? and ID = ?", opID, lid)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -107,7 +108,7 @@ func (opID OperationID) deleteLink(lid LinkID, tx *sql.Tx) error {
 	return nil
 }
 
-func (opID OperationID) updateLink(l Link, tx *sql.Tx) error {
+func (opID OperationID) updateLink(ctx context.Context, l Link, tx *sql.Tx) error {
 	if l.To == l.From {
 		log.Infow("source and destination the same, ignoring link", "resource", opID)
 		return nil
@@ -140,7 +141,7 @@ func (opID OperationID) updateLink(l Link, tx *sql.Tx) error {
 
 	comment := makeNullString(util.Sanitize(l.Comment))
 
-	_, err := tx.Exec("INSERT INTO task (ID, opID, comment, taskorder, state, zone, delta) VALUES (?, ?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE comment = ?, taskorder = ?, state = ?, zone = ?, delta = ?",
+	_, err := tx.ExecContext(ctx, "INSERT INTO task (ID, opID, comment, taskorder, state, zone, delta) VALUES (?, ?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE comment = ?, taskorder = ?, state = ?, zone = ?, delta = ?",
 		l.ID, opID, comment, l.Order, l.State, l.Zone, l.DeltaMinutes,
 		comment, l.Order, l.State, l.Zone, l.DeltaMinutes)
 	if err != nil {
@@ -148,21 +149,21 @@ func (opID OperationID) updateLink(l Link, tx *sql.Tx) error {
 		return err
 	}
 
-	_, err = tx.Exec("REPLACE INTO link (ID, opID, fromPortalID, toPortalID, color, mu) VALUES (?, ?, ?, ?, ?, ?)", l.ID, opID, l.From, l.To, l.Color, l.MuCaptured) // REPLACE OK SCB
+	_, err = tx.ExecContext(ctx, "REPLACE INTO link (ID, opID, fromPortalID, toPortalID, color, mu) VALUES (?, ?, ?, ?, ?, ?)", l.ID, opID, l.From, l.To, l.Color, l.MuCaptured) // REPLACE OK SCB
 	if err != nil {
 		log.Error(err)
 		return err
 	}
 
 	// empty assignments clears them
-	if err := l.SetAssignments(l.Assignments, tx); err != nil {
+	if err := l.SetAssignments(ctx, l.Assignments, tx); err != nil {
 		log.Error(err)
 		return err
 	}
 
 	// do not clear if they used an old client
 	if len(l.DependsOn) > 0 {
-		if err := l.SetDepends(l.DependsOn, tx); err != nil {
+		if err := l.SetDepends(ctx, l.DependsOn, tx); err != nil {
 			log.Error(err)
 			return err
 		}
@@ -172,10 +173,10 @@ func (opID OperationID) updateLink(l Link, tx *sql.Tx) error {
 }
 
 // PopulateLinks fills in the Links list for the Operation.
-func (o *Operation) populateLinks(zones []Zone, inGid GoogleID, assignments map[TaskID][]GoogleID, depends map[TaskID][]TaskID) error {
+func (o *Operation) populateLinks(ctx context.Context, assignments map[TaskID][]GoogleID, depends map[TaskID][]TaskID) error {
 	var description sql.NullString
 
-	rows, err := db.Query("SELECT link.ID, link.fromPortalID, link.toPortalID, task.comment, task.taskorder, task.state, link.color, task.zone, task.delta FROM link JOIN task ON link.ID = task.ID WHERE task.opID = ? AND link.opID = task.opID", o.ID)
+	rows, err := db.QueryContext(ctx, "SELECT link.ID, link.fromPortalID, link.toPortalID, task.comment, task.taskorder, task.state, link.color, task.zone, task.delta FROM link JOIN task ON link.ID = task.ID WHERE task.opID = ? AND link.opID = task.opID", o.ID)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -213,10 +214,6 @@ func (o *Operation) populateLinks(zones []Zone, inGid GoogleID, assignments map[
 			tmpLink.Completed = true
 		}
 
-		// this isn't in a zone with which we are concerned AND not assigned to me, skip
-		if !tmpLink.Zone.inZones(zones) && !tmpLink.IsAssignedTo(inGid) {
-			continue
-		}
 		o.Links = append(o.Links, tmpLink)
 	}
 	return nil
@@ -228,8 +225,9 @@ func (l LinkID) String() string {
 }
 
 // LinkOrder changes the order of the throws for an operation
-func (o *Operation) LinkOrder(order string) error {
-	stmt, err := db.Prepare("UPDATE link SET throworder = ? WHERE opID = ? AND ID = ?")
+func (o *Operation) LinkOrder(ctx context.Context, order string) error {
+	defer o.ID.uncache()
+	stmt, err := db.PrepareContext(ctx, "UPDATE link SET throworder = ? WHERE opID = ? AND ID = ?")
 	if err != nil {
 		log.Error(err)
 		return err
@@ -241,7 +239,7 @@ func (o *Operation) LinkOrder(order string) error {
 		if links[i] == "000" { // the header, could be anyplace in the order if the user was being silly
 			continue
 		}
-		if _, err := stmt.Exec(pos, o.ID, links[i]); err != nil {
+		if _, err := stmt.ExecContext(ctx, pos, o.ID, links[i]); err != nil {
 			log.Error(err)
 			continue
 		}
@@ -251,8 +249,9 @@ func (o *Operation) LinkOrder(order string) error {
 }
 
 // SetColor changes the color of a link in an operation
-func (l *Link) SetColor(color string) error {
-	_, err := db.Exec("UPDATE link SET color = ? WHERE ID = ? and opID = ?", color, l.ID, l.opID)
+func (l *Link) SetColor(ctx context.Context, color string) error {
+	defer l.opID.uncache()
+	_, err := db.ExecContext(ctx, "UPDATE link SET color = ? WHERE ID = ? and opID = ?", color, l.ID, l.opID)
 	if err != nil {
 		log.Error(err)
 	}
@@ -260,16 +259,17 @@ func (l *Link) SetColor(color string) error {
 }
 
 // Swap changes the direction of a link in an operation
-func (l *Link) Swap() error {
+func (l *Link) Swap(ctx context.Context) error {
+	defer l.opID.uncache()
 	var tmpLink Link
 
-	err := db.QueryRow("SELECT fromPortalID, toPortalID FROM link WHERE opID = ? AND ID = ?", l.opID, l.ID).Scan(&tmpLink.From, &tmpLink.To)
+	err := db.QueryRowContext(ctx, "SELECT fromPortalID, toPortalID FROM link WHERE opID = ? AND ID = ?", l.opID, l.ID).Scan(&tmpLink.From, &tmpLink.To)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
 
-	_, err = db.Exec("UPDATE link SET fromPortalID = ?, toPortalID = ? WHERE ID = ? and opID = ?", tmpLink.To, tmpLink.From, l.ID, l.opID)
+	_, err = db.ExecContext(ctx, "UPDATE link SET fromPortalID = ?, toPortalID = ? WHERE ID = ? and opID = ?", tmpLink.To, tmpLink.From, l.ID, l.opID)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
@@ -42,7 +43,7 @@ type Attribute struct {
 // TODO use the logic from insertZone to unify insertMarker and updateMarker
 
 // insertMarkers adds a marker to the database
-func (opID OperationID) insertMarker(m Marker, tx *sql.Tx) error {
+func (opID OperationID) insertMarker(ctx context.Context, m Marker, tx *sql.Tx) error {
 	if m.State == "" {
 		m.State = "pending"
 	}
@@ -53,14 +54,14 @@ func (opID OperationID) insertMarker(m Marker, tx *sql.Tx) error {
 
 	comment := makeNullString(util.Sanitize(m.Comment))
 
-	_, err := tx.Exec("INSERT INTO task (ID, opID, comment, taskorder, state, zone, delta) VALUES (?, ?, ?, ?, ?, ?, ?)",
+	_, err := tx.ExecContext(ctx, "INSERT INTO task (ID, opID, comment, taskorder, state, zone, delta) VALUES (?, ?, ?, ?, ?, ?, ?)",
 		m.ID, opID, comment, m.Order, m.State, m.Zone, m.DeltaMinutes)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
 
-	_, err = tx.Exec("INSERT INTO marker (ID, opID, PortalID, type) VALUES (?, ?, ?, ?)", m.ID, opID, m.PortalID, m.Type)
+	_, err = tx.ExecContext(ctx, "INSERT INTO marker (ID, opID, PortalID, type) VALUES (?, ?, ?, ?)", m.ID, opID, m.PortalID, m.Type)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -72,21 +73,21 @@ func (opID OperationID) insertMarker(m Marker, tx *sql.Tx) error {
 	}
 
 	// empty m.Assignments clears any
-	if err := m.SetAssignments(m.Assignments, tx); err != nil {
+	if err := m.SetAssignments(ctx, m.Assignments, tx); err != nil {
 		log.Error(err)
 		return err
 	}
 
 	// len() == 0 could be empty, or could be old client; do not clear them (yet)
 	if len(m.DependsOn) > 0 {
-		if err := m.SetDepends(m.DependsOn, tx); err != nil {
+		if err := m.SetDepends(ctx, m.DependsOn, tx); err != nil {
 			log.Error(err)
 			return err
 		}
 	}
 
 	if len(m.Attributes) > 0 {
-		if err := m.setAttributes(m.Attributes, tx); err != nil {
+		if err := m.setAttributes(ctx, m.Attributes, tx); err != nil {
 			log.Error(err)
 			return err
 		}
@@ -95,7 +96,7 @@ func (opID OperationID) insertMarker(m Marker, tx *sql.Tx) error {
 	return nil
 }
 
-func (opID OperationID) updateMarker(m Marker, tx *sql.Tx) error {
+func (opID OperationID) updateMarker(ctx context.Context, m Marker, tx *sql.Tx) error {
 	if m.State == "" {
 		m.State = "pending"
 	}
@@ -115,7 +116,7 @@ func (opID OperationID) updateMarker(m Marker, tx *sql.Tx) error {
 
 	comment := makeNullString(util.Sanitize(m.Comment))
 
-	_, err := tx.Exec("INSERT INTO task (ID, opID, comment, taskorder, state, zone, delta) VALUES (?, ?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE comment = ?, taskorder = ?, state = ?, zone = ?, delta = ?",
+	_, err := tx.ExecContext(ctx, "INSERT INTO task (ID, opID, comment, taskorder, state, zone, delta) VALUES (?, ?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE comment = ?, taskorder = ?, state = ?, zone = ?, delta = ?",
 		m.ID, opID, comment, m.Order, m.State, m.Zone, m.DeltaMinutes,
 		comment, m.Order, m.State, m.Zone, m.DeltaMinutes)
 	if err != nil {
@@ -123,27 +124,27 @@ func (opID OperationID) updateMarker(m Marker, tx *sql.Tx) error {
 		return err
 	}
 
-	if _, err := tx.Exec("REPLACE INTO marker (ID, opID, PortalID, type) VALUES (?, ?, ?, ?)", m.ID, opID, m.PortalID, m.Type); err != nil { // REPLACE OK SCB
+	if _, err := tx.ExecContext(ctx, "REPLACE INTO marker (ID, opID, PortalID, type) VALUES (?, ?, ?, ?)", m.ID, opID, m.PortalID, m.Type); err != nil { // REPLACE OK SCB
 		log.Error(err)
 		return err
 	}
 
 	// empty m.Assignments clears any
-	if err := m.SetAssignments(m.Assignments, tx); err != nil {
+	if err := m.SetAssignments(ctx, m.Assignments, tx); err != nil {
 		log.Error(err)
 		return err
 	}
 
 	// do not clear them if someone is using an old client (yet)
 	if len(m.DependsOn) > 0 {
-		if err := m.SetDepends(m.DependsOn, tx); err != nil {
+		if err := m.SetDepends(ctx, m.DependsOn, tx); err != nil {
 			log.Error(err)
 			return err
 		}
 	}
 
 	if len(m.Attributes) > 0 {
-		if err := m.setAttributes(m.Attributes, tx); err != nil {
+		if err := m.setAttributes(ctx, m.Attributes, tx); err != nil {
 			log.Error(err)
 			return err
 		}
@@ -152,15 +153,15 @@ func (opID OperationID) updateMarker(m Marker, tx *sql.Tx) error {
 	return nil
 }
 
-func (opID OperationID) deleteMarker(mid MarkerID, tx *sql.Tx) error {
+func (opID OperationID) deleteMarker(ctx context.Context, mid MarkerID, tx *sql.Tx) error {
 	// deleting the task would cascade and take this out... but this is safe
-	_, err := tx.Exec("DELETE FROM task WHERE opID = ? and ID = ?", opID, mid)
+	_, err := tx.ExecContext(ctx, "DELETE FROM task WHERE opID = ? and ID = ?", opID, mid)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
 
-	_, err = tx.Exec("DELETE FROM marker WHERE opID = ? and ID = ?", opID, mid)
+	_, err = tx.ExecContext(ctx, "DELETE FROM marker WHERE opID = ? and ID = ?", opID, mid)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -169,10 +170,10 @@ func (opID OperationID) deleteMarker(mid MarkerID, tx *sql.Tx) error {
 }
 
 // PopulateMarkers fills in the Markers list for the Operation.
-func (o *Operation) populateMarkers(zones []Zone, gid GoogleID, assignments map[TaskID][]GoogleID, depends map[TaskID][]TaskID) error {
+func (o *Operation) populateMarkers(ctx context.Context, assignments map[TaskID][]GoogleID, depends map[TaskID][]TaskID, attributes map[MarkerID][]Attribute) error {
 	var comment sql.NullString
 
-	rows, err := db.Query("SELECT marker.ID, marker.PortalID, marker.type, task.comment, task.state, task.taskorder, task.zone, task.delta FROM marker JOIN task ON marker.ID = task.ID WHERE marker.opID = ? AND marker.opID = task.opID", o.ID)
+	rows, err := db.QueryContext(ctx, "SELECT marker.ID, marker.PortalID, marker.type, task.comment, task.state, task.taskorder, task.zone, task.delta FROM marker JOIN task ON marker.ID = task.ID WHERE marker.opID = ? AND marker.opID = task.opID", o.ID)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -210,13 +211,7 @@ func (o *Operation) populateMarkers(zones []Zone, gid GoogleID, assignments map[
 			tmpMarker.Comment = ""
 		}
 
-		// if the marker is not in the zones with which we are concerned AND not assigned to me, skip
-		if !tmpMarker.Zone.inZones(zones) && !tmpMarker.IsAssignedTo(gid) {
-			continue
-		}
-
-		// load attributes
-		_ = tmpMarker.loadAttributes()
+		tmpMarker.Attributes = attributes[tmpMarker.ID]
 
 		o.Markers = append(o.Markers, tmpMarker)
 	}
@@ -252,8 +247,9 @@ func (o *Operation) GetMarker(markerID MarkerID) (*Marker, error) {
 }
 
 // MarkerOrder changes the order of the tasks for an operation
-func (o *Operation) MarkerOrder(order string) error {
-	stmt, err := db.Prepare("UPDATE marker SET taskorder = ? WHERE opID = ? AND ID = ?")
+func (o *Operation) MarkerOrder(ctx context.Context, order string) error {
+	defer o.ID.uncache()
+	stmt, err := db.PrepareContext(ctx, "UPDATE marker SET taskorder = ? WHERE opID = ? AND ID = ?")
 	if err != nil {
 		log.Error(err)
 		return err
@@ -265,7 +261,7 @@ func (o *Operation) MarkerOrder(order string) error {
 		if markers[i] == "000" { // the header, could be any place in the order if the user was being silly
 			continue
 		}
-		if _, err := stmt.Exec(pos, o.ID, markers[i]); err != nil {
+		if _, err := stmt.ExecContext(ctx, pos, o.ID, markers[i]); err != nil {
 			log.Error(err)
 			continue
 		}
@@ -307,14 +303,14 @@ func NewMarkerType(old MarkerType) string {
 	return old.String()
 }
 
-func (m *Marker) setAttributes(a []Attribute, tx *sql.Tx) error {
-	if _, err := tx.Exec("DELETE FROM markerattributes WHERE opID = ? AND markerID = ?", m.opID, m.ID); err != nil {
+func (m *Marker) setAttributes(ctx context.Context, a []Attribute, tx *sql.Tx) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM markerattributes WHERE opID = ? AND markerID = ?", m.opID, m.ID); err != nil {
 		log.Error(err)
 		return err
 	}
 
 	for _, v := range a {
-		if _, err := tx.Exec("INSERT INTO markerattributes (ID, opID, markerID, name, value) VALUES (?, ?, ?, ?, ?)", v.ID, m.opID, m.ID, v.Name, v.Value); err != nil {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO markerattributes (ID, opID, markerID, name, value) VALUES (?, ?, ?, ?, ?)", v.ID, m.opID, m.ID, v.Name, v.Value); err != nil {
 			log.Error(err)
 			continue
 		}
@@ -322,23 +318,27 @@ func (m *Marker) setAttributes(a []Attribute, tx *sql.Tx) error {
 	return nil
 }
 
-func (m *Marker) loadAttributes() error {
-	rows, err := db.Query("SELECT ID, name, value FROM markerattributes WHERE opID = ? AND markerID = ?", m.opID, m.ID)
+// attributePrecache gets the attributes for every marker in the op in one query, used by op.Populate
+func (opID OperationID) attributePrecache(ctx context.Context) (map[MarkerID][]Attribute, error) {
+	buf := make(map[MarkerID][]Attribute)
+
+	rows, err := db.QueryContext(ctx, "SELECT markerID, ID, name, value FROM markerattributes WHERE opID = ?", opID)
 	if err != nil {
 		log.Error(err)
-		return err
+		return buf, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
+		var m MarkerID
 		tmp := Attribute{}
 
-		if err := rows.Scan(&tmp.ID, &tmp.Name, &tmp.Value); err != nil {
+		if err := rows.Scan(&m, &tmp.ID, &tmp.Name, &tmp.Value); err != nil {
 			log.Error(err)
 			continue
 		}
 
-		m.Attributes = append(m.Attributes, tmp)
+		buf[m] = append(buf[m], tmp)
 	}
-	return nil
+	return buf, nil
 }
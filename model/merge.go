@@ -0,0 +1,120 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+)
+
+// mergeAgentSQL moves everything belonging to the first agent (from) onto the second (into)
+// where both agents have a row that must be unique, the row already on into wins
+var mergeAgentSQL = []string{
+	"INSERT IGNORE INTO agentteams (teamID, gid, shareLoc, shareWD, loadWD, comment) SELECT teamID, ?, shareLoc, shareWD, loadWD, comment FROM agentteams WHERE gid = ?",
+	"DELETE a FROM assignments a JOIN assignments b ON a.opID = b.opID AND a.taskID = b.taskID AND b.gid = ? WHERE a.gid = ?",
+	"UPDATE assignments SET gid = ? WHERE gid = ?",
+	"UPDATE IGNORE opkeys SET gid = ? WHERE gid = ?",
+	"UPDATE IGNORE defensivekeys SET gid = ? WHERE gid = ?",
+	"UPDATE IGNORE telegram SET gid = ? WHERE gid = ?",
+	"UPDATE IGNORE rocks SET gid = ? WHERE gid = ?",
+	"UPDATE IGNORE v SET gid = ? WHERE gid = ?",
+	"UPDATE IGNORE locations SET gid = ? WHERE gid = ?",
+	"UPDATE team SET owner = ? WHERE owner = ?",
+	"UPDATE operation SET gid = ? WHERE gid = ?",
+	"UPDATE firebase SET gid = ? WHERE gid = ?",
+	"UPDATE agentidentity SET gid = ? WHERE gid = ?",
+	"UPDATE apitoken SET gid = ? WHERE gid = ?",
+	"UPDATE deletedops SET gid = ? WHERE gid = ?",
+	"UPDATE messagelog SET gid = ? WHERE gid = ?",
+	"UPDATE agent i JOIN agent f ON f.gid = ? SET i.intelname = COALESCE(i.intelname, f.intelname), i.intelfaction = IF(i.intelfaction = -1, f.intelfaction, i.intelfaction), i.picurl = COALESCE(i.picurl, f.picurl) WHERE i.gid = ?",
+}
+
+// MergeAgents moves the teams, operations, keys, assignments, Telegram ID and linked logins of one agent (from) to another (into) and deletes the first
+// the caller is responsible for revoking from's JWTs
+func MergeAgents(ctx context.Context, from, into GoogleID) error {
+	// their assignments and keys are in ops
+	defer uncacheAllOps()
+
+	if from == into {
+		return fmt.Errorf("cannot merge an agent with itself")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	defer func() {
+		err := tx.Rollback()
+		if err != nil && err != sql.ErrTxDone {
+			log.Error(err)
+		}
+	}()
+
+	// the audit log keeps the history as it happened, record the moves rather than rewriting past entries
+	if _, err := tx.ExecContext(ctx, "INSERT INTO teamaudit (teamID, actor, source, gid, action) SELECT f.teamID, ?, ?, ?, ? FROM agentteams f LEFT JOIN agentteams i ON i.teamID = f.teamID AND i.gid = ? WHERE f.gid = ? AND i.gid IS NULL", into, AuditSourceMerge, into, AuditActionAdd, into, from); err != nil {
+		log.Error(err)
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO teamaudit (teamID, actor, source, gid, action) SELECT teamID, ?, ?, gid, ? FROM agentteams WHERE gid = ?", into, AuditSourceMerge, AuditActionRemove, from); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	for _, q := range mergeAgentSQL {
+		if _, err := tx.ExecContext(ctx, q, into, from); err != nil {
+			log.Errorw(err.Error(), "from", from, "into", into, "query", q)
+			return err
+		}
+	}
+
+	// communityname is unique, clear it on from before giving it to into
+	var community sql.NullString
+	if err := tx.QueryRowContext(ctx, "SELECT communityname FROM agent WHERE gid = ?", from).Scan(&community); err != nil {
+		log.Error(err)
+		return err
+	}
+	if community.Valid {
+		if _, err := tx.ExecContext(ctx, "UPDATE agent SET communityname = NULL WHERE gid = ?", from); err != nil {
+			log.Error(err)
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE agent SET communityname = ? WHERE gid = ? AND communityname IS NULL", community, into); err != nil {
+			log.Error(err)
+			return err
+		}
+	}
+
+	// a Google login for from now logs in as into, rather than recreating from; Apple and OIDC agents have their logins moved above
+	if !strings.HasPrefix(string(from), "A-") && !strings.HasPrefix(string(from), "O-") {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO agentidentity (provider, subject, gid) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE gid = VALUES(gid)", IdentityGoogle, from, into); err != nil {
+			log.Error(err)
+			return err
+		}
+	}
+
+	// the moves show up in into's teams and in into itself
+	if _, err := tx.ExecContext(ctx, "UPDATE team JOIN agentteams ON team.teamID = agentteams.teamID SET team.modified = CURRENT_TIMESTAMP(6) WHERE agentteams.gid = ?", into); err != nil {
+		log.Error(err)
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE agent SET modified = CURRENT_TIMESTAMP(6) WHERE gid = ?", into); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	// anything left over (duplicates, sessions) goes with the agent
+	if _, err := tx.ExecContext(ctx, "DELETE FROM agent WHERE gid = ?", from); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error(err)
+		return err
+	}
+	log.Infow("merged agents", "from", from, "into", into)
+	return nil
+}
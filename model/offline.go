@@ -0,0 +1,184 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// OfflineAction is something an agent did while out of signal, queued by the client and sent when it reconnects
+type OfflineAction struct {
+	ID      string    `json:"id"`   // the client's ID for the action, echoed in the result
+	Type    string    `json:"type"` // complete, acknowledge, keys, location
+	At      time.Time `json:"at"`   // when the agent did it, RFC 3339
+	Task    TaskID    `json:"task,omitempty"`
+	Portal  PortalID  `json:"portal,omitempty"`
+	Onhand  int32     `json:"onhand,omitempty"`
+	Capsule string    `json:"capsule,omitempty"`
+	Lat     string    `json:"lat,omitempty"`
+	Lon     string    `json:"lng,omitempty"`
+}
+
+// OfflineResult is the outcome of one OfflineAction
+// Status is one of applied, noop (already so), conflict (the op changed in a way that overrides it), gone (no such task),
+// superseded (a later action in the batch replaces it), stale (older than what the server has), invalid or error
+type OfflineResult struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// OfflineResults is the outcome of a batch of offline actions
+type OfflineResults struct {
+	Results []OfflineResult
+	OpDirty bool // something in the op changed, it needs a Touch
+	Located bool // the agent's location changed
+}
+
+// how old a queued action may be, a task done a week ago is not worth reporting
+const offlineMaxAge = 7 * 24 * time.Hour
+
+// ApplyOfflineActions applies actions queued while gid was offline, in the order they were done
+// unlike a task batch each action stands alone; the rules are there so a late replay does not undo what happened since:
+// a task reassigned to someone else is not completed, a completed task is not set back to acknowledged,
+// and only the newest keys count per portal and the newest location is only kept if newer than the server's
+// the op must be populated for gid
+func (o *Operation) ApplyOfflineActions(ctx context.Context, gid GoogleID, actions []OfflineAction) OfflineResults {
+	var out OfflineResults
+	out.Results = make([]OfflineResult, len(actions))
+
+	order := make([]int, len(actions))
+	for i := range actions {
+		order[i] = i
+		out.Results[i] = OfflineResult{ID: actions[i].ID, Type: actions[i].Type}
+	}
+	sort.SliceStable(order, func(a, b int) bool { return actions[order[a]].At.Before(actions[order[b]].At) })
+
+	// with the actions in time order, the last keys for each portal and the last location are the ones that count
+	lastKeys := make(map[string]int)
+	lastLocation := -1
+	for _, i := range order {
+		switch actions[i].Type {
+		case "keys":
+			lastKeys[string(actions[i].Portal)+"/"+actions[i].Capsule] = i
+		case "location":
+			lastLocation = i
+		}
+	}
+
+	for _, i := range order {
+		a := &actions[i]
+		r := &out.Results[i]
+
+		if a.At.IsZero() {
+			r.Status, r.Reason = "invalid", "no time given"
+			continue
+		}
+		if time.Since(a.At) > offlineMaxAge {
+			r.Status, r.Reason = "stale", "too old"
+			continue
+		}
+
+		switch a.Type {
+		case "complete", "acknowledge":
+			o.offlineTask(ctx, gid, a, r)
+			if r.Status == "applied" {
+				out.OpDirty = true
+			}
+		case "keys":
+			if lastKeys[string(a.Portal)+"/"+a.Capsule] != i {
+				r.Status = "superseded"
+				continue
+			}
+			onhand := a.Onhand
+			if onhand < 0 {
+				onhand = 0
+			}
+			if onhand > 3000 {
+				onhand = 3000
+			}
+			if err := o.KeyOnHand(ctx, gid, a.Portal, onhand, a.Capsule); err != nil {
+				r.Status, r.Reason = "error", err.Error()
+				continue
+			}
+			r.Status = "applied"
+			out.OpDirty = true
+		case "location":
+			if i != lastLocation {
+				r.Status = "superseded"
+				continue
+			}
+			// SetLocationAt ignores an empty location, which would look like a stale one
+			if _, err := strconv.ParseFloat(a.Lat, 64); err != nil {
+				r.Status, r.Reason = "invalid", "no usable lat given"
+				continue
+			}
+			if _, err := strconv.ParseFloat(a.Lon, 64); err != nil {
+				r.Status, r.Reason = "invalid", "no usable lng given"
+				continue
+			}
+			ok, err := gid.SetLocationAt(ctx, a.Lat, a.Lon, a.At)
+			if err != nil {
+				r.Status, r.Reason = "error", err.Error()
+				continue
+			}
+			if !ok {
+				r.Status, r.Reason = "stale", "server has a newer location"
+				continue
+			}
+			r.Status = "applied"
+			out.Located = true
+		default:
+			r.Status, r.Reason = "invalid", fmt.Sprintf("unknown action type: %s", a.Type)
+		}
+	}
+	return out
+}
+
+// offlineTask completes or acknowledges a task, unless the op has moved on since
+func (o *Operation) offlineTask(ctx context.Context, gid GoogleID, a *OfflineAction, r *OfflineResult) {
+	task, err := o.GetTask(a.Task)
+	if err != nil {
+		r.Status, r.Reason = "gone", err.Error()
+		return
+	}
+
+	assigned := task.assignedTo(gid)
+	if len(task.Assignments) > 0 && !assigned {
+		r.Status, r.Reason = "conflict", "task is assigned to another agent"
+		return
+	}
+
+	var state string
+	switch a.Type {
+	case "complete":
+		if task.State == "completed" {
+			r.Status = "noop"
+			return
+		}
+		state = "completed"
+		err = task.Complete(ctx)
+	case "acknowledge":
+		if !assigned {
+			r.Status, r.Reason = "conflict", "task is not assigned to you"
+			return
+		}
+		if task.State == "acknowledged" || task.State == "completed" {
+			r.Status = "noop"
+			return
+		}
+		state = "acknowledged"
+		err = task.Acknowledge(ctx)
+	}
+	if err != nil {
+		r.Status, r.Reason = "error", err.Error()
+		return
+	}
+
+	// GetTask points into the op, so later actions in the batch see this one
+	task.State = state
+	r.Status = "applied"
+}
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 
@@ -16,10 +17,10 @@ func (ott OneTimeToken) String() string {
 }
 
 // Gid converts a location share key to a agent's gid
-func (ott OneTimeToken) Gid() (GoogleID, error) {
+func (ott OneTimeToken) Gid(ctx context.Context) (GoogleID, error) {
 	var gid GoogleID
 
-	err := db.QueryRow("SELECT gid FROM agent WHERE OneTimeToken = ?", ott).Scan(&gid)
+	err := db.QueryRowContext(ctx, "SELECT gid FROM agent WHERE OneTimeToken = ?", ott).Scan(&gid)
 	if err != nil && err == sql.ErrNoRows {
 		err := fmt.Errorf(ErrInvalidOTT)
 		log.Warn(err)
@@ -34,13 +35,13 @@ func (ott OneTimeToken) Gid() (GoogleID, error) {
 }
 
 // NewOneTimeToken generates a new OTT for an agent
-func (gid GoogleID) newOneTimeToken() (OneTimeToken, error) {
-	ott, err := GenerateSafeName()
+func (gid GoogleID) newOneTimeToken(ctx context.Context) (OneTimeToken, error) {
+	ott, err := GenerateSafeName(ctx)
 	if err != nil {
 		log.Error(err)
 		return "", err
 	}
-	if _, err = db.Exec("UPDATE agent SET OneTimeToken = ? WHERE gid = ?", ott, gid); err != nil {
+	if _, err = db.ExecContext(ctx, "UPDATE agent SET OneTimeToken = ? WHERE gid = ?", ott, gid); err != nil {
 		log.Error(err)
 		return "", err
 	}
@@ -48,13 +49,13 @@ func (gid GoogleID) newOneTimeToken() (OneTimeToken, error) {
 }
 
 // Increment "uses" the OTT and returns a googleID, replacing the agent's OTT in the databse
-func (ott OneTimeToken) Increment() (GoogleID, error) {
-	gid, err := ott.Gid()
+func (ott OneTimeToken) Increment(ctx context.Context) (GoogleID, error) {
+	gid, err := ott.Gid(ctx)
 	if err != nil {
 		return "", err
 	}
 
-	_, err = gid.newOneTimeToken()
+	_, err = gid.newOneTimeToken(ctx)
 	if err != nil {
 		log.Warn(err)
 	}
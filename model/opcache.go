@@ -0,0 +1,123 @@
+package model
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Populated operations are cached unfiltered and keyed by their LastEditID; each agent's view is filtered from the cached copy.
+// Every change made through this package drops the op from the cache. Changes made by other servers sharing the database
+// are picked up because Populate always reads the op's current LastEditID, and Touch changes it.
+// opCacheMaxAge bounds how long a change made elsewhere without a Touch can go unseen.
+
+// how many ops are kept, the least recently fetched are dropped first
+const opCacheSize = 256
+
+// how long a cached op is trusted
+const opCacheMaxAge = 10 * time.Minute
+
+type opCacheEntry struct {
+	lastEditID string
+	loaded     time.Time
+	used       time.Time
+	ready      chan struct{} // closed once op and err are set
+	op         *Operation
+	err        error
+}
+
+var opCache = struct {
+	sync.Mutex
+	m map[OperationID]*opCacheEntry
+}{m: make(map[OperationID]*opCacheEntry)}
+
+var opCacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{Name: "wasabee_opcache_requests_total", Help: "Operation fetches by cache result."}, []string{"result"})
+
+func init() {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{Name: "wasabee_opcache_ops", Help: "Operations in the populated-op cache."}, func() float64 {
+		opCache.Lock()
+		defer opCache.Unlock()
+		return float64(len(opCache.m))
+	})
+}
+
+// cached returns the unfiltered op as of lastEditID
+// when many agents fetch the op at once, e.g. after a map change push, it is only loaded once and the others wait for it
+func (opID OperationID) cached(ctx context.Context, lastEditID string) (*Operation, error) {
+	for {
+		opCache.Lock()
+		e, ok := opCache.m[opID]
+		if ok && e.lastEditID == lastEditID && time.Since(e.loaded) < opCacheMaxAge {
+			e.used = time.Now()
+			opCache.Unlock()
+
+			select {
+			case <-e.ready:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			if e.err != nil {
+				// the agent loading it gave up or the database failed, try again
+				continue
+			}
+			opCacheRequests.WithLabelValues("hit").Inc()
+			return e.op, nil
+		}
+
+		e = &opCacheEntry{
+			lastEditID: lastEditID,
+			loaded:     time.Now(),
+			used:       time.Now(),
+			ready:      make(chan struct{}),
+		}
+		opCache.m[opID] = e
+		evictOps()
+		opCache.Unlock()
+
+		opCacheRequests.WithLabelValues("miss").Inc()
+		e.op, e.err = opID.load(ctx)
+		if e.err != nil {
+			opCache.Lock()
+			if opCache.m[opID] == e {
+				delete(opCache.m, opID)
+			}
+			opCache.Unlock()
+		}
+		close(e.ready)
+		return e.op, e.err
+	}
+}
+
+// evictOps drops the least recently fetched op when the cache is full, opCache must be locked
+func evictOps() {
+	if len(opCache.m) <= opCacheSize {
+		return
+	}
+
+	var oldest OperationID
+	var t time.Time
+	for id, e := range opCache.m {
+		if t.IsZero() || e.used.Before(t) {
+			oldest = id
+			t = e.used
+		}
+	}
+	delete(opCache.m, oldest)
+}
+
+// uncache drops the cached copy of an op, called by everything that changes an op
+func (opID OperationID) uncache() {
+	opCache.Lock()
+	defer opCache.Unlock()
+	delete(opCache.m, opID)
+}
+
+// uncacheAllOps empties the cache, for changes to agents which reach into every op they are assigned in
+func uncacheAllOps() {
+	opCache.Lock()
+	defer opCache.Unlock()
+	opCache.m = make(map[OperationID]*opCacheEntry)
+}
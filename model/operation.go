@@ -48,13 +48,13 @@ type OpStat struct {
 // use ONLY for initial op creation
 // All assignment data and key count data is assumed to be correct
 func DrawInsert(ctx context.Context, o *Operation, gid GoogleID) error {
-	if o.ID.Valid() {
+	if o.ID.Valid(ctx) {
 		err := fmt.Errorf("attempt to create an opID that is already in use")
 		log.Infow(err.Error(), "GID", gid, "opID", o.ID)
 		return err
 	}
 
-	if o.ID.IsDeletedOp() {
+	if o.ID.IsDeletedOp(ctx) {
 		err := fmt.Errorf("attempt to reuse a deleted opID; duplicate and upload the copy instead")
 		log.Infow(err.Error(), "GID", gid, "opID", o.ID)
 		return err
@@ -83,7 +83,7 @@ func DrawInsert(ctx context.Context, o *Operation, gid GoogleID) error {
 	}()
 
 	// start the insert process
-	_, err = tx.Exec("INSERT INTO operation (ID, name, gid, color, modified, comment, referencetime) VALUES (?, ?, ?, ?, UTC_TIMESTAMP(), ?, ?)", o.ID, o.Name, gid, o.Color, comment, reftime.Format("2006-01-02 15:04:05"))
+	_, err = tx.ExecContext(ctx, "INSERT INTO operation (ID, name, gid, color, modified, comment, referencetime) VALUES (?, ?, ?, ?, UTC_TIMESTAMP(), ?, ?)", o.ID, o.Name, gid, o.Color, comment, reftime.Format("2006-01-02 15:04:05"))
 	if err != nil {
 		log.Error(err)
 		return err
@@ -92,7 +92,7 @@ func DrawInsert(ctx context.Context, o *Operation, gid GoogleID) error {
 	portalMap := make(map[PortalID]bool)
 	for _, p := range o.OpPortals {
 		portalMap[p.ID] = true
-		if err = o.ID.insertPortal(p, tx); err != nil {
+		if err = o.ID.insertPortal(ctx, p, tx); err != nil {
 			// log.Error(err)
 			return err
 		}
@@ -110,7 +110,7 @@ func DrawInsert(ctx context.Context, o *Operation, gid GoogleID) error {
 
 		// assignments here would be invalid since teams are not known
 		m.AssignedTo = ""
-		if err = o.ID.insertMarker(m, tx); err != nil {
+		if err = o.ID.insertMarker(ctx, m, tx); err != nil {
 			// log.Error(err)
 			return err
 		}
@@ -133,14 +133,14 @@ func DrawInsert(ctx context.Context, o *Operation, gid GoogleID) error {
 		}
 		// assignments here would be invalid since teams are not known
 		l.AssignedTo = ""
-		if err = o.ID.insertLink(l, tx); err != nil {
+		if err = o.ID.insertLink(ctx, l, tx); err != nil {
 			// log.Error(err)
 			return err
 		}
 	}
 
 	for _, k := range o.Keys {
-		if err := o.insertKey(k, tx); err != nil {
+		if err := o.insertKey(ctx, k, tx); err != nil {
 			// log.Error(err)
 			return err
 		}
@@ -151,7 +151,7 @@ func DrawInsert(ctx context.Context, o *Operation, gid GoogleID) error {
 		o.Zones = defaultZones()
 	}
 	for _, z := range o.Zones {
-		if err = o.insertZone(z, tx); err != nil {
+		if err = o.insertZone(ctx, z, tx); err != nil {
 			// log.Error(err)
 			return err
 		}
@@ -170,13 +170,14 @@ func DrawInsert(ctx context.Context, o *Operation, gid GoogleID) error {
 // Key count data is left untouched (unless the portal is no longer listed in the portals list).
 // Database is locked per-op, each update runs in an all-or-nothing transaction
 func DrawUpdate(ctx context.Context, o *Operation, gid GoogleID) error {
-	if o.ID.IsDeletedOp() {
+	defer o.ID.uncache()
+	if o.ID.IsDeletedOp(ctx) {
 		err := fmt.Errorf("attempt to update a deleted opID; duplicate and upload the copy instead")
 		log.Infow(err.Error(), "GID", gid, "opID", o.ID)
 		return err
 	}
 
-	if !o.ID.Valid() {
+	if !o.ID.Valid(ctx) {
 		err := fmt.Errorf("update op.ID does not exist")
 		log.Errorw(err.Error(), "resource", o.ID)
 		return err
@@ -186,7 +187,7 @@ func DrawUpdate(ctx context.Context, o *Operation, gid GoogleID) error {
 	o.Teams = nil
 
 	// this repopulates the team data with what is in the DB
-	if !o.WriteAccess(gid) {
+	if !o.WriteAccess(ctx, gid) {
 		err := fmt.Errorf("write access denied to op: %s", o.ID)
 		log.Error(err)
 		return err
@@ -197,7 +198,7 @@ func DrawUpdate(ctx context.Context, o *Operation, gid GoogleID) error {
 		return err
 	}
 	defer func() {
-		if _, err := db.Exec("SELECT RELEASE_LOCK(?)", o.ID); err != nil {
+		if _, err := db.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", o.ID); err != nil {
 			log.Error(err)
 		}
 	}()
@@ -222,36 +223,36 @@ func DrawUpdate(ctx context.Context, o *Operation, gid GoogleID) error {
 
 	comment := makeNullString(util.Sanitize(o.Comment))
 
-	_, err = tx.Exec("UPDATE operation SET name = ?, color = ?, comment = ?, referencetime = ? WHERE ID = ?",
+	_, err = tx.ExecContext(ctx, "UPDATE operation SET name = ?, color = ?, comment = ?, referencetime = ? WHERE ID = ?",
 		o.Name, o.Color, comment, reftime.Format("2006-01-02 15:04:05"), o.ID)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
 
-	portalMap, err := drawOpUpdatePortals(o, tx)
+	portalMap, err := drawOpUpdatePortals(ctx, o, tx)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
 
-	agentMap, err := allOpAgents(o.Teams, tx)
+	agentMap, err := allOpAgents(ctx, o.Teams, tx)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
 
-	if err := drawOpUpdateMarkers(o, portalMap, agentMap, tx); err != nil {
+	if err := drawOpUpdateMarkers(ctx, o, portalMap, agentMap, tx); err != nil {
 		log.Error(err)
 		return err
 	}
 
-	if err := drawOpUpdateLinks(o, portalMap, agentMap, tx); err != nil {
+	if err := drawOpUpdateLinks(ctx, o, portalMap, agentMap, tx); err != nil {
 		log.Error(err)
 		return err
 	}
 
-	if err := drawOpUpdateZones(o, tx); err != nil {
+	if err := drawOpUpdateZones(ctx, o, tx); err != nil {
 		log.Error(err)
 		return err
 	}
@@ -265,10 +266,10 @@ func DrawUpdate(ctx context.Context, o *Operation, gid GoogleID) error {
 	return nil
 }
 
-func drawOpUpdatePortals(o *Operation, tx *sql.Tx) (map[PortalID]Portal, error) {
+func drawOpUpdatePortals(ctx context.Context, o *Operation, tx *sql.Tx) (map[PortalID]Portal, error) {
 	// get the current portal list and stash in map
 	curPortals := make(map[PortalID]bool)
-	portalRows, err := tx.Query("SELECT ID FROM portal WHERE OpID = ?", o.ID)
+	portalRows, err := tx.QueryContext(ctx, "SELECT ID FROM portal WHERE OpID = ?", o.ID)
 	if err != nil {
 		log.Error(err)
 		return nil, err
@@ -289,23 +290,23 @@ func drawOpUpdatePortals(o *Operation, tx *sql.Tx) (map[PortalID]Portal, error)
 	portalMap := make(map[PortalID]Portal)
 	for _, p := range o.OpPortals {
 		portalMap[p.ID] = p
-		if err = o.ID.updatePortal(p, tx); err != nil {
+		if err = o.ID.updatePortal(ctx, p, tx); err != nil {
 			return portalMap, err
 		}
 		delete(curPortals, p.ID)
 	}
 	// clear portals that were not sent in this update
 	for k := range curPortals {
-		if err := o.ID.deletePortal(k, tx); err != nil {
+		if err := o.ID.deletePortal(ctx, k, tx); err != nil {
 			return portalMap, err
 		}
 	}
 	return portalMap, nil
 }
 
-func drawOpUpdateMarkers(o *Operation, portalMap map[PortalID]Portal, agentMap map[GoogleID]bool, tx *sql.Tx) error {
+func drawOpUpdateMarkers(ctx context.Context, o *Operation, portalMap map[PortalID]Portal, agentMap map[GoogleID]bool, tx *sql.Tx) error {
 	curMarkers := make(map[MarkerID]bool)
-	markerRows, err := tx.Query("SELECT ID FROM marker WHERE OpID = ?", o.ID)
+	markerRows, err := tx.QueryContext(ctx, "SELECT ID FROM marker WHERE OpID = ?", o.ID)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -333,7 +334,7 @@ func drawOpUpdateMarkers(o *Operation, portalMap map[PortalID]Portal, agentMap m
 
 		// m.checkAssignments(agentMap)
 
-		if err := o.ID.updateMarker(m, tx); err != nil {
+		if err := o.ID.updateMarker(ctx, m, tx); err != nil {
 			return err
 		}
 		delete(curMarkers, m.ID)
@@ -341,16 +342,16 @@ func drawOpUpdateMarkers(o *Operation, portalMap map[PortalID]Portal, agentMap m
 
 	// remove all markers not sent in this update
 	for k := range curMarkers {
-		if err := o.ID.deleteMarker(k, tx); err != nil {
+		if err := o.ID.deleteMarker(ctx, k, tx); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func drawOpUpdateLinks(o *Operation, portalMap map[PortalID]Portal, agentMap map[GoogleID]bool, tx *sql.Tx) error {
+func drawOpUpdateLinks(ctx context.Context, o *Operation, portalMap map[PortalID]Portal, agentMap map[GoogleID]bool, tx *sql.Tx) error {
 	curLinks := make(map[LinkID]bool)
-	linkRows, err := tx.Query("SELECT ID FROM link WHERE OpID = ?", o.ID)
+	linkRows, err := tx.QueryContext(ctx, "SELECT ID FROM link WHERE OpID = ?", o.ID)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -384,27 +385,27 @@ func drawOpUpdateLinks(o *Operation, portalMap map[PortalID]Portal, agentMap map
 
 		// l.checkAssignments(agentMap)
 
-		if err = o.ID.updateLink(l, tx); err != nil {
+		if err = o.ID.updateLink(ctx, l, tx); err != nil {
 			return err
 		}
 		delete(curLinks, l.ID)
 	}
 	for k := range curLinks {
-		if err = o.ID.deleteLink(k, tx); err != nil {
+		if err = o.ID.deleteLink(ctx, k, tx); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func drawOpUpdateZones(o *Operation, tx *sql.Tx) error {
+func drawOpUpdateZones(ctx context.Context, o *Operation, tx *sql.Tx) error {
 	// pre 0.18 clients do not send zone info
 	if len(o.Zones) == 0 {
 		o.Zones = defaultZones()
 	}
 
 	curZones := make(map[Zone]bool)
-	zoneRows, err := tx.Query("SELECT ID from zone WHERE OpID = ?", o.ID)
+	zoneRows, err := tx.QueryContext(ctx, "SELECT ID from zone WHERE OpID = ?", o.ID)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -423,14 +424,14 @@ func drawOpUpdateZones(o *Operation, tx *sql.Tx) error {
 
 	// update and insert are the saem
 	for _, z := range o.Zones {
-		if err := o.insertZone(z, tx); err != nil {
+		if err := o.insertZone(ctx, z, tx); err != nil {
 			log.Error(err)
 			continue
 		}
 		delete(curZones, z.Zone)
 	}
 	for k := range curZones {
-		if err = o.ID.deleteZone(k, tx); err != nil {
+		if err = o.ID.deleteZone(ctx, k, tx); err != nil {
 			log.Error(err)
 			continue
 		}
@@ -440,20 +441,30 @@ func drawOpUpdateZones(o *Operation, tx *sql.Tx) error {
 }
 
 // Delete removes an operation and all associated data
-func (o *Operation) Delete(gid GoogleID) error {
-	if !o.ID.IsOwner(gid) {
+func (o *Operation) Delete(ctx context.Context, gid GoogleID) error {
+	if !o.ID.IsOwner(ctx, gid) {
 		err := fmt.Errorf("permission denied")
 		log.Error(err)
 		return err
 	}
+	return o.ID.purge(ctx, gid)
+}
+
+// AdminDelete removes an operation and all associated data without checking ownership
+// caller must verify the agent is a server administrator
+func (opID OperationID) AdminDelete(ctx context.Context, admin GoogleID) error {
+	return opID.purge(ctx, admin)
+}
 
-	_, err := db.Exec("INSERT INTO deletedops (opID, deletedate, gid) VALUES (?, UTC_TIMESTAMP(), ?)", o.ID, gid)
+func (opID OperationID) purge(ctx context.Context, gid GoogleID) error {
+	defer opID.uncache()
+	_, err := db.ExecContext(ctx, "INSERT INTO deletedops (opID, deletedate, gid) VALUES (?, UTC_TIMESTAMP(), ?)", opID, gid)
 	if err != nil {
 		log.Error(err)
 		// carry on
 	}
 
-	_, err = db.Exec("DELETE FROM operation WHERE ID = ?", o.ID)
+	_, err = db.ExecContext(ctx, "DELETE FROM operation WHERE ID = ?", opID)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -464,7 +475,7 @@ func (o *Operation) Delete(gid GoogleID) error {
 	for _, v := range tables {
 		// #nosec
 		q := fmt.Sprintf("DELETE FROM %s WHERE opID = ?", v)
-		if _, err = db.Exec(q, o.ID); err != nil {
+		if _, err = db.ExecContext(ctx, q, opID); err != nil {
 			log.Info(err)
 			// carry on
 		}
@@ -474,9 +485,9 @@ func (o *Operation) Delete(gid GoogleID) error {
 }
 
 // IsDeletedOp reports back if a particular op has been deleted
-func (opID OperationID) IsDeletedOp() bool {
+func (opID OperationID) IsDeletedOp(ctx context.Context) bool {
 	var i int
-	r := db.QueryRow("SELECT COUNT(*) FROM deletedops WHERE opID = ?", opID)
+	r := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM deletedops WHERE opID = ?", opID)
 	err := r.Scan(&i)
 	if err != nil {
 		log.Error(err)
@@ -487,9 +498,9 @@ func (opID OperationID) IsDeletedOp() bool {
 
 // Populate takes a pointer to an Operation and fills it in; o.ID must be set
 // checks to see that either the gid created the operation or the gid is on the team assigned to the operation
-func (o *Operation) Populate(gid GoogleID) error {
+func (o *Operation) Populate(ctx context.Context, gid GoogleID) error {
 	var comment sql.NullString
-	err := db.QueryRow("SELECT name, gid, color, modified, comment, lasteditid, referencetime FROM operation WHERE ID = ?", o.ID).Scan(&o.Name, &o.Gid, &o.Color, &o.Modified, &comment, &o.LastEditID, &o.ReferenceTime)
+	err := db.QueryRowContext(ctx, "SELECT name, gid, color, modified, comment, lasteditid, referencetime FROM operation WHERE ID = ?", o.ID).Scan(&o.Name, &o.Gid, &o.Color, &o.Modified, &comment, &o.LastEditID, &o.ReferenceTime)
 	if err != nil && err == sql.ErrNoRows {
 		err = fmt.Errorf(ErrOpNotFound)
 		log.Errorw(err.Error(), "resource", o.ID, "GID", gid, "opID", o.ID)
@@ -516,13 +527,13 @@ func (o *Operation) Populate(gid GoogleID) error {
 	}
 
 	// ReadAccess will do this if we don't, but this is a harmless redundancy since it won't double-query (unless no permissions are set)
-	if err := o.PopulateTeams(); err != nil {
+	if err := o.PopulateTeams(ctx); err != nil {
 		log.Error(err)
 		return err
 	}
 
-	read, zones := o.ReadAccess(gid)
-	assignedOnly := o.AssignedOnlyAccess(gid)
+	read, zones := o.ReadAccess(ctx, gid)
+	assignedOnly := o.AssignedOnlyAccess(ctx, gid)
 	if !read {
 		if assignedOnly {
 			zones = []Zone{ZoneAssignOnly}
@@ -531,70 +542,114 @@ func (o *Operation) Populate(gid GoogleID) error {
 		}
 	}
 
-	// get all the assignments in a single query, so we don't lock up the database when one agent requests 50 ops, each with hundreds of links
-	assignments, err := o.ID.assignmentPrecache()
+	// everything an agent might see is shared by all agents and only loaded when the op changes
+	cached, err := o.ID.cached(ctx, o.LastEditID)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
+	o.view(cached, zones, gid, assignedOnly)
+	return nil
+}
+
+// load reads the entire op from the database without any filtering; the result is cached and must not be modified
+func (opID OperationID) load(ctx context.Context) (*Operation, error) {
+	o := &Operation{ID: opID}
+
+	// get all the assignments in a single query, so we don't lock up the database when one agent requests 50 ops, each with hundreds of links
+	assignments, err := opID.assignmentPrecache(ctx)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
 
 	// same for depends
-	depends, err := o.ID.dependsPrecache()
+	depends, err := opID.dependsPrecache(ctx)
 	if err != nil {
 		log.Error(err)
-		return err
+		return nil, err
 	}
 
-	// start with everything -- filter after the rest is set up
-	if err = o.populatePortals(); err != nil {
+	// and marker attributes
+	attributes, err := opID.attributePrecache(ctx)
+	if err != nil {
 		log.Error(err)
-		return err
+		return nil, err
 	}
 
-	if err = o.populateMarkers(zones, gid, assignments, depends); err != nil {
+	if err = o.populatePortals(ctx); err != nil {
 		log.Error(err)
-		return err
+		return nil, err
 	}
 
-	if err = o.populateLinks(zones, gid, assignments, depends); err != nil {
+	if err = o.populateMarkers(ctx, assignments, depends, attributes); err != nil {
 		log.Error(err)
-		return err
+		return nil, err
 	}
 
-	if err = o.populateAnchors(); err != nil {
+	if err = o.populateLinks(ctx, assignments, depends); err != nil {
 		log.Error(err)
-		return err
+		return nil, err
 	}
 
-	if assignedOnly {
-		if err = o.populateMyKeys(gid); err != nil {
-			log.Error(err)
-			return err
+	if err = o.populateKeys(ctx); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	if err = o.populateZones(ctx); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return o, nil
+}
+
+// view fills in o with copies of the parts of the cached op the agent is permitted to see, replacing any earlier view
+func (o *Operation) view(cached *Operation, zones []Zone, gid GoogleID, assignedOnly bool) {
+	o.OpPortals = append([]Portal(nil), cached.OpPortals...)
+	o.Markers = nil
+	o.Links = nil
+	o.Anchors = nil
+	o.Keys = nil
+
+	for _, m := range cached.Markers {
+		// if the marker is not in the zones with which we are concerned AND not assigned to me, skip
+		if !m.Zone.inZones(zones) && !m.assignedTo(gid) {
+			continue
 		}
-	} else {
-		if err = o.populateKeys(); err != nil {
-			log.Error(err)
-			return err
+		m.Task = m.Task.copy()
+		m.Attributes = append([]Attribute(nil), m.Attributes...)
+		o.Markers = append(o.Markers, m)
+	}
+
+	for _, l := range cached.Links {
+		// this isn't in a zone with which we are concerned AND not assigned to me, skip
+		if !l.Zone.inZones(zones) && !l.assignedTo(gid) {
+			continue
 		}
+		l.Task = l.Task.copy()
+		o.Links = append(o.Links, l)
 	}
 
-	if !ZoneAll.inZones(zones) {
-		if err = o.filterPortals(); err != nil {
-			log.Error(err)
-			return err
+	_ = o.populateAnchors()
+
+	for _, k := range cached.Keys {
+		if assignedOnly && k.Gid != gid {
+			continue
 		}
+		o.Keys = append(o.Keys, k)
 	}
 
-	if err = o.populateZones(); err != nil {
-		log.Error(err)
-		return err
+	if !ZoneAll.inZones(zones) {
+		_ = o.filterPortals()
 	}
-	return nil
+
+	o.Zones = append([]ZoneListElement(nil), cached.Zones...)
 }
 
 // SetInfo changes the description of an operation
-func (o *Operation) SetInfo(info string, gid GoogleID) error {
-	_, err := db.Exec("UPDATE operation SET comment = ? WHERE ID = ?", info, o.ID)
+func (o *Operation) SetInfo(ctx context.Context, info string, gid GoogleID) error {
+	_, err := db.ExecContext(ctx, "UPDATE operation SET comment = ? WHERE ID = ?", info, o.ID)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -603,10 +658,11 @@ func (o *Operation) SetInfo(info string, gid GoogleID) error {
 }
 
 // Touch updates the modified timestamp on an operation
-func (o *Operation) Touch() (string, error) {
+func (o *Operation) Touch(ctx context.Context) (string, error) {
+	defer o.ID.uncache()
 	updateID := util.GenerateID(40)
 
-	_, err := db.Exec("UPDATE operation SET modified = UTC_TIMESTAMP(), lasteditid = ? WHERE ID = ?", updateID, o.ID)
+	_, err := db.ExecContext(ctx, "UPDATE operation SET modified = UTC_TIMESTAMP(), lasteditid = ? WHERE ID = ?", updateID, o.ID)
 	if err != nil {
 		log.Error(err)
 		return "", err
@@ -615,10 +671,10 @@ func (o *Operation) Touch() (string, error) {
 }
 
 // Stat returns useful info on an operation
-func (opID OperationID) Stat() (*OpStat, error) {
+func (opID OperationID) Stat(ctx context.Context) (*OpStat, error) {
 	s := OpStat{}
 	s.ID = opID
-	err := db.QueryRow("SELECT name, gid, modified, lasteditid FROM operation WHERE ID = ?", opID).Scan(&s.Name, &s.Gid, &s.Modified, &s.LastEditID)
+	err := db.QueryRowContext(ctx, "SELECT name, gid, modified, lasteditid FROM operation WHERE ID = ?", opID).Scan(&s.Name, &s.Gid, &s.Modified, &s.LastEditID)
 	if err != nil && err != sql.ErrNoRows {
 		log.Error(err)
 		return &s, err
@@ -632,8 +688,8 @@ func (opID OperationID) Stat() (*OpStat, error) {
 }
 
 // Rename changes an op's name
-func (opID OperationID) Rename(gid GoogleID, name string) error {
-	if !opID.IsOwner(gid) {
+func (opID OperationID) Rename(ctx context.Context, gid GoogleID, name string) error {
+	if !opID.IsOwner(ctx, gid) {
 		err := fmt.Errorf("permission denied")
 		log.Warnw(err.Error(), "GID", gid, "resource", opID)
 		return err
@@ -645,7 +701,7 @@ func (opID OperationID) Rename(gid GoogleID, name string) error {
 		return err
 	}
 
-	_, err := db.Exec("UPDATE operation SET name = ? WHERE ID = ?", name, opID)
+	_, err := db.ExecContext(ctx, "UPDATE operation SET name = ? WHERE ID = ?", name, opID)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -653,11 +709,17 @@ func (opID OperationID) Rename(gid GoogleID, name string) error {
 	return nil
 }
 
-func allOpAgents(perms []OpPermission, tx *sql.Tx) (map[GoogleID]bool, error) {
+func allOpAgents(ctx context.Context, perms []OpPermission, tx *sql.Tx) (map[GoogleID]bool, error) {
 	am := make(map[GoogleID]bool)
 
+	var teams []TeamID
 	for _, p := range perms {
-		rows, err := tx.Query("SELECT gid FROM agentteams WHERE teamID = ?", p.TeamID)
+		teams = append(teams, p.TeamID)
+	}
+
+	// permissions granted to a team group apply to every team under it, read in tx like the members
+	for _, teamID := range expandTeamGroups(ctx, tx, teams) {
+		rows, err := tx.QueryContext(ctx, "SELECT gid FROM agentteams WHERE teamID = ?", teamID)
 		if err != nil {
 			log.Error(err)
 			continue
@@ -676,9 +738,9 @@ func allOpAgents(perms []OpPermission, tx *sql.Tx) (map[GoogleID]bool, error) {
 	return am, nil
 }
 
-func (opID OperationID) Valid() bool {
+func (opID OperationID) Valid(ctx context.Context) bool {
 	var count int
-	err := db.QueryRow("SELECT COUNT(*) FROM operation WHERE ID = ?", opID).Scan(&count)
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM operation WHERE ID = ?", opID).Scan(&count)
 	if err != nil {
 		log.Error(err)
 	}
@@ -0,0 +1,28 @@
+package model
+
+import (
+	"testing"
+)
+
+// Populate on an op which was already populated, as the offline sync does after applying actions, must not repeat anything
+func TestViewReplaces(t *testing.T) {
+	cached := &Operation{
+		ID:        "op",
+		OpPortals: []Portal{{ID: "p1"}, {ID: "p2"}},
+		Markers:   []Marker{{ID: "m1", PortalID: "p1", Task: Task{ID: "t1"}}},
+		Links:     []Link{{ID: "l1", From: "p1", To: "p2", Task: Task{ID: "t2"}}},
+		Keys:      []KeyOnHand{{ID: "p2", Gid: "agent", Onhand: 3}},
+	}
+
+	o := &Operation{ID: "op"}
+	o.view(cached, []Zone{ZoneAll}, "agent", false)
+	o.Markers[0].State = "stale"
+	o.view(cached, []Zone{ZoneAll}, "agent", false)
+
+	if len(o.Markers) != 1 || len(o.Links) != 1 || len(o.Keys) != 1 || len(o.Anchors) != 2 {
+		t.Errorf("second view has %d markers, %d links, %d keys, %d anchors; want 1, 1, 1, 2", len(o.Markers), len(o.Links), len(o.Keys), len(o.Anchors))
+	}
+	if o.Markers[0].State == "stale" {
+		t.Error("second view kept the marker from the first")
+	}
+}
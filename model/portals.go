@@ -1,6 +1,7 @@
 package model
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 
@@ -23,11 +24,11 @@ type Portal struct {
 }
 
 // insertPortal adds a portal to the database
-func (opID OperationID) insertPortal(p Portal, tx *sql.Tx) error {
+func (opID OperationID) insertPortal(ctx context.Context, p Portal, tx *sql.Tx) error {
 	comment := makeNullString(util.Sanitize(p.Comment))
 	hardness := makeNullString(util.Sanitize(p.Hardness))
 
-	_, err := tx.Exec("INSERT IGNORE INTO portal (ID, opID, name, loc, comment, hardness) VALUES (?, ?, ?, POINT(?, ?), ?, ?)",
+	_, err := tx.ExecContext(ctx, "INSERT IGNORE INTO portal (ID, opID, name, loc, comment, hardness) VALUES (?, ?, ?, POINT(?, ?), ?, ?)",
 		p.ID, opID, p.Name, p.Lon, p.Lat, comment, hardness)
 	if err != nil {
 		log.Error(err)
@@ -36,11 +37,11 @@ func (opID OperationID) insertPortal(p Portal, tx *sql.Tx) error {
 	return nil
 }
 
-func (opID OperationID) updatePortal(p Portal, tx *sql.Tx) error {
+func (opID OperationID) updatePortal(ctx context.Context, p Portal, tx *sql.Tx) error {
 	comment := makeNullString(util.Sanitize(p.Comment))
 	hardness := makeNullString(util.Sanitize(p.Hardness))
 
-	_, err := tx.Exec("REPLACE INTO portal (ID, opID, name, loc, comment, hardness) VALUES (?, ?, ?, POINT(?, ?), ?, ?)", // REPLACE OK SCB (so long as any task is rebuilt after)
+	_, err := tx.ExecContext(ctx, "REPLACE INTO portal (ID, opID, name, loc, comment, hardness) VALUES (?, ?, ?, POINT(?, ?), ?, ?)", // REPLACE OK SCB (so long as any task is rebuilt after)
 		p.ID, opID, p.Name, p.Lon, p.Lat, comment, hardness)
 	if err != nil {
 		log.Error(err)
@@ -49,8 +50,8 @@ func (opID OperationID) updatePortal(p Portal, tx *sql.Tx) error {
 	return nil
 }
 
-func (opID OperationID) deletePortal(p PortalID, tx *sql.Tx) error {
-	_, err := tx.Exec("DELETE FROM portal WHERE ID = ? AND opID = ?", p, opID)
+func (opID OperationID) deletePortal(ctx context.Context, p PortalID, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, "DELETE FROM portal WHERE ID = ? AND opID = ?", p, opID)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -59,11 +60,11 @@ func (opID OperationID) deletePortal(p PortalID, tx *sql.Tx) error {
 }
 
 // PopulatePortals fills in the OpPortals list for the Operation. No authorization takes place.
-func (o *Operation) populatePortals() error {
+func (o *Operation) populatePortals(ctx context.Context) error {
 	var p Portal
 	p.opID = o.ID
 
-	rows, err := db.Query("SELECT ID, name, Y(loc) AS lat, X(loc) AS lon, comment, hardness FROM portal WHERE opID = ?", o.ID)
+	rows, err := db.QueryContext(ctx, "SELECT ID, name, Y(loc) AS lat, X(loc) AS lon, comment, hardness FROM portal WHERE opID = ?", o.ID)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -141,10 +142,11 @@ func (p PortalID) String() string {
 }
 
 // PortalHardness updates the comment on a portal
-func (opID OperationID) PortalHardness(portalID PortalID, hardness string) error {
+func (opID OperationID) PortalHardness(ctx context.Context, portalID PortalID, hardness string) error {
+	defer opID.uncache()
 	h := makeNullString(util.Sanitize(hardness))
 
-	_, err := db.Exec("UPDATE portal SET hardness = ? WHERE ID = ? AND opID = ?", h, portalID, opID)
+	_, err := db.ExecContext(ctx, "UPDATE portal SET hardness = ? WHERE ID = ? AND opID = ?", h, portalID, opID)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -153,10 +155,11 @@ func (opID OperationID) PortalHardness(portalID PortalID, hardness string) error
 }
 
 // PortalComment updates the comment on a portal
-func (opID OperationID) PortalComment(portalID PortalID, comment string) error {
+func (opID OperationID) PortalComment(ctx context.Context, portalID PortalID, comment string) error {
+	defer opID.uncache()
 	c := makeNullString(util.Sanitize(comment))
 
-	_, err := db.Exec("UPDATE portal SET comment = ? WHERE ID = ? AND opID = ?", c, portalID, opID)
+	_, err := db.ExecContext(ctx, "UPDATE portal SET comment = ? WHERE ID = ? AND opID = ?", c, portalID, opID)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -166,19 +169,19 @@ func (opID OperationID) PortalComment(portalID PortalID, comment string) error {
 
 // PortalDetails returns information about the portal
 // does access checking (cached)
-func (o *Operation) PortalDetails(portalID PortalID, gid GoogleID) (*Portal, error) {
+func (o *Operation) PortalDetails(ctx context.Context, portalID PortalID, gid GoogleID) (*Portal, error) {
 	var p Portal
 	p.ID = portalID
 	p.opID = o.ID
 
-	if read, _ := o.ReadAccess(gid); !read {
+	if read, _ := o.ReadAccess(ctx, gid); !read {
 		err := fmt.Errorf("unauthorized: unable to get portal details")
 		log.Errorw(err.Error(), "GID", gid, "resource", o.ID, "portal", portalID)
 		return &p, err
 	}
 
 	var comment, hardness sql.NullString
-	err := db.QueryRow("SELECT name, Y(loc) AS lat, X(loc) AS lon, comment, hardness FROM portal WHERE opID = ? AND ID = ?", o.ID, portalID).Scan(&p.Name, &p.Lat, &p.Lon, &comment, &hardness)
+	err := db.QueryRowContext(ctx, "SELECT name, Y(loc) AS lat, X(loc) AS lon, comment, hardness FROM portal WHERE opID = ? AND ID = ?", o.ID, portalID).Scan(&p.Name, &p.Lat, &p.Lon, &comment, &hardness)
 	if err != nil && err == sql.ErrNoRows {
 		err := fmt.Errorf("portal %s not in op", portalID)
 		return &p, err
@@ -197,13 +200,13 @@ func (o *Operation) PortalDetails(portalID PortalID, gid GoogleID) (*Portal, err
 }
 
 // a transaction-safe version, no access checking
-func (opID OperationID) portalDetails(portalID PortalID, tx *sql.Tx) (*Portal, error) {
+func (opID OperationID) portalDetails(ctx context.Context, portalID PortalID, tx *sql.Tx) (*Portal, error) {
 	var p Portal
 	p.ID = portalID
 	p.opID = opID
 
 	var comment, hardness sql.NullString
-	err := tx.QueryRow("SELECT name, Y(loc) AS lat, X(loc) AS lon, comment, hardness FROM portal WHERE opID = ? AND ID = ?", opID, portalID).Scan(&p.Name, &p.Lat, &p.Lon, &comment, &hardness)
+	err := tx.QueryRowContext(ctx, "SELECT name, Y(loc) AS lat, X(loc) AS lon, comment, hardness FROM portal WHERE opID = ? AND ID = ?", opID, portalID).Scan(&p.Name, &p.Lat, &p.Lon, &comment, &hardness)
 	if err != nil && err == sql.ErrNoRows {
 		err := fmt.Errorf("portal %s not in op", portalID)
 		return &p, err
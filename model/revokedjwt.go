@@ -1,15 +1,78 @@
 package model
 
 import (
+	"context"
+	"time"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
 	"github.com/wasabee-project/Wasabee-Server/util"
 )
 
-// LoadRevokedJWT does nothing yet
+// revoked JWT IDs are kept a day past the longest a JWT can live without being refreshed
+const revokedJWTRetention = "8 DAY"
+
+// LoadRevokedJWT reads the recently revoked JWT IDs
 func LoadRevokedJWT() *util.Safemap {
-	return util.NewSafemap()
+	r := util.NewSafemap()
+
+	if _, err := db.Exec("DELETE FROM revokedjwt WHERE revoked < DATE_SUB(UTC_TIMESTAMP(), INTERVAL " + revokedJWTRetention + ")"); err != nil {
+		log.Error(err)
+	}
+
+	rows, err := db.Query("SELECT tokenID FROM revokedjwt")
+	if err != nil {
+		log.Error(err)
+		return r
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tokenID string
+		if err := rows.Scan(&tokenID); err != nil {
+			log.Error(err)
+			continue
+		}
+		r.SetBool(tokenID, true)
+	}
+	return r
 }
 
-// StoreRevokedJWT does nothing yet
+// StoreRevokedJWT does nothing, revocations are written by RecordRevokedJWT as they happen
 func StoreRevokedJWT(r *util.Safemap) {
 	// return
 }
+
+// RecordRevokedJWT saves a revoked JWT ID so the revocation survives a restart
+func RecordRevokedJWT(ctx context.Context, tokenID string) error {
+	if _, err := db.ExecContext(ctx, "INSERT IGNORE INTO revokedjwt (tokenID, revoked) VALUES (?, UTC_TIMESTAMP())", tokenID); err != nil {
+		log.Error(err)
+		return err
+	}
+	if _, err := db.ExecContext(ctx, "DELETE FROM jwtsession WHERE tokenID = ?", tokenID); err != nil {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// RevokedJWTSince lists the JWT IDs revoked after t, including those revoked by other processes sharing the database
+func RevokedJWTSince(ctx context.Context, t time.Time) ([]string, error) {
+	var ids []string
+
+	rows, err := db.QueryContext(ctx, "SELECT tokenID FROM revokedjwt WHERE revoked >= ?", t.UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		log.Error(err)
+		return ids, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tokenID string
+		if err := rows.Scan(&tokenID); err != nil {
+			log.Error(err)
+			continue
+		}
+		ids = append(ids, tokenID)
+	}
+	return ids, nil
+}
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"context"
 	"database/sql"
 	"time"
 
@@ -18,7 +19,7 @@ type RocksAgent struct {
 }
 
 // RocksToDB writes a rocks agent to the database
-func RocksToDB(a *RocksAgent) error {
+func RocksToDB(ctx context.Context, a *RocksAgent) error {
 	if a.Agent == "" {
 		return nil
 	}
@@ -34,38 +35,40 @@ func RocksToDB(a *RocksAgent) error {
 	}
 
 	// REPLACE OK SCB
-	_, err := db.Exec("REPLACE INTO rocks (gid, tgid, agent, verified, smurf, fetched) VALUES (?,?,LEFT(?,15),?,?,UTC_TIMESTAMP())", a.Gid, a.TGId, a.Agent, a.Verified, a.Smurf)
+	_, err := db.ExecContext(ctx, "REPLACE INTO rocks (gid, tgid, agent, verified, smurf, fetched) VALUES (?,?,LEFT(?,15),?,?,UTC_TIMESTAMP())", a.Gid, a.TGId, a.Agent, a.Verified, a.Smurf)
 	if err != nil {
 		log.Error(err)
 		return nil
 	}
+	a.Gid.touch(ctx)
 
 	// we trust .rocks to verify telegram info; if it is not already set for a agent, just import it.
 	if a.TGId > 0 { // negative numbers are group chats, 0 is invalid
-		existing, err := a.Gid.TelegramID()
+		existing, err := a.Gid.TelegramID(ctx)
 		if err != nil {
 			log.Error(err)
 			return err
 		}
 		if existing == 0 {
-			if _, err := db.Exec("INSERT IGNORE INTO telegram (telegramID, gid, verified) VALUES (?, ?, 1)", a.TGId, a.Gid); err != nil {
+			if _, err := db.ExecContext(ctx, "INSERT IGNORE INTO telegram (telegramID, gid, verified) VALUES (?, ?, 1)", a.TGId, a.Gid); err != nil {
 				log.Error(err)
 				return err
 			}
+			a.Gid.touch(ctx)
 		}
 	}
 	return nil
 }
 
 // RocksFromDB returns a rocks agent from the database
-func RocksFromDB(gid GoogleID) (*RocksAgent, time.Time, error) {
+func RocksFromDB(ctx context.Context, gid GoogleID) (*RocksAgent, time.Time, error) {
 	a := RocksAgent{}
 	var fetched string
 	var t time.Time
 	var tgid sql.NullInt64
 	var agent sql.NullString
 
-	err := db.QueryRow("SELECT gid, tgid, agent, verified, smurf, fetched FROM rocks WHERE gid = ?", gid).Scan(&a.Gid, &tgid, &agent, &a.Verified, &a.Smurf, &fetched)
+	err := db.QueryRowContext(ctx, "SELECT gid, tgid, agent, verified, smurf, fetched FROM rocks WHERE gid = ?", gid).Scan(&a.Gid, &tgid, &agent, &a.Verified, &a.Smurf, &fetched)
 	if err != nil && err != sql.ErrNoRows {
 		log.Error(err)
 		return &a, t, err
@@ -97,9 +100,9 @@ func RocksFromDB(gid GoogleID) (*RocksAgent, time.Time, error) {
 }
 
 // RocksCommunity returns a communityID for a TeamID
-func (teamID TeamID) RocksCommunity() (string, error) {
+func (teamID TeamID) RocksCommunity(ctx context.Context) (string, error) {
 	var rc sql.NullString
-	err := db.QueryRow("SELECT rockscomm FROM team WHERE teamID = ?", teamID).Scan(&rc)
+	err := db.QueryRowContext(ctx, "SELECT rockscomm FROM team WHERE teamID = ?", teamID).Scan(&rc)
 	if err != nil {
 		log.Error(err)
 		return "", err
@@ -111,9 +114,9 @@ func (teamID TeamID) RocksCommunity() (string, error) {
 }
 
 // RocksKey returns a rocks key for a TeamID
-func (teamID TeamID) RocksKey() (string, error) {
+func (teamID TeamID) RocksKey(ctx context.Context) (string, error) {
 	var rc sql.NullString
-	err := db.QueryRow("SELECT rockskey FROM team WHERE teamID = ?", teamID).Scan(&rc)
+	err := db.QueryRowContext(ctx, "SELECT rockskey FROM team WHERE teamID = ?", teamID).Scan(&rc)
 	if err != nil && err != sql.ErrNoRows {
 		log.Error(err)
 		return "", err
@@ -125,9 +128,9 @@ func (teamID TeamID) RocksKey() (string, error) {
 }
 
 // RocksCommunityToTeam returns a TeamID from a Rocks Community
-func RocksCommunityToTeam(communityID string) (TeamID, error) {
+func RocksCommunityToTeam(ctx context.Context, communityID string) (TeamID, error) {
 	var teamID TeamID
-	err := db.QueryRow("SELECT teamID FROM team WHERE rockscomm = ?", communityID).Scan(&teamID)
+	err := db.QueryRowContext(ctx, "SELECT teamID FROM team WHERE rockscomm = ?", communityID).Scan(&teamID)
 	if err != nil {
 		log.Errorw("rocks community team lookup", "error", err.Error(), "community", communityID)
 		return "", err
@@ -139,11 +142,11 @@ func RocksCommunityToTeam(communityID string) (TeamID, error) {
 // Does not check team ownership -- caller should take care of authorization.
 // Local adds/deletes will be pushed to the community (API management must be enabled on the community at enl.rocks).
 // adds/deletes at enl.rocks will be pushed here (onJoin/onLeave web hooks must be configured in the community at enl.rocks)
-func (teamID TeamID) SetRocks(key, community string) error {
+func (teamID TeamID) SetRocks(ctx context.Context, key, community string) error {
 	k := makeNullString(util.Sanitize(key))
 	c := makeNullString(util.Sanitize(community))
 
-	_, err := db.Exec("UPDATE team SET rockskey = ?, rockscomm = ? WHERE teamID = ?", k, c, teamID)
+	_, err := db.ExecContext(ctx, "UPDATE team SET rockskey = ?, rockscomm = ? WHERE teamID = ?", k, c, teamID)
 	if err != nil {
 		log.Error(err)
 	}
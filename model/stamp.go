@@ -0,0 +1,79 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+)
+
+// The team and agent tables carry a modification stamp so conditional requests can be answered without building the response.
+// Changes to the rows themselves bump it automatically (ON UPDATE), the membership, Telegram, V and .rocks changes which show up
+// in FetchTeam and GetAgent bump it explicitly. The stamps are only ever compared for equality, never with other times.
+
+// touch bumps a team's modification stamp
+func (teamID TeamID) touch(ctx context.Context) {
+	if _, err := db.ExecContext(ctx, "UPDATE team SET modified = CURRENT_TIMESTAMP(6) WHERE teamID = ?", teamID); err != nil {
+		log.Error(err)
+	}
+}
+
+// touch bumps an agent's modification stamp
+func (gid GoogleID) touch(ctx context.Context) {
+	if _, err := db.ExecContext(ctx, "UPDATE agent SET modified = CURRENT_TIMESTAMP(6) WHERE gid = ?", gid); err != nil {
+		log.Error(err)
+	}
+}
+
+// touchMembership bumps both stamps after an agent's membership of a team, or its settings on the team, change
+func touchMembership(ctx context.Context, teamID TeamID, gid GoogleID) {
+	teamID.touch(ctx)
+	gid.touch(ctx)
+}
+
+// touch bumps the modification stamp of the agent using a Telegram ID
+func (tgid TelegramID) touch(ctx context.Context) {
+	if _, err := db.ExecContext(ctx, "UPDATE agent JOIN telegram ON agent.gid = telegram.gid SET agent.modified = CURRENT_TIMESTAMP(6) WHERE telegram.telegramID = ?", tgid); err != nil {
+		log.Error(err)
+	}
+}
+
+// Stamp changes whenever FetchTeam would return something different: the team, its membership, or its members' names and locations
+func (teamID TeamID) Stamp(ctx context.Context) (string, error) {
+	var modified string
+	var members int
+	var agents, located sql.NullString
+
+	err := db.QueryRowContext(ctx, "SELECT team.modified, COUNT(agentteams.gid), MAX(agent.modified), MAX(locations.upTime) FROM team LEFT JOIN agentteams ON team.teamID = agentteams.teamID LEFT JOIN agent ON agentteams.gid = agent.gid LEFT JOIN locations ON agentteams.gid = locations.gid WHERE team.teamID = ? GROUP BY team.teamID", teamID).Scan(&modified, &members, &agents, &located)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("team not found")
+	}
+	if err != nil {
+		log.Error(err)
+		return "", err
+	}
+	return fmt.Sprintf("%s %d %s %s", modified, members, agents.String, located.String), nil
+}
+
+// Stamp changes whenever GetAgent would return something different: the agent, its teams, and the names and edits of the ops it can see,
+// including those shared with the team groups above its teams
+func (gid GoogleID) Stamp(ctx context.Context) (string, error) {
+	var modified, teams, owned, shared string
+
+	err := db.QueryRowContext(ctx, "SELECT a.modified, "+
+		"(SELECT CONCAT(COUNT(*), '/', COALESCE(MAX(team.modified), '')) FROM agentteams JOIN team ON agentteams.teamID = team.teamID WHERE agentteams.gid = a.gid), "+
+		"(SELECT CONCAT(COUNT(*), '/', COALESCE(SUM(CRC32(CONCAT_WS('/', ID, name, color, modified, lasteditid))), 0)) FROM operation WHERE operation.gid = a.gid), "+
+		"(WITH RECURSIVE up (teamID, depth) AS (SELECT teamID, 0 FROM agentteams WHERE gid = ? UNION ALL SELECT teamgroup.parent, up.depth + 1 FROM teamgroup JOIN up ON teamgroup.child = up.teamID WHERE up.depth < ?) "+
+		"SELECT CONCAT(COUNT(*), '/', COALESCE(SUM(CRC32(CONCAT_WS('/', operation.ID, operation.name, operation.color, operation.modified, operation.lasteditid, permissions.teamID))), 0)) "+
+		"FROM (SELECT DISTINCT teamID FROM up) t JOIN permissions ON t.teamID = permissions.teamID JOIN operation ON permissions.opID = operation.ID) "+
+		"FROM agent a WHERE a.gid = ?", gid, maxTeamGroupDepth, gid).Scan(&modified, &teams, &owned, &shared)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf(ErrAgentNotFound)
+	}
+	if err != nil {
+		log.Error(err)
+		return "", err
+	}
+	return fmt.Sprintf("%s %s %s %s", modified, teams, owned, shared), nil
+}
@@ -0,0 +1,223 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/util"
+)
+
+// SyncDiff is the set of membership changes a sync with an external roster provider (V, Rocks, etc) would make to a team
+type SyncDiff struct {
+	ID          string          `json:"id"`
+	TeamID      TeamID          `json:"teamID"`
+	Source      TeamAuditSource `json:"source"`
+	Add         []GoogleID      `json:"add"`
+	Remove      []GoogleID      `json:"remove"`
+	Unknown     []GoogleID      `json:"unknown"`   // agents not yet known to this server, they are created when the diff is applied
+	Unmatched   []string        `json:"unmatched"` // external IDs which could not be mapped to an agent
+	NeverRemove bool            `json:"neverremove"`
+	created     time.Time
+	// importAgent is set by the service to create the records of unknown agents when the diff is applied
+	importAgent func(GoogleID) error
+}
+
+// how long a previewed diff can be applied
+const syncDiffLifetime = 15 * time.Minute
+
+var syncDiffs = struct {
+	sync.Mutex
+	m map[string]*SyncDiff
+}{m: make(map[string]*SyncDiff)}
+
+// NewSyncDiff starts a diff for a team, the service fills in the changes
+// importAgent is called for each unknown agent when the diff is applied; it may be nil
+func (teamID TeamID) NewSyncDiff(ctx context.Context, source TeamAuditSource, importAgent func(GoogleID) error) *SyncDiff {
+	neverRemove, _ := teamID.NeverRemove(ctx)
+
+	return &SyncDiff{
+		ID:          util.GenerateID(16),
+		TeamID:      teamID,
+		Source:      source,
+		Add:         make([]GoogleID, 0),
+		Remove:      make([]GoogleID, 0),
+		Unknown:     make([]GoogleID, 0),
+		Unmatched:   make([]string, 0),
+		NeverRemove: neverRemove,
+		created:     time.Now(),
+		importAgent: importAgent,
+	}
+}
+
+// Store holds a previewed diff so it can be applied later with TakeSyncDiff
+func (d *SyncDiff) Store() {
+	syncDiffs.Lock()
+	defer syncDiffs.Unlock()
+
+	for id, old := range syncDiffs.m {
+		if time.Since(old.created) > syncDiffLifetime {
+			delete(syncDiffs.m, id)
+		}
+	}
+	syncDiffs.m[d.ID] = d
+}
+
+// TakeSyncDiff returns a previously stored diff for the team, a diff can only be taken once
+func (teamID TeamID) TakeSyncDiff(id string) (*SyncDiff, error) {
+	syncDiffs.Lock()
+	defer syncDiffs.Unlock()
+
+	d, ok := syncDiffs.m[id]
+	if !ok || d.TeamID != teamID || time.Since(d.created) > syncDiffLifetime {
+		err := fmt.Errorf("sync preview not found or expired")
+		log.Warnw(err.Error(), "resource", teamID, "id", id)
+		return nil, err
+	}
+	delete(syncDiffs.m, id)
+	return d, nil
+}
+
+// Apply makes the changes in the diff; removals are skipped if the team is set to never remove agents
+// actor is the agent applying the diff, empty for automatic syncs
+func (d *SyncDiff) Apply(ctx context.Context, actor GoogleID) error {
+	owner, err := d.TeamID.Owner(ctx)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	neverRemove, err := d.TeamID.NeverRemove(ctx)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	failed := make(map[GoogleID]bool)
+	for _, gid := range d.Unknown {
+		if d.importAgent == nil {
+			continue
+		}
+		if err := d.importAgent(gid); err != nil {
+			log.Errorw(err.Error(), "resource", d.TeamID, "GID", gid, "source", d.Source)
+			failed[gid] = true
+		}
+	}
+
+	for _, gid := range d.Add {
+		if failed[gid] {
+			continue
+		}
+		if err := d.TeamID.AddAgent(ctx, gid); err != nil {
+			log.Info(err)
+			continue
+		}
+		d.TeamID.AuditMembership(ctx, actor, d.Source, gid, AuditActionAdd)
+	}
+
+	if neverRemove {
+		if len(d.Remove) > 0 {
+			log.Infow("team set to never remove agents, skipping removals", "resource", d.TeamID, "source", d.Source, "count", len(d.Remove))
+		}
+		return nil
+	}
+
+	for _, gid := range d.Remove {
+		if gid == owner {
+			continue
+		}
+		if err := d.TeamID.RemoveAgent(ctx, gid); err != nil {
+			log.Error(err)
+			continue
+		}
+		d.TeamID.AuditMembership(ctx, actor, d.Source, gid, AuditActionRemove)
+	}
+	return nil
+}
+
+// NeverRemove reports if syncs with external services are prevented from removing agents from the team
+func (teamID TeamID) NeverRemove(ctx context.Context) (bool, error) {
+	var neverRemove bool
+
+	if err := db.QueryRowContext(ctx, "SELECT neverremove FROM team WHERE teamID = ?", teamID).Scan(&neverRemove); err != nil {
+		log.Error(err)
+		return false, err
+	}
+	return neverRemove, nil
+}
+
+// SetNeverRemove sets if syncs with external services may remove agents from the team
+// does not check team ownership -- caller should take care of authorization
+func (teamID TeamID) SetNeverRemove(ctx context.Context, state bool) error {
+	if _, err := db.ExecContext(ctx, "UPDATE team SET neverremove = ? WHERE teamID = ?", state, teamID); err != nil {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// LinkedTeams returns every team linked to V, a .rocks community or a roster URL
+func LinkedTeams(ctx context.Context) ([]TeamID, error) {
+	var teams []TeamID
+
+	rows, err := db.QueryContext(ctx, "SELECT teamID FROM team WHERE vteam != 0 OR (rockskey IS NOT NULL AND rockskey != '') OR rosterurl IS NOT NULL")
+	if err != nil && err != sql.ErrNoRows {
+		log.Error(err)
+		return teams, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var teamID TeamID
+		if err := rows.Scan(&teamID); err != nil {
+			log.Error(err)
+			continue
+		}
+		teams = append(teams, teamID)
+	}
+	return teams, nil
+}
+
+// maxSyncStatusLength is the size of the lastsyncstatus column
+const maxSyncStatusLength = 255
+
+// SetSyncStatus records the time and result of the most recent sync with V or .rocks
+func (teamID TeamID) SetSyncStatus(ctx context.Context, status string) error {
+	if len(status) > maxSyncStatusLength {
+		status = status[:maxSyncStatusLength]
+	}
+
+	if _, err := db.ExecContext(ctx, "UPDATE team SET lastsync = UTC_TIMESTAMP(), lastsyncstatus = ? WHERE teamID = ?", status, teamID); err != nil {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
+
+// RosterURL returns the URL of the CSV/JSON roster the team is linked to
+func (teamID TeamID) RosterURL(ctx context.Context) (string, error) {
+	var url sql.NullString
+
+	err := db.QueryRowContext(ctx, "SELECT rosterurl FROM team WHERE teamID = ?", teamID).Scan(&url)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error(err)
+		return "", err
+	}
+	if !url.Valid {
+		return "", nil
+	}
+	return url.String, nil
+}
+
+// SetRosterURL links a team to a CSV/JSON roster, "" to unlink
+// does not check team ownership -- caller should take care of authorization
+func (teamID TeamID) SetRosterURL(ctx context.Context, url string) error {
+	if _, err := db.ExecContext(ctx, "UPDATE team SET rosterurl = ? WHERE teamID = ?", makeNullString(url), teamID); err != nil {
+		log.Error(err)
+		return err
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 
@@ -11,12 +12,17 @@ import (
 
 // UnspecifiedTask is the type for tasks which could be either markers or links
 type UnspecifiedTask interface {
-	Claim(GoogleID) error
-	Reject(GoogleID) error
-	SetOrder(int16) error
+	Claim(context.Context, GoogleID) error
+	Reject(context.Context, GoogleID) error
+	SetOrder(context.Context, int16) error
 	GetOrder() int16
-	IsAssignedTo(GoogleID) bool
-	Acknowledge() error
+	IsAssignedTo(context.Context, GoogleID) bool
+	Acknowledge(context.Context) error
+}
+
+// execer is what the task setters need from *sql.DB and *sql.Tx, so they can run alone or as part of a batch
+type execer interface {
+	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
 }
 
 // TaskID is the basic type for a task identifier
@@ -36,8 +42,9 @@ type Task struct {
 }
 
 // AddDepend add a single task dependency
-func (t *Task) AddDepend(task TaskID) error {
-	_, err := db.Exec("INSERT INTO depends (opID, taskID, dependsOn) VALUES (?, ?, ?)", t.opID, t.ID, task)
+func (t *Task) AddDepend(ctx context.Context, task TaskID) error {
+	defer t.opID.uncache()
+	_, err := db.ExecContext(ctx, "INSERT INTO depends (opID, taskID, dependsOn) VALUES (?, ?, ?)", t.opID, t.ID, task)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -46,18 +53,19 @@ func (t *Task) AddDepend(task TaskID) error {
 }
 
 // SetDepends overwrites a task's dependencies, if tx is null, one is created
-func (t *Task) SetDepends(d []TaskID, tx *sql.Tx) error {
+func (t *Task) SetDepends(ctx context.Context, d []TaskID, tx *sql.Tx) error {
+	defer t.opID.uncache()
 	if len(d) < 1 {
 		return nil
 	}
 
-	if _, err := tx.Exec("DELETE FROM depends WHERE opID = ? AND taskID = ?", t.opID, t.ID); err != nil {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM depends WHERE opID = ? AND taskID = ?", t.opID, t.ID); err != nil {
 		log.Error(err)
 		return err
 	}
 
 	for _, depend := range d {
-		if _, err := tx.Exec("INSERT INTO depends (opID, taskID, dependsOn) VALUES (?, ?, ?)", t.opID, t.ID, depend); err != nil {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO depends (opID, taskID, dependsOn) VALUES (?, ?, ?)", t.opID, t.ID, depend); err != nil {
 			log.Error(err)
 			return err
 		}
@@ -66,8 +74,9 @@ func (t *Task) SetDepends(d []TaskID, tx *sql.Tx) error {
 }
 
 // DelDepend deletes all dependencies for a task
-func (t *Task) DelDepend(task TaskID) error {
-	_, err := db.Exec("DELETE FROM depends WHERE opID = ? AND taskID = ? AND dependsOn = ?", t.opID, t.ID, task)
+func (t *Task) DelDepend(ctx context.Context, task TaskID) error {
+	defer t.opID.uncache()
+	_, err := db.ExecContext(ctx, "DELETE FROM depends WHERE opID = ? AND taskID = ? AND dependsOn = ?", t.opID, t.ID, task)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -76,10 +85,10 @@ func (t *Task) DelDepend(task TaskID) error {
 }
 
 // dependsPrecache -- used to save queries in op.Populate
-func (o OperationID) dependsPrecache() (map[TaskID][]TaskID, error) {
+func (o OperationID) dependsPrecache(ctx context.Context) (map[TaskID][]TaskID, error) {
 	buf := make(map[TaskID][]TaskID)
 
-	rows, err := db.Query("SELECT taskID, dependsOn FROM depends WHERE opID = ?", o)
+	rows, err := db.QueryContext(ctx, "SELECT taskID, dependsOn FROM depends WHERE opID = ?", o)
 	if err != nil {
 		log.Error(err)
 		return buf, err
@@ -128,14 +137,18 @@ func (o OperationID) dependsPrecache() (map[TaskID][]TaskID, error) {
 } */
 
 // GetAssignments gets all assignments for a task
-func (t *Task) GetAssignments(tx *sql.Tx) ([]GoogleID, error) {
+func (t *Task) GetAssignments(ctx context.Context, tx *sql.Tx) ([]GoogleID, error) {
 	tmp := make([]GoogleID, 0)
 
 	if t.ID == "" {
 		return tmp, nil
 	}
 
-	rows, err := db.Query("SELECT DISTINCT gid FROM assignments WHERE opID = ? AND taskID = ?", t.opID, t.ID)
+	q := db.QueryContext
+	if tx != nil {
+		q = tx.QueryContext
+	}
+	rows, err := q(ctx, "SELECT DISTINCT gid FROM assignments WHERE opID = ? AND taskID = ?", t.opID, t.ID)
 	if err != nil {
 		log.Error(err)
 		return tmp, err
@@ -154,10 +167,10 @@ func (t *Task) GetAssignments(tx *sql.Tx) ([]GoogleID, error) {
 }
 
 // assignmentsPrecache is used by op.Populate to reduce the number of queries
-func (o OperationID) assignmentPrecache() (map[TaskID][]GoogleID, error) {
+func (o OperationID) assignmentPrecache(ctx context.Context) (map[TaskID][]GoogleID, error) {
 	buf := make(map[TaskID][]GoogleID)
 
-	rows, err := db.Query("SELECT DISTINCT taskID, gid FROM assignments WHERE opID = ?", o)
+	rows, err := db.QueryContext(ctx, "SELECT DISTINCT taskID, gid FROM assignments WHERE opID = ?", o)
 	if err != nil {
 		log.Error(err)
 		return buf, err
@@ -184,11 +197,31 @@ func (o OperationID) assignmentPrecache() (map[TaskID][]GoogleID, error) {
 }
 
 // SetAssignments assigns a task to an agent using a given transaction, if the transaction is nil, one is created for this block
-func (t *Task) SetAssignments(gs []GoogleID, tx *sql.Tx) error {
+// the newly assigned agents are told
+func (t *Task) SetAssignments(ctx context.Context, gs []GoogleID, tx *sql.Tx) error {
+	added, err := t.setAssignments(ctx, gs, tx)
+	if err != nil {
+		return err
+	}
+	t.announceAssignments(ctx, added)
+	return nil
+}
+
+// announceAssignments tells agents they have been assigned the task
+func (t *Task) announceAssignments(ctx context.Context, added []GoogleID) {
+	for _, gid := range added {
+		messaging.SendAssignment(ctx, messaging.GoogleID(gid), messaging.TaskID(t.ID), messaging.OperationID(t.opID), "assigned")
+	}
+}
+
+// setAssignments is SetAssignments without telling anyone, it returns the agents who were not already assigned
+func (t *Task) setAssignments(ctx context.Context, gs []GoogleID, tx *sql.Tx) ([]GoogleID, error) {
+	defer t.opID.uncache()
+	var added []GoogleID
 	needtx := false
 	if tx == nil {
 		needtx = true
-		tx, _ = db.Begin()
+		tx, _ = db.BeginTx(ctx, nil)
 
 		defer func() {
 			if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
@@ -197,7 +230,7 @@ func (t *Task) SetAssignments(gs []GoogleID, tx *sql.Tx) error {
 		}()
 	}
 
-	b, err := t.GetAssignments(tx)
+	b, err := t.GetAssignments(ctx, tx)
 	if err != nil {
 		log.Error(err)
 		// continue
@@ -223,52 +256,52 @@ func (t *Task) SetAssignments(gs []GoogleID, tx *sql.Tx) error {
 				log.Debugw("existing assignment", "gid", gid)
 			} else {
 				log.Debugw("new assignment", "gid", gid)
-				_, err := tx.Exec("REPLACE INTO assignments (opID, taskID, gid) VALUES (?, ?, ?)", t.opID, t.ID, gid)
+				_, err := tx.ExecContext(ctx, "REPLACE INTO assignments (opID, taskID, gid) VALUES (?, ?, ?)", t.opID, t.ID, gid)
 				if err != nil {
 					log.Error(err)
-					return err
+					return added, err
 				}
-				messaging.SendAssignment(messaging.GoogleID(gid), messaging.TaskID(t.ID), messaging.OperationID(t.opID), "assigned")
+				added = append(added, gid)
 			}
 		}
-		// Need an messaging.BuildAssignment / messaging.BulkSendAddignments pair to do this in one go
 
 		for gid := range before {
 			if gid == "" {
 				continue
 			}
 			log.Debugw("removing assignment", "gid", gid)
-			_, err := tx.Exec("DELETE FROM assignments WHERE opID = ? AND taskID = ? AND gid = ?", t.opID, t.ID, gid)
+			_, err := tx.ExecContext(ctx, "DELETE FROM assignments WHERE opID = ? AND taskID = ? AND gid = ?", t.opID, t.ID, gid)
 			if err != nil {
 				log.Error(err)
-				return err
+				return added, err
 			}
 		}
 	}
 
 	if len(gs) == 0 && len(before) > 0 {
 		log.Debugw("clearing assignments", "opID", t.opID, "taskID", t.ID, "gs", gs, "before", b)
-		t.ClearAssignments(tx)
+		t.ClearAssignments(ctx, tx)
 	}
 
 	if needtx {
 		if err := tx.Commit(); err != nil {
 			log.Error(err)
-			return err
+			return nil, err
 		}
 	}
-	return nil
+	return added, nil
 }
 
 // ClearAssignments removes any assignments for this task from the database
-func (t *Task) ClearAssignments(tx *sql.Tx) error {
-	if _, err := tx.Exec("DELETE FROM assignments WHERE taskID = ? AND opID = ?", t.ID, t.opID); err != nil {
+func (t *Task) ClearAssignments(ctx context.Context, tx *sql.Tx) error {
+	defer t.opID.uncache()
+	if _, err := tx.ExecContext(ctx, "DELETE FROM assignments WHERE taskID = ? AND opID = ?", t.ID, t.opID); err != nil {
 		log.Error(err)
 		return err
 	}
 
 	// change "assigned" and "acknowledge" to "pending", leave "completed" alone
-	if _, err := tx.Exec("UPDATE task SET state = 'pending' WHERE ID = ? AND opID = ? AND state != 'completed'", t.ID, t.opID); err != nil {
+	if _, err := tx.ExecContext(ctx, "UPDATE task SET state = 'pending' WHERE ID = ? AND opID = ? AND state != 'completed'", t.ID, t.opID); err != nil {
 		log.Error(err)
 		return err
 	}
@@ -276,10 +309,10 @@ func (t *Task) ClearAssignments(tx *sql.Tx) error {
 }
 
 // IsAssignedTo checks to see if a task is assigned to a particular agent
-func (t *Task) IsAssignedTo(gid GoogleID) bool {
+func (t *Task) IsAssignedTo(ctx context.Context, gid GoogleID) bool {
 	var x int
 
-	err := db.QueryRow("SELECT COUNT(*) FROM assignments WHERE opID = ? AND taskID = ? AND gid = ?", t.opID, t.ID, gid).Scan(&x)
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM assignments WHERE opID = ? AND taskID = ? AND gid = ?", t.opID, t.ID, gid).Scan(&x)
 	if err != nil {
 		log.Error(err)
 		return false
@@ -287,13 +320,35 @@ func (t *Task) IsAssignedTo(gid GoogleID) bool {
 	return x == 1
 }
 
+// assignedTo checks the task's loaded assignments, IsAssignedTo asks the database
+func (t *Task) assignedTo(gid GoogleID) bool {
+	for _, a := range t.Assignments {
+		if a == gid {
+			return true
+		}
+	}
+	return false
+}
+
+// copy returns the task with its own assignment and depends lists, so cached tasks are not shared
+func (t Task) copy() Task {
+	t.Assignments = append([]GoogleID(nil), t.Assignments...)
+	t.DependsOn = append([]TaskID(nil), t.DependsOn...)
+	return t
+}
+
 // Claim assignes a task to the calling agent
-func (t *Task) Claim(gid GoogleID) error {
-	if _, err := db.Exec("INSERT IGNORE INTO assignments (opID, taskID, gid) VALUES (?,?,?)", t.opID, t.ID, gid); err != nil {
+func (t *Task) Claim(ctx context.Context, gid GoogleID) error {
+	return t.claim(ctx, db, gid)
+}
+
+func (t *Task) claim(ctx context.Context, x execer, gid GoogleID) error {
+	defer t.opID.uncache()
+	if _, err := x.ExecContext(ctx, "INSERT IGNORE INTO assignments (opID, taskID, gid) VALUES (?,?,?)", t.opID, t.ID, gid); err != nil {
 		log.Error(err)
 		return err
 	}
-	if _, err := db.Exec("UPDATE task SET state = 'acknowledged' WHERE ID = ? AND opID = ?", t.ID, t.opID); err != nil {
+	if _, err := x.ExecContext(ctx, "UPDATE task SET state = 'acknowledged' WHERE ID = ? AND opID = ?", t.ID, t.opID); err != nil {
 		log.Error(err)
 		return err
 	}
@@ -301,8 +356,13 @@ func (t *Task) Claim(gid GoogleID) error {
 }
 
 // Complete marks as task as completed
-func (t *Task) Complete() error {
-	if _, err := db.Exec("UPDATE task SET state = 'completed' WHERE ID = ? AND opID = ?", t.ID, t.opID); err != nil {
+func (t *Task) Complete(ctx context.Context) error {
+	return t.complete(ctx, db)
+}
+
+func (t *Task) complete(ctx context.Context, x execer) error {
+	defer t.opID.uncache()
+	if _, err := x.ExecContext(ctx, "UPDATE task SET state = 'completed' WHERE ID = ? AND opID = ?", t.ID, t.opID); err != nil {
 		log.Error(err)
 		return err
 	}
@@ -310,8 +370,13 @@ func (t *Task) Complete() error {
 }
 
 // Incomplete marks a task as not completed
-func (t *Task) Incomplete() error {
-	if _, err := db.Exec("UPDATE task SET state = 'assigned' WHERE ID = ? AND opID = ?", t.ID, t.opID); err != nil {
+func (t *Task) Incomplete(ctx context.Context) error {
+	return t.incomplete(ctx, db)
+}
+
+func (t *Task) incomplete(ctx context.Context, x execer) error {
+	defer t.opID.uncache()
+	if _, err := x.ExecContext(ctx, "UPDATE task SET state = 'assigned' WHERE ID = ? AND opID = ?", t.ID, t.opID); err != nil {
 		log.Error(err)
 		return err
 	}
@@ -319,8 +384,13 @@ func (t *Task) Incomplete() error {
 }
 
 // Acknowledge marks a task as acknowledged
-func (t *Task) Acknowledge() error {
-	if _, err := db.Exec("UPDATE task SET state = 'acknowledged' WHERE ID = ? AND opID = ?", t.ID, t.opID); err != nil {
+func (t *Task) Acknowledge(ctx context.Context) error {
+	return t.acknowledge(ctx, db)
+}
+
+func (t *Task) acknowledge(ctx context.Context, x execer) error {
+	defer t.opID.uncache()
+	if _, err := x.ExecContext(ctx, "UPDATE task SET state = 'acknowledged' WHERE ID = ? AND opID = ?", t.ID, t.opID); err != nil {
 		log.Error(err)
 		return err
 	}
@@ -328,21 +398,31 @@ func (t *Task) Acknowledge() error {
 }
 
 // Reject unassignes an agent from a task
-func (t *Task) Reject(gid GoogleID) error {
-	if _, err := db.Exec("UPDATE task SET state = 'pending' WHERE ID = ? AND opID = ?", t.ID, t.opID); err != nil {
+func (t *Task) Reject(ctx context.Context, gid GoogleID) error {
+	return t.reject(ctx, db, gid)
+}
+
+func (t *Task) reject(ctx context.Context, x execer, gid GoogleID) error {
+	defer t.opID.uncache()
+	if _, err := x.ExecContext(ctx, "UPDATE task SET state = 'pending' WHERE ID = ? AND opID = ?", t.ID, t.opID); err != nil {
 		log.Error(err)
 		return err
 	}
-	if _, err := db.Exec("DELETE FROM assignments WHERE opID = ? AND taskID = ? AND gid = ?", t.opID, t.ID, gid); err != nil {
+	if _, err := x.ExecContext(ctx, "DELETE FROM assignments WHERE opID = ? AND taskID = ? AND gid = ?", t.opID, t.ID, gid); err != nil {
 		log.Error(err)
 		return err
 	}
 	return nil
 }
 
-// SetDelta sets the DeltaMinutes of a link in an operation
-func (t *Task) SetDelta(delta int) error {
-	_, err := db.Exec("UPDATE link SET delta = ? WHERE ID = ? and opID = ?", delta, t.ID, t.opID)
+// SetDelta sets the DeltaMinutes of a task
+func (t *Task) SetDelta(ctx context.Context, delta int) error {
+	return t.setDelta(ctx, db, delta)
+}
+
+func (t *Task) setDelta(ctx context.Context, x execer, delta int) error {
+	defer t.opID.uncache()
+	_, err := x.ExecContext(ctx, "UPDATE task SET delta = ? WHERE ID = ? AND opID = ?", delta, t.ID, t.opID)
 	if err != nil {
 		log.Error(err)
 	}
@@ -350,10 +430,15 @@ func (t *Task) SetDelta(delta int) error {
 }
 
 // SetComment sets the comment on a task
-func (t *Task) SetComment(comment string) error {
+func (t *Task) SetComment(ctx context.Context, comment string) error {
+	return t.setComment(ctx, db, comment)
+}
+
+func (t *Task) setComment(ctx context.Context, x execer, comment string) error {
+	defer t.opID.uncache()
 	desc := makeNullString(util.Sanitize(comment))
 
-	_, err := db.Exec("UPDATE task SET comment = ? WHERE ID = ? AND opID = ?", desc, t.ID, t.opID)
+	_, err := x.ExecContext(ctx, "UPDATE task SET comment = ? WHERE ID = ? AND opID = ?", desc, t.ID, t.opID)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -362,8 +447,13 @@ func (t *Task) SetComment(comment string) error {
 }
 
 // SetZone updates the task's zone
-func (t *Task) SetZone(z Zone) error {
-	if _, err := db.Exec("UPDATE task SET zone = ? WHERE ID = ? AND opID = ?", z, t.ID, t.opID); err != nil {
+func (t *Task) SetZone(ctx context.Context, z Zone) error {
+	return t.setZone(ctx, db, z)
+}
+
+func (t *Task) setZone(ctx context.Context, x execer, z Zone) error {
+	defer t.opID.uncache()
+	if _, err := x.ExecContext(ctx, "UPDATE task SET zone = ? WHERE ID = ? AND opID = ?", z, t.ID, t.opID); err != nil {
 		log.Error(err)
 		return err
 	}
@@ -371,8 +461,13 @@ func (t *Task) SetZone(z Zone) error {
 }
 
 // SetOrder updates the task'sorder
-func (t *Task) SetOrder(order int16) error {
-	if _, err := db.Exec("UPDATE task SET order = ? WHERE ID = ? AND opID = ?", order, t.ID, t.opID); err != nil {
+func (t *Task) SetOrder(ctx context.Context, order int16) error {
+	return t.setOrder(ctx, db, order)
+}
+
+func (t *Task) setOrder(ctx context.Context, x execer, order int16) error {
+	defer t.opID.uncache()
+	if _, err := x.ExecContext(ctx, "UPDATE task SET taskorder = ? WHERE ID = ? AND opID = ?", order, t.ID, t.opID); err != nil {
 		log.Error(err)
 		return err
 	}
@@ -386,15 +481,15 @@ func (t *Task) GetOrder() int16 {
 
 // GetTask looks up and returns a populated Task from an id
 func (o *Operation) GetTask(taskID TaskID) (*Task, error) {
-	for _, m := range o.Markers {
-		if m.Task.ID == taskID {
-			return &m.Task, nil
+	for i := range o.Markers {
+		if o.Markers[i].Task.ID == taskID {
+			return &o.Markers[i].Task, nil
 		}
 	}
 
-	for _, l := range o.Links {
-		if l.Task.ID == taskID {
-			return &l.Task, nil
+	for i := range o.Links {
+		if o.Links[i].Task.ID == taskID {
+			return &o.Links[i].Task, nil
 		}
 	}
 
@@ -0,0 +1,192 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+)
+
+// TaskChange is one entry in a batch of task changes, which fields are used depends on Action
+type TaskChange struct {
+	Task        TaskID     `json:"task"`
+	Action      string     `json:"action"` // assign, state, zone, delta, order, comment, depends
+	Assignments []GoogleID `json:"assignments,omitempty"`
+	State       string     `json:"state,omitempty"` // claim, reject, complete, incomplete, acknowledge
+	Zone        Zone       `json:"zone,omitempty"`
+	Delta       int        `json:"delta,omitempty"`
+	Order       int16      `json:"order,omitempty"`
+	Comment     string     `json:"comment,omitempty"`
+	DependsOn   []TaskID   `json:"dependsOn,omitempty"`
+}
+
+// TaskChangeResult is the outcome of one TaskChange
+type TaskChangeResult struct {
+	Task   TaskID `json:"task"`
+	Action string `json:"action"`
+	Status string `json:"status"` // ok, error, or skipped when another entry failed and the batch was rolled back
+	Error  string `json:"error,omitempty"`
+}
+
+// ErrTaskBatchFailed is returned when any entry in a batch fails, none of the batch is applied
+const ErrTaskBatchFailed = "task batch not applied"
+
+// NeedsWrite reports if the change requires write access, state changes are open to agents who can see the task
+func (c *TaskChange) NeedsWrite() bool {
+	return c.Action != "state"
+}
+
+// check validates the change against the populated op, before anything is written
+func (c *TaskChange) check(o *Operation) (*Task, error) {
+	task, err := o.GetTask(c.Task)
+	if err != nil {
+		return task, err
+	}
+
+	switch c.Action {
+	case "assign", "delta", "order", "comment", "depends":
+	case "state":
+		switch c.State {
+		case "claim", "reject", "complete", "incomplete", "acknowledge":
+		default:
+			return task, fmt.Errorf("unknown task state: %s", c.State)
+		}
+	case "zone":
+		if !c.Zone.Valid() {
+			return task, fmt.Errorf("invalid zone: %d", c.Zone)
+		}
+	default:
+		return task, fmt.Errorf("unknown task action: %s", c.Action)
+	}
+	return task, nil
+}
+
+// apply makes the change within tx, agents newly assigned are added to assigned to be told once tx is committed
+func (c *TaskChange) apply(ctx context.Context, tx *sql.Tx, task *Task, gid GoogleID, assigned map[TaskID][]GoogleID) error {
+	switch c.Action {
+	case "assign":
+		added, err := task.setAssignments(ctx, c.Assignments, tx)
+		if err != nil {
+			return err
+		}
+		// an earlier entry for the task may have assigned agents this one removes
+		keep := make(map[GoogleID]bool)
+		for _, a := range c.Assignments {
+			keep[a] = true
+		}
+		var still []GoogleID
+		for _, a := range assigned[task.ID] {
+			if keep[a] {
+				still = append(still, a)
+			}
+		}
+		assigned[task.ID] = append(still, added...)
+		return nil
+	case "zone":
+		return task.setZone(ctx, tx, c.Zone)
+	case "delta":
+		return task.setDelta(ctx, tx, c.Delta)
+	case "order":
+		return task.setOrder(ctx, tx, c.Order)
+	case "comment":
+		return task.setComment(ctx, tx, c.Comment)
+	case "depends":
+		if len(c.DependsOn) == 0 {
+			// SetDepends leaves empty lists alone, here an empty list clears them
+			if _, err := tx.ExecContext(ctx, "DELETE FROM depends WHERE opID = ? AND taskID = ?", task.opID, task.ID); err != nil {
+				log.Error(err)
+				return err
+			}
+			return nil
+		}
+		return task.SetDepends(ctx, c.DependsOn, tx)
+	case "state":
+		switch c.State {
+		case "claim":
+			return task.claim(ctx, tx, gid)
+		case "reject":
+			return task.reject(ctx, tx, gid)
+		case "complete":
+			return task.complete(ctx, tx)
+		case "incomplete":
+			return task.incomplete(ctx, tx)
+		case "acknowledge":
+			return task.acknowledge(ctx, tx)
+		}
+	}
+	return fmt.Errorf("unknown task action: %s", c.Action)
+}
+
+// ApplyTaskChanges makes a batch of task changes in one transaction, either all are applied or none are
+// the op must be populated for gid; access checks are the caller's job
+// the caller should Touch the op once the batch succeeds
+func (o *Operation) ApplyTaskChanges(ctx context.Context, gid GoogleID, changes []TaskChange) ([]TaskChangeResult, error) {
+	defer o.ID.uncache()
+
+	results := make([]TaskChangeResult, len(changes))
+	tasks := make([]*Task, len(changes))
+	failed := false
+	for i := range changes {
+		results[i] = TaskChangeResult{Task: changes[i].Task, Action: changes[i].Action, Status: "ok"}
+		task, err := changes[i].check(o)
+		if err != nil {
+			results[i].Status = "error"
+			results[i].Error = err.Error()
+			failed = true
+			continue
+		}
+		tasks[i] = task
+	}
+	if failed {
+		skipRest(results)
+		return results, fmt.Errorf(ErrTaskBatchFailed)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Error(err)
+		skipRest(results)
+		return results, err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.Error(err)
+		}
+	}()
+
+	assigned := make(map[TaskID][]GoogleID)
+	for i := range changes {
+		if err := changes[i].apply(ctx, tx, tasks[i], gid, assigned); err != nil {
+			log.Errorw(err.Error(), "resource", o.ID, "task", changes[i].Task, "action", changes[i].Action)
+			results[i].Status = "error"
+			results[i].Error = err.Error()
+			skipRest(results)
+			return results, fmt.Errorf(ErrTaskBatchFailed)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error(err)
+		skipRest(results)
+		return results, err
+	}
+
+	// only now that the assignments are saved
+	for i := range changes {
+		if added, ok := assigned[changes[i].Task]; ok {
+			tasks[i].announceAssignments(ctx, added)
+			delete(assigned, changes[i].Task)
+		}
+	}
+	return results, nil
+}
+
+// skipRest marks every entry which did not fail as skipped, since the batch is not applied
+func skipRest(results []TaskChangeResult) {
+	for i := range results {
+		if results[i].Status != "error" {
+			results[i].Status = "skipped"
+		}
+	}
+}
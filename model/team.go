@@ -1,6 +1,7 @@
 package model
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strconv"
@@ -15,14 +16,20 @@ type TeamID string
 
 // TeamData is the wrapper type containing all the team info
 type TeamData struct {
-	Name          string       `json:"name"`
-	ID            TeamID       `json:"id"`
-	RocksComm     string       `json:"rc,omitempty"`
-	RocksKey      string       `json:"rk,omitempty"`
-	JoinLinkToken string       `json:"jlt,omitempty"`
-	TeamMembers   []TeamMember `json:"agents"`
-	VTeam         int64        `json:"vt,omitempty"`
-	VRole         int8         `json:"vr,omitempty"`
+	Name           string       `json:"name"`
+	ID             TeamID       `json:"id"`
+	RocksComm      string       `json:"rc,omitempty"`
+	RocksKey       string       `json:"rk,omitempty"`
+	JoinLinkToken  string       `json:"jlt,omitempty"`
+	TeamMembers    []TeamMember `json:"agents"`
+	VTeam          int64        `json:"vt,omitempty"`
+	VRole          int8         `json:"vr,omitempty"`
+	NeverRemove    bool         `json:"neverremove,omitempty"`
+	LastSync       string       `json:"lastsync,omitempty"`
+	LastSyncStatus string       `json:"lastsyncstatus,omitempty"`
+	RosterURL      string       `json:"rosterurl,omitempty"`
+	Parent         TeamID       `json:"parent,omitempty"`
+	Children       []TeamID     `json:"children,omitempty"`
 }
 
 // TeamMember is the light version of AgentData, containing visible information exported to teams
@@ -51,10 +58,10 @@ type TeamMember struct {
 }
 
 // AgentInTeam checks to see if a agent is in a team and enabled.
-func (gid GoogleID) AgentInTeam(team TeamID) (bool, error) {
+func (gid GoogleID) AgentInTeam(ctx context.Context, team TeamID) (bool, error) {
 	var count string
 
-	err := db.QueryRow("SELECT COUNT(*) FROM agentteams WHERE teamID = ? AND gid = ?", team, gid).Scan(&count)
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM agentteams WHERE teamID = ? AND gid = ?", team, gid).Scan(&count)
 	if err != nil {
 		return false, err
 	}
@@ -66,12 +73,12 @@ func (gid GoogleID) AgentInTeam(team TeamID) (bool, error) {
 }
 
 // FetchTeam populates an entire TeamData struct
-func (teamID TeamID) FetchTeam() (*TeamData, error) {
+func (teamID TeamID) FetchTeam(ctx context.Context) (*TeamData, error) {
 	var teamList TeamData
 	// var rows *sql.Rows
 
-	rows, err := db.Query("SELECT agentteams.gid, v.Agent, agent.IntelName, rocks.Agent, agentteams.comment, agentteams.shareLoc, Y(locations.loc), X(locations.loc), locations.upTime, v.Verified, v.Blacklisted, v.EnlID, rocks.verified, rocks.smurf, agentteams.sharewd, agentteams.loadwd, agent.intelfaction, agent.communityname, agent.picurl "+
-		" FROM agentteams JOIN team ON agentteams.teamID = team.teamID JOIN agent ON agentteams.gid = agent.gid JOIN locations ON agentteams.gid = locations.gid LEFT JOIN v ON agentteams.gid = v.gid LEFT JOIN rocks ON agentteams.gid = rocks.gid WHERE agentteams.teamID = ?", teamID)
+	rows, err := db.QueryContext(ctx, "SELECT agentteams.gid, v.Agent, agent.IntelName, rocks.Agent, agentteams.comment, agentteams.shareLoc, Y(locations.loc), X(locations.loc), locations.upTime, v.Verified, v.Blacklisted, v.EnlID, rocks.verified, rocks.smurf, agentteams.sharewd, agentteams.loadwd, agent.intelfaction, agent.communityname, agent.picurl "+
+		" FROM agentteams JOIN team ON agentteams.teamID = team.teamID JOIN agent ON agentteams.gid = agent.gid JOIN locations ON agentteams.gid = locations.gid LEFT JOIN v ON agentteams.gid = v.gid LEFT JOIN rocks ON agentteams.gid = rocks.gid WHERE agentteams.teamID = ? ORDER BY agentteams.gid", teamID)
 	if err != nil {
 		log.Error(err)
 		return &teamList, err
@@ -149,8 +156,8 @@ func (teamID TeamID) FetchTeam() (*TeamData, error) {
 		teamList.TeamMembers = append(teamList.TeamMembers, agent)
 	}
 
-	var rockscomm, rockskey, joinlinktoken sql.NullString
-	if err := db.QueryRow("SELECT name, rockscomm, rockskey, joinLinkToken, vteam, vrole FROM team WHERE teamID = ?", teamID).Scan(&teamList.Name, &rockscomm, &rockskey, &joinlinktoken, &teamList.VTeam, &teamList.VRole); err != nil {
+	var rockscomm, rockskey, joinlinktoken, lastsync, lastsyncstatus, rosterurl sql.NullString
+	if err := db.QueryRowContext(ctx, "SELECT name, rockscomm, rockskey, joinLinkToken, vteam, vrole, neverremove, lastsync, lastsyncstatus, rosterurl FROM team WHERE teamID = ?", teamID).Scan(&teamList.Name, &rockscomm, &rockskey, &joinlinktoken, &teamList.VTeam, &teamList.VRole, &teamList.NeverRemove, &lastsync, &lastsyncstatus, &rosterurl); err != nil {
 		log.Error(err)
 		return &teamList, err
 	}
@@ -164,15 +171,33 @@ func (teamID TeamID) FetchTeam() (*TeamData, error) {
 	if joinlinktoken.Valid {
 		teamList.JoinLinkToken = joinlinktoken.String
 	}
+	if lastsync.Valid {
+		teamList.LastSync = lastsync.String
+	}
+	if lastsyncstatus.Valid {
+		teamList.LastSyncStatus = lastsyncstatus.String
+	}
+	if rosterurl.Valid {
+		teamList.RosterURL = rosterurl.String
+	}
+
+	if teamList.Parent, err = teamID.Parent(ctx); err != nil {
+		log.Error(err)
+		return &teamList, err
+	}
+	if teamList.Children, err = teamID.Children(ctx); err != nil {
+		log.Error(err)
+		return &teamList, err
+	}
 
 	return &teamList, nil
 }
 
 // Owner returns the owner of the team
-func (teamID TeamID) Owner() (GoogleID, error) {
+func (teamID TeamID) Owner(ctx context.Context) (GoogleID, error) {
 	var owner GoogleID
 
-	err := db.QueryRow("SELECT owner FROM team WHERE teamID = ?", teamID).Scan(&owner)
+	err := db.QueryRowContext(ctx, "SELECT owner FROM team WHERE teamID = ?", teamID).Scan(&owner)
 	if err != nil && err == sql.ErrNoRows {
 		// log.Warnw("non-existent team ownership queried", "resource", teamID)
 		return "", nil
@@ -184,10 +209,10 @@ func (teamID TeamID) Owner() (GoogleID, error) {
 }
 
 // OwnsTeam returns true if the GoogleID owns the team identified by teamID
-func (gid GoogleID) OwnsTeam(teamID TeamID) (bool, error) {
+func (gid GoogleID) OwnsTeam(ctx context.Context, teamID TeamID) (bool, error) {
 	var count int
 
-	err := db.QueryRow("SELECT COUNT(*) FROM team WHERE teamID = ? AND owner = ?", teamID, gid).Scan(&count)
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM team WHERE teamID = ? AND owner = ?", teamID, gid).Scan(&count)
 	if err != nil {
 		return false, err
 	}
@@ -199,8 +224,8 @@ func (gid GoogleID) OwnsTeam(teamID TeamID) (bool, error) {
 
 // NewTeam initializes a new team and returns a teamID
 // the creating gid is added and enabled on that team by default
-func (gid GoogleID) NewTeam(name string) (TeamID, error) {
-	team, err := GenerateSafeName()
+func (gid GoogleID) NewTeam(ctx context.Context, name string) (TeamID, error) {
+	team, err := GenerateSafeName(ctx)
 	if err != nil {
 		log.Error(err)
 		return "", err
@@ -213,22 +238,23 @@ func (gid GoogleID) NewTeam(name string) (TeamID, error) {
 		name = team
 	}
 
-	_, err = db.Exec("INSERT INTO team (teamID, owner, name, rockskey, rockscomm, vteam, vrole) VALUES (?,?,?,NULL,NULL,0,0)", team, gid, name)
+	_, err = db.ExecContext(ctx, "INSERT INTO team (teamID, owner, name, rockskey, rockscomm, vteam, vrole) VALUES (?,?,?,NULL,NULL,0,0)", team, gid, name)
 	if err != nil {
 		log.Error(err)
 		return "", err
 	}
-	_, err = db.Exec("INSERT INTO agentteams (teamID, gid, shareLoc, comment, shareWD, loadWD) VALUES (?,?,0,'owner',0,0)", team, gid)
+	_, err = db.ExecContext(ctx, "INSERT INTO agentteams (teamID, gid, shareLoc, comment, shareWD, loadWD) VALUES (?,?,0,'owner',0,0)", team, gid)
 	if err != nil {
 		log.Error(err)
 		return TeamID(team), err
 	}
+	gid.touch(ctx)
 	return TeamID(team), nil
 }
 
 // Rename sets a new name for a teamID
 // does not check team ownership -- caller should take care of authorization
-func (teamID TeamID) Rename(name string) error {
+func (teamID TeamID) Rename(ctx context.Context, name string) error {
 	name = util.Sanitize(name)
 	if name == "" {
 		err := fmt.Errorf("empty name on rename")
@@ -236,7 +262,7 @@ func (teamID TeamID) Rename(name string) error {
 		return err
 	}
 
-	if _, err := db.Exec("UPDATE team SET name = ? WHERE teamID = ?", name, teamID); err != nil {
+	if _, err := db.ExecContext(ctx, "UPDATE team SET name = ? WHERE teamID = ?", name, teamID); err != nil {
 		log.Error(err)
 		return err
 	}
@@ -245,9 +271,9 @@ func (teamID TeamID) Rename(name string) error {
 
 // Delete removes the team identified by teamID
 // does not check team ownership -- caller should take care of authorization
-func (teamID TeamID) Delete() error {
+func (teamID TeamID) Delete(ctx context.Context) error {
 	// do them one-at-a-time to take care of rocks/v/firebase/telegram sync
-	rows, err := db.Query("SELECT gid FROM agentteams WHERE teamID = ?", teamID)
+	rows, err := db.QueryContext(ctx, "SELECT gid FROM agentteams WHERE teamID = ?", teamID)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -261,82 +287,89 @@ func (teamID TeamID) Delete() error {
 			log.Warn(err)
 			continue
 		}
-		err = teamID.RemoveAgent(gid)
+		err = teamID.RemoveAgent(ctx, gid)
 		if err != nil {
 			log.Warn(err)
 			continue
 		}
 	}
 
-	_, err = db.Exec("DELETE FROM permissions WHERE teamID = ?", teamID)
+	_, err = db.ExecContext(ctx, "DELETE FROM permissions WHERE teamID = ?", teamID)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
-	_, err = db.Exec("DELETE FROM team WHERE teamID = ?", teamID)
+
+	// the teamgroup rows go with the team, its parent and children lose it from their Children and Parent
+	parent, err := teamID.Parent(ctx)
+	if err != nil {
+		return err
+	}
+	children, err := teamID.Children(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, "DELETE FROM team WHERE teamID = ?", teamID)
 	if err != nil {
 		log.Warn(err)
 		return err
 	}
+	touchGroup(ctx, append(children, parent)...)
 	return nil
 }
 
 // AddAgent adds a agent to a team
-func (teamID TeamID) AddAgent(in AgentID) error {
-	gid, err := in.Gid()
+func (teamID TeamID) AddAgent(ctx context.Context, in AgentID) error {
+	gid, err := in.Gid(ctx)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
 
-	_, err = db.Exec("INSERT IGNORE INTO agentteams (teamID, gid, shareLoc, comment, shareWD, loadWD) VALUES (?, ?, 0, 'agents', 0, 0)", teamID, gid)
+	_, err = db.ExecContext(ctx, "INSERT IGNORE INTO agentteams (teamID, gid, shareLoc, comment, shareWD, loadWD) VALUES (?, ?, 0, 'agents', 0, 0)", teamID, gid)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
+	touchMembership(ctx, teamID, gid)
 
-	messaging.AddToRemote(messaging.GoogleID(gid), messaging.TeamID(teamID))
+	messaging.AddToRemote(ctx, messaging.GoogleID(gid), messaging.TeamID(teamID))
 	// log.Infow("adding agent to team", "GID", gid, "resource", teamID, "message", "adding agent to team")
 	return nil
 }
 
 // RemoveAgent removes a agent (identified by location share key, GoogleID, agent name, or EnlID) from a team.
-func (teamID TeamID) RemoveAgent(in AgentID) error {
-	gid, err := in.Gid()
+func (teamID TeamID) RemoveAgent(ctx context.Context, in AgentID) error {
+	gid, err := in.Gid(ctx)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
 
-	_, err = db.Exec("DELETE FROM agentteams WHERE teamID = ? AND gid = ?", teamID, gid)
+	_, err = db.ExecContext(ctx, "DELETE FROM agentteams WHERE teamID = ? AND gid = ?", teamID, gid)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
+	touchMembership(ctx, teamID, gid)
 
-	messaging.RemoveFromRemote(messaging.GoogleID(gid), messaging.TeamID(teamID))
+	messaging.RemoveFromRemote(ctx, messaging.GoogleID(gid), messaging.TeamID(teamID))
 
-	// instruct the agent to delete all associated ops
+	// instruct the agent to delete all associated ops, including those shared with parent teams
 	// this may get ops for which the agent has double-access, but they can just re-fetch them
-	rows, err := db.Query("SELECT opID FROM permissions WHERE teamID = ?", teamID)
-	if err != nil && err != sql.ErrNoRows {
+	perms, err := teamID.Operations(ctx)
+	if err != nil {
 		log.Error(err)
 		return err
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var opID OperationID
-		err = rows.Scan(&opID)
-		if err != nil {
-			log.Error(err)
-			// continue
-		}
-		messaging.AgentDeleteOperation(messaging.GoogleID(gid), messaging.OperationID(opID))
+	for _, p := range perms {
+		messaging.AgentDeleteOperation(ctx, messaging.GoogleID(gid), messaging.OperationID(p.OpID))
 	}
 
 	// remove this team from ops the agent owns
-	oprows, err := db.Query("SELECT ID FROM operation WHERE gid = ?", gid)
+	oprows, err := db.QueryContext(ctx, "SELECT ID FROM operation WHERE gid = ?", gid)
 	if err != nil && err != sql.ErrNoRows {
 		log.Error(err)
 		return err
@@ -351,7 +384,7 @@ func (teamID TeamID) RemoveAgent(in AgentID) error {
 			return err
 		}
 
-		if _, err := db.Exec("DELETE FROM permissions WHERE teamID = ? AND opID = ?", teamID, ID); err != nil {
+		if _, err := db.ExecContext(ctx, "DELETE FROM permissions WHERE teamID = ? AND opID = ?", teamID, ID); err != nil {
 			log.Error(err)
 			return err
 		}
@@ -362,14 +395,14 @@ func (teamID TeamID) RemoveAgent(in AgentID) error {
 
 // Chown changes a team's ownership
 // caller must verify permissions
-func (teamID TeamID) Chown(to AgentID) error {
-	gid, err := to.Gid()
+func (teamID TeamID) Chown(ctx context.Context, to AgentID) error {
+	gid, err := to.Gid(ctx)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
 
-	_, err = db.Exec("UPDATE team SET owner = ? WHERE teamID = ?", gid, teamID)
+	_, err = db.ExecContext(ctx, "UPDATE team SET owner = ? WHERE teamID = ?", gid, teamID)
 	if err != nil {
 		log.Error(err)
 		return (err)
@@ -382,47 +415,50 @@ func (teamID TeamID) String() string {
 }
 
 // SetTeamState updates the agent's shareLoc the team
-func (gid GoogleID) SetTeamState(teamID TeamID, state bool) error {
-	if _, err := db.Exec("UPDATE agentteams SET shareLoc = ? WHERE gid = ? AND teamID = ?", state, gid, teamID); err != nil {
+func (gid GoogleID) SetTeamState(ctx context.Context, teamID TeamID, state bool) error {
+	if _, err := db.ExecContext(ctx, "UPDATE agentteams SET shareLoc = ? WHERE gid = ? AND teamID = ?", state, gid, teamID); err != nil {
 		log.Error(err)
 		return err
 	}
+	touchMembership(ctx, teamID, gid)
 	return nil
 }
 
 // SetWDShare updates the agent's willingness to share WD keys with other agents on this team
-func (gid GoogleID) SetWDShare(teamID TeamID, state bool) error {
-	if _, err := db.Exec("UPDATE agentteams SET shareWD = ? WHERE gid = ? AND teamID = ?", state, gid, teamID); err != nil {
+func (gid GoogleID) SetWDShare(ctx context.Context, teamID TeamID, state bool) error {
+	if _, err := db.ExecContext(ctx, "UPDATE agentteams SET shareWD = ? WHERE gid = ? AND teamID = ?", state, gid, teamID); err != nil {
 		log.Error(err)
 		return err
 	}
+	touchMembership(ctx, teamID, gid)
 	return nil
 }
 
 // SetWDLoad updates the agent's desire to load WD keys from other agents on this team
-func (gid GoogleID) SetWDLoad(teamID TeamID, state bool) error {
-	if _, err := db.Exec("UPDATE agentteams SET loadWD = ? WHERE gid = ? AND teamID = ?", state, gid, teamID); err != nil {
+func (gid GoogleID) SetWDLoad(ctx context.Context, teamID TeamID, state bool) error {
+	if _, err := db.ExecContext(ctx, "UPDATE agentteams SET loadWD = ? WHERE gid = ? AND teamID = ?", state, gid, teamID); err != nil {
 		log.Error(err)
 		return err
 	}
+	touchMembership(ctx, teamID, gid)
 	return nil
 }
 
 // FetchAgent populates the minimal Agent struct with data anyone can see
-func FetchAgent(id AgentID, caller GoogleID) (*TeamMember, error) {
+func FetchAgent(ctx context.Context, id AgentID, caller GoogleID) (*TeamMember, error) {
 	var tm TeamMember
 
 	var vverified, vblacklisted, rocksverified, rockssmurf sql.NullBool
 	var level, enlID, vname, rocksname, intelname, communityname, picurl sql.NullString
 	var ifac IntelFaction
 
-	gid, err := id.Gid()
+	gid, err := id.Gid(ctx)
 	if err != nil {
 		log.Error(err)
 		return nil, err
 	}
 
-	if err = db.QueryRow("SELECT agent.gid, v.agent, rocks.agent, agent.intelname, agent.intelfaction, v.level, v.verified, v.blacklisted, v.enlid, rocks.verified, rocks.smurf, agent.communityname, agent.picurl FROM agent LEFT JOIN v ON agent.gid = v.gid LEFT JOIN rocks ON agent.gid = rocks.gid WHERE agent.gid = ?", gid).Scan(
+	if err = db.QueryRowContext(ctx, "SELECT agent.gid, v.agent, rocks.agent, agent.intelname, agent.intelfaction, v.level, v.verified, v.blacklisted, v.enlid, rocks.verified, rocks.smurf, agent.communityname, agent.picurl FROM agent LEFT JOIN v ON agent.gid = v.gid LEFT JOIN rocks ON agent.gid = rocks.gid WHERE agent.gid = ?", gid).Scan(
 		&tm.Gid, &vname, &rocksname, &intelname, &ifac, &level, &vverified, &vblacklisted, &enlID, &rocksverified, &rockssmurf, &communityname, &picurl); err != nil {
 		log.Error(err)
 		return nil, err
@@ -482,7 +518,7 @@ func FetchAgent(id AgentID, caller GoogleID) (*TeamMember, error) {
 
 	// XXX make this a distinct function?
 	var count int
-	if err = db.QueryRow("SELECT COUNT(*) FROM agentteams=x, agentteams=y WHERE x.gid = ? AND x.shareLoc = 1 AND y.gid = ?", id, caller).Scan(&count); err != nil {
+	if err = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM agentteams=x, agentteams=y WHERE x.gid = ? AND x.shareLoc = 1 AND y.gid = ?", id, caller).Scan(&count); err != nil {
 		log.Error(err)
 		return nil, err
 	}
@@ -493,7 +529,7 @@ func FetchAgent(id AgentID, caller GoogleID) (*TeamMember, error) {
 	}
 
 	var lat, lon string
-	if err = db.QueryRow("SELECT Y(loc), X(loc) FROM locations WHERE gid = ?", id).Scan(&lat, &lon); err != nil {
+	if err = db.QueryRowContext(ctx, "SELECT Y(loc), X(loc) FROM locations WHERE gid = ?", id).Scan(&lat, &lon); err != nil {
 		log.Error(err)
 		return nil, err
 	}
@@ -503,9 +539,9 @@ func FetchAgent(id AgentID, caller GoogleID) (*TeamMember, error) {
 }
 
 // Name returns a team's friendly name for a TeamID
-func (teamID TeamID) Name() (string, error) {
+func (teamID TeamID) Name(ctx context.Context) (string, error) {
 	var name string
-	err := db.QueryRow("SELECT name FROM team WHERE teamID = ?", teamID).Scan(&name)
+	err := db.QueryRowContext(ctx, "SELECT name FROM team WHERE teamID = ?", teamID).Scan(&name)
 	if err != nil {
 		log.Error(err)
 		return "", err
@@ -514,11 +550,11 @@ func (teamID TeamID) Name() (string, error) {
 }
 
 // teamList is used for getting a list of all an agent's teams
-func (gid GoogleID) teamList() []TeamID {
+func (gid GoogleID) teamList(ctx context.Context) []TeamID {
 	var tid TeamID
 	var x []TeamID
 
-	rows, err := db.Query("SELECT teamID FROM agentteams WHERE gid = ?", gid)
+	rows, err := db.QueryContext(ctx, "SELECT teamID FROM agentteams WHERE gid = ?", gid)
 	if err != nil {
 		log.Error(err)
 		return x
@@ -536,11 +572,11 @@ func (gid GoogleID) teamList() []TeamID {
 }
 
 // TeamListEnabled is used for getting a list of agent's enabled teams
-func (gid GoogleID) TeamListEnabled() []TeamID {
+func (gid GoogleID) TeamListEnabled(ctx context.Context) []TeamID {
 	var tid TeamID
 	var x []TeamID
 
-	rows, err := db.Query("SELECT teamID FROM agentteams WHERE gid = ? AND shareLoc = 1", gid)
+	rows, err := db.QueryContext(ctx, "SELECT teamID FROM agentteams WHERE gid = ? AND shareLoc = 1", gid)
 	if err != nil {
 		log.Error(err)
 		return x
@@ -558,26 +594,27 @@ func (gid GoogleID) TeamListEnabled() []TeamID {
 }
 
 // SetComment sets an agent's comment on a given team
-func (teamID TeamID) SetComment(gid GoogleID, comment string) error {
+func (teamID TeamID) SetComment(ctx context.Context, gid GoogleID, comment string) error {
 	c := makeNullString(util.Sanitize(comment))
 
-	_, err := db.Exec("UPDATE agentteams SET comment = ? WHERE teamID = ? AND gid = ?", c, teamID, gid)
+	_, err := db.ExecContext(ctx, "UPDATE agentteams SET comment = ? WHERE teamID = ? AND gid = ?", c, teamID, gid)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
+	touchMembership(ctx, teamID, gid)
 	return nil
 }
 
 // GenerateJoinToken sets a team's join link token
-func (teamID TeamID) GenerateJoinToken() (string, error) {
-	key, err := GenerateSafeName()
+func (teamID TeamID) GenerateJoinToken(ctx context.Context) (string, error) {
+	key, err := GenerateSafeName(ctx)
 	if err != nil {
 		log.Error(err)
 		return key, err
 	}
 
-	_, err = db.Exec("UPDATE team SET joinLinkToken = ? WHERE teamID = ?", key, teamID)
+	_, err = db.ExecContext(ctx, "UPDATE team SET joinLinkToken = ? WHERE teamID = ?", key, teamID)
 	if err != nil {
 		log.Error(err)
 		return key, err
@@ -586,8 +623,8 @@ func (teamID TeamID) GenerateJoinToken() (string, error) {
 }
 
 // DeleteJoinToken removes a team's join link token
-func (teamID TeamID) DeleteJoinToken() error {
-	_, err := db.Exec("UPDATE team SET joinLinkToken = NULL WHERE teamID = ?", teamID)
+func (teamID TeamID) DeleteJoinToken(ctx context.Context) error {
+	_, err := db.ExecContext(ctx, "UPDATE team SET joinLinkToken = NULL WHERE teamID = ?", teamID)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -596,10 +633,10 @@ func (teamID TeamID) DeleteJoinToken() error {
 }
 
 // JoinToken verifies a join link
-func (teamID TeamID) JoinToken(gid GoogleID, key string) error {
+func (teamID TeamID) JoinToken(ctx context.Context, gid GoogleID, key string) error {
 	var count string
 
-	err := db.QueryRow("SELECT COUNT(*) FROM team WHERE teamID = ? AND joinLinkToken= ?", teamID, key).Scan(&count)
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM team WHERE teamID = ? AND joinLinkToken= ?", teamID, key).Scan(&count)
 	if err != nil {
 		return err
 	}
@@ -614,11 +651,12 @@ func (teamID TeamID) JoinToken(gid GoogleID, key string) error {
 		return err
 	}
 
-	err = teamID.AddAgent(gid)
+	err = teamID.AddAgent(ctx, gid)
 	if err != nil {
 		return err
 	}
-	err = teamID.SetComment(gid, "joined via link")
+	teamID.AuditMembership(ctx, gid, AuditSourceJoinLink, gid, AuditActionAdd)
+	err = teamID.SetComment(ctx, gid, "joined via link")
 	if err != nil {
 		return err
 	}
@@ -626,32 +664,40 @@ func (teamID TeamID) JoinToken(gid GoogleID, key string) error {
 	return nil
 }
 
-func (teamID TeamID) FetchFBTokens() ([]string, error) {
+// FetchFBTokens returns the firebase tokens for every agent on the team and on any team below it
+func (teamID TeamID) FetchFBTokens(ctx context.Context) ([]string, error) {
 	var tokens []string
+	seen := make(map[string]bool)
 
-	rows, err := db.Query("SELECT firebase.token FROM agentteams JOIN firebase ON firebase.gid = agentteams.gid WHERE agentteams.teamID = ?", teamID)
-	if err != nil && err != sql.ErrNoRows {
-		log.Error(err)
-		return tokens, err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var token string
-		if err = rows.Scan(&token); err != nil {
+	for _, t := range teamID.WithDescendants(ctx) {
+		rows, err := db.QueryContext(ctx, "SELECT firebase.token FROM agentteams JOIN firebase ON firebase.gid = agentteams.gid WHERE agentteams.teamID = ?", t)
+		if err != nil && err != sql.ErrNoRows {
 			log.Error(err)
-			continue
+			return tokens, err
+		}
+
+		for rows.Next() {
+			var token string
+			if err = rows.Scan(&token); err != nil {
+				log.Error(err)
+				continue
+			}
+			if seen[token] {
+				continue
+			}
+			seen[token] = true
+			tokens = append(tokens, token)
 		}
-		tokens = append(tokens, token)
+		rows.Close()
 	}
 
 	return tokens, nil
 }
 
-func GetAllTeams() ([]TeamID, error) {
+func GetAllTeams(ctx context.Context) ([]TeamID, error) {
 	var teams []TeamID
 
-	rows, err := db.Query("SELECT DISTINCT teamID FROM team")
+	rows, err := db.QueryContext(ctx, "SELECT DISTINCT teamID FROM team")
 	if err != nil && err != sql.ErrNoRows {
 		log.Error(err)
 		return teams, err
@@ -671,10 +717,10 @@ func GetAllTeams() ([]TeamID, error) {
 }
 
 // Valid checks to see if team exists.
-func (teamID TeamID) Valid() bool {
+func (teamID TeamID) Valid(ctx context.Context) bool {
 	var i uint8
 
-	err := db.QueryRow("SELECT COUNT(*) FROM team WHERE teamID = ?", teamID).Scan(&i)
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM team WHERE teamID = ?", teamID).Scan(&i)
 	if err != nil || i != 1 {
 		return false
 	}
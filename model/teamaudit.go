@@ -0,0 +1,78 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+)
+
+// TeamAuditSource identifies the subsystem which changed a team's membership
+type TeamAuditSource string
+
+// the subsystems which add/remove agents from teams
+const (
+	AuditSourceOwner    TeamAuditSource = "owner"
+	AuditSourceSelf     TeamAuditSource = "self"
+	AuditSourceJoinLink TeamAuditSource = "joinlink"
+	AuditSourceV        TeamAuditSource = "v"
+	AuditSourceRocks    TeamAuditSource = "rocks"
+	AuditSourceTelegram TeamAuditSource = "telegram"
+	AuditSourceURL      TeamAuditSource = "url"
+	AuditSourceAdmin    TeamAuditSource = "admin" // a server administrator, actor is empty when done from the command line
+	AuditSourceRISC     TeamAuditSource = "risc"  // Google reported the account purged
+	AuditSourceMerge    TeamAuditSource = "merge" // the agent was merged into another
+)
+
+// the membership changes which are recorded
+const (
+	AuditActionAdd    = "add"
+	AuditActionRemove = "remove"
+)
+
+// TeamAuditEntry is a single team membership change
+type TeamAuditEntry struct {
+	Actor     GoogleID        `json:"actor,omitempty"`
+	Source    TeamAuditSource `json:"source"`
+	Agent     GoogleID        `json:"gid"`
+	Action    string          `json:"action"`
+	Timestamp string          `json:"timestamp"`
+}
+
+// maxTeamAuditEntries is the most entries returned by AuditLog
+const maxTeamAuditEntries = 1000
+
+// AuditMembership records a membership change on a team
+// actor is the agent responsible for the change, empty for changes made by external services
+// errors are logged but not returned, failing to record the change should not block the change
+func (teamID TeamID) AuditMembership(ctx context.Context, actor GoogleID, source TeamAuditSource, gid GoogleID, action string) {
+	if _, err := db.ExecContext(ctx, "INSERT INTO teamaudit (teamID, actor, source, gid, action) VALUES (?, ?, ?, ?, ?)", teamID, makeNullString(string(actor)), source, gid, action); err != nil {
+		log.Error(err)
+	}
+}
+
+// AuditLog returns the most recent membership changes for a team, newest first
+func (teamID TeamID) AuditLog(ctx context.Context) ([]TeamAuditEntry, error) {
+	var entries []TeamAuditEntry
+
+	rows, err := db.QueryContext(ctx, "SELECT actor, source, gid, action, timestamp FROM teamaudit WHERE teamID = ? ORDER BY timestamp DESC LIMIT ?", teamID, maxTeamAuditEntries)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error(err)
+		return entries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e TeamAuditEntry
+		var actor sql.NullString
+		if err := rows.Scan(&actor, &e.Source, &e.Agent, &e.Action, &e.Timestamp); err != nil {
+			log.Error(err)
+			continue
+		}
+		if actor.Valid {
+			e.Actor = GoogleID(actor.String)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
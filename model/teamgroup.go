@@ -0,0 +1,231 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+)
+
+// maxTeamGroupDepth limits how far the team hierarchy is walked, a safety net in case a loop sneaks into the table
+const maxTeamGroupDepth = 16
+
+// querier is what the hierarchy walks need from *sql.DB and *sql.Tx, so a transaction can see the hierarchy as it sees everything else
+type querier interface {
+	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
+}
+
+// Parent returns the parent team of a team, or "" if the team is not part of a group
+func (teamID TeamID) Parent(ctx context.Context) (TeamID, error) {
+	var parent TeamID
+
+	err := db.QueryRowContext(ctx, "SELECT parent FROM teamgroup WHERE child = ?", teamID).Scan(&parent)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error(err)
+		return "", err
+	}
+	return parent, nil
+}
+
+// SetParent places a team under a parent team, any op permissions granted to the parent (or its ancestors) apply to this team
+// does not check team ownership -- caller should take care of authorization
+func (teamID TeamID) SetParent(ctx context.Context, parent TeamID) error {
+	if parent == teamID {
+		err := fmt.Errorf(ErrTeamGroupLoop)
+		log.Warnw(err.Error(), "resource", teamID, "parent", parent)
+		return err
+	}
+
+	if !parent.Valid(ctx) {
+		err := fmt.Errorf("unknown parent team")
+		log.Warnw(err.Error(), "resource", teamID, "parent", parent)
+		return err
+	}
+
+	// the new parent cannot be one of this team's descendants
+	ancestors, err := parent.Ancestors(ctx)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	for _, a := range ancestors {
+		if a == teamID {
+			err := fmt.Errorf(ErrTeamGroupLoop)
+			log.Warnw(err.Error(), "resource", teamID, "parent", parent)
+			return err
+		}
+	}
+
+	old, err := teamID.Parent(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.ExecContext(ctx, "INSERT INTO teamgroup (child, parent) VALUES (?, ?) ON DUPLICATE KEY UPDATE parent = ?", teamID, parent, parent); err != nil {
+		log.Error(err)
+		return err
+	}
+	touchGroup(ctx, teamID, old, parent)
+	return nil
+}
+
+// ClearParent removes a team from its parent's group
+// does not check team ownership -- caller should take care of authorization
+func (teamID TeamID) ClearParent(ctx context.Context) error {
+	old, err := teamID.Parent(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.ExecContext(ctx, "DELETE FROM teamgroup WHERE child = ?", teamID); err != nil {
+		log.Error(err)
+		return err
+	}
+	touchGroup(ctx, teamID, old)
+	return nil
+}
+
+// touchGroup bumps the stamps of the teams whose Parent or Children changed
+// the ops the child's agents inherit are covered by GoogleID.Stamp walking the hierarchy
+func touchGroup(ctx context.Context, teams ...TeamID) {
+	for _, t := range teams {
+		if t != "" {
+			t.touch(ctx)
+		}
+	}
+}
+
+// Children returns the teams directly under this team
+func (teamID TeamID) Children(ctx context.Context) ([]TeamID, error) {
+	return teamID.children(ctx, db)
+}
+
+func (teamID TeamID) children(ctx context.Context, q querier) ([]TeamID, error) {
+	var children []TeamID
+
+	rows, err := q.QueryContext(ctx, "SELECT child FROM teamgroup WHERE parent = ?", teamID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error(err)
+		return children, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var child TeamID
+		if err := rows.Scan(&child); err != nil {
+			log.Error(err)
+			continue
+		}
+		children = append(children, child)
+	}
+	return children, nil
+}
+
+// Ancestors returns the parent, grandparent, etc. of a team, nearest first
+func (teamID TeamID) Ancestors(ctx context.Context) ([]TeamID, error) {
+	var ancestors []TeamID
+
+	current := teamID
+	for i := 0; i < maxTeamGroupDepth; i++ {
+		parent, err := current.Parent(ctx)
+		if err != nil {
+			return ancestors, err
+		}
+		if parent == "" || parent == teamID {
+			break
+		}
+		ancestors = append(ancestors, parent)
+		current = parent
+	}
+	return ancestors, nil
+}
+
+// Descendants returns every team below this team in the hierarchy
+func (teamID TeamID) Descendants(ctx context.Context) ([]TeamID, error) {
+	return teamID.descendants(ctx, db)
+}
+
+func (teamID TeamID) descendants(ctx context.Context, q querier) ([]TeamID, error) {
+	var descendants []TeamID
+	seen := map[TeamID]bool{teamID: true}
+
+	level := []TeamID{teamID}
+	for depth := 0; depth < maxTeamGroupDepth && len(level) > 0; depth++ {
+		var next []TeamID
+		for _, t := range level {
+			children, err := t.children(ctx, q)
+			if err != nil {
+				return descendants, err
+			}
+			for _, c := range children {
+				if seen[c] {
+					continue
+				}
+				seen[c] = true
+				descendants = append(descendants, c)
+				next = append(next, c)
+			}
+		}
+		level = next
+	}
+	return descendants, nil
+}
+
+// WithDescendants returns the team and all teams below it
+func (teamID TeamID) WithDescendants(ctx context.Context) []TeamID {
+	return teamID.withDescendants(ctx, db)
+}
+
+func (teamID TeamID) withDescendants(ctx context.Context, q querier) []TeamID {
+	teams := []TeamID{teamID}
+
+	descendants, err := teamID.descendants(ctx, q)
+	if err != nil {
+		log.Error(err)
+		return teams
+	}
+	return append(teams, descendants...)
+}
+
+// ExpandTeamGroups adds the descendants of each team to the list, removing duplicates
+func ExpandTeamGroups(ctx context.Context, teams []TeamID) []TeamID {
+	return expandTeamGroups(ctx, db, teams)
+}
+
+func expandTeamGroups(ctx context.Context, q querier, teams []TeamID) []TeamID {
+	var out []TeamID
+	seen := make(map[TeamID]bool)
+
+	for _, t := range teams {
+		for _, d := range t.withDescendants(ctx, q) {
+			if seen[d] {
+				continue
+			}
+			seen[d] = true
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// AgentInTeamGroup checks to see if an agent is in a team or any of the teams below it
+func (gid GoogleID) AgentInTeamGroup(ctx context.Context, teamID TeamID) (bool, error) {
+	teams := teamID.WithDescendants(ctx)
+
+	// one query for the whole tree rather than one per team
+	args := make([]interface{}, 0, len(teams)+1)
+	args = append(args, gid)
+	for _, t := range teams {
+		args = append(args, t)
+	}
+	in := strings.TrimSuffix(strings.Repeat("?,", len(teams)), ",")
+
+	var count int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM agentteams WHERE gid = ? AND teamID IN ("+in+")", args...).Scan(&count); err != nil {
+		log.Error(err)
+		return false, err
+	}
+	return count > 0, nil
+}
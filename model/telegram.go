@@ -1,6 +1,7 @@
 package model
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strconv"
@@ -13,11 +14,11 @@ import (
 type TelegramID int64
 
 // GidV returns a googleID/verified pair for a given telegram ID
-func (tgid TelegramID) GidV() (GoogleID, bool, error) {
+func (tgid TelegramID) GidV(ctx context.Context) (GoogleID, bool, error) {
 	var gid GoogleID
 	var verified bool
 
-	err := db.QueryRow("SELECT gid, verified FROM telegram WHERE telegramID = ?", tgid).Scan(&gid, &verified)
+	err := db.QueryRowContext(ctx, "SELECT gid, verified FROM telegram WHERE telegramID = ?", tgid).Scan(&gid, &verified)
 	if err != nil && err == sql.ErrNoRows {
 		return "", false, nil
 	}
@@ -29,8 +30,8 @@ func (tgid TelegramID) GidV() (GoogleID, bool, error) {
 }
 
 // Gid returns a verified GoogleID for a Telegram ID
-func (tgid TelegramID) Gid() (GoogleID, error) {
-	gid, v, err := tgid.GidV()
+func (tgid TelegramID) Gid(ctx context.Context) (GoogleID, error) {
+	gid, v, err := tgid.GidV(ctx)
 	if err != nil {
 		return "", err
 	}
@@ -41,10 +42,10 @@ func (tgid TelegramID) Gid() (GoogleID, error) {
 }
 
 // TelegramID returns a telegram ID number for a gid
-func (gid GoogleID) TelegramID() (TelegramID, error) {
+func (gid GoogleID) TelegramID(ctx context.Context) (TelegramID, error) {
 	var tgid TelegramID
 
-	err := db.QueryRow("SELECT telegramID FROM telegram WHERE gid = ?", gid).Scan(&tgid)
+	err := db.QueryRowContext(ctx, "SELECT telegramID FROM telegram WHERE gid = ?", gid).Scan(&tgid)
 	if err != nil && err == sql.ErrNoRows {
 		return 0, nil
 	}
@@ -56,10 +57,10 @@ func (gid GoogleID) TelegramID() (TelegramID, error) {
 }
 
 // TelegramName returns a telegram friendly name for a gid
-func (gid GoogleID) TelegramName() (string, error) {
+func (gid GoogleID) TelegramName(ctx context.Context) (string, error) {
 	var tgName sql.NullString
 
-	err := db.QueryRow("SELECT telegramName FROM telegram WHERE gid = ?", gid).Scan(&tgName)
+	err := db.QueryRowContext(ctx, "SELECT telegramName FROM telegram WHERE gid = ?", gid).Scan(&tgName)
 	if (err != nil && err == sql.ErrNoRows) || !tgName.Valid {
 		return "", nil
 	}
@@ -71,9 +72,9 @@ func (gid GoogleID) TelegramName() (string, error) {
 }
 
 // InitAgent establishes a new telegram user in the database and begins the verification process
-func (tgid TelegramID) InitAgent(name string, ott OneTimeToken) error {
+func (tgid TelegramID) InitAgent(ctx context.Context, name string, ott OneTimeToken) error {
 	authtoken := util.GenerateName()
-	gid, err := ott.Gid()
+	gid, err := ott.Gid(ctx)
 	if err != nil && err == sql.ErrNoRows {
 		err = fmt.Errorf("token not recognized")
 		log.Debugw(err.Error(), "resource", ott, "tgid", tgid, "name", name)
@@ -84,26 +85,29 @@ func (tgid TelegramID) InitAgent(name string, ott OneTimeToken) error {
 		return err
 	}
 
-	if _, err = db.Exec("INSERT INTO telegram (telegramID, telegramName, gid, verified, authtoken) VALUES (?, ?, ?, 0, ?)", tgid, name, gid, authtoken); err != nil {
+	if _, err = db.ExecContext(ctx, "INSERT INTO telegram (telegramID, telegramName, gid, verified, authtoken) VALUES (?, ?, ?, 0, ?)", tgid, name, gid, authtoken); err != nil {
 		log.Info(err)
 		return err
 	}
+	gid.touch(ctx)
 
 	return nil
 }
 
 // SetName is used to set an agent's telegram display name
-func (tgid TelegramID) SetName(name string) error {
-	if _, err := db.Exec("UPDATE telegram SET telegramName = ? WHERE telegramID = ?", name, tgid); err != nil {
+func (tgid TelegramID) SetName(ctx context.Context, name string) error {
+	if _, err := db.ExecContext(ctx, "UPDATE telegram SET telegramName = ? WHERE telegramID = ?", name, tgid); err != nil {
 		log.Info(err)
 		return err
 	}
+	tgid.touch(ctx)
 	return nil
 }
 
 // Delete is used to remove a TelegramID
-func (tgid TelegramID) Delete() error {
-	if _, err := db.Exec("DELETE FROM telegram WHERE telegramID = ?", tgid); err != nil {
+func (tgid TelegramID) Delete(ctx context.Context) error {
+	tgid.touch(ctx) // while the row is there to find the agent
+	if _, err := db.ExecContext(ctx, "DELETE FROM telegram WHERE telegramID = ?", tgid); err != nil {
 		log.Info(err)
 		return err
 	}
@@ -111,25 +115,27 @@ func (tgid TelegramID) Delete() error {
 }
 
 // SetTelegramID adds a verified agent's telegram ID
-func (gid GoogleID) SetTelegramID(tgid TelegramID, name string) error {
-	if _, err := db.Exec("INSERT INTO telegram (gid, telegramID, telegramName, verified) VALUES (?, ?, ?, 1)", gid, tgid, name); err != nil {
+func (gid GoogleID) SetTelegramID(ctx context.Context, tgid TelegramID, name string) error {
+	if _, err := db.ExecContext(ctx, "INSERT INTO telegram (gid, telegramID, telegramName, verified) VALUES (?, ?, ?, 1)", gid, tgid, name); err != nil {
 		log.Info(err)
 		return err
 	}
+	gid.touch(ctx)
 	return nil
 }
 
 // RemoveTelegramID clears any telegram configuration for a given agent
-func (gid GoogleID) RemoveTelegramID() error {
-	if _, err := db.Exec("DELETE FROM telegram WHERE gid = ?", gid); err != nil {
+func (gid GoogleID) RemoveTelegramID(ctx context.Context) error {
+	if _, err := db.ExecContext(ctx, "DELETE FROM telegram WHERE gid = ?", gid); err != nil {
 		return err
 	}
+	gid.touch(ctx)
 	return nil
 }
 
 // VerifyAgent is the second stage of the verication process
-func (tgid TelegramID) VerifyAgent(authtoken string) error {
-	res, err := db.Exec("UPDATE telegram SET authtoken = NULL, verified = 1 WHERE telegramID = ? AND authtoken = ?", tgid, authtoken)
+func (tgid TelegramID) VerifyAgent(ctx context.Context, authtoken string) error {
+	res, err := db.ExecContext(ctx, "UPDATE telegram SET authtoken = NULL, verified = 1 WHERE telegramID = ? AND authtoken = ?", tgid, authtoken)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -146,16 +152,18 @@ func (tgid TelegramID) VerifyAgent(authtoken string) error {
 		return err
 	} // trust the primary key prevents i > 1
 
+	tgid.touch(ctx)
 	return nil
 }
 
 // UnverifyAgent marks an ID as unverified (if the agent blocks the bot)
-func (tgid TelegramID) UnverifyAgent() error {
-	_, err := db.Exec("UPDATE telegram SET verified = 0 WHERE telegramID = ?", tgid)
+func (tgid TelegramID) UnverifyAgent(ctx context.Context) error {
+	_, err := db.ExecContext(ctx, "UPDATE telegram SET verified = 0 WHERE telegramID = ?", tgid)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
+	tgid.touch(ctx)
 	return nil
 }
 
@@ -167,11 +175,11 @@ func (tgid TelegramID) String() string {
 // LinkToTelegramChat associates a telegram chat ID with the team, performs authorization
 // a chat can be linked to a single team
 // a team can be linked to a single chat (irrespective of opID)
-func (teamID TeamID) LinkToTelegramChat(chat TelegramID, opID OperationID) error {
+func (teamID TeamID) LinkToTelegramChat(ctx context.Context, chat TelegramID, opID OperationID) error {
 	log.Debugw("linking team to chat", "chat", chat, "teamID", teamID, "opID", opID)
 
 	// REPLACE OK SCB
-	_, err := db.Exec("REPLACE INTO telegramteam (teamID, telegram, opID) VALUES (?,?,?)", teamID, chat, makeNullString(string(opID)))
+	_, err := db.ExecContext(ctx, "REPLACE INTO telegramteam (teamID, telegram, opID) VALUES (?,?,?)", teamID, chat, makeNullString(string(opID)))
 	if err != nil {
 		log.Error(err)
 		return err
@@ -180,8 +188,8 @@ func (teamID TeamID) LinkToTelegramChat(chat TelegramID, opID OperationID) error
 }
 
 // UnlinkFromTelegramChat disassociates a telegram chat ID from the team -- not authenticated since bot removal from chat is enough
-func (teamID TeamID) UnlinkFromTelegramChat() error {
-	_, err := db.Exec("DELETE FROM telegramteam WHERE teamID = ?", teamID)
+func (teamID TeamID) UnlinkFromTelegramChat(ctx context.Context) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM telegramteam WHERE teamID = ?", teamID)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -192,10 +200,10 @@ func (teamID TeamID) UnlinkFromTelegramChat() error {
 }
 
 // TelegramChat returns the associated telegram chat ID for this team, if any
-func (teamID TeamID) TelegramChat() (int64, error) {
+func (teamID TeamID) TelegramChat(ctx context.Context) (int64, error) {
 	var chatID int64
 
-	err := db.QueryRow("SELECT telegram FROM telegramteam WHERE teamID = ?", teamID).Scan(&chatID)
+	err := db.QueryRowContext(ctx, "SELECT telegram FROM telegramteam WHERE teamID = ?", teamID).Scan(&chatID)
 	if err != nil && err != sql.ErrNoRows {
 		log.Error(err)
 		return chatID, err
@@ -204,12 +212,12 @@ func (teamID TeamID) TelegramChat() (int64, error) {
 }
 
 // ChatToTeam takes a chatID and returns a linked teamID
-func ChatToTeam(chat int64) (TeamID, OperationID, error) {
+func ChatToTeam(ctx context.Context, chat int64) (TeamID, OperationID, error) {
 	var t TeamID
 	var o OperationID
 	var on sql.NullString
 
-	err := db.QueryRow("SELECT teamID, opID FROM telegramteam WHERE telegram = ?", chat).Scan(&t, &on)
+	err := db.QueryRowContext(ctx, "SELECT teamID, opID FROM telegramteam WHERE telegram = ?", chat).Scan(&t, &on)
 	if err != nil && err != sql.ErrNoRows {
 		log.Error(err)
 		return t, o, err
@@ -225,8 +233,8 @@ func ChatToTeam(chat int64) (TeamID, OperationID, error) {
 }
 
 // AddToChatMemberList notes a telegramID has been seen in a given telegram chat
-func AddToChatMemberList(agent TelegramID, chat TelegramID) error {
-	if _, err := db.Exec("INSERT IGNORE INTO telegramchatmembers (agent, chat) VALUES (?, ?)", agent, chat); err != nil {
+func AddToChatMemberList(ctx context.Context, agent TelegramID, chat TelegramID) error {
+	if _, err := db.ExecContext(ctx, "INSERT IGNORE INTO telegramchatmembers (agent, chat) VALUES (?, ?)", agent, chat); err != nil {
 		// log.Debug(err) // foreign key errors due to chat not being linked can be ignored
 		return err
 	}
@@ -234,10 +242,10 @@ func AddToChatMemberList(agent TelegramID, chat TelegramID) error {
 }
 
 // IsChatMember reports if a given telegramID has been seen in a given telegram chat
-func IsChatMember(agent TelegramID, chat TelegramID) bool {
+func IsChatMember(ctx context.Context, agent TelegramID, chat TelegramID) bool {
 	var i bool
 
-	err := db.QueryRow("SELECT COUNT(*) FROM telegramchatmembers WHERE agent = ? AND chat = ?", agent, chat).Scan(&i)
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM telegramchatmembers WHERE agent = ? AND chat = ?", agent, chat).Scan(&i)
 	if err != nil {
 		return false
 	}
@@ -245,8 +253,8 @@ func IsChatMember(agent TelegramID, chat TelegramID) bool {
 }
 
 // RemoveFromChatMemberList removes the agent from the list for the telegram chat
-func RemoveFromChatMemberList(agent TelegramID, chat TelegramID) error {
-	if _, err := db.Exec("DELETE FROM telegramchatmembers WHERE agent=? AND chat=?", agent, chat); err != nil {
+func RemoveFromChatMemberList(ctx context.Context, agent TelegramID, chat TelegramID) error {
+	if _, err := db.ExecContext(ctx, "DELETE FROM telegramchatmembers WHERE agent=? AND chat=?", agent, chat); err != nil {
 		log.Error(err)
 		return err
 	}
@@ -254,10 +262,10 @@ func RemoveFromChatMemberList(agent TelegramID, chat TelegramID) error {
 }
 
 // GetAllTelegramIDs is used by the telegram cleanup function
-func GetAllTelegramIDs() ([]TelegramID, error) {
+func GetAllTelegramIDs(ctx context.Context) ([]TelegramID, error) {
 	var tgs []TelegramID
 
-	rows, err := db.Query("SELECT telegramID FROM telegram")
+	rows, err := db.QueryContext(ctx, "SELECT telegramID FROM telegram")
 	if err != nil {
 		log.Error(err)
 		return tgs, err
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/wasabee-project/Wasabee-Server/log"
@@ -8,7 +9,7 @@ import (
 )
 
 // GenerateSafeName generates a slug (like GenerateName()) that doesn't exist in the database yet.
-func GenerateSafeName() (string, error) {
+func GenerateSafeName(ctx context.Context) (string, error) {
 	name := ""
 	rows := 1
 
@@ -19,17 +20,17 @@ func GenerateSafeName() (string, error) {
 			err := fmt.Errorf(ErrNameGenFailed)
 			return "", err
 		}
-		err := db.QueryRow("SELECT COUNT(OneTimeToken) FROM agent WHERE OneTimeToken = ?", name).Scan(&i)
+		err := db.QueryRowContext(ctx, "SELECT COUNT(OneTimeToken) FROM agent WHERE OneTimeToken = ?", name).Scan(&i)
 		if err != nil {
 			return "", err
 		}
 		total = i
-		err = db.QueryRow("SELECT COUNT(teamID) FROM team WHERE teamID = ?", name).Scan(&i)
+		err = db.QueryRowContext(ctx, "SELECT COUNT(teamID) FROM team WHERE teamID = ?", name).Scan(&i)
 		if err != nil {
 			return "", err
 		}
 		total += i
-		err = db.QueryRow("SELECT COUNT(joinLinkToken) FROM team WHERE joinLinkToken = ?", name).Scan(&i)
+		err = db.QueryRowContext(ctx, "SELECT COUNT(joinLinkToken) FROM team WHERE joinLinkToken = ?", name).Scan(&i)
 		if err != nil {
 			return "", err
 		}
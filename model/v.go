@@ -1,6 +1,7 @@
 package model
 
 import (
+	"context"
 	"database/sql"
 	"time"
 
@@ -36,7 +37,7 @@ type VAgent struct {
 }
 
 // VToDB updates the database to reflect an agent's current status at V.
-func VToDB(a *VAgent) error {
+func VToDB(ctx context.Context, a *VAgent) error {
 	if a.Agent == "" {
 		return nil
 	}
@@ -48,22 +49,23 @@ func VToDB(a *VAgent) error {
 	// telegram, startlat, startlon, distance, fetched are not set on the "trust" API call.
 	// use ON DUPLICATE so as to not overwrite apikey or telegram
 	// TODO: prune fields we will never use or that V never sends
-	_, err := db.Exec("INSERT INTO v (enlid, gid, vlevel, vpoints, agent, level, quarantine, active, blacklisted, verified, flagged, banned, cellid, startlat, startlon, distance, fetched) VALUES (?,?,?,?,LEFT(?,15),?,?,?,?,?,?,?,?,?,?,?,UTC_TIMESTAMP()) ON DUPLICATE KEY UPDATE agent=LEFT(?, 15), quarantine=?, blacklisted=?, verified=?, flagged=?, banned=?, fetched=UTC_TIMESTAMP()",
+	_, err := db.ExecContext(ctx, "INSERT INTO v (enlid, gid, vlevel, vpoints, agent, level, quarantine, active, blacklisted, verified, flagged, banned, cellid, startlat, startlon, distance, fetched) VALUES (?,?,?,?,LEFT(?,15),?,?,?,?,?,?,?,?,?,?,?,UTC_TIMESTAMP()) ON DUPLICATE KEY UPDATE agent=LEFT(?, 15), quarantine=?, blacklisted=?, verified=?, flagged=?, banned=?, fetched=UTC_TIMESTAMP()",
 		a.EnlID, a.Gid, a.Vlevel, a.Vpoints, a.Agent, a.Level, a.Quarantine, a.Active, a.Blacklisted, a.Verified, a.Flagged, a.Banned, a.CellID, a.StartLat, a.StartLon, a.Distance,
 		a.Agent, a.Quarantine, a.Blacklisted, a.Verified, a.Flagged, a.Banned)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
+	a.Gid.touch(ctx)
 
 	if a.TelegramID != 0 {
-		existing, err := a.Gid.TelegramID()
+		existing, err := a.Gid.TelegramID(ctx)
 		if err != nil {
 			log.Error(err)
 			return err
 		}
 		if existing == 0 {
-			err := a.Gid.SetTelegramID(TelegramID(a.TelegramID), a.Telegram)
+			err := a.Gid.SetTelegramID(ctx, TelegramID(a.TelegramID), a.Telegram)
 			if err != nil {
 				log.Error(err)
 				return err
@@ -75,7 +77,7 @@ func VToDB(a *VAgent) error {
 }
 
 // VFromDB pulls a V agent from the database
-func VFromDB(gid GoogleID) (*VAgent, time.Time, error) {
+func VFromDB(ctx context.Context, gid GoogleID) (*VAgent, time.Time, error) {
 	a := VAgent{
 		Gid: gid,
 	}
@@ -85,7 +87,7 @@ func VFromDB(gid GoogleID) (*VAgent, time.Time, error) {
 	var telegram, cellid sql.NullString
 	var startlat, startlon sql.NullFloat64
 
-	err := db.QueryRow("SELECT enlid, vlevel, vpoints, agent, level, quarantine, active, blacklisted, verified, flagged, banned, cellid, telegram, startlat, startlon, distance, fetched FROM v WHERE gid = ?", gid).Scan(&a.EnlID, &vlevel, &vpoints, &a.Agent, &a.Level, &a.Quarantine, &a.Active, &a.Blacklisted, &a.Verified, &a.Flagged, &a.Banned, &cellid, &telegram, &startlat, &startlon, &distance, &fetched)
+	err := db.QueryRowContext(ctx, "SELECT enlid, vlevel, vpoints, agent, level, quarantine, active, blacklisted, verified, flagged, banned, cellid, telegram, startlat, startlon, distance, fetched FROM v WHERE gid = ?", gid).Scan(&a.EnlID, &vlevel, &vpoints, &a.Agent, &a.Level, &a.Quarantine, &a.Active, &a.Blacklisted, &a.Verified, &a.Flagged, &a.Banned, &cellid, &telegram, &startlat, &startlon, &distance, &fetched)
 	if err != nil && err != sql.ErrNoRows {
 		log.Error(err)
 		return &a, t, err
@@ -131,10 +133,10 @@ func VFromDB(gid GoogleID) (*VAgent, time.Time, error) {
 }
 
 // VTeam returns the V team/role pair for a Wasabee team
-func (teamID TeamID) VTeam() (int64, uint8, error) {
+func (teamID TeamID) VTeam(ctx context.Context) (int64, uint8, error) {
 	var team int64
 	var role uint8
-	err := db.QueryRow("SELECT vteam, vrole FROM team WHERE teamID = ?", teamID).Scan(&team, &role)
+	err := db.QueryRowContext(ctx, "SELECT vteam, vrole FROM team WHERE teamID = ?", teamID).Scan(&team, &role)
 	if err != nil {
 		log.Error(err)
 		return 0, 0, err
@@ -143,10 +145,10 @@ func (teamID TeamID) VTeam() (int64, uint8, error) {
 }
 
 // GetTeamsByVID returns all wasabee teams which match the V team ID
-func GetTeamsByVID(v int64) ([]TeamID, error) {
+func GetTeamsByVID(ctx context.Context, v int64) ([]TeamID, error) {
 	var teams []TeamID
 
-	row, err := db.Query("SELECT teamID FROM team WHERE vteam = ?", v)
+	row, err := db.QueryContext(ctx, "SELECT teamID FROM team WHERE vteam = ?", v)
 	if err != nil {
 		log.Error(err)
 		return teams, err
@@ -166,9 +168,9 @@ func GetTeamsByVID(v int64) ([]TeamID, error) {
 }
 
 // VTeamExists checks if a v-team/role pair exists for a specific googleID
-func VTeamExists(vteam int64, vrole uint8, gid GoogleID) (bool, error) {
+func VTeamExists(ctx context.Context, vteam int64, vrole uint8, gid GoogleID) (bool, error) {
 	i := false
-	err := db.QueryRow("SELECT COUNT(*) FROM team WHERE vteam = ? AND vrole = ? AND owner = ?", vteam, vrole, gid).Scan(&i)
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM team WHERE vteam = ? AND vrole = ? AND owner = ?", vteam, vrole, gid).Scan(&i)
 	if err != nil {
 		log.Error(err)
 		return i, err
@@ -177,10 +179,10 @@ func VTeamExists(vteam int64, vrole uint8, gid GoogleID) (bool, error) {
 }
 
 // VConfigure sets V connection for a Wasabee team -- caller should verify ownership
-func (teamID TeamID) VConfigure(vteam int64, role uint8) error {
+func (teamID TeamID) VConfigure(ctx context.Context, vteam int64, role uint8) error {
 	log.Infow("linking team to V", "teamID", teamID, "vteam", vteam, "role", role)
 
-	if _, err := db.Exec("UPDATE team SET vteam = ?, vrole = ? WHERE teamID = ?", vteam, role, teamID); err != nil {
+	if _, err := db.ExecContext(ctx, "UPDATE team SET vteam = ?, vrole = ? WHERE teamID = ?", vteam, role, teamID); err != nil {
 		log.Error(err)
 		return err
 	}
@@ -188,10 +190,10 @@ func (teamID TeamID) VConfigure(vteam int64, role uint8) error {
 }
 
 // GetGIDFromEnlID looks up an agent's GoogleID by V EnlID
-func GetGIDFromEnlID(enlid string) (GoogleID, error) {
+func GetGIDFromEnlID(ctx context.Context, enlid string) (GoogleID, error) {
 	var gid GoogleID
 
-	err := db.QueryRow("SELECT gid FROM v WHERE enlid = ?", enlid).Scan(&gid)
+	err := db.QueryRowContext(ctx, "SELECT gid FROM v WHERE enlid = ?", enlid).Scan(&gid)
 	if err != nil && err != sql.ErrNoRows {
 		log.Error(err)
 		return gid, err
@@ -200,10 +202,10 @@ func GetGIDFromEnlID(enlid string) (GoogleID, error) {
 }
 
 // GetVAPIkey (gid GoogleID) loads an agents's V API key (this should be unusual); "" is "not set"
-func (gid GoogleID) GetVAPIkey() (string, error) {
+func (gid GoogleID) GetVAPIkey(ctx context.Context) (string, error) {
 	var v sql.NullString
 
-	err := db.QueryRow("SELECT VAPIkey FROM v WHERE GID = ?", gid).Scan(&v)
+	err := db.QueryRowContext(ctx, "SELECT VAPIkey FROM v WHERE GID = ?", gid).Scan(&v)
 	if err != nil {
 		log.Error(err)
 		return "", nil
@@ -215,10 +217,11 @@ func (gid GoogleID) GetVAPIkey() (string, error) {
 }
 
 // SetVAPIkey stores an agent's V API key (this should be unusual)
-func (gid GoogleID) SetVAPIkey(key string) error {
-	if _, err := db.Exec("UPDATE v SET vapikey=? WHERE gid =? ", key, gid); err != nil {
+func (gid GoogleID) SetVAPIkey(ctx context.Context, key string) error {
+	if _, err := db.ExecContext(ctx, "UPDATE v SET vapikey=? WHERE gid =? ", key, gid); err != nil {
 		log.Error(err)
 		return err
 	}
+	gid.touch(ctx)
 	return nil
 }
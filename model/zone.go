@@ -1,6 +1,7 @@
 package model
 
 import (
+	"context"
 	"database/sql"
 	"strconv"
 
@@ -81,15 +82,15 @@ func defaultZones() []ZoneListElement {
 	}
 }
 
-func (o *Operation) insertZone(z ZoneListElement, tx *sql.Tx) error {
-	_, err := tx.Exec("REPLACE INTO zone (ID, opID, name, color) VALUES (?, ?, ?, ?)", z.Zone, o.ID, z.Name, z.Color) // REPLACE OK SCB
+func (o *Operation) insertZone(ctx context.Context, z ZoneListElement, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, "REPLACE INTO zone (ID, opID, name, color) VALUES (?, ?, ?, ?)", z.Zone, o.ID, z.Name, z.Color) // REPLACE OK SCB
 	if err != nil {
 		log.Error(err)
 		return err
 	}
 
 	// don't be too smart, just delete and re-add the points
-	_, err = tx.Exec("DELETE FROM zonepoints WHERE opID = ? AND zoneID = ?", o.ID, z.Zone)
+	_, err = tx.ExecContext(ctx, "DELETE FROM zonepoints WHERE opID = ? AND zoneID = ?", o.ID, z.Zone)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -97,7 +98,7 @@ func (o *Operation) insertZone(z ZoneListElement, tx *sql.Tx) error {
 
 	for _, p := range z.Points {
 		// log.Debug("inserting point", "pos", p.Position, "zone", z.Zone, "op", o.ID)
-		_, err := tx.Exec("INSERT INTO zonepoints (zoneID, opID, position, point) VALUES (?, ?, ?, POINT(?, ?))", z.Zone, o.ID, p.Position, p.Lat, p.Lon)
+		_, err := tx.ExecContext(ctx, "INSERT INTO zonepoints (zoneID, opID, position, point) VALUES (?, ?, ?, POINT(?, ?))", z.Zone, o.ID, p.Position, p.Lat, p.Lon)
 		if err != nil {
 			log.Error(err)
 			return err
@@ -106,8 +107,8 @@ func (o *Operation) insertZone(z ZoneListElement, tx *sql.Tx) error {
 	return nil
 }
 
-func (o *Operation) populateZones() error {
-	rows, err := db.Query("SELECT ID, name, color FROM zone WHERE opID = ?", o.ID)
+func (o *Operation) populateZones(ctx context.Context) error {
+	rows, err := db.QueryContext(ctx, "SELECT ID, name, color FROM zone WHERE opID = ?", o.ID)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -121,7 +122,7 @@ func (o *Operation) populateZones() error {
 			continue
 		}
 
-		pointrows, err := db.Query("SELECT position, X(point), Y(point) FROM zonepoints WHERE opID = ? AND zoneID = ?", o.ID, tmpZone.Zone)
+		pointrows, err := db.QueryContext(ctx, "SELECT position, X(point), Y(point) FROM zonepoints WHERE opID = ? AND zoneID = ?", o.ID, tmpZone.Zone)
 		if err != nil {
 			log.Error(err)
 			continue
@@ -148,13 +149,13 @@ func (o *Operation) populateZones() error {
 	return nil
 }
 
-func (o OperationID) deleteZone(z Zone, tx *sql.Tx) error {
-	if _, err := tx.Exec("DELETE FROM zonepoints WHERE opID = ? AND zoneID = ?", o, z); err != nil {
+func (o OperationID) deleteZone(ctx context.Context, z Zone, tx *sql.Tx) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM zonepoints WHERE opID = ? AND zoneID = ?", o, z); err != nil {
 		log.Error(err)
 		// return err
 	}
 
-	if _, err := tx.Exec("DELETE FROM zone WHERE opID = ? AND ID = ?", o, z); err != nil {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM zone WHERE opID = ? AND ID = ?", o, z); err != nil {
 		log.Error(err)
 		return err
 	}
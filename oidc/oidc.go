@@ -0,0 +1,268 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"golang.org/x/oauth2"
+
+	"github.com/wasabee-project/Wasabee-Server/config"
+	"github.com/wasabee-project/Wasabee-Server/log"
+)
+
+// Provider is a configured OpenID Connect identity provider
+type Provider struct {
+	cfg       config.OIDCProvider
+	discovery discovery
+	keys      *jwk.Cache
+	oauth     *oauth2.Config
+}
+
+// discovery is the part of the issuer's openid-configuration we use
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Identity is what the provider tells us about the agent
+type Identity struct {
+	Provider string
+	Subject  string
+	Name     string
+	Picture  string
+}
+
+const discoveryTimeout = 10 * time.Second
+
+var providers = struct {
+	sync.RWMutex
+	m map[string]*Provider
+}{m: make(map[string]*Provider)}
+
+// Start sets up the configured providers
+func Start(ctx context.Context) {
+	c := config.Get()
+
+	for _, cfg := range c.OIDC {
+		if cfg.RedirectURL == "" {
+			cfg.RedirectURL = strings.TrimSuffix(c.HTTP.Webroot, "/") + "/oidc/" + cfg.Name + "/callback"
+		}
+		p, err := New(ctx, cfg)
+		if err != nil {
+			log.Errorw("OIDC provider not started", "provider", cfg.Name, "error", err.Error())
+			continue
+		}
+		providers.Lock()
+		providers.m[cfg.Name] = p
+		providers.Unlock()
+		log.Infow("startup", "message", "OIDC provider configured", "provider", cfg.Name, "issuer", cfg.Issuer)
+	}
+
+	<-ctx.Done()
+	log.Infow("shutdown", "message", "oidc shutting down")
+}
+
+// New reads the issuer's discovery document and prepares to verify its tokens
+func New(ctx context.Context, cfg config.OIDCProvider) (*Provider, error) {
+	if cfg.Name == "" || cfg.Issuer == "" || cfg.ClientID == "" {
+		return nil, fmt.Errorf("OIDC provider requires Name, Issuer and ClientID")
+	}
+	if cfg.SubjectClaim == "" {
+		cfg.SubjectClaim = "sub"
+	}
+	if cfg.NameClaim == "" {
+		cfg.NameClaim = "preferred_username"
+	}
+	if cfg.PictureClaim == "" {
+		cfg.PictureClaim = "picture"
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "profile"}
+	}
+
+	p := Provider{cfg: cfg}
+	if err := p.discover(ctx); err != nil {
+		return nil, err
+	}
+
+	p.keys = jwk.NewCache(ctx)
+	if err := p.keys.Register(p.discovery.JWKSURI, jwk.WithMinRefreshInterval(time.Hour)); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	p.oauth = &oauth2.Config{
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		RedirectURL:  cfg.RedirectURL,
+		Scopes:       cfg.Scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  p.discovery.AuthorizationEndpoint,
+			TokenURL: p.discovery.TokenEndpoint,
+		},
+	}
+	return &p, nil
+}
+
+func (p *Provider) discover(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, discoveryTimeout)
+	defer cancel()
+
+	url := strings.TrimSuffix(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("OIDC discovery returned %s", resp.Status)
+		log.Errorw(err.Error(), "provider", p.cfg.Name)
+		return err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	if err := json.Unmarshal(body, &p.discovery); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	// the issuer must match what we were configured with, or tokens will never validate
+	if strings.TrimSuffix(p.discovery.Issuer, "/") != strings.TrimSuffix(p.cfg.Issuer, "/") {
+		err := fmt.Errorf("OIDC discovery issuer mismatch: %s", p.discovery.Issuer)
+		log.Errorw(err.Error(), "provider", p.cfg.Name)
+		return err
+	}
+	if p.discovery.JWKSURI == "" || p.discovery.TokenEndpoint == "" {
+		err := fmt.Errorf("OIDC discovery incomplete")
+		log.Errorw(err.Error(), "provider", p.cfg.Name)
+		return err
+	}
+	return nil
+}
+
+// Get returns a running provider by name
+func Get(name string) (*Provider, error) {
+	providers.RLock()
+	defer providers.RUnlock()
+
+	p, ok := providers.m[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown OIDC provider")
+	}
+	return p, nil
+}
+
+// Name is the configured name of the provider
+func (p *Provider) Name() string {
+	return p.cfg.Name
+}
+
+// CreateAgents reports if subjects not yet linked to an agent should get a new agent
+func (p *Provider) CreateAgents() bool {
+	return p.cfg.CreateAgents
+}
+
+// AuthCodeURL is where to send the browser to log in
+func (p *Provider) AuthCodeURL(state, nonce string) string {
+	return p.oauth.AuthCodeURL(state, oauth2.SetAuthURLParam("nonce", nonce))
+}
+
+// Exchange trades an authorization code for the ID token
+func (p *Provider) Exchange(ctx context.Context, code string) (string, error) {
+	token, err := p.oauth.Exchange(ctx, code)
+	if err != nil {
+		log.Error(err)
+		return "", err
+	}
+
+	raw, ok := token.Extra("id_token").(string)
+	if !ok || raw == "" {
+		err := fmt.Errorf("no id_token in OIDC token response")
+		log.Errorw(err.Error(), "provider", p.cfg.Name)
+		return "", err
+	}
+	return raw, nil
+}
+
+// Verify checks an ID token's signature, issuer, audience, lifetime and nonce (if not empty) and maps its claims
+func (p *Provider) Verify(ctx context.Context, raw, nonce string) (*Identity, error) {
+	keys, err := p.keys.Get(ctx, p.discovery.JWKSURI)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	token, err := jwt.Parse([]byte(raw),
+		jwt.WithKeySet(keys, jws.WithInferAlgorithmFromKey(true)),
+		jwt.WithValidate(true),
+		jwt.WithIssuer(p.discovery.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithAcceptableSkew(20*time.Second),
+	)
+	if err != nil {
+		log.Infow("OIDC token rejected", "provider", p.cfg.Name, "error", err.Error())
+		return nil, err
+	}
+
+	if nonce != "" {
+		if n, _ := token.Get("nonce"); n != nonce {
+			err := fmt.Errorf("OIDC nonce mismatch")
+			log.Infow(err.Error(), "provider", p.cfg.Name)
+			return nil, err
+		}
+	}
+
+	id := Identity{
+		Provider: p.cfg.Name,
+		Subject:  claimString(token, p.cfg.SubjectClaim),
+		Name:     claimString(token, p.cfg.NameClaim),
+		Picture:  claimString(token, p.cfg.PictureClaim),
+	}
+	if id.Subject == "" {
+		err := fmt.Errorf("OIDC token missing subject claim %s", p.cfg.SubjectClaim)
+		log.Infow(err.Error(), "provider", p.cfg.Name)
+		return nil, err
+	}
+	return &id, nil
+}
+
+func claimString(token jwt.Token, claim string) string {
+	if claim == "sub" {
+		return token.Subject()
+	}
+	v, ok := token.Get(claim)
+	if !ok {
+		return ""
+	}
+	switch s := v.(type) {
+	case string:
+		return s
+	case fmt.Stringer:
+		return s.String()
+	case float64:
+		return fmt.Sprintf("%.0f", s)
+	}
+	return ""
+}
@@ -0,0 +1,179 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+
+	"github.com/wasabee-project/Wasabee-Server/config"
+	"github.com/wasabee-project/Wasabee-Server/log"
+)
+
+// issuer is a stand-in OpenID Connect provider
+type issuer struct {
+	*httptest.Server
+	key   jwk.Key
+	nonce string
+	claim map[string]interface{}
+}
+
+func newIssuer(t *testing.T) *issuer {
+	raw, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := jwk.FromRaw(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = key.Set(jwk.KeyIDKey, "test")
+	_ = key.Set(jwk.AlgorithmKey, jwa.RS256)
+
+	is := &issuer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(res http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(res).Encode(map[string]string{
+			"issuer":                 is.URL,
+			"authorization_endpoint": is.URL + "/authorize",
+			"token_endpoint":         is.URL + "/token",
+			"jwks_uri":               is.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(res http.ResponseWriter, req *http.Request) {
+		pub, _ := key.PublicKey()
+		set := jwk.NewSet()
+		_ = set.AddKey(pub)
+		json.NewEncoder(res).Encode(set)
+	})
+	mux.HandleFunc("/token", func(res http.ResponseWriter, req *http.Request) {
+		if req.FormValue("code") != "good-code" {
+			http.Error(res, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(res).Encode(map[string]string{
+			"access_token": "at",
+			"token_type":   "Bearer",
+			"id_token":     is.sign(t, "client", time.Hour),
+		})
+	})
+	is.Server = httptest.NewServer(mux)
+	t.Cleanup(is.Close)
+	return is
+}
+
+func (is *issuer) sign(t *testing.T, aud string, lifetime time.Duration) string {
+	b := jwt.NewBuilder().
+		Issuer(is.URL).
+		Subject("agent-123").
+		Audience([]string{aud}).
+		IssuedAt(time.Now()).
+		Expiration(time.Now().Add(lifetime)).
+		Claim("preferred_username", "TestAgent")
+	if is.nonce != "" {
+		b = b.Claim("nonce", is.nonce)
+	}
+	for k, v := range is.claim {
+		b = b.Claim(k, v)
+	}
+	tok, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := jwt.Sign(tok, jwt.WithKey(jwa.RS256, is.key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(signed)
+}
+
+func newProvider(t *testing.T, is *issuer, cfg config.OIDCProvider) *Provider {
+	log.Start(context.Background(), &log.Configuration{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	cfg.Name = "test"
+	cfg.Issuer = is.URL
+	cfg.ClientID = "client"
+	cfg.RedirectURL = "https://wasabee.example/oidc/test/callback"
+	p, err := New(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestCodeFlow(t *testing.T) {
+	is := newIssuer(t)
+	is.nonce = "n-1"
+	p := newProvider(t, is, config.OIDCProvider{})
+
+	u, err := url.Parse(p.AuthCodeURL("s-1", "n-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Path != "/authorize" || u.Query().Get("nonce") != "n-1" || u.Query().Get("state") != "s-1" {
+		t.Errorf("unexpected auth URL %s", u)
+	}
+
+	raw, err := p.Exchange(context.Background(), "good-code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := p.Verify(context.Background(), raw, "n-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Subject != "agent-123" || id.Name != "TestAgent" || id.Provider != "test" {
+		t.Errorf("unexpected identity %+v", id)
+	}
+
+	if _, err := p.Verify(context.Background(), raw, "other-nonce"); err == nil {
+		t.Error("nonce mismatch accepted")
+	}
+	if _, err := p.Exchange(context.Background(), "bad-code"); err == nil {
+		t.Error("bad code accepted")
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	is := newIssuer(t)
+	p := newProvider(t, is, config.OIDCProvider{})
+
+	if _, err := p.Verify(context.Background(), is.sign(t, "someone-else", time.Hour), ""); err == nil {
+		t.Error("wrong audience accepted")
+	}
+	if _, err := p.Verify(context.Background(), is.sign(t, "client", -time.Hour), ""); err == nil {
+		t.Error("expired token accepted")
+	}
+
+	other := newIssuer(t)
+	if _, err := p.Verify(context.Background(), other.sign(t, "client", time.Hour), ""); err == nil {
+		t.Error("token from another issuer accepted")
+	}
+}
+
+func TestClaimMapping(t *testing.T) {
+	is := newIssuer(t)
+	is.claim = map[string]interface{}{"agent_id": "mapped-456", "agent": "Mapped", "avatar": "https://example.com/a.png"}
+	p := newProvider(t, is, config.OIDCProvider{SubjectClaim: "agent_id", NameClaim: "agent", PictureClaim: "avatar"})
+
+	id, err := p.Verify(context.Background(), is.sign(t, "client", time.Hour), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Subject != "mapped-456" || id.Name != "Mapped" || id.Picture != "https://example.com/a.png" {
+		t.Errorf("unexpected identity %+v", id)
+	}
+}
@@ -1,6 +1,7 @@
 package rocks
 
 import (
+	"context"
 	"time"
 
 	"github.com/wasabee-project/Wasabee-Server/log"
@@ -14,10 +15,10 @@ type Rocks struct{}
 // responses are cached for an hour
 // unknown agents are permitted implicitly
 // if an agent is marked as smurf at rocks, they are prohibited
-func (r *Rocks) Authorize(gid model.GoogleID) bool {
+func (r *Rocks) Authorize(ctx context.Context, gid model.GoogleID) bool {
 	// log.Debugw("rocks authorize", "gid", gid)
 
-	a, fetched, err := model.RocksFromDB(gid)
+	a, fetched, err := model.RocksFromDB(ctx, gid)
 	if err != nil {
 		// do not block on db error
 		return true
@@ -34,7 +35,7 @@ func (r *Rocks) Authorize(gid model.GoogleID) bool {
 			// log.Debugw("Rocks returned a result without a GID, adding it", "gid", gid, "result", net)
 			net.Gid = gid
 		}
-		if err := model.RocksToDB(net); err != nil {
+		if err := model.RocksToDB(ctx, net); err != nil {
 			log.Error(err)
 		}
 		a = net
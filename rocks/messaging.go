@@ -13,11 +13,10 @@ import (
 	"github.com/wasabee-project/Wasabee-Server/model"
 )
 
-// addToRemote adds an agent to a Rocks Community IF that community has API enabled.
-func addToRemote(gid messaging.GoogleID, teamID messaging.TeamID) error {
-	// log.Debug("add to remote rocks", "gid", gid, "teamID", teamID)
-	t := model.TeamID(teamID)
-	cid, err := t.RocksKey()
+// AddToRemote adds an agent to a Rocks Community IF that community has API enabled.
+func (r *Rocks) AddToRemote(ctx context.Context, gid model.GoogleID, t model.TeamID) error {
+	// log.Debug("add to remote rocks", "gid", gid, "teamID", t)
+	cid, err := t.RocksKey(ctx)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -54,26 +53,25 @@ func addToRemote(gid messaging.GoogleID, teamID messaging.TeamID) error {
 	}
 
 	if !rr.Success {
-		log.Errorw("unable to add to remote rocks team", "teamID", teamID, "gid", gid, "cid", cid, "error", rr.Error)
+		log.Errorw("unable to add to remote rocks team", "teamID", t, "gid", gid, "cid", cid, "error", rr.Error)
 
 		// try to alert the team owner
-		owner, _ := t.Owner()
-		msg := fmt.Sprintf("unable to add agent to rocks community for teamID: %s. Check that your community ID and api key are correct.", teamID)
-		messaging.SendMessage(messaging.GoogleID(owner), msg)
+		owner, _ := t.Owner(ctx)
+		msg := fmt.Sprintf("unable to add agent to rocks community for teamID: %s. Check that your community ID and api key are correct.", t)
+		messaging.SendMessage(ctx, messaging.GoogleID(owner), msg)
 
 		if rr.Error == "Invalid key" {
-			c, _ := t.RocksCommunity()
-			_ = t.SetRocks("", c) // unlink
+			c, _ := t.RocksCommunity(ctx)
+			_ = t.SetRocks(ctx, "", c) // unlink
 		}
 	}
 	return nil
 }
 
-// removeFromRemote removes an agent from a Rocks Community IF that community has API enabled.
-func removeFromRemote(gid messaging.GoogleID, teamID messaging.TeamID) error {
-	// log.Debugw("remove from remote rocks", "gid", gid, "teamID", teamID)
-	t := model.TeamID(teamID)
-	cid, err := t.RocksKey()
+// RemoveFromRemote removes an agent from a Rocks Community IF that community has API enabled.
+func (r *Rocks) RemoveFromRemote(ctx context.Context, gid model.GoogleID, t model.TeamID) error {
+	// log.Debugw("remove from remote rocks", "gid", gid, "teamID", t)
+	cid, err := t.RocksKey(ctx)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -118,8 +116,8 @@ func removeFromRemote(gid messaging.GoogleID, teamID messaging.TeamID) error {
 		err = fmt.Errorf(rr.Error)
 		log.Error(err)
 		if rr.Error == "Invalid key" {
-			c, _ := t.RocksCommunity()
-			_ = t.SetRocks("", c) // unlink
+			c, _ := t.RocksCommunity(ctx)
+			_ = t.SetRocks(ctx, "", c) // unlink
 		}
 		return err
 	}
@@ -9,11 +9,11 @@ import (
 
 	"golang.org/x/time/rate"
 
-	"github.com/wasabee-project/Wasabee-Server/auth"
 	"github.com/wasabee-project/Wasabee-Server/config"
 	"github.com/wasabee-project/Wasabee-Server/log"
 	"github.com/wasabee-project/Wasabee-Server/messaging"
 	"github.com/wasabee-project/Wasabee-Server/model"
+	"github.com/wasabee-project/Wasabee-Server/roster"
 )
 
 var holdtime = 3 * time.Second
@@ -34,13 +34,8 @@ func Start(ctx context.Context) {
 	// rocks.MethodNotAllowedHandler = http.HandlerFunc(notFoundJSONRoute)
 	// rocks.PathPrefix("/rocks").HandlerFunc(notFoundJSONRoute)
 
-	// let the messaging susbsystem know we exist and how to use us
-	messaging.RegisterMessageBus("Rocks", messaging.Bus{
-		AddToRemote:      addToRemote,
-		RemoveFromRemote: removeFromRemote,
-	})
-
-	auth.RegisterAuthProvider(&Rocks{})
+	// let the roster, authorization and messaging subsystems know we exist and how to use us
+	roster.Register(&Rocks{})
 
 	config.SetRocksRunning(true)
 
@@ -95,7 +90,7 @@ func Search(id string) (*model.RocksAgent, error) {
 }
 
 // CommunitySync is called from the https server when it receives a push notification
-func CommunitySync(msg json.RawMessage) error {
+func CommunitySync(ctx context.Context, msg json.RawMessage) error {
 	log.Debug("rocks community request", "data", string(msg))
 
 	// check the source? is the community key enough for this? I don't think so
@@ -106,45 +101,50 @@ func CommunitySync(msg json.RawMessage) error {
 		return err
 	}
 
-	teamID, err := model.RocksCommunityToTeam(rc.Community)
+	teamID, err := model.RocksCommunityToTeam(ctx, rc.Community)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
 
 	// already known?
-	if !rc.User.Gid.Valid() {
-		if err := rc.User.Gid.FirstLogin(); err != nil {
+	if !rc.User.Gid.Valid(ctx) {
+		if err := rc.User.Gid.FirstLogin(ctx); err != nil {
 			log.Error(err)
 			return err
 		}
 
 		r := &Rocks{}
-		_ = r.Authorize(rc.User.Gid)
+		_ = r.Authorize(ctx, rc.User.Gid)
 	}
 
 	if rc.Action == "onJoin" {
-		if inteam, err := rc.User.Gid.AgentInTeam(teamID); err != nil || inteam {
+		if inteam, err := rc.User.Gid.AgentInTeam(ctx, teamID); err != nil || inteam {
 			return err // if already on the team, this is nil
 		}
-		if err := teamID.AddAgent(rc.User.Gid); err != nil {
+		if err := teamID.AddAgent(ctx, rc.User.Gid); err != nil {
 			return err
 		}
-		owner, err := teamID.Owner()
+		teamID.AuditMembership(ctx, "", model.AuditSourceRocks, rc.User.Gid, model.AuditActionAdd)
+		owner, err := teamID.Owner(ctx)
 		if err != nil {
 			return err
 		}
-		agent, _ := rc.User.Gid.IngressName()
-		team, _ := teamID.Name()
-		messaging.SendMessage(messaging.GoogleID(owner), fmt.Sprintf("added %s to %s via rocks community join", agent, team))
+		agent, _ := rc.User.Gid.IngressName(ctx)
+		team, _ := teamID.Name(ctx)
+		messaging.SendMessage(ctx, messaging.GoogleID(owner), fmt.Sprintf("added %s to %s via rocks community join", agent, team))
 	} else {
-		if err := teamID.RemoveAgent(rc.User.Gid); err != nil {
+		if neverRemove, err := teamID.NeverRemove(ctx); err != nil || neverRemove {
+			return err // if the team is set to never remove, this is nil
+		}
+		if err := teamID.RemoveAgent(ctx, rc.User.Gid); err != nil {
 			return err
 		}
+		teamID.AuditMembership(ctx, "", model.AuditSourceRocks, rc.User.Gid, model.AuditActionRemove)
 	}
 
 	if rc.TGId > 0 && rc.TGName != "" {
-		if err := rc.TGId.SetName(rc.TGName); err != nil {
+		if err := rc.TGId.SetName(ctx, rc.TGName); err != nil {
 			return err
 		}
 	}
@@ -153,61 +153,6 @@ func CommunitySync(msg json.RawMessage) error {
 }
 
 // CommunityMemberPull grabs the member list from the associated community at enl.rocks and adds each agent to the team
-func CommunityMemberPull(teamID model.TeamID) error {
-	cid, err := teamID.RocksKey()
-	if err != nil {
-		log.Error(err)
-		return err
-	}
-	if cid == "" {
-		return nil
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), holdtime)
-	defer cancel()
-	if err := limiter.Wait(ctx); err != nil {
-		log.Warn(err)
-		// just keep going
-	}
-
-	c := config.Get().Rocks
-	apiurl := fmt.Sprintf("%s?key=%s", c.CommunityEndpoint, cid)
-	req, err := http.NewRequest("GET", apiurl, nil)
-	if err != nil {
-		err := fmt.Errorf("error establishing community pull request")
-		log.Error(err)
-		return err
-	}
-	client := &http.Client{
-		Timeout: holdtime,
-	}
-	resp, err := client.Do(req)
-	if err != nil {
-		err := fmt.Errorf("error executing community pull request")
-		log.Error(err)
-		return err
-	}
-	defer resp.Body.Close()
-
-	rr := communityResponse{}
-	if err := json.NewDecoder(resp.Body).Decode(&rr); err != nil {
-		log.Error(err)
-		return err
-	}
-	if rr.Error != "" {
-		log.Error(rr.Error)
-		return err
-	}
-	// log.Debugw("rocks sync", "response", rr)
-
-	for _, gid := range rr.Members {
-		if inteam, _ := gid.AgentInTeam(teamID); inteam {
-			continue
-		}
-		log.Debugw("rocks sync", "adding", gid)
-		if err := teamID.AddAgent(gid); err != nil {
-			log.Info(err)
-		}
-	}
-	return nil
+func CommunityMemberPull(ctx context.Context, teamID model.TeamID) error {
+	return roster.Sync(ctx, &Rocks{}, teamID)
 }
@@ -0,0 +1,93 @@
+package rocks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/wasabee-project/Wasabee-Server/config"
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+// Name satisfies roster.Provider
+func (r *Rocks) Name() model.TeamAuditSource {
+	return model.AuditSourceRocks
+}
+
+// Linked reports if a team has a .rocks community API key set
+func (r *Rocks) Linked(ctx context.Context, teamID model.TeamID) bool {
+	cid, err := teamID.RocksKey(ctx)
+	if err != nil {
+		return false
+	}
+	return cid != ""
+}
+
+// AddOnly -- .rocks joins/leaves arrive by webhook, scheduled pulls only add missing agents
+func (r *Rocks) AddOnly() bool {
+	return true
+}
+
+// Roster grabs the member list from the associated community at enl.rocks
+func (r *Rocks) Roster(ctx context.Context, teamID model.TeamID) ([]string, error) {
+	var ids []string
+
+	cid, err := teamID.RocksKey(ctx)
+	if err != nil {
+		log.Error(err)
+		return ids, err
+	}
+	if cid == "" {
+		return ids, nil
+	}
+
+	lctx, cancel := context.WithTimeout(ctx, holdtime)
+	defer cancel()
+	if err := limiter.Wait(lctx); err != nil {
+		log.Warn(err)
+		// just keep going
+	}
+
+	c := config.Get().Rocks
+	apiurl := fmt.Sprintf("%s?key=%s", c.CommunityEndpoint, cid)
+	req, err := http.NewRequestWithContext(ctx, "GET", apiurl, nil)
+	if err != nil {
+		err := fmt.Errorf("error establishing community pull request")
+		log.Error(err)
+		return ids, err
+	}
+	client := &http.Client{
+		Timeout: holdtime,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		err := fmt.Errorf("error executing community pull request")
+		log.Error(err)
+		return ids, err
+	}
+	defer resp.Body.Close()
+
+	rr := communityResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&rr); err != nil {
+		log.Error(err)
+		return ids, err
+	}
+	if rr.Error != "" {
+		err := fmt.Errorf(rr.Error)
+		log.Error(err)
+		return ids, err
+	}
+	// log.Debugw("rocks sync", "response", rr)
+
+	for _, gid := range rr.Members {
+		ids = append(ids, string(gid))
+	}
+	return ids, nil
+}
+
+// ToGid maps a .rocks ID to a GoogleID, .rocks uses GoogleIDs
+func (r *Rocks) ToGid(ctx context.Context, id string) (model.GoogleID, error) {
+	return model.GoogleID(id), nil
+}
@@ -35,7 +35,7 @@ func rocksCommunityRoute(res http.ResponseWriter, req *http.Request) {
 	}
 
 	jRaw := json.RawMessage(jBlob)
-	if err := CommunitySync(jRaw); err != nil {
+	if err := CommunitySync(req.Context(), jRaw); err != nil {
 		log.Errorw(err.Error(), "content", jRaw)
 		http.Error(res, err.Error(), http.StatusNotAcceptable)
 		return
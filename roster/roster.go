@@ -0,0 +1,185 @@
+package roster
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/wasabee-project/Wasabee-Server/auth"
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/messaging"
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+// Provider is an external service which manages team membership (V, .rocks, a community's own tooling)
+type Provider interface {
+	// Name identifies the provider, it is used as the source in the team audit log
+	Name() model.TeamAuditSource
+	// Linked reports if a team is linked to the provider
+	Linked(ctx context.Context, teamID model.TeamID) bool
+	// Roster fetches the external IDs of the agents who belong on the team
+	Roster(ctx context.Context, teamID model.TeamID) ([]string, error)
+	// ToGid maps one of the provider's external IDs to a GoogleID
+	ToGid(ctx context.Context, id string) (model.GoogleID, error)
+	// Authorize checks if an agent is permitted to use Wasabee
+	Authorize(ctx context.Context, gid model.GoogleID) bool
+	// AddToRemote pushes an agent added to a team to the provider
+	AddToRemote(ctx context.Context, gid model.GoogleID, teamID model.TeamID) error
+	// RemoveFromRemote pushes an agent removed from a team to the provider
+	RemoveFromRemote(ctx context.Context, gid model.GoogleID, teamID model.TeamID) error
+}
+
+// AddOnly is implemented by providers whose rosters are not authoritative, Sync only adds agents; removals are only shown by Preview
+type AddOnly interface {
+	AddOnly() bool
+}
+
+var providers = struct {
+	sync.RWMutex
+	m map[model.TeamAuditSource]Provider
+}{m: make(map[model.TeamAuditSource]Provider)}
+
+// Register lets wasabee know about a roster provider, it is also registered for authorization and with the messaging bus
+func Register(p Provider) {
+	providers.Lock()
+	providers.m[p.Name()] = p
+	providers.Unlock()
+
+	auth.RegisterAuthProvider(p)
+
+	messaging.RegisterMessageBus(string(p.Name()), messaging.Bus{
+		AddToRemote: func(ctx context.Context, gid messaging.GoogleID, teamID messaging.TeamID) error {
+			return p.AddToRemote(ctx, model.GoogleID(gid), model.TeamID(teamID))
+		},
+		RemoveFromRemote: func(ctx context.Context, gid messaging.GoogleID, teamID messaging.TeamID) error {
+			return p.RemoveFromRemote(ctx, model.GoogleID(gid), model.TeamID(teamID))
+		},
+	})
+}
+
+// Get returns a registered provider by name
+func Get(name model.TeamAuditSource) (Provider, error) {
+	providers.RLock()
+	defer providers.RUnlock()
+
+	p, ok := providers.m[name]
+	if !ok {
+		err := fmt.Errorf("roster provider not running")
+		log.Warnw(err.Error(), "provider", name)
+		return nil, err
+	}
+	return p, nil
+}
+
+// Providers returns all the registered providers
+func Providers() []Provider {
+	providers.RLock()
+	defer providers.RUnlock()
+
+	var list []Provider
+	for _, p := range providers.m {
+		list = append(list, p)
+	}
+	return list
+}
+
+// Preview compares a team with the provider's roster without making any changes
+// a nil diff is returned if the team is not linked to the provider
+func Preview(ctx context.Context, p Provider, teamID model.TeamID) (*model.SyncDiff, error) {
+	if !p.Linked(ctx, teamID) {
+		return nil, nil
+	}
+
+	ids, err := p.Roster(ctx, teamID)
+	if err != nil {
+		log.Errorw(err.Error(), "resource", teamID, "provider", p.Name())
+		return nil, err
+	}
+
+	// do not remove the owner from the team
+	owner, err := teamID.Owner(ctx)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	// agents previously unknown to wasabee are created and checked when the diff is applied
+	diff := teamID.NewSyncDiff(ctx, p.Name(), func(gid model.GoogleID) error {
+		log.Infow("importing previously unknown agent", "GID", gid, "provider", p.Name())
+		if err := gid.FirstLogin(ctx); err != nil {
+			return err
+		}
+		if !p.Authorize(ctx, gid) {
+			return fmt.Errorf("agent not authorized by %s", p.Name())
+		}
+		return nil
+	})
+
+	members := make(map[model.GoogleID]bool)
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		gid, err := p.ToGid(ctx, id)
+		if err != nil || gid == "" {
+			diff.Unmatched = append(diff.Unmatched, id)
+			continue
+		}
+		if members[gid] {
+			continue
+		}
+		members[gid] = true
+
+		if !gid.Valid(ctx) {
+			diff.Unknown = append(diff.Unknown, gid)
+			diff.Add = append(diff.Add, gid)
+			continue
+		}
+
+		// don't re-add them if already in the team
+		if inteam, _ := gid.AgentInTeam(ctx, teamID); inteam {
+			continue
+		}
+		diff.Add = append(diff.Add, gid)
+	}
+
+	t, err := teamID.FetchTeam(ctx)
+	if err != nil {
+		log.Info(err)
+		return nil, err
+	}
+	for _, a := range t.TeamMembers {
+		if a.Gid == owner || members[a.Gid] {
+			continue
+		}
+		diff.Remove = append(diff.Remove, a.Gid)
+	}
+	return diff, nil
+}
+
+// Sync brings a team's membership in line with the provider's roster
+func Sync(ctx context.Context, p Provider, teamID model.TeamID) error {
+	diff, err := Preview(ctx, p, teamID)
+	if err != nil {
+		return err
+	}
+	if diff == nil {
+		return nil
+	}
+
+	if ao, ok := p.(AddOnly); ok && ao.AddOnly() {
+		diff.Remove = diff.Remove[:0]
+	}
+	return diff.Apply(ctx, "")
+}
+
+// SyncAll syncs a team with every provider to which it is linked
+func SyncAll(ctx context.Context, teamID model.TeamID) error {
+	for _, p := range Providers() {
+		if err := Sync(ctx, p, teamID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
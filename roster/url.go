@@ -0,0 +1,237 @@
+package roster
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+// URL is a generic roster provider for communities with their own tooling
+// the team owner sets an https URL which returns either a JSON list of agents or a CSV file with agents in the first column
+// agents can be identified by anything model.ToGid understands: GoogleID, agent name, EnlID, etc.
+// only agents who have already used Wasabee are matched
+type URL struct{}
+
+// the most we are willing to read from a roster URL
+const maxRosterSize = 1024 * 1024
+
+const rosterTimeout = 10 * time.Second
+
+// the size of the team.rosterurl column
+const maxRosterURLLength = 255
+
+// Start registers the URL provider
+func Start(ctx context.Context) {
+	Register(&URL{})
+
+	// there is no reason to stay running now -- this costs nothing
+	<-ctx.Done()
+	log.Infow("shutdown", "message", "roster shutting down")
+}
+
+// Name satisfies Provider
+func (u *URL) Name() model.TeamAuditSource {
+	return model.AuditSourceURL
+}
+
+// Linked reports if the team has a roster URL set
+func (u *URL) Linked(ctx context.Context, teamID model.TeamID) bool {
+	rurl, err := teamID.RosterURL(ctx)
+	if err != nil {
+		return false
+	}
+	return rurl != ""
+}
+
+// Roster fetches and parses the team's roster URL
+func (u *URL) Roster(ctx context.Context, teamID model.TeamID) ([]string, error) {
+	rurl, err := teamID.RosterURL(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidRosterURL(rurl); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", rurl, nil)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json, text/csv")
+
+	client := &http.Client{
+		Timeout: rosterTimeout,
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{
+				Timeout: rosterTimeout,
+				Control: publicOnly,
+			}).DialContext,
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		err := fmt.Errorf("error fetching roster URL")
+		log.Errorw(err.Error(), "resource", teamID)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("roster URL returned %s", resp.Status)
+		log.Errorw(err.Error(), "resource", teamID)
+		return nil, err
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRosterSize))
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	return parseRoster(body, resp.Header.Get("Content-Type"))
+}
+
+// parseRoster accepts a JSON list of strings, a JSON list of objects with a "gid", "id" or "agent" field, {"members": [...]} of either, or a CSV file
+func parseRoster(body []byte, contentType string) ([]string, error) {
+	trimmed := bytes.TrimSpace(body)
+
+	if strings.Contains(contentType, "json") || bytes.HasPrefix(trimmed, []byte("[")) || bytes.HasPrefix(trimmed, []byte("{")) {
+		var list []json.RawMessage
+		if bytes.HasPrefix(trimmed, []byte("{")) {
+			var wrapped struct {
+				Members []json.RawMessage `json:"members"`
+			}
+			if err := json.Unmarshal(trimmed, &wrapped); err != nil {
+				log.Error(err)
+				return nil, err
+			}
+			list = wrapped.Members
+		} else if err := json.Unmarshal(trimmed, &list); err != nil {
+			log.Error(err)
+			return nil, err
+		}
+
+		ids := make([]string, 0, len(list))
+		for _, raw := range list {
+			var id string
+			if err := json.Unmarshal(raw, &id); err == nil {
+				ids = append(ids, strings.TrimSpace(id))
+				continue
+			}
+			var obj struct {
+				Gid   string `json:"gid"`
+				ID    string `json:"id"`
+				Agent string `json:"agent"`
+			}
+			if err := json.Unmarshal(raw, &obj); err != nil {
+				continue
+			}
+			switch {
+			case obj.Gid != "":
+				ids = append(ids, obj.Gid)
+			case obj.ID != "":
+				ids = append(ids, obj.ID)
+			case obj.Agent != "":
+				ids = append(ids, obj.Agent)
+			}
+		}
+		return ids, nil
+	}
+
+	r := csv.NewReader(bytes.NewReader(trimmed))
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(records))
+	for i, rec := range records {
+		if len(rec) == 0 {
+			continue
+		}
+		id := strings.TrimSpace(rec[0])
+		if id == "" {
+			continue
+		}
+		// skip a header row
+		if i == 0 {
+			switch strings.ToLower(id) {
+			case "gid", "id", "agent", "googleid", "name":
+				continue
+			}
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// ToGid maps anything model.ToGid understands to the GoogleID of an existing agent
+// a published file vouches for no one, so unlike V and .rocks it never creates agents
+func (u *URL) ToGid(ctx context.Context, id string) (model.GoogleID, error) {
+	gid, err := model.ToGid(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if !gid.Valid(ctx) {
+		return "", fmt.Errorf(model.ErrAgentNotFound)
+	}
+	return gid, nil
+}
+
+// Authorize -- the URL provider has no opinion on who may use Wasabee
+func (u *URL) Authorize(ctx context.Context, gid model.GoogleID) bool {
+	return true
+}
+
+// AddToRemote -- roster URLs are read-only
+func (u *URL) AddToRemote(ctx context.Context, gid model.GoogleID, teamID model.TeamID) error {
+	return nil
+}
+
+// RemoveFromRemote -- roster URLs are read-only
+func (u *URL) RemoveFromRemote(ctx context.Context, gid model.GoogleID, teamID model.TeamID) error {
+	return nil
+}
+
+// ValidRosterURL checks that a roster URL is something we are willing to fetch
+func ValidRosterURL(rurl string) error {
+	if len(rurl) > maxRosterURLLength {
+		return fmt.Errorf("roster URL too long, limit is %d", maxRosterURLLength)
+	}
+	parsed, err := url.Parse(rurl)
+	if err != nil {
+		return err
+	}
+	if parsed.Scheme != "https" || parsed.Host == "" {
+		return fmt.Errorf("roster URL must be https")
+	}
+	return nil
+}
+
+// publicOnly prevents roster URLs from being used to reach hosts on the server's own network
+func publicOnly(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("roster URL resolves to a non-public address")
+	}
+	return nil
+}
@@ -63,6 +63,11 @@ func Start(frontendPath string) error {
 	return nil
 }
 
+// Loaded reports if any template languages have been loaded
+func Loaded() bool {
+	return len(ts) > 0
+}
+
 // Execute runs a template with the given data -- defaulting to English
 func Execute(name string, data interface{}) (string, error) {
 	return ExecuteLang(name, "en", data)
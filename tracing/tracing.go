@@ -0,0 +1,88 @@
+// Package tracing exports OpenTelemetry spans to an OTLP collector
+// when no collector is configured the global no-op tracer is left in place and spans cost next to nothing
+package tracing
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/wasabee-project/Wasabee-Server/config"
+	"github.com/wasabee-project/Wasabee-Server/log"
+)
+
+const tracerName = "github.com/wasabee-project/Wasabee-Server"
+
+// how long to wait for the last spans to be sent at shutdown
+const shutdownTimeout = 5 * time.Second
+
+// Start sets up the exporter and tracer provider, flushing the remaining spans when ctx is done
+func Start(ctx context.Context) {
+	c := config.Get().Tracing
+	if c.Endpoint == "" {
+		log.Debugw("startup", "message", "tracing collector not configured")
+		return
+	}
+
+	opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(c.Endpoint)}
+	if c.Insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	host, _ := os.Hostname()
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName("wasabee-server"),
+		semconv.HostName(host),
+		attribute.String("wasabee.webroot", config.Get().HTTP.Webroot),
+	))
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(c.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	log.Infow("startup", "message", "exporting traces", "collector", c.Endpoint, "sample ratio", c.SampleRatio)
+
+	<-ctx.Done()
+	log.Infow("shutdown", "message", "flushing traces")
+	sctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := tp.Shutdown(sctx); err != nil {
+		log.Error(err)
+	}
+}
+
+// Span starts a span as a child of any span in ctx
+func Span(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, opts...)
+}
+
+// End records err, if any, on the span and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
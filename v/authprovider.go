@@ -1,6 +1,7 @@
 package v
 
 import (
+	"context"
 	"time"
 
 	"github.com/wasabee-project/Wasabee-Server/log"
@@ -14,10 +15,10 @@ type V struct{}
 // data is cached per-agent for one hour
 // if an agent is not known at V, they are implicitly permitted
 // if an agent is banned, blacklisted, etc at V, they are prohibited
-func (v *V) Authorize(gid model.GoogleID) bool {
+func (v *V) Authorize(ctx context.Context, gid model.GoogleID) bool {
 	// log.Debugw("V authorize", "gid", gid)
 
-	a, fetched, err := model.VFromDB(gid)
+	a, fetched, err := model.VFromDB(ctx, gid)
 	if err != nil {
 		log.Error(err)
 		// do not block on db error
@@ -32,7 +33,7 @@ func (v *V) Authorize(gid model.GoogleID) bool {
 			return !a.Blacklisted
 		}
 		// log.Debugw("v cache refreshed", "gid", gid, "data", net.Data)
-		err = model.VToDB(&net.Data)
+		err = model.VToDB(ctx, &net.Data)
 		if err != nil {
 			log.Error(err)
 		}
@@ -1,17 +0,0 @@
-package v
-
-import (
-	"github.com/wasabee-project/Wasabee-Server/messaging"
-)
-
-func addToRemote(gid messaging.GoogleID, teamID messaging.TeamID) error {
-	// V's api doesn't support this?
-	// log.Info("v add to remote not written")
-	return nil
-}
-
-func removeFromRemote(gid messaging.GoogleID, teamID messaging.TeamID) error {
-	// V's api doesn't support this?
-	// log.Info("v remove from remote not written")
-	return nil
-}
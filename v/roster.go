@@ -0,0 +1,88 @@
+package v
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/wasabee-project/Wasabee-Server/log"
+	"github.com/wasabee-project/Wasabee-Server/model"
+)
+
+// Name satisfies roster.Provider
+func (v *V) Name() model.TeamAuditSource {
+	return model.AuditSourceV
+}
+
+// Linked reports if a team is linked to a V team
+func (v *V) Linked(ctx context.Context, teamID model.TeamID) bool {
+	vteam, _, err := teamID.VTeam(ctx)
+	if err != nil {
+		return false
+	}
+	return vteam != 0
+}
+
+// Roster pulls the team (and role) from V using the team owner's V API key
+func (v *V) Roster(ctx context.Context, teamID model.TeamID) ([]string, error) {
+	var ids []string
+
+	x, role, err := teamID.VTeam(ctx)
+	if err != nil {
+		return ids, err
+	}
+	vteamID := vTeamID(x)
+
+	owner, err := teamID.Owner(ctx)
+	if err != nil {
+		log.Error(err)
+		return ids, err
+	}
+	key, err := owner.GetVAPIkey(ctx)
+	if err != nil {
+		return ids, err
+	}
+	if key == "" {
+		err := fmt.Errorf("cannot sync V team if no V API key set")
+		log.Errorw(err.Error(), "resource", teamID, "GID", owner)
+		return ids, err
+	}
+
+	vt, err := vteamID.getTeamFromV(key)
+	if err != nil {
+		log.Error(err)
+		return ids, err
+	}
+
+	for _, agent := range vt.Agents {
+		if role == 0 { // role 0 means "any"
+			ids = append(ids, string(agent.Gid))
+			continue
+		}
+		for _, r := range agent.Roles {
+			if r.ID == role {
+				ids = append(ids, string(agent.Gid))
+				break
+			}
+		}
+	}
+	return ids, nil
+}
+
+// ToGid maps a V ID to a GoogleID, V uses GoogleIDs
+func (v *V) ToGid(ctx context.Context, id string) (model.GoogleID, error) {
+	return model.GoogleID(id), nil
+}
+
+// AddToRemote satisfies roster.Provider
+func (v *V) AddToRemote(ctx context.Context, gid model.GoogleID, teamID model.TeamID) error {
+	// V's api doesn't support this?
+	// log.Info("v add to remote not written")
+	return nil
+}
+
+// RemoveFromRemote satisfies roster.Provider
+func (v *V) RemoveFromRemote(ctx context.Context, gid model.GoogleID, teamID model.TeamID) error {
+	// V's api doesn't support this?
+	// log.Info("v remove from remote not written")
+	return nil
+}
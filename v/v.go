@@ -8,11 +8,10 @@ import (
 	"strings"
 	"time"
 
-	"github.com/wasabee-project/Wasabee-Server/auth"
 	"github.com/wasabee-project/Wasabee-Server/config"
 	"github.com/wasabee-project/Wasabee-Server/log"
-	"github.com/wasabee-project/Wasabee-Server/messaging"
 	"github.com/wasabee-project/Wasabee-Server/model"
+	"github.com/wasabee-project/Wasabee-Server/roster"
 )
 
 // Start is called start V integration
@@ -29,12 +28,8 @@ func Start(ctx context.Context) {
 	// v.MethodNotAllowedHandler = http.HandlerFunc(notFoundJSONRoute)
 	// v.PathPrefix("/v").HandlerFunc(notFoundJSONRoute)
 
-	messaging.RegisterMessageBus("v.enl.one", messaging.Bus{
-		AddToRemote:      addToRemote,
-		RemoveFromRemote: removeFromRemote,
-	})
-
-	auth.RegisterAuthProvider(&V{})
+	// let the roster, authorization and messaging subsystems know we exist
+	roster.Register(&V{})
 
 	config.SetVRunning(true)
 
@@ -90,10 +85,10 @@ func trustCheck(id model.GoogleID) (*trustResult, error) {
 }
 
 // geTeams pulls a list of teams the agent is on at V
-func getTeams(gid model.GoogleID) (*myTeams, error) {
+func getTeams(ctx context.Context, gid model.GoogleID) (*myTeams, error) {
 	v := myTeams{}
 
-	key, err := gid.GetVAPIkey()
+	key, err := gid.GetVAPIkey(ctx)
 	if err != nil {
 		log.Error(err)
 		return &v, err
@@ -176,124 +171,21 @@ func (vteamID vTeamID) getTeamFromV(key string) (*teamResult, error) {
 	return &vt, nil
 }
 
-// Sync pulls a team (and role) from V to sync with a Wasabee team
-func Sync(ctx context.Context, teamID model.TeamID, key string) error {
-	// XXX put ctx.Done() checks in the loops....
-
-	x, role, err := teamID.VTeam()
-	if err != nil {
-		return err
-	}
-	vteamID := vTeamID(x)
-	if vteamID == 0 {
-		return nil
-	}
-
-	if key == "" {
-		err := fmt.Errorf("cannot sync V team if no V API key set")
-		log.Error(err)
-		return err
-	}
-
-	vt, err := vteamID.getTeamFromV(key)
-	if err != nil {
-		log.Error(err)
-		return err
-	}
-	// log.Debug("V Sync", "team", vt)
-
-	// do not remove the owner from the team
-	owner, err := teamID.Owner()
-	if err != nil {
-		log.Error(err)
-		return err
-	}
-
-	// a map to track added agents
-	atv := make(map[model.GoogleID]bool)
-
-	for _, agent := range vt.Agents {
-		if !agent.Gid.Valid() {
-			log.Infow("Importing previously unknown agent", "GID", agent.Gid)
-			if err := agent.Gid.FirstLogin(); err != nil {
-				log.Error(err)
-				continue
-			}
-			// #nosec -- model.VToDB isn't async, aliasing doesn't matter here
-			if err := model.VToDB(&agent); err != nil {
-				log.Error(err)
-				continue
-			}
-		}
-
-		if role != 0 { // role 0 means "any"
-			for _, r := range agent.Roles {
-				if r.ID == role {
-					atv[agent.Gid] = true
-					break
-				}
-			}
-		} else {
-			atv[agent.Gid] = true
-		}
-
-		// don't re-add them if already in the team
-		in, err := agent.Gid.AgentInTeam(teamID)
-		if err != nil {
-			log.Info(err)
-			continue
-		}
-		if in {
-			// log.Debugw("ignoring agent already on team", "GID", agent.Gid, "team", teamID)
-			continue
-		}
-
-		if _, ok := atv[agent.Gid]; ok {
-			// log.Infow("adding agent to team via V pull", "GID", agent.Gid, "team", teamID)
-			if err := teamID.AddAgent(agent.Gid); err != nil {
-				log.Info(err)
-				continue
-			}
-		}
-	}
-
-	// remove those not present at V
-	t, err := teamID.FetchTeam()
-	if err != nil {
-		log.Info(err)
-		return err
-	}
-	for _, a := range t.TeamMembers {
-		if a.Gid == owner {
-			continue
-		}
-		if !atv[a.Gid] {
-			err := fmt.Errorf("agent in wasabee team but not in V team/role, removing")
-			log.Infow(err.Error(), "GID", a.Gid, "wteam", teamID, "vteam", vteamID, "role", role)
-
-			if err = teamID.RemoveAgent(a.Gid); err != nil {
-				log.Error(err)
-			}
-		}
-	}
-	return nil
-}
-
 // BulkImport imports all teams of which the GoogleID is an admin
 // mode determines how many teams are created
 // team = one Wasabee Team per V team -- roles are ignored
 // role = one Wasabee Team per V team/role pair
 // team data is populated from V at creation
-func BulkImport(gid model.GoogleID, mode string) error {
+func BulkImport(ctx context.Context, gid model.GoogleID, mode string) error {
 	log.Infow("v BulkImport", "gid", gid, "mode", mode)
 
-	key, err := gid.GetVAPIkey()
+	key, err := gid.GetVAPIkey(ctx)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
 
-	teamsfromv, err := getTeams(gid)
+	teamsfromv, err := getTeams(ctx, gid)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -307,6 +199,9 @@ func BulkImport(gid model.GoogleID, mode string) error {
 }
 
 func bulkImportWorker(gid model.GoogleID, key string, mode string, teamsfromv *myTeams) error {
+	// the request that started the import has already returned, its context is no use here
+	ctx := context.Background()
+
 	type teamToMake struct {
 		ID   vTeamID
 		Role uint8
@@ -355,7 +250,7 @@ func bulkImportWorker(gid model.GoogleID, key string, mode string, teamsfromv *m
 	}
 
 	for _, t := range tomake {
-		exists, err := model.VTeamExists(int64(t.ID), uint8(t.Role), gid)
+		exists, err := model.VTeamExists(ctx, int64(t.ID), uint8(t.Role), gid)
 		if err != nil {
 			log.Error(err)
 			continue
@@ -366,17 +261,17 @@ func bulkImportWorker(gid model.GoogleID, key string, mode string, teamsfromv *m
 		}
 
 		log.Infow("Creating Wasabee team for V team", "v team", t.ID, "role", t.Role)
-		teamID, err := gid.NewTeam(t.Name)
+		teamID, err := gid.NewTeam(ctx, t.Name)
 		if err != nil {
 			log.Error(err)
 			return err
 		}
-		err = teamID.VConfigure(int64(t.ID), uint8(t.Role))
+		err = teamID.VConfigure(ctx, int64(t.ID), uint8(t.Role))
 		if err != nil {
 			log.Error(err)
 			return err
 		}
-		err = Sync(context.Background(), teamID, key)
+		err = roster.Sync(ctx, &V{}, teamID)
 		if err != nil {
 			log.Error(err)
 			return err
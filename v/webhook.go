@@ -8,6 +8,7 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/wasabee-project/Wasabee-Server/log"
 	"github.com/wasabee-project/Wasabee-Server/model"
+	"github.com/wasabee-project/Wasabee-Server/roster"
 )
 
 const jsonStatusOK = `{"status":"ok"}`
@@ -32,37 +33,15 @@ func vTeamRoute(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	teams, err := model.GetTeamsByVID(vteam)
+	teams, err := model.GetTeamsByVID(req.Context(), vteam)
 	if err != nil {
 		log.Error(err)
 		http.Error(res, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	keys := make(map[model.GoogleID]string)
-
 	for _, teamID := range teams {
-		gid, err := teamID.Owner()
-		if err != nil {
-			log.Error(err)
-			continue
-		}
-
-		key := keys[gid]
-		if key != "" {
-			key, err = gid.GetVAPIkey()
-			if err != nil {
-				log.Error(err)
-				continue
-			}
-			if key == "" {
-				log.Errorw("no VAPI key for team owner, skipping sync", "GID", gid, "teamID", teamID, "vteam", vteam)
-				continue
-			}
-			keys[gid] = key
-		}
-
-		if err := Sync(req.Context(), teamID, key); err != nil {
+		if err := roster.Sync(req.Context(), &V{}, teamID); err != nil {
 			log.Error(err)
 			http.Error(res, err.Error(), http.StatusInternalServerError)
 			return